@@ -3,10 +3,13 @@ package gowsl
 // This file contains windows-only API definitions and imports
 
 import (
+	"debug/pe"
 	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -34,10 +37,40 @@ type wBOOL = int     // Windows' BOOL
 type wULONG = uint32 // Windows' ULONG
 type char = byte     // Windows' CHAR (which is the same as C's char)
 
+// callWslAPI calls a function of wslapi.dll on behalf of a distro, and logs its HRESULT.
+func callWslAPI(proc *syscall.LazyProc, distroName string, args ...uintptr) (hresult uintptr) {
+	start := time.Now()
+	r1, _, _ := proc.Call(args...)
+	logWslAPI(proc.Name, distroName, r1, time.Since(start))
+	return r1
+}
+
 func coTaskMemFree(p unsafe.Pointer) {
 	windows.CoTaskMemFree(p)
 }
 
+// nativeArch returns the architecture of the machine in the terms of GOARCH, which
+// differs from runtime.GOARCH when the process is emulated, such as amd64 on arm64.
+func nativeArch() string {
+	var process, native uint16
+	if err := windows.IsWow64Process2(windows.CurrentProcess(), &process, &native); err != nil {
+		// IsWow64Process2 is missing from versions of Windows too old to emulate other
+		// architectures than 32-bit x86, which WSL does not support.
+		return runtime.GOARCH
+	}
+
+	switch native {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386"
+	default:
+		return runtime.GOARCH
+	}
+}
+
 // Extracting the type of file a handle points to
 // https://learn.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-getfiletype
 type winFileType int
@@ -59,13 +92,13 @@ func fileType(f *os.File) (winFileType, error) {
 }
 
 // startProcess replaces os.StartProcess with WSL commands.
-func (c Cmd) startProcess() (process *os.Process, err error) {
+func (c *Cmd) startProcess() (process *os.Process, err error) {
 	distroUTF16, err := syscall.UTF16PtrFromString(c.distro.Name())
 	if err != nil {
 		return nil, errors.New("failed to convert distro name to UTF16")
 	}
 
-	commandUTF16, err := syscall.UTF16PtrFromString(c.command)
+	commandUTF16, err := syscall.UTF16PtrFromString(c.launchCommand())
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert command %q to UTF16", c.command)
 	}
@@ -76,7 +109,7 @@ func (c Cmd) startProcess() (process *os.Process, err error) {
 	}
 
 	var handle windows.Handle
-	r1, _, _ := wslLaunch.Call(
+	r1 := callWslAPI(wslLaunch, c.distro.Name(),
 		uintptr(unsafe.Pointer(distroUTF16)),
 		uintptr(unsafe.Pointer(commandUTF16)),
 		uintptr(useCwd),
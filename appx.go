@@ -0,0 +1,48 @@
+package gowsl
+
+// This file contains utilities to register distros from the packages of the Microsoft Store.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ubuntu/gowsl/internal/appx"
+)
+
+// AppxMetadata describes a distro package of the Microsoft Store. See InspectAppx.
+type AppxMetadata = appx.Metadata
+
+// InspectAppx returns the metadata of the distro package at path, in the .appx or
+// .appxbundle format. Bundles contain a package per architecture: the one for the
+// architecture of the machine is inspected.
+func InspectAppx(path string) (AppxMetadata, error) {
+	pkg, err := appx.Open(path, appx.Options{Architecture: nativeArch()})
+	if err != nil {
+		return AppxMetadata{}, fmt.Errorf("could not inspect package %q: %v", path, err)
+	}
+	defer pkg.Close()
+
+	return pkg.Metadata, nil
+}
+
+// RegisterFromAppx is like RegisterContext, but it registers the rootfs inside the
+// distro package at path, in the .appx or .appxbundle format, as downloaded from the
+// Microsoft Store. Bundles contain a package per architecture: the one for the
+// architecture of the machine is used.
+//
+// The package is not installed: only the distro is registered, without its launcher.
+func (d *Distro) RegisterFromAppx(ctx context.Context, path string, opts ...func(*registerOptions)) error {
+	pkg, err := appx.Open(path, appx.Options{Architecture: nativeArch()})
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not open package: %v", d.Name(), err)
+	}
+	defer pkg.Close()
+
+	r, err := pkg.Rootfs()
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not read rootfs of package: %v", d.Name(), err)
+	}
+	defer r.Close()
+
+	return d.RegisterFrom(ctx, r, opts...)
+}
@@ -0,0 +1,130 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectAppx(t *testing.T) {
+	testCases := map[string]struct {
+		rootfs   []byte
+		noAppx   bool
+		wantErr  bool
+		wantMeta wsl.AppxMetadata
+	}{
+		"success": {rootfs: []byte("rootfs"), wantMeta: wsl.AppxMetadata{
+			Name:         "Test.Distro",
+			DisplayName:  "Test distro",
+			Version:      "1.0.0.0",
+			Publisher:    "CN=Test",
+			Architecture: runtime.GOARCH,
+			Launcher:     "testdistro.exe",
+		}},
+
+		"error with an inexistent package": {noAppx: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "I am not a real package.appx")
+			if !tc.noAppx {
+				p = writeTestAppx(t, tc.rootfs)
+			}
+
+			got, err := wsl.InspectAppx(p)
+			if tc.wantErr {
+				require.Error(t, err, "InspectAppx should have failed")
+				return
+			}
+			require.NoError(t, err, "InspectAppx should not have failed")
+			require.Equal(t, tc.wantMeta, got, "Unexpected metadata")
+		})
+	}
+}
+
+func TestRegisterFromAppx(t *testing.T) {
+	image, err := os.ReadFile(emptyRootFs)
+	require.NoError(t, err, "Setup: could not read rootfs")
+
+	testCases := map[string]struct {
+		rootfs    []byte
+		cancelled bool
+
+		wantErr bool
+	}{
+		"success": {rootfs: image},
+
+		"error with a cancelled context": {rootfs: image, cancelled: true, wantErr: true},
+		"error with a broken rootfs":     {rootfs: []byte("not a tarball"), wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := wsl.NewDistro(uniqueDistroName(t))
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			err := d.RegisterFromAppx(ctx, writeTestAppx(t, tc.rootfs))
+			if tc.wantErr {
+				require.Error(t, err, "RegisterFromAppx should have failed")
+				r, err := d.IsRegistered()
+				require.NoError(t, err, "IsRegistered should not fail")
+				require.False(t, r, "The distro should not be registered")
+				return
+			}
+			require.NoError(t, err, "RegisterFromAppx should not have failed")
+
+			r, err := d.IsRegistered()
+			require.NoError(t, err, "IsRegistered should not fail")
+			require.True(t, r, "The distro should be registered")
+		})
+	}
+}
+
+// writeTestAppx writes a distro package for the architecture of the machine with
+// the given rootfs, and returns its path.
+func writeTestAppx(t *testing.T, rootfs []byte) string {
+	t.Helper()
+
+	arch := map[string]string{"amd64": "x64", "386": "x86"}[runtime.GOARCH]
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	manifest := `<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10">
+  <Identity Name="Test.Distro" Publisher="CN=Test" Version="1.0.0.0" ProcessorArchitecture="` + arch + `"/>
+  <Properties><DisplayName>Test distro</DisplayName></Properties>
+  <Applications><Application Id="testdistro" Executable="testdistro.exe"/></Applications>
+</Package>`
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{"AppxManifest.xml": []byte(manifest), "install.tar.gz": rootfs} {
+		w, err := zw.Create(name)
+		require.NoError(t, err, "Setup: could not write package")
+		_, err = w.Write(data)
+		require.NoError(t, err, "Setup: could not write package")
+	}
+	require.NoError(t, zw.Close(), "Setup: could not write package")
+
+	p := filepath.Join(t.TempDir(), "TestDistro.appx")
+	require.NoError(t, os.WriteFile(p, buf.Bytes(), 0600), "Setup: could not write package")
+	return p
+}
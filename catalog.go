@@ -0,0 +1,178 @@
+package gowsl
+
+// This file contains utilities to install distros from catalogs of versioned images.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/catalog"
+)
+
+// CatalogImage is an image of a Catalog, with the instructions to set it up.
+type CatalogImage = catalog.Image
+
+// Catalog is a set of versioned distro images, along with the cache where the
+// images that are downloaded are kept. See LoadCatalog.
+type Catalog struct {
+	catalog catalog.Catalog
+	cache   catalog.Cache
+}
+
+type catalogOptions struct {
+	cacheDir  string
+	cacheSize int64
+}
+
+// WithCacheDir sets the directory where the images of a catalog are cached. It
+// defaults to the gowsl\images directory in the cache directory of the user.
+func WithCacheDir(dir string) func(*catalogOptions) {
+	return func(o *catalogOptions) {
+		o.cacheDir = dir
+	}
+}
+
+// WithCacheSize bounds the size in bytes of the cache of a catalog. The least
+// recently used images are removed from the cache after every download to fit in
+// it. The cache is not bounded by default.
+func WithCacheSize(size int64) func(*catalogOptions) {
+	return func(o *catalogOptions) {
+		o.cacheSize = size
+	}
+}
+
+// LoadCatalog reads the catalog in the JSON file at path, such as:
+//
+//	{
+//	  "images": [
+//	    {
+//	      "name": "base",
+//	      "version": "1.2.0",
+//	      "url": "https://example.com/base-1.2.0.tar.gz",
+//	      "sha256": "…",
+//	      "defaultUser": "dev",
+//	      "postInstall": ["useradd -m -s /bin/bash dev"]
+//	    }
+//	  ]
+//	}
+//
+// Images have either a URL or a path, which is relative to the directory of the
+// catalog unless it is absolute. See CatalogImage for the meaning of every field.
+//
+// Can be used with optional helper parameters WithCacheDir and WithCacheSize.
+func LoadCatalog(path string, opts ...func(*catalogOptions)) (*Catalog, error) {
+	options := catalogOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if options.cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not load catalog %q: could not find cache directory: %v", path, err)
+		}
+		options.cacheDir = filepath.Join(dir, "gowsl", "images")
+	}
+
+	c, err := catalog.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load catalog %q: %v", path, err)
+	}
+
+	return &Catalog{
+		catalog: c,
+		cache:   catalog.Cache{Dir: options.cacheDir, MaxSize: options.cacheSize},
+	}, nil
+}
+
+// Images returns the images of the catalog, in the order they are listed.
+func (c *Catalog) Images() []CatalogImage {
+	return append([]CatalogImage(nil), c.catalog.Images...)
+}
+
+// InstallFromCatalog registers a distro named distroName with the image imageName of
+// the catalog, and sets it up. imageName is either the name of an image, for its
+// latest version, or a name and a version separated by @, such as base@1.2.0.
+//
+// Images with a URL are downloaded into the cache of the catalog, unless they are in
+// it already, and the checksum of images is verified every time they are used. The
+// cache can be shared by concurrent calls, in this process or in others.
+// Once the distro is registered, the post-install steps of the image are run in
+// order, and its default user is set. If any of this fails, the distro is
+// unregistered. The steps run as the default user of the distro, which is root
+// unless /etc/wsl.conf sets another one, be it in the image or with a patch such
+// as RootfsDefaultUser. Such a user also takes precedence over the default user of
+// the image.
+//
+// The options are the ones of Register, such as WithPatches.
+func InstallFromCatalog(ctx context.Context, c *Catalog, imageName, distroName string, opts ...func(*registerOptions)) (d Distro, err error) {
+	d = NewDistro(distroName)
+	defer func() {
+		// Errors from the context are returned as is, like with Cmd.
+		if err != nil && !errors.Is(err, ctx.Err()) {
+			err = fmt.Errorf("could not install %q from catalog: %v", distroName, err)
+		}
+	}()
+
+	img, err := c.catalog.Lookup(imageName)
+	if err != nil {
+		return d, err
+	}
+
+	rootFsPath, release, err := c.cache.Get(ctx, img)
+	if err != nil {
+		return d, err
+	}
+
+	// The image is kept in the cache until it is imported, which may be after
+	// register returns if the context is cancelled.
+	if err := d.register(ctx, rootFsPath, release, opts); err != nil {
+		return d, err
+	}
+
+	defer func() {
+		if err != nil {
+			// The context may be done already.
+			_ = d.UnregisterContext(context.Background())
+		}
+	}()
+
+	return d, setUp(ctx, &d, img)
+}
+
+// setUp runs the post-install steps of the image in the distro, and sets its
+// default user.
+func setUp(ctx context.Context, d *Distro, img CatalogImage) error {
+	for i, step := range img.PostInstall {
+		if _, err := d.Command(ctx, step).Output(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("post-install step #%d failed: %v", i+1, err)
+		}
+	}
+
+	if img.DefaultUser == "" {
+		return nil
+	}
+
+	// The name of the user is validated by the catalog, so it is safe in a command.
+	out, err := d.Command(ctx, "id -u "+img.DefaultUser).Output()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("could not find default user %q: %v", img.DefaultUser, err)
+	}
+	uid, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 32)
+	if err != nil {
+		return fmt.Errorf("could not parse ID of default user %q: %v", img.DefaultUser, err)
+	}
+
+	return d.DefaultUID(uint32(uid))
+}
@@ -0,0 +1,116 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallFromCatalog(t *testing.T) {
+	image, err := os.ReadFile(rootFs)
+	require.NoError(t, err, "Setup: could not read rootfs")
+	sum := sha256.Sum256(image)
+	checksum := hex.EncodeToString(sum[:])
+
+	path, err := filepath.Abs(rootFs)
+	require.NoError(t, err, "Setup: could not find rootfs")
+
+	testCases := map[string]struct {
+		imageName   string
+		defaultUser string // Default user set in /etc/wsl.conf by a patch
+
+		wantUser     string
+		wantStepUser string // User that ran the post-install steps, if they tell
+		wantErr      bool
+	}{
+		"latest version": {imageName: "test", wantUser: "catalog"},
+		"pinned version": {imageName: "test@1.0", wantUser: "root"},
+		"post-install steps run as the default user of wsl.conf": {imageName: "whoami", defaultUser: "nobody", wantUser: "nobody", wantStepUser: "nobody"},
+		"post-install steps run as root otherwise":               {imageName: "whoami", wantUser: "root", wantStepUser: "root"},
+
+		"error with an image that does not exist": {imageName: "inexistent", wantErr: true},
+		"error with a wrong checksum":             {imageName: "corrupted", wantErr: true},
+		"error with a failing post-install step":  {imageName: "failing", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "catalog.json")
+			writeTestCatalog(t, p, []wsl.CatalogImage{
+				{Name: "test", Version: "1.0", Path: path, SHA256: checksum},
+				{Name: "test", Version: "1.1", Path: path, SHA256: checksum, DefaultUser: "catalog", PostInstall: []string{"useradd -m catalog"}},
+				{Name: "corrupted", Version: "1.0", Path: path, SHA256: strings.Repeat("0", 64)},
+				{Name: "failing", Version: "1.0", Path: path, SHA256: checksum, PostInstall: []string{"exit 42"}},
+				{Name: "whoami", Version: "1.0", Path: path, SHA256: checksum, PostInstall: []string{"whoami > /tmp/post-install-user"}},
+			})
+
+			c, err := wsl.LoadCatalog(p, wsl.WithCacheDir(t.TempDir()))
+			require.NoError(t, err, "LoadCatalog should not have failed")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			var d wsl.Distro
+			if tc.defaultUser != "" {
+				d, err = wsl.InstallFromCatalog(ctx, c, tc.imageName, uniqueDistroName(t), wsl.WithPatches(wsl.RootfsDefaultUser(tc.defaultUser)))
+			} else {
+				d, err = wsl.InstallFromCatalog(ctx, c, tc.imageName, uniqueDistroName(t))
+			}
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+			if tc.wantErr {
+				require.Error(t, err, "InstallFromCatalog should have failed")
+				r, err := d.IsRegistered()
+				require.NoError(t, err, "IsRegistered should not fail")
+				require.False(t, r, "The distro should not be registered")
+				return
+			}
+			require.NoError(t, err, "InstallFromCatalog should not have failed")
+
+			out, err := d.Command(ctx, "whoami").Output()
+			require.NoError(t, err, "whoami should not have failed")
+			require.Equal(t, tc.wantUser, strings.TrimSpace(string(out)), "Unexpected default user")
+
+			if tc.wantStepUser != "" {
+				out, err := d.Command(ctx, "cat /tmp/post-install-user").Output()
+				require.NoError(t, err, "The post-install step should have written its user")
+				require.Equal(t, tc.wantStepUser, strings.TrimSpace(string(out)), "Unexpected user of the post-install steps")
+			}
+		})
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "catalog.json")
+	writeTestCatalog(t, p, []wsl.CatalogImage{
+		{Name: "test", Version: "1.0", Path: "images/test.tar.gz", SHA256: strings.Repeat("0", 64)},
+	})
+
+	c, err := wsl.LoadCatalog(p)
+	require.NoError(t, err, "LoadCatalog should not have failed")
+	require.Len(t, c.Images(), 1, "The catalog should have one image")
+	require.Equal(t, filepath.Join(dir, "images", "test.tar.gz"), c.Images()[0].Path, "Paths should be relative to the catalog")
+
+	_, err = wsl.LoadCatalog(filepath.Join(dir, "I am not a real catalog.json"))
+	require.Error(t, err, "LoadCatalog should have failed with an inexistent catalog")
+}
+
+// writeTestCatalog writes a catalog with the given images at path.
+func writeTestCatalog(t *testing.T, path string, images []wsl.CatalogImage) {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"images": images})
+	require.NoError(t, err, "Setup: could not write catalog")
+	require.NoError(t, os.WriteFile(path, data, 0600), "Setup: could not write catalog")
+}
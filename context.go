@@ -0,0 +1,36 @@
+package gowsl
+
+// This file contains utilities to bound blocking calls with a context.
+
+import "context"
+
+// runBlocking runs f, which cannot be interrupted, in a goroutine, and returns its
+// result or ctx.Err() if ctx is done first. In that case, f carries on in the
+// background, and abandoned is called with its result once it finishes, so that
+// its effects can be undone. abandoned can be nil.
+//
+// f is always called, even if ctx is done already: callers should check it
+// beforehand if f is not meant to run then.
+func runBlocking[T any](ctx context.Context, f func() T, abandoned func(T)) (T, error) {
+	var zero T
+
+	done := make(chan T, 1)
+	go func() {
+		done <- f()
+	}()
+
+	select {
+	case res := <-done:
+		return res, nil
+	case <-ctx.Done():
+	}
+
+	go func() {
+		res := <-done
+		if abandoned != nil {
+			abandoned(res)
+		}
+	}()
+
+	return zero, ctx.Err()
+}
@@ -0,0 +1,103 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextVariants(t *testing.T) {
+	testCases := map[string]struct {
+		call func(ctx context.Context, d *wsl.Distro) error
+	}{
+		"RegisterContext": {call: func(ctx context.Context, d *wsl.Distro) error {
+			other := wsl.NewDistro(d.Name() + "_other")
+			defer cleanUpWslInstance(other) //nolint: errcheck // Best effort cleanup
+			return other.RegisterContext(ctx, rootFs)
+		}},
+		"UnregisterContext":       {call: func(ctx context.Context, d *wsl.Distro) error { return d.UnregisterContext(ctx) }},
+		"TerminateContext":        {call: func(ctx context.Context, d *wsl.Distro) error { return d.TerminateContext(ctx) }},
+		"SetAsDefaultContext":     {call: func(ctx context.Context, d *wsl.Distro) error { return d.SetAsDefaultContext(ctx) }},
+		"GetConfigurationContext": {call: func(ctx context.Context, d *wsl.Distro) error { _, err := d.GetConfigurationContext(ctx); return err }},
+		"ShellContext": {call: func(ctx context.Context, d *wsl.Distro) error {
+			return d.ShellContext(ctx, wsl.WithCommand("exit 0"))
+		}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			restore, err := backUpDefaultDistro()
+			require.NoError(t, err, "Setup: could not back up the default distro")
+			defer restore()
+
+			t.Run("success with a live context", func(t *testing.T) {
+				d := newTestDistro(t, rootFs)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				defer cancel()
+
+				require.NoError(t, tc.call(ctx, &d), "Call should not fail with a live context")
+			})
+
+			t.Run("error with a cancelled context", func(t *testing.T) {
+				d := newTestDistro(t, rootFs)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				err := tc.call(ctx, &d)
+				require.ErrorIs(t, err, context.Canceled, "Call should return the error of the context")
+			})
+		})
+	}
+}
+
+func TestRegisterContextRollsBack(t *testing.T) {
+	d := wsl.NewDistro(uniqueDistroName(t))
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := d.RegisterContext(ctx, rootFs)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "RegisterContext should return the error of the context")
+
+	// Registration carries on in the background, and must be undone afterwards.
+	require.Eventually(t, func() bool {
+		r, err := d.IsRegistered()
+		return err == nil && !r
+	}, 2*time.Minute, time.Second, "The distro should not remain registered after RegisterContext is cancelled")
+}
+
+func TestShutdownContext(t *testing.T) {
+	d := newTestDistro(t, rootFs) // Will terminate
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, wsl.ShutdownContext(ctx), context.Canceled, "ShutdownContext should return the error of the context")
+
+	defer startTestLinuxProcess(t, &d)()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	require.NoError(t, wsl.ShutdownContext(ctx), "ShutdownContext should not fail with a live context")
+	require.False(t, isTestLinuxProcessAlive(&d), "Process was not killed by shutting down.")
+}
+
+func TestShellContextKillsShell(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+	defer keepAwake(t, context.Background(), &d)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := d.ShellContext(ctx, wsl.WithCommand("sleep 60"))
+	require.ErrorIs(t, err, context.DeadlineExceeded, "ShellContext should return the error of the context")
+	require.Less(t, time.Since(start), 30*time.Second, "ShellContext should return as soon as the context is done")
+}
@@ -0,0 +1,242 @@
+package gowsl
+
+// This file contains utilities to copy files into and out of a distro.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/archive"
+	"github.com/ubuntu/gowsl/internal/shell"
+)
+
+// CopyFileError is the error of a single file that could not be copied.
+type CopyFileError = archive.FileError
+
+// CopyError is returned by CopyTo and CopyFrom when some files could not be
+// copied. The rest of the files are copied regardless.
+type CopyError struct {
+	Files []CopyFileError
+}
+
+func (err *CopyError) Error() string {
+	msgs := make([]string, 0, len(err.Files))
+	for _, f := range err.Files {
+		msgs = append(msgs, f.Error())
+	}
+	return fmt.Sprintf("could not copy %d file(s):\n%s", len(err.Files), strings.Join(msgs, "\n"))
+}
+
+// CopyProgress is the information passed to the progress callback of CopyTo
+// and CopyFrom after every file is copied.
+type CopyProgress struct {
+	Path       string // Path of the file relative to the destination
+	Size       int64  // Size of the file
+	Files      int    // Number of files copied so far
+	TotalBytes int64  // Number of bytes copied so far
+}
+
+type copyOptions struct {
+	owner    *archive.Owner
+	progress func(CopyProgress)
+}
+
+// WithOwner is an optional parameter for (*Distro).CopyTo that sets the owner of
+// the copied files. Otherwise, files belong to the user that extracts them, or
+// root if it is root.
+func WithOwner(uid, gid int) func(*copyOptions) {
+	return func(o *copyOptions) {
+		o.owner = &archive.Owner{UID: uid, GID: gid}
+	}
+}
+
+// WithProgress is an optional parameter for (*Distro).CopyTo and (*Distro).CopyFrom
+// that calls f after every file is copied.
+func WithProgress(f func(CopyProgress)) func(*copyOptions) {
+	return func(o *copyOptions) {
+		o.progress = f
+	}
+}
+
+// CopyTo copies local files and directories into a directory of the distro,
+// which is created if needed. The local path may be a glob pattern (see
+// filepath.Match), in which case all matches are copied. Directories are
+// copied recursively.
+//
+// Files are streamed as a tar archive, so mode, modification time, and symbolic
+// links are preserved. Owners can be set with WithOwner.
+//
+// If some files cannot be copied, the error is of type *CopyError. Progress
+// can be followed with WithProgress.
+func (d *Distro) CopyTo(ctx context.Context, localPath, linuxPath string, opts ...func(*copyOptions)) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("could not copy %q into %s:%s: %v", localPath, d.Name(), linuxPath, err)
+		}
+	}()
+
+	options := copyOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	sources, err := filepath.Glob(localPath)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return errors.New("no such file or directory")
+	}
+
+	dest := shell.Quote(linuxPath)
+	cmd := d.Command(ctx, fmt.Sprintf("mkdir -p -- %s && tar -x -p -f - -C %s", dest, dest))
+
+	stderr := &prefixSuffixSaver{N: 32 << 10}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	fileErrs, packErr := archive.Pack(stdin, sources, archive.Options{
+		Owner:    options.owner,
+		Progress: options.progressFunc(),
+	})
+	stdin.Close()
+
+	waitErr := cmd.Wait()
+
+	if waitErr != nil {
+		fileErrs = append(fileErrs, tarFileErrors(stderr.Bytes())...)
+	}
+	if len(fileErrs) != 0 {
+		return &CopyError{Files: fileErrs}
+	}
+	if waitErr != nil {
+		return fmt.Errorf("%v: %s", waitErr, stderr.Bytes())
+	}
+	return packErr
+}
+
+// CopyFrom copies files and directories from the distro into a local directory,
+// which is created if needed. The Linux path may contain a glob pattern in its
+// last element, in which case all matches are copied. Directories are copied
+// recursively.
+//
+// Files are streamed as a tar archive, so mode, modification time, and symbolic
+// links are preserved. Note that creating symbolic links on Windows may require
+// special privileges.
+//
+// If some files cannot be copied, the error is of type *CopyError. Progress
+// can be followed with WithProgress.
+func (d *Distro) CopyFrom(ctx context.Context, linuxPath, localPath string, opts ...func(*copyOptions)) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("could not copy %s:%s into %q: %v", d.Name(), linuxPath, localPath, err)
+		}
+	}()
+
+	options := copyOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	dir, pattern := path.Split(path.Clean(linuxPath))
+	if dir == "" {
+		dir = "."
+	}
+	if pattern == "" {
+		// Copying the root directory
+		pattern = "."
+	}
+	cmd := d.Command(ctx, fmt.Sprintf("cd %s && tar -c -f - -- %s", shell.Quote(dir), shell.QuoteGlob(pattern)))
+
+	stderr := &prefixSuffixSaver{N: 32 << 10}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	fileErrs, unpackErr := archive.Unpack(stdout, localPath, archive.Options{
+		Progress: options.progressFunc(),
+	})
+	if unpackErr != nil {
+		// Stop the command so it does not block writing to a pipe no one reads.
+		cmd.Process.Kill()
+	}
+
+	waitErr := cmd.Wait()
+
+	if waitErr != nil {
+		fileErrs = append(tarFileErrors(stderr.Bytes()), fileErrs...)
+	}
+	if len(fileErrs) != 0 {
+		return &CopyError{Files: fileErrs}
+	}
+	if unpackErr != nil {
+		return unpackErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("%v: %s", waitErr, stderr.Bytes())
+	}
+	return nil
+}
+
+// progressFunc adapts the progress callback to the one used by the archive.
+func (o copyOptions) progressFunc() func(string, int64) {
+	if o.progress == nil {
+		return nil
+	}
+
+	var p CopyProgress
+	return func(name string, size int64) {
+		p.Path = name
+		p.Size = size
+		p.Files++
+		p.TotalBytes += size
+		o.progress(p)
+	}
+}
+
+// tarFileErrors parses the errors printed by tar for individual files, which
+// look like:
+//
+//	tar: path/to/file: Cannot open: Permission denied
+//
+// tar prints warnings the same way, such as for time stamps in the future, so
+// this is only relevant when it fails.
+func tarFileErrors(stderr []byte) (errs []CopyFileError) {
+	s := bufio.NewScanner(bytes.NewReader(stderr))
+	for s.Scan() {
+		line := strings.TrimPrefix(s.Text(), "tar: ")
+		if line == s.Text() {
+			continue
+		}
+
+		fields := strings.SplitN(line, ": ", 2)
+		if len(fields) != 2 {
+			// General messages such as "Exiting with failure status due to previous errors".
+			continue
+		}
+
+		errs = append(errs, CopyFileError{Path: fields[0], Err: errors.New(fields[1])})
+	}
+	return errs
+}
@@ -0,0 +1,151 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyTo(t *testing.T) {
+	realDistro := newTestDistro(t, rootFs)
+	fakeDistro := wsl.NewDistro(uniqueDistroName(t))
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &realDistro)()
+
+	testCases := map[string]struct {
+		distro    *wsl.Distro
+		localPath string
+		owner     bool
+		future    bool // Whether the files are from the future, for tar to warn about them
+
+		wantFiles []string
+		wantErr   bool
+	}{
+		"success with a file":         {distro: &realDistro, localPath: "dir/file.txt", wantFiles: []string{"file.txt"}},
+		"success with a directory":    {distro: &realDistro, localPath: "dir", wantFiles: []string{"dir/file.txt", "dir/sub/nested.txt"}},
+		"success with a glob":         {distro: &realDistro, localPath: "dir/*.txt", wantFiles: []string{"file.txt", "other.txt"}},
+		"success with an owner":       {distro: &realDistro, localPath: "dir/file.txt", owner: true, wantFiles: []string{"file.txt"}},
+		"success with tar warnings":   {distro: &realDistro, localPath: "dir/file.txt", future: true, wantFiles: []string{"file.txt"}},
+		"error with a fake distro":    {distro: &fakeDistro, localPath: "dir", wantErr: true},
+		"error with a missing source": {distro: &realDistro, localPath: "missing", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			src := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0750), "Setup: could not create directories")
+			require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file.txt"), []byte("Hello!"), 0600), "Setup: could not write file")
+			require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "other.txt"), []byte("Hello!"), 0600), "Setup: could not write file")
+			require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "sub", "nested.txt"), []byte("Hello!"), 0600), "Setup: could not write file")
+			if tc.future {
+				future := time.Now().AddDate(10, 0, 0)
+				require.NoError(t, os.Chtimes(filepath.Join(src, "dir", "file.txt"), future, future), "Setup: could not change modification time")
+			}
+
+			dest := "/tmp/" + sanitizeDistroName(t.Name())
+
+			var progress []wsl.CopyProgress
+			withProgress := wsl.WithProgress(func(p wsl.CopyProgress) { progress = append(progress, p) })
+
+			var err error
+			if tc.owner {
+				err = tc.distro.CopyTo(ctx, filepath.Join(src, tc.localPath), dest, withProgress, wsl.WithOwner(1234, 1234))
+			} else {
+				err = tc.distro.CopyTo(ctx, filepath.Join(src, tc.localPath), dest, withProgress)
+			}
+			if tc.wantErr {
+				require.Error(t, err, "Unexpected success calling CopyTo")
+				return
+			}
+			require.NoError(t, err, "Unexpected error calling CopyTo")
+			require.NotEmpty(t, progress, "Progress should have been reported")
+
+			for _, f := range tc.wantFiles {
+				out, err := tc.distro.Command(ctx, "cat "+dest+"/"+f).Output()
+				require.NoError(t, err, "Could not read copied file %q", f)
+				require.Equal(t, "Hello!", string(out), "Unexpected contents in copied file %q", f)
+			}
+
+			if tc.owner {
+				out, err := tc.distro.Command(ctx, "stat -c %u:%g "+dest+"/"+tc.wantFiles[0]).Output()
+				require.NoError(t, err, "Could not stat copied file")
+				require.Equal(t, "1234:1234\n", string(out), "Unexpected owner of copied file")
+			}
+		})
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	realDistro := newTestDistro(t, rootFs)
+	fakeDistro := wsl.NewDistro(uniqueDistroName(t))
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &realDistro)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	out, err := realDistro.Command(ctx, `mkdir -p /tmp/copyfrom/sub && printf 'Hello!' > /tmp/copyfrom/file.txt && printf 'Hello!' > /tmp/copyfrom/other.txt \
+		&& printf 'Hello!' > /tmp/copyfrom/sub/nested.txt && chmod 750 /tmp/copyfrom/file.txt \
+		&& touch -d '2020-05-17 12:30:00Z' /tmp/copyfrom/file.txt && ln -s file.txt /tmp/copyfrom/link`).CombinedOutput()
+	require.NoError(t, err, "Setup: could not create files in the distro: %s", out)
+
+	testCases := map[string]struct {
+		distro    *wsl.Distro
+		linuxPath string
+
+		wantFiles     []string
+		wantErr       bool
+		wantCopyError bool
+	}{
+		"success with a file":         {distro: &realDistro, linuxPath: "/tmp/copyfrom/file.txt", wantFiles: []string{"file.txt"}},
+		"success with a directory":    {distro: &realDistro, linuxPath: "/tmp/copyfrom", wantFiles: []string{"copyfrom/file.txt", "copyfrom/sub/nested.txt"}},
+		"success with a glob":         {distro: &realDistro, linuxPath: "/tmp/copyfrom/*.txt", wantFiles: []string{"file.txt", "other.txt"}},
+		"error with a fake distro":    {distro: &fakeDistro, linuxPath: "/tmp/copyfrom", wantErr: true},
+		"error with a missing source": {distro: &realDistro, linuxPath: "/tmp/copyfrom/missing", wantErr: true, wantCopyError: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			dest := t.TempDir()
+
+			var progress []wsl.CopyProgress
+			err := tc.distro.CopyFrom(ctx, tc.linuxPath, dest, wsl.WithProgress(func(p wsl.CopyProgress) { progress = append(progress, p) }))
+			if tc.wantErr {
+				require.Error(t, err, "Unexpected success calling CopyFrom")
+				if tc.wantCopyError {
+					target := &wsl.CopyError{}
+					require.ErrorAs(t, err, &target, "Unexpected error type. Expected a CopyError.")
+					require.Len(t, target.Files, 1, "Unexpected number of file errors")
+				}
+				return
+			}
+			require.NoError(t, err, "Unexpected error calling CopyFrom")
+			require.NotEmpty(t, progress, "Progress should have been reported")
+
+			for _, f := range tc.wantFiles {
+				out, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(f)))
+				require.NoError(t, err, "Could not read copied file %q", f)
+				require.Equal(t, "Hello!", string(out), "Unexpected contents in copied file %q", f)
+			}
+
+			if tc.linuxPath == "/tmp/copyfrom/file.txt" {
+				info, err := os.Stat(filepath.Join(dest, "file.txt"))
+				require.NoError(t, err, "Could not stat copied file")
+				require.Equal(t, time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC), info.ModTime().UTC(), "Modification time was not preserved")
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ package gowsl
 // This file contains utilities to interact with a Distro and its configuration
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -57,7 +58,13 @@ func (d *Distro) GUID() (id guid, err error) {
 //
 //	wsl --terminate <distro>
 func (d Distro) Terminate() error {
-	return terminate(d.Name())
+	return d.TerminateContext(context.Background())
+}
+
+// TerminateContext is like Terminate, but wsl.exe is killed if the context is
+// done before it completes.
+func (d Distro) TerminateContext(ctx context.Context) error {
+	return terminate(ctx, d.Name())
 }
 
 // Shutdown powers off all of WSL, including all other distros.
@@ -65,7 +72,13 @@ func (d Distro) Terminate() error {
 //
 //	wsl --shutdown
 func Shutdown() error {
-	return shutdown()
+	return ShutdownContext(context.Background())
+}
+
+// ShutdownContext is like Shutdown, but wsl.exe is killed if the context is
+// done before it completes.
+func ShutdownContext(ctx context.Context) error {
+	return shutdown(ctx)
 }
 
 // SetAsDefault sets a particular distribution as the default one.
@@ -73,7 +86,13 @@ func Shutdown() error {
 //
 //	wsl --set-default <distro>
 func (d Distro) SetAsDefault() error {
-	return setAsDefault(d.Name())
+	return d.SetAsDefaultContext(context.Background())
+}
+
+// SetAsDefaultContext is like SetAsDefault, but wsl.exe is killed if the context
+// is done before it completes.
+func (d Distro) SetAsDefaultContext(ctx context.Context) error {
+	return setAsDefault(ctx, d.Name())
 }
 
 // DefaultDistro gets the current default distribution.
@@ -156,12 +175,24 @@ func (d *Distro) DriveMountingEnabled(value bool) error {
 
 // GetConfiguration is a wrapper around Win32's WslGetDistributionConfiguration.
 // It returns a configuration object with information about the distro.
-func (d Distro) GetConfiguration() (c Configuration, e error) {
+func (d Distro) GetConfiguration() (Configuration, error) {
+	return d.GetConfigurationContext(context.Background())
+}
+
+// GetConfigurationContext is like GetConfiguration, but returns ctx.Err() as soon
+// as the context is done. WslGetDistributionConfiguration cannot be interrupted,
+// so it carries on in the background in that case.
+func (d Distro) GetConfigurationContext(ctx context.Context) (c Configuration, e error) {
 	defer func() {
-		if e != nil {
+		// Errors from the context are returned as is, like with Cmd.
+		if e != nil && !errors.Is(e, ctx.Err()) {
 			e = fmt.Errorf("error in GetConfiguration: %v", e)
 		}
 	}()
+
+	if err := ctx.Err(); err != nil {
+		return Configuration{}, err
+	}
 	var conf Configuration
 
 	distroUTF16, err := syscall.UTF16PtrFromString(d.Name())
@@ -175,14 +206,24 @@ func (d Distro) GetConfiguration() (c Configuration, e error) {
 		envVarsLen   uint64 // size_t
 	)
 
-	r1, _, _ := wslGetDistributionConfiguration.Call(
-		uintptr(unsafe.Pointer(distroUTF16)),
-		uintptr(unsafe.Pointer(&conf.Version)),
-		uintptr(unsafe.Pointer(&conf.DefaultUID)),
-		uintptr(unsafe.Pointer(&flags)),
-		uintptr(unsafe.Pointer(&envVarsBegin)),
-		uintptr(unsafe.Pointer(&envVarsLen)),
-	)
+	r1, err := runBlocking(ctx, func() uintptr {
+		return callWslAPI(wslGetDistributionConfiguration, d.Name(),
+			uintptr(unsafe.Pointer(distroUTF16)),
+			uintptr(unsafe.Pointer(&conf.Version)),
+			uintptr(unsafe.Pointer(&conf.DefaultUID)),
+			uintptr(unsafe.Pointer(&flags)),
+			uintptr(unsafe.Pointer(&envVarsBegin)),
+			uintptr(unsafe.Pointer(&envVarsLen)),
+		)
+	}, func(r1 uintptr) {
+		if r1 == 0 {
+			// Nobody will read the environment variables, which must be freed all the same.
+			processEnvVariables(envVarsBegin, envVarsLen)
+		}
+	})
+	if err != nil {
+		return Configuration{}, err
+	}
 
 	if r1 != 0 {
 		return conf, fmt.Errorf("failed syscall to WslGetDistributionConfiguration")
@@ -268,7 +309,7 @@ func (d *Distro) configure(config Configuration) error {
 		return err
 	}
 
-	r1, _, _ := wslConfigureDistribution.Call(
+	r1 := callWslAPI(wslConfigureDistribution, d.Name(),
 		uintptr(unsafe.Pointer(distroUTF16)),
 		uintptr(config.DefaultUID),
 		uintptr(flags),
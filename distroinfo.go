@@ -0,0 +1,116 @@
+package gowsl
+
+// This file contains utilities to register the distros that can be installed with wsl --install.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ubuntu/gowsl/internal/distroinfo"
+	"github.com/ubuntu/gowsl/internal/download"
+)
+
+// DistributionListURL is where wsl.exe gets the list of distros that can be
+// installed from, unless it is overridden by the DistributionListUrl value of
+// its registry key.
+const DistributionListURL = distroinfo.DefaultURL
+
+// DistributionList is a list of distros that can be installed, as shown by
+// wsl --list --online. See LoadDistributionList.
+type DistributionList = distroinfo.List
+
+// OnlineDistribution is a distro of a DistributionList.
+type OnlineDistribution = distroinfo.Distribution
+
+// OnlineDistributionPackage is the package of an OnlineDistribution for an architecture.
+type OnlineDistributionPackage = distroinfo.Package
+
+// LoadDistributionList reads the list of distros that can be installed, in the
+// format of the DistributionInfo.json of wsl --install. source is either the URL of
+// a mirror, the path of a local file, or a file:// URL. The list of Microsoft at
+// DistributionListURL is read when source is empty.
+//
+// The URLs of the packages that are relative are resolved against source, so that
+// a local list can refer to packages next to it, and a mirror to packages it serves.
+func LoadDistributionList(ctx context.Context, source string) (DistributionList, error) {
+	list, err := distroinfo.Open(ctx, source, nil)
+	if ctx.Err() != nil {
+		return DistributionList{}, ctx.Err()
+	}
+	if err != nil {
+		return DistributionList{}, fmt.Errorf("could not load distribution list: %v", err)
+	}
+	return list, nil
+}
+
+// RegisterFromDistributionList is like RegisterContext, but it registers the package
+// of the distro named name in the list, for the architecture of the machine, even
+// when the process is emulated, such as amd64 on arm64. An empty name stands for the
+// default distro of the list.
+//
+// The URLs of the packages can be URLs over HTTP, paths of local files, or file://
+// URLs, so that mirrors can serve the packages along with the list. Modern distros
+// are tarballs, whose checksum is verified as with RegisterFromURL. Legacy distros
+// are Microsoft Store packages, registered as with RegisterFromAppx: the list has no
+// checksum for them, so they cannot be verified.
+func (d *Distro) RegisterFromDistributionList(ctx context.Context, list DistributionList, name string, opts ...func(*registerOptions)) error {
+	dist, err := list.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("error registering %q: %v", d.Name(), err)
+	}
+	pkg, err := dist.Package(nativeArch())
+	if err != nil {
+		return fmt.Errorf("error registering %q: %v", d.Name(), err)
+	}
+
+	p, local, err := distroinfo.LocalPath(pkg.URL)
+	if err != nil {
+		return fmt.Errorf("error registering %q: invalid package URL: %v", d.Name(), err)
+	}
+	switch {
+	case dist.Legacy && local:
+		return d.RegisterFromAppx(ctx, p, opts...)
+	case dist.Legacy:
+		return d.registerRemoteAppx(ctx, pkg.URL, opts)
+	case local:
+		got, err := download.Checksum(p)
+		if err != nil {
+			return fmt.Errorf("error registering %q: %v", d.Name(), err)
+		}
+		if got != pkg.SHA256 {
+			return ChecksumError{URL: pkg.URL, Want: pkg.SHA256, Got: got}
+		}
+		return d.RegisterContext(ctx, p, opts...)
+	default:
+		return d.RegisterFromURL(ctx, pkg.URL, pkg.SHA256, opts...)
+	}
+}
+
+// registerRemoteAppx downloads the Microsoft Store package at url into a temporary
+// file, and registers it.
+func (d *Distro) registerRemoteAppx(ctx context.Context, url string, opts []func(*registerOptions)) error {
+	f, err := os.CreateTemp("", "gowsl-package-*.appxbundle")
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not create temporary file: %v", d.Name(), err)
+	}
+	defer os.Remove(f.Name())
+
+	r, err := distroinfo.Get(ctx, url, nil)
+	if err == nil {
+		_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+		r.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not download package: %v", d.Name(), err)
+	}
+
+	return d.RegisterFromAppx(ctx, f.Name(), opts...)
+}
@@ -0,0 +1,146 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterFromDistributionList(t *testing.T) {
+	image, err := os.ReadFile(emptyRootFs)
+	require.NoError(t, err, "Setup: could not read rootfs")
+	sum := sha256.Sum256(image)
+	checksum := hex.EncodeToString(sum[:])
+
+	rootfsPath, err := filepath.Abs(emptyRootFs)
+	require.NoError(t, err, "Setup: could not find rootfs")
+	appxPath := writeTestAppx(t, image)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootfs.tar.gz":
+			_, _ = w.Write(image)
+		case "/package.appx":
+			http.ServeFile(w, r, appxPath)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// Packages are listed for the architecture of the machine.
+	arch := map[string]string{"amd64": "Amd64", "arm64": "Arm64"}[runtime.GOARCH]
+	modern := func(name, url, checksum string) string {
+		return fmt.Sprintf(`{"Name": %q, "FriendlyName": "Test", "%sUrl": {"Url": %q, "Sha256": "0x%s"}}`, name, arch, url, checksum)
+	}
+	legacy := func(name, url string) string {
+		return fmt.Sprintf(`{"Name": %q, "FriendlyName": "Test", "%s": true, "%sPackageUrl": %q}`, name, arch, arch, url)
+	}
+	listDir := t.TempDir()
+	listPath := filepath.Join(listDir, "DistributionInfo.json")
+	// Relative paths are relative to the directory of the list.
+	require.NoError(t, os.WriteFile(filepath.Join(listDir, "rootfs.tar.gz"), image, 0600), "Setup: could not copy rootfs")
+	err = os.WriteFile(listPath, []byte(`{
+		"Default": "local",
+		"ModernDistributions": {"Test": [`+strings.Join([]string{
+		modern("local", rootfsPath, checksum),
+		modern("local-url", "file:///"+filepath.ToSlash(rootfsPath), checksum),
+		modern("relative", "rootfs.tar.gz", checksum),
+		modern("mirror", srv.URL+"/rootfs.tar.gz", checksum),
+		modern("corrupted", rootfsPath, strings.Repeat("0", 64)),
+		modern("missing", srv.URL+"/missing.tar.gz", checksum),
+	}, ",")+`]},
+		"Distributions": [`+strings.Join([]string{
+		legacy("store-local", appxPath),
+		legacy("store-mirror", srv.URL+"/package.appx"),
+		legacy("store-missing", srv.URL+"/missing.appx"),
+	}, ",")+`]
+	}`), 0600)
+	require.NoError(t, err, "Setup: could not write distribution list")
+
+	list, err := wsl.LoadDistributionList(context.Background(), listPath)
+	require.NoError(t, err, "Setup: LoadDistributionList should not have failed")
+
+	testCases := map[string]struct {
+		name string
+
+		wantErr         bool
+		wantChecksumErr bool
+	}{
+		"modern distro from a local file": {name: "local"},
+		"modern distro from a file URL":   {name: "local-url"},
+		"modern distro from a mirror":     {name: "mirror"},
+		"modern distro next to the list":  {name: "relative"},
+		"default distro":                  {name: ""},
+		"legacy distro from a local file": {name: "store-local"},
+		"legacy distro from a mirror":     {name: "store-mirror"},
+		"names are case insensitive":      {name: "MIRROR"},
+
+		"error with a distro that is not listed":             {name: "inexistent", wantErr: true},
+		"error with a checksum mismatch":                     {name: "corrupted", wantErr: true, wantChecksumErr: true},
+		"error with a modern distro missing from the mirror": {name: "missing", wantErr: true},
+		"error with a legacy distro missing from the mirror": {name: "store-missing", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := wsl.NewDistro(uniqueDistroName(t))
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			err := d.RegisterFromDistributionList(ctx, list, tc.name)
+			if tc.wantErr {
+				require.Error(t, err, "RegisterFromDistributionList should have failed")
+				if tc.wantChecksumErr {
+					var target wsl.ChecksumError
+					require.ErrorAs(t, err, &target, "RegisterFromDistributionList should have returned a ChecksumError")
+				}
+				r, err := d.IsRegistered()
+				require.NoError(t, err, "IsRegistered should not fail")
+				require.False(t, r, "The distro should not be registered")
+				return
+			}
+			require.NoError(t, err, "RegisterFromDistributionList should not have failed")
+
+			r, err := d.IsRegistered()
+			require.NoError(t, err, "IsRegistered should not fail")
+			require.True(t, r, "The distro should be registered")
+		})
+	}
+}
+
+func TestLoadDistributionList(t *testing.T) {
+	ctx := context.Background()
+
+	p := filepath.Join(t.TempDir(), "DistributionInfo.json")
+	require.NoError(t, os.WriteFile(p, []byte(`{"Distributions": [{"Name": "Test", "Amd64": true}]}`), 0600), "Setup: could not write list")
+
+	list, err := wsl.LoadDistributionList(ctx, p)
+	require.NoError(t, err, "LoadDistributionList should not have failed")
+	require.Len(t, list.Distributions, 1, "Unexpected number of distributions")
+	require.True(t, list.Distributions[0].Legacy, "Distributions of the Distributions section should be legacy ones")
+
+	_, err = wsl.LoadDistributionList(ctx, filepath.Join(t.TempDir(), "I am not a real list.json"))
+	require.Error(t, err, "LoadDistributionList should have failed with an inexistent list")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = wsl.LoadDistributionList(cancelled, "https://localhost:1/DistributionInfo.json")
+	require.ErrorIs(t, err, context.Canceled, "LoadDistributionList should have returned the error of the context")
+}
@@ -0,0 +1,226 @@
+package gowsl
+
+// This file contains utilities to converge distros to a desired state, so that
+// setup scripts can be run again and again.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ubuntu/gowsl/internal/download"
+)
+
+// DesiredConfiguration is the configuration that EnsureRegistered converges a distro
+// to. Settings that are nil are left as they are.
+type DesiredConfiguration struct {
+	DefaultUID           *uint32 // User ID of default user
+	InteropEnabled       *bool   // Whether interop with windows is enabled
+	PathAppended         *bool   // Whether Windows paths are appended
+	DriveMountingEnabled *bool   // Whether drive mounting is enabled
+}
+
+// EnsureReport tells what EnsureRegistered changed to converge a distro to the
+// desired state.
+type EnsureReport struct {
+	// Registered is true if the distro was registered, as it did not exist.
+	Registered bool
+	// Recreated is true if the distro was unregistered and registered again, as
+	// it was registered from another tarball. See WithRecreateOnSourceChange.
+	Recreated bool
+	// Configured are the names of the settings of the configuration that were
+	// changed, such as DefaultUID.
+	Configured []string
+	// Destroyed is true if the distro was unregistered to be recreated, but could
+	// not be registered again. The distro is absent then.
+	Destroyed bool
+}
+
+// Changed returns true if anything was changed.
+func (r EnsureReport) Changed() bool {
+	return r.Registered || r.Recreated || len(r.Configured) > 0 || r.Destroyed
+}
+
+// WithRecreateOnSourceChange makes EnsureRegistered unregister the distro and register
+// it again if the checksum of the tarball differs from the one it was registered from.
+// This destroys the filesystem of the distro along with any change made to it. It has
+// no effect on the other ways to register distros.
+//
+// The checksum is only known for the distros that EnsureRegistered registered: other
+// distros are never recreated.
+func WithRecreateOnSourceChange() func(*registerOptions) {
+	return func(o *registerOptions) {
+		o.recreate = true
+	}
+}
+
+// EnsureRegistered converges the distro to a registered one with the desired
+// configuration, and reports what it changed. Unlike Register, it does not fail if
+// the distro is registered already: the distro is left as it is then, and only the
+// settings of its configuration that differ are changed.
+//
+// The checksum of the tarball at rootFsPath is recorded when the distro is registered,
+// so that it can be recreated when the tarball changes. See WithRecreateOnSourceChange.
+// If the distro cannot be set up once registered, it is unregistered, so that it is
+// never left without its checksum. When recreating it, this leaves it absent: see
+// EnsureReport.Destroyed. However, the checksum is only recorded once the registration
+// is over: if the context is done before, the registration carries on in the
+// background as with RegisterContext, and the distro is unregistered once created.
+// If that fails, or if the process exits in between, the distro is left without its
+// checksum, and WithRecreateOnSourceChange never recreates it.
+//
+// The options are the ones of Register, such as WithPatches, along with
+// WithRecreateOnSourceChange.
+func (d *Distro) EnsureRegistered(ctx context.Context, rootFsPath string, desired DesiredConfiguration, opts ...func(*registerOptions)) (report EnsureReport, err error) {
+	defer func() {
+		// Errors from the context are returned as is, like with Cmd.
+		if err != nil && !errors.Is(err, ctx.Err()) {
+			err = fmt.Errorf("could not ensure %q is registered: %v", d.Name(), err)
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	options := registerOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	registered, err := d.IsRegistered()
+	if err != nil {
+		return report, err
+	}
+
+	var sum string
+	if registered && options.recreate {
+		id, err := d.GUID()
+		if err != nil {
+			return report, err
+		}
+		recorded, err := sourceChecksum(id)
+		if err != nil {
+			return report, err
+		}
+		if recorded != "" {
+			if sum, err = download.Checksum(rootFsPath); err != nil {
+				return report, err
+			}
+			if sum != recorded {
+				if err := d.UnregisterContext(ctx); err != nil {
+					return report, err
+				}
+				registered = false
+				report.Recreated = true
+			}
+		}
+	}
+
+	if !registered {
+		if sum == "" {
+			if sum, err = download.Checksum(rootFsPath); err != nil {
+				return report, err
+			}
+		}
+		if err := d.RegisterContext(ctx, rootFsPath, opts...); err != nil {
+			if report.Recreated {
+				report.Recreated, report.Destroyed = false, true
+				return report, destroyedError(err)
+			}
+			return report, err
+		}
+		report.Registered = !report.Recreated
+
+		defer func() {
+			if err == nil {
+				return
+			}
+			// The context may be done already.
+			if uerr := d.UnregisterContext(context.Background()); uerr != nil {
+				err = fmt.Errorf("%v. Could not unregister the distro afterwards: %v", err, uerr)
+				return
+			}
+			report.Registered = false
+			if report.Recreated {
+				report.Recreated, report.Destroyed = false, true
+				err = destroyedError(err)
+			}
+		}()
+
+		id, err := d.GUID()
+		if err != nil {
+			return report, err
+		}
+		if err := setSourceChecksum(id, sum); err != nil {
+			return report, err
+		}
+	}
+
+	report.Configured, err = d.ensureConfiguration(ctx, desired)
+	return report, err
+}
+
+// destroyedError explains that the distro is absent after failing to be recreated.
+func destroyedError(err error) error {
+	return fmt.Errorf("%v. The distro was unregistered to be recreated, so it is absent now", err)
+}
+
+// ensureConfiguration changes the settings of the configuration of the distro that
+// differ from the desired ones, and returns their names.
+func (d *Distro) ensureConfiguration(ctx context.Context, desired DesiredConfiguration) ([]string, error) {
+	conf, err := d.GetConfigurationContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	if desired.DefaultUID != nil && *desired.DefaultUID != conf.DefaultUID {
+		conf.DefaultUID = *desired.DefaultUID
+		changed = append(changed, "DefaultUID")
+	}
+	for _, s := range []struct {
+		name    string
+		desired *bool
+		current *bool
+	}{
+		{"InteropEnabled", desired.InteropEnabled, &conf.InteropEnabled},
+		{"PathAppended", desired.PathAppended, &conf.PathAppended},
+		{"DriveMountingEnabled", desired.DriveMountingEnabled, &conf.DriveMountingEnabled},
+	} {
+		if s.desired != nil && *s.desired != *s.current {
+			*s.current = *s.desired
+			changed = append(changed, s.name)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	if err := d.configure(conf); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// EnsureAbsent converges the distro to an unregistered one, and reports whether it
+// unregistered it. Unlike Unregister, it does not fail if the distro is not
+// registered. Like Unregister, it irreparably destroys the distro and its filesystem.
+func (d *Distro) EnsureAbsent(ctx context.Context) (unregistered bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	registered, err := d.IsRegistered()
+	if err != nil {
+		return false, fmt.Errorf("could not ensure %q is absent: %v", d.Name(), err)
+	}
+	if !registered {
+		return false, nil
+	}
+
+	if err := d.UnregisterContext(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
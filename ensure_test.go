@@ -0,0 +1,170 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureRegistered(t *testing.T) {
+	disabled, enabled := false, true
+	uid := uint32(0)
+
+	testCases := map[string]struct {
+		registered   string // Tarball the distro is registered from beforehand, if any
+		byEnsure     bool   // Whether the distro was registered by EnsureRegistered beforehand
+		rootfs       string
+		desired      wsl.DesiredConfiguration
+		recreate     bool
+		wantReport   wsl.EnsureReport
+		wantNoChange bool
+	}{
+		"registers an absent distro":                      {rootfs: emptyRootFs, wantReport: wsl.EnsureReport{Registered: true}},
+		"leaves a registered distro as it is":             {registered: emptyRootFs, byEnsure: true, rootfs: emptyRootFs, wantNoChange: true},
+		"leaves a distro registered otherwise as it is":   {registered: emptyRootFs, rootfs: emptyRootFs, wantNoChange: true},
+		"changes the settings that differ":                {registered: emptyRootFs, rootfs: emptyRootFs, desired: wsl.DesiredConfiguration{InteropEnabled: &disabled, PathAppended: &enabled, DefaultUID: &uid}, wantReport: wsl.EnsureReport{Configured: []string{"InteropEnabled"}}},
+		"configures an absent distro":                     {rootfs: emptyRootFs, desired: wsl.DesiredConfiguration{DriveMountingEnabled: &disabled}, wantReport: wsl.EnsureReport{Registered: true, Configured: []string{"DriveMountingEnabled"}}},
+		"does not recreate a distro without the option":   {registered: emptyRootFs, byEnsure: true, rootfs: rootFs, wantNoChange: true},
+		"recreates a distro whose source changed":         {registered: emptyRootFs, byEnsure: true, rootfs: rootFs, recreate: true, wantReport: wsl.EnsureReport{Recreated: true}},
+		"does not recreate a distro whose source is same": {registered: emptyRootFs, byEnsure: true, rootfs: emptyRootFs, recreate: true, wantNoChange: true},
+		"does not recreate a distro registered otherwise": {registered: emptyRootFs, rootfs: rootFs, recreate: true, wantNoChange: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := wsl.NewDistro(uniqueDistroName(t))
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			if tc.registered != "" && tc.byEnsure {
+				_, err := d.EnsureRegistered(ctx, tc.registered, wsl.DesiredConfiguration{})
+				require.NoError(t, err, "Setup: EnsureRegistered should not have failed")
+			} else if tc.registered != "" {
+				require.NoError(t, d.RegisterContext(ctx, tc.registered), "Setup: Register should not have failed")
+			}
+
+			var report wsl.EnsureReport
+			var err error
+			if tc.recreate {
+				report, err = d.EnsureRegistered(ctx, tc.rootfs, tc.desired, wsl.WithRecreateOnSourceChange())
+			} else {
+				report, err = d.EnsureRegistered(ctx, tc.rootfs, tc.desired)
+			}
+			require.NoError(t, err, "EnsureRegistered should not have failed")
+
+			if tc.wantNoChange {
+				require.False(t, report.Changed(), "EnsureRegistered should not have changed anything, but reported %+v", report)
+			} else {
+				require.Equal(t, tc.wantReport, report, "Unexpected report")
+				require.True(t, report.Changed(), "EnsureRegistered should have reported changes")
+			}
+
+			r, err := d.IsRegistered()
+			require.NoError(t, err, "IsRegistered should not fail")
+			require.True(t, r, "The distro should be registered")
+
+			// Converging again changes nothing.
+			if tc.recreate {
+				report, err = d.EnsureRegistered(ctx, tc.rootfs, tc.desired, wsl.WithRecreateOnSourceChange())
+			} else {
+				report, err = d.EnsureRegistered(ctx, tc.rootfs, tc.desired)
+			}
+			require.NoError(t, err, "EnsureRegistered should not have failed the second time")
+			require.False(t, report.Changed(), "EnsureRegistered should not have changed anything the second time, but reported %+v", report)
+		})
+	}
+}
+
+func TestEnsureRegisteredWithRegisterOptions(t *testing.T) {
+	d := wsl.NewDistro(uniqueDistroName(t))
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := d.EnsureRegistered(ctx, rootFs, wsl.DesiredConfiguration{},
+		wsl.WithRecreateOnSourceChange(),
+		wsl.WithPreflightCheck(),
+		wsl.WithPatches(wsl.RootfsWriteFile("/etc/gowsl-ensured", []byte("Hello!"), 0644)))
+	require.NoError(t, err, "EnsureRegistered should not have failed")
+	require.True(t, report.Registered, "The distro should have been registered")
+
+	out, err := d.Command(ctx, "cat /etc/gowsl-ensured").Output()
+	require.NoError(t, err, "The patched file should be readable")
+	require.Equal(t, "Hello!", string(out), "The distro should have been registered with the patches")
+}
+
+func TestEnsureRegisteredErrors(t *testing.T) {
+	d := wsl.NewDistro(uniqueDistroName(t))
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	_, err := d.EnsureRegistered(context.Background(), "I am not a real file.tar.gz", wsl.DesiredConfiguration{})
+	require.Error(t, err, "EnsureRegistered should have failed with an inexistent rootfs")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.EnsureRegistered(ctx, emptyRootFs, wsl.DesiredConfiguration{})
+	require.ErrorIs(t, err, context.Canceled, "EnsureRegistered should have returned the error of the context")
+
+	r, err := d.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not fail")
+	require.False(t, r, "The distro should not be registered")
+}
+
+func TestEnsureRegisteredDestroyed(t *testing.T) {
+	d := wsl.NewDistro(uniqueDistroName(t))
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err := d.EnsureRegistered(ctx, emptyRootFs, wsl.DesiredConfiguration{})
+	require.NoError(t, err, "Setup: EnsureRegistered should not have failed")
+
+	// The tarball changed, but it cannot be registered.
+	corrupted := filepath.Join(t.TempDir(), "corrupted.tar.gz")
+	require.NoError(t, os.WriteFile(corrupted, []byte("I am not a tarball"), 0600), "Setup: could not write corrupted tarball")
+
+	report, err := d.EnsureRegistered(ctx, corrupted, wsl.DesiredConfiguration{}, wsl.WithRecreateOnSourceChange())
+	require.Error(t, err, "EnsureRegistered should have failed with a corrupted tarball")
+	require.Equal(t, wsl.EnsureReport{Destroyed: true}, report, "EnsureRegistered should have reported that the distro was destroyed")
+	require.True(t, report.Changed(), "EnsureRegistered should have reported changes")
+
+	r, err := d.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not fail")
+	require.False(t, r, "The distro should not be registered")
+}
+
+func TestEnsureAbsent(t *testing.T) {
+	d := newTestDistro(t, emptyRootFs)
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	unregistered, err := d.EnsureAbsent(ctx)
+	require.NoError(t, err, "EnsureAbsent should not have failed")
+	require.True(t, unregistered, "EnsureAbsent should have unregistered the distro")
+
+	r, err := d.IsRegistered()
+	require.NoError(t, err, "IsRegistered should not fail")
+	require.False(t, r, "The distro should not be registered")
+
+	unregistered, err = d.EnsureAbsent(ctx)
+	require.NoError(t, err, "EnsureAbsent should not have failed with an absent distro")
+	require.False(t, unregistered, "EnsureAbsent should not have done anything with an absent distro")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = d.EnsureAbsent(cancelled)
+	require.ErrorIs(t, err, context.Canceled, "EnsureAbsent should have returned the error of the context")
+}
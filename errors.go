@@ -0,0 +1,95 @@
+package gowsl
+
+// This file contains the error returned by commands that exit unsuccessfully.
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// ExitError is returned when a command launched into a distro, either via
+// Cmd or Shell, exits with a non-zero exit code. Shell wraps it into the
+// deprecated ShellError: use errors.As to find it.
+//
+// Experimentally we've seen that Linux produces exit codes under 256, and
+// Windows produces them above or equal to 256. Exit codes under 256 can
+// still come from both sides.
+type ExitError struct {
+	// Stderr holds a subset of the standard error output of the command,
+	// if it was collected by (*Cmd).Output.
+	Stderr []byte
+
+	command  string
+	exitCode uint32
+
+	// err is the error returned by the Windows process. It is nil for Shell.
+	err *exec.ExitError
+}
+
+// newExitError creates an ExitError for the command from the error of its Windows process.
+func newExitError(command string, err *exec.ExitError) *ExitError {
+	return &ExitError{
+		command:  command,
+		exitCode: uint32(err.ExitCode()),
+		err:      err,
+	}
+}
+
+// Error makes it so ExitError implements the error interface. It displays
+// the exit code and some auxiliary info.
+func (err *ExitError) Error() string {
+	cmd := "shell"
+	if err.command != "" {
+		cmd = fmt.Sprintf("command %q", err.command)
+	}
+
+	if err.IsWindowsSide() {
+		// Windows errors are commonly displayed in HEX, so we stick to the standard
+		return fmt.Sprintf("%s failed Windows-side: exit code 0x%x", cmd, err.exitCode)
+	}
+	// Linux exit codes are always displayed in decimal
+	if sig, ok := err.Signal(); ok {
+		return fmt.Sprintf("%s returned exit code %d (%v)", cmd, err.exitCode, sig)
+	}
+	return fmt.Sprintf("%s returned exit code %d", cmd, err.exitCode)
+}
+
+// ExitCode returns the exit code of the command.
+func (err *ExitError) ExitCode() int {
+	return int(err.exitCode)
+}
+
+// IsWindowsSide returns true when the exit code is too large to come from Linux,
+// meaning that the command failed on the Windows side.
+func (err *ExitError) IsWindowsSide() bool {
+	return err.exitCode > 0xff
+}
+
+// sigRTMax is the highest Linux signal.
+const sigRTMax = 64
+
+// Signal decodes the signal that terminated the command, following the shell
+// convention of exit codes 128+N for processes killed by signal N. The boolean
+// is false when the exit code does not follow this convention, or when N is not
+// a Linux signal.
+//
+// Note that a program may also exit with such a code of its own accord.
+func (err *ExitError) Signal() (Signal, bool) {
+	if err.IsWindowsSide() || err.exitCode <= 128 || err.exitCode > 128+sigRTMax {
+		return 0, false
+	}
+	return Signal(err.exitCode - 128), true
+}
+
+// Command returns the command that failed. It is empty for the default shell.
+func (err *ExitError) Command() string {
+	return err.command
+}
+
+// Unwrap returns the *exec.ExitError of the Windows process, if any.
+func (err *ExitError) Unwrap() error {
+	if err.err == nil {
+		return nil
+	}
+	return err.err
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"time"
 
 	wsl "github.com/ubuntu/gowsl"
@@ -53,7 +52,7 @@ func main() {
 
 	// Waiting for command 1
 
-	target := &exec.ExitError{}
+	target := &wsl.ExitError{}
 	switch err := cmd1.Wait(); {
 	case err == nil:
 		fmt.Printf("Succesful async command!\n")
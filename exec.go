@@ -6,11 +6,14 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Cmd is a wrapper around the Windows process spawned by WslLaunch.
@@ -25,6 +28,10 @@ type Cmd struct {
 	Stderr io.Writer // Writer to write stdout into
 	UseCWD bool      // Whether WSL is launched in the current working directory (true) or the home directory (false)
 
+	// ReportLinuxPID makes the command report its Linux PID, so that LinuxPID and
+	// Signal can be used. It requires the default shell of the distro to be POSIX-compliant.
+	ReportLinuxPID bool
+
 	// Immutable parameters
 	distro  *Distro // The distro that the command will be launched into.
 	command string  // The command to be launched
@@ -32,6 +39,8 @@ type Cmd struct {
 	// Pipes
 	closeAfterStart []io.Closer    // IO closers to be invoked after Launching the command
 	closeAfterWait  []io.Closer    // IO closers to be invoked after Waiting for the command to end
+	closeAfterCopy  []io.Closer    // IO closers to be invoked after Launching the command, once the output has been copied
+	copyingOutput   sync.WaitGroup // Goroutines that copy Stdout/Stderr, which may write into the closers above
 	goroutine       []func() error // Goroutines that monitor Stdout/Stderr/Stdin and copy them asyncrounously
 	errch           chan error     // The gouroutines will send any error down this chanel
 
@@ -44,6 +53,14 @@ type Cmd struct {
 	Process      *os.Process      // The windows handle to the WSL process
 	finished     bool             // Flag to fail nicely when Wait is invoked twice
 	ProcessState *os.ProcessState // Status of the process. Cached because it cannot be read after the process is closed.
+	linuxPID     *linuxPIDReader  // Reads the Linux PID from stderr. Only used if ReportLinuxPID is set.
+	startTime    time.Time        // Time when the process started, to log the duration of the command
+	stateMu      sync.Mutex       // Protects ProcessState, which Signal may read while Wait writes it
+
+	// Line callbacks
+	onStdoutLine func(line string) // Called for every line of stdout. See OnStdoutLine.
+	onStderrLine func(line string) // Called for every line of stderr. See OnStderrLine.
+	sharedWriter *lockedWriter     // Writer shared by stdout and stderr when they are read apart. See stdout.
 
 	// Context management
 	ctx      context.Context // Context to kill the process before it finishes
@@ -74,7 +91,20 @@ func (d *Distro) Command(ctx context.Context, cmd string) *Cmd {
 //
 // The Wait method will return the exit code and release associated resources
 // once the command exits.
-func (c *Cmd) Start() (err error) {
+//
+// Start is called through the interceptors of the command. See Interceptor.
+func (c *Cmd) Start() error {
+	err := c.intercept(PhaseStart, c.start)
+	if err != nil && c.Process == nil {
+		// An interceptor may have denied the command: its pipes must be released all the same.
+		c.closeDescriptors(c.closeAfterStart)
+		c.closeDescriptors(c.closeAfterWait)
+		c.closeDescriptors(c.closeAfterCopy)
+	}
+	return err
+}
+
+func (c *Cmd) start() (err error) {
 	// Based on exec/exec.go.
 	r, err := c.distro.IsRegistered()
 	if err != nil {
@@ -93,6 +123,7 @@ func (c *Cmd) Start() (err error) {
 		case <-c.ctx.Done():
 			c.closeDescriptors(c.closeAfterStart)
 			c.closeDescriptors(c.closeAfterWait)
+			c.closeDescriptors(c.closeAfterCopy)
 			return c.ctx.Err()
 		default:
 		}
@@ -104,16 +135,21 @@ func (c *Cmd) Start() (err error) {
 		if err != nil {
 			c.closeDescriptors(c.closeAfterStart)
 			c.closeDescriptors(c.closeAfterWait)
+			c.closeDescriptors(c.closeAfterCopy)
 			return err
 		}
 	}
 
+	c.startTime = time.Now()
 	c.Process, err = c.startProcess()
 	if err != nil {
+		logCommandStart(c.contextOrBackground(), c.distro.Name(), c.command, 0, err)
 		c.closeDescriptors(c.closeAfterStart)
 		c.closeDescriptors(c.closeAfterWait)
+		c.closeDescriptors(c.closeAfterCopy)
 		return err
 	}
+	logCommandStart(c.contextOrBackground(), c.distro.Name(), c.command, c.Process.Pid, nil)
 
 	c.closeDescriptors(c.closeAfterStart)
 
@@ -127,6 +163,13 @@ func (c *Cmd) Start() (err error) {
 		}
 	}
 
+	if len(c.closeAfterCopy) > 0 {
+		go func() {
+			c.copyingOutput.Wait()
+			c.closeDescriptors(c.closeAfterCopy)
+		}()
+	}
+
 	if c.ctx != nil {
 		c.waitDone = make(chan struct{})
 		go func() {
@@ -155,22 +198,34 @@ func (c *Cmd) Output() ([]byte, error) {
 	var stdout bytes.Buffer
 	c.Stdout = &stdout
 
-	captureErr := c.Stderr == nil
-	if captureErr {
-		c.Stderr = &prefixSuffixSaver{N: 32 << 10}
-	}
+	stderr := c.captureStderr()
 
 	err := c.Run()
-	if err != nil && captureErr {
-		//nolint: errorlint
-		// copied from stdlib. (*Cmd).Wait returns an unwrapped *ExitError so there should be no issue
-		if ee, ok := err.(*exec.ExitError); ok {
-			//nolint: forcetypeassert
-			// copied from stdlib. We know this to be true because it is set further up in this same function
-			ee.Stderr = c.Stderr.(*prefixSuffixSaver).Bytes()
+	return stdout.Bytes(), withStderr(err, stderr())
+}
+
+// captureStderr makes the command save a subset of its standard error output,
+// unless c.Stderr was set already. It returns a function that retrieves it.
+func (c *Cmd) captureStderr() func() []byte {
+	if c.Stderr != nil {
+		return func() []byte { return nil }
+	}
+	saver := &prefixSuffixSaver{N: 32 << 10}
+	c.Stderr = saver
+	return saver.Bytes
+}
+
+// withStderr attaches the captured standard error output to err if it is an *ExitError.
+func withStderr(err error, stderr []byte) error {
+	//nolint: errorlint
+	// copied from stdlib. (*Cmd).Wait returns an unwrapped *ExitError so there should be no issue
+	if ee, ok := err.(*ExitError); ok && stderr != nil {
+		ee.Stderr = stderr
+		if ee.err != nil {
+			ee.err.Stderr = stderr
 		}
 	}
-	return stdout.Bytes(), err
+	return err
 }
 
 // CombinedOutput runs the command and returns its combined standard
@@ -254,7 +309,8 @@ func (c *Cmd) StdoutPipe() (io.ReadCloser, error) {
 		return nil, err
 	}
 	c.Stdout = pw
-	c.closeAfterStart = append(c.closeAfterStart, pw)
+	// The output may be copied into the pipe rather than written by WSL directly.
+	c.closeAfterCopy = append(c.closeAfterCopy, pw)
 	c.closeAfterWait = append(c.closeAfterWait, pr)
 	return pr, nil
 }
@@ -279,7 +335,8 @@ func (c *Cmd) StderrPipe() (io.ReadCloser, error) {
 		return nil, err
 	}
 	c.Stderr = pw
-	c.closeAfterStart = append(c.closeAfterStart, pw)
+	// The output may be copied into the pipe rather than written by WSL directly.
+	c.closeAfterCopy = append(c.closeAfterCopy, pw)
 	c.closeAfterWait = append(c.closeAfterWait, pr)
 	return pr, nil
 }
@@ -294,7 +351,20 @@ func (c *Cmd) stdin() error {
 
 func (c *Cmd) stdout() error {
 	// Based on exec/exec.go.
-	w, e := c.writerDescriptor(c.Stdout)
+	var stdout io.Writer = c.Stdout
+	if c.readsStreamsApart() && c.Stderr != nil && interfaceEqual(c.Stdout, c.Stderr) {
+		// Stderr must be read on its own (to find the PID or to split it into lines),
+		// so it cannot share a descriptor with stdout. Instead, both descriptors
+		// share the writer, which must then be protected against concurrent writes.
+		c.sharedWriter = &lockedWriter{w: c.Stdout}
+		stdout = c.sharedWriter
+	}
+
+	if c.onStdoutLine != nil {
+		stdout = newLineSplitter(stdout, c.onStdoutLine)
+	}
+
+	w, e := c.writerDescriptor(stdout)
 	if e == nil {
 		c.stdoutW = w
 	}
@@ -303,19 +373,38 @@ func (c *Cmd) stdout() error {
 
 func (c *Cmd) stderr() error {
 	// Based on exec/exec.go.
+	var stderr io.Writer = c.Stderr
+	if c.sharedWriter != nil {
+		stderr = c.sharedWriter
+	}
+	if c.onStderrLine != nil {
+		stderr = newLineSplitter(stderr, c.onStderrLine)
+	}
+
+	if c.ReportLinuxPID {
+		c.linuxPID = newLinuxPIDReader(stderr)
+		stderr = c.linuxPID
+	}
+
 	// Case where Stdout and Stderr are the same
-	if c.Stderr != nil && interfaceEqual(c.Stdout, c.Stderr) {
+	if !c.readsStreamsApart() && c.Stderr != nil && interfaceEqual(c.Stdout, c.Stderr) {
 		c.stderrW = c.stdoutW
 		return nil
 	}
 	// Different stdout and stderr
-	w, e := c.writerDescriptor(c.Stderr)
+	w, e := c.writerDescriptor(stderr)
 	if e == nil {
 		c.stderrW = w
 	}
 	return e
 }
 
+// readsStreamsApart returns true if stdout and stderr must have their own
+// descriptors, even if they are written into the same writer.
+func (c *Cmd) readsStreamsApart() bool {
+	return c.ReportLinuxPID || c.onStdoutLine != nil || c.onStderrLine != nil
+}
+
 // interfaceEqual protects against panics from doing equality tests on
 // two interfaces with non-comparable underlying types.
 func interfaceEqual(a, b any) bool {
@@ -409,14 +498,29 @@ func (c *Cmd) writerDescriptor(w io.Writer) (f *os.File, err error) {
 
 	c.closeAfterStart = append(c.closeAfterStart, pw)
 	c.closeAfterWait = append(c.closeAfterWait, pr)
+	c.copyingOutput.Add(1)
 	c.goroutine = append(c.goroutine, func() error {
+		defer c.copyingOutput.Done()
 		_, err := io.Copy(w, pr)
 		pr.Close() // in case io.Copy stopped due to write error
+		// Writers that hold on to incomplete data are given the chance to write it out.
+		if f, ok := w.(flusher); ok {
+			if err1 := f.flush(); err == nil {
+				err = err1
+			}
+		}
 		return err
 	})
 	return pw, nil
 }
 
+// flusher is implemented by the writers in this package that buffer data
+// until they see a line ending. The copy goroutines call flush once the
+// stream is over.
+type flusher interface {
+	flush() error
+}
+
 // Wait waits for the command to exit and waits for any copying to
 // stdin or copying from stdout or stderr to complete.
 //
@@ -427,14 +531,27 @@ func (c *Cmd) writerDescriptor(w io.Writer) (f *os.File, err error) {
 // status.
 //
 // If the command fails to run or doesn't complete successfully, the
-// error is of type ExitError. Other error types may be
+// error is of type *ExitError. Other error types may be
 // returned for I/O problems.
 //
 // If any of c.Stdin, c.Stdout or c.Stderr are not an *os.File, Wait also waits
 // for the respective I/O loop copying to or from the process to complete.
 //
 // Wait releases any resources associated with the Cmd.
+//
+// Wait is called through the interceptors of the command. See Interceptor.
 func (c *Cmd) Wait() error {
+	err := c.intercept(PhaseWait, c.wait)
+	if c.Process != nil && !c.finished {
+		// An interceptor denied the call: the process and the goroutines copying
+		// its streams must be released all the same.
+		//nolint: errcheck // The error of the interceptor is the relevant one
+		c.wait()
+	}
+	return err
+}
+
+func (c *Cmd) wait() error {
 	// Based on exec/exec.go.
 	if c.Process == nil {
 		return errors.New("wsl: not started")
@@ -448,7 +565,9 @@ func (c *Cmd) Wait() error {
 	if c.waitDone != nil {
 		close(c.waitDone)
 	}
+	c.stateMu.Lock()
 	c.ProcessState = state
+	c.stateMu.Unlock()
 
 	var copyError error
 	for range c.goroutine {
@@ -459,19 +578,41 @@ func (c *Cmd) Wait() error {
 
 	c.closeDescriptors(c.closeAfterWait)
 
+	err = c.exitError(state, err, copyError)
+
+	exitCode := -1
+	if state != nil {
+		exitCode = state.ExitCode()
+	}
+	logCommandExit(c.contextOrBackground(), c.distro.Name(), c.command, c.Process.Pid, exitCode, time.Since(c.startTime), err)
+
+	return err
+}
+
+// exitError returns the error of a command that exited, given the outcome of
+// waiting for its process and of copying its standard streams.
+func (c *Cmd) exitError(state *os.ProcessState, waitErr, copyErr error) error {
 	if c.ctxErr != nil {
 		// This if block does not exist in the stdlib. We deviate because
 		// printing "context cancelled" is more useful than "exit code 1".
 		return c.ctxErr
 	}
 
-	if err != nil {
-		return err
+	if waitErr != nil {
+		return waitErr
 	} else if !state.Success() {
-		return &exec.ExitError{ProcessState: state}
+		return newExitError(c.command, &exec.ExitError{ProcessState: state})
 	}
 
-	return copyError
+	return copyErr
+}
+
+// contextOrBackground returns the context of the command, which may be unset in Cmd literals.
+func (c *Cmd) contextOrBackground() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
 }
 
 // Run starts the specified WslProcess and waits for it to complete.
@@ -487,6 +628,192 @@ func (c *Cmd) Run() error {
 	return c.Wait()
 }
 
+// linuxPIDPreamble is prepended to the command when ReportLinuxPID is set. It
+// prints the PID and process group of the shell that runs the command to stderr.
+const linuxPIDPreamble = `read -r _ _ _ _ gowsl_pgid _ </proc/$$/stat; ` +
+	`printf '` + linuxPIDMarker + `%s %s\n' "$$" "$gowsl_pgid" >&2; ` +
+	`unset gowsl_pgid; `
+
+// linuxPIDMarker starts the line of stderr where the preamble reports the PID.
+const linuxPIDMarker = "gowsl-linux-pid: "
+
+// launchCommand returns the command to be passed on to WslLaunch.
+func (c *Cmd) launchCommand() string {
+	if c.ReportLinuxPID {
+		return linuxPIDPreamble + c.command
+	}
+	return c.command
+}
+
+// LinuxPID returns the PID of the Linux shell running the command. It blocks
+// until the PID is reported, which happens right after the command starts.
+//
+// ReportLinuxPID must be set before calling Start.
+func (c *Cmd) LinuxPID() (int, error) {
+	pid, _, err := c.linuxProcess()
+	return pid, err
+}
+
+// LinuxProcessGroup returns the process group ID of the Linux shell running the
+// command. It blocks until the PID is reported, which happens right after the
+// command starts.
+//
+// ReportLinuxPID must be set before calling Start.
+func (c *Cmd) LinuxProcessGroup() (int, error) {
+	_, pgid, err := c.linuxProcess()
+	return pgid, err
+}
+
+// Signal sends a Linux signal to the process running the command. If the shell
+// running the command leads its own process group, the whole group is signaled,
+// so that children of the shell receive the signal as well.
+//
+// ReportLinuxPID must be set before calling Start.
+func (c *Cmd) Signal(sig Signal) error {
+	pid, pgid, err := c.linuxProcess()
+	if err != nil {
+		return err
+	}
+	c.stateMu.Lock()
+	finished := c.ProcessState != nil
+	c.stateMu.Unlock()
+	if finished {
+		return errors.New("wsl: process already finished")
+	}
+
+	target := strconv.Itoa(pid)
+	if pid == pgid {
+		target = "-" + target
+	}
+
+	out, err := c.distro.Command(c.ctx, fmt.Sprintf("kill -%d %s", int(sig), target)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("wsl: could not send %v to Linux process %d: %v. Output: %s", sig, pid, err, out)
+	}
+	return nil
+}
+
+// linuxProcess waits for the Linux PID and process group to be reported.
+func (c *Cmd) linuxProcess() (pid, pgid int, err error) {
+	if !c.ReportLinuxPID {
+		return 0, 0, errors.New("wsl: ReportLinuxPID is not set")
+	}
+	if c.Process == nil || c.linuxPID == nil {
+		return 0, 0, errors.New("wsl: not started")
+	}
+
+	<-c.linuxPID.done
+	return c.linuxPID.pid, c.linuxPID.pgid, c.linuxPID.err
+}
+
+// linuxPIDReader is an io.Writer that forwards everything written to it,
+// except for the line where the preamble reports the Linux PID, which it
+// parses and stores.
+type linuxPIDReader struct {
+	w io.Writer // Writer to forward stderr to
+
+	line  []byte // Incomplete line, kept until the PID is found
+	found bool
+
+	pid  int
+	pgid int
+	err  error
+
+	done chan struct{} // Closed once pid, pgid and err can be read
+}
+
+func newLinuxPIDReader(w io.Writer) *linuxPIDReader {
+	if w == nil {
+		w = io.Discard
+	}
+	return &linuxPIDReader{w: w, done: make(chan struct{})}
+}
+
+func (r *linuxPIDReader) Write(p []byte) (n int, err error) {
+	n = len(p)
+	for !r.found && len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			r.line = append(r.line, p...)
+			return n, nil
+		}
+
+		r.line = append(r.line, p[:i+1]...)
+		p = p[i+1:]
+
+		if r.parse(string(r.line)) {
+			r.found = true
+			close(r.done)
+		} else if _, err := r.w.Write(r.line); err != nil {
+			return n, err
+		}
+		r.line = r.line[:0]
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+	if _, err := r.w.Write(p); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// parse attempts to read the PID and process group from a line of stderr.
+// Lines that are not the preamble's report are rejected.
+func (r *linuxPIDReader) parse(line string) bool {
+	if !strings.HasPrefix(line, linuxPIDMarker) {
+		return false
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, linuxPIDMarker))
+	if len(fields) != 2 {
+		return false
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	pgid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+
+	r.pid = pid
+	r.pgid = pgid
+	return true
+}
+
+// flush writes out any incomplete line and, if the PID was never reported,
+// releases anyone waiting for it. Then, it flushes the writer it forwards to.
+func (r *linuxPIDReader) flush() error {
+	if !r.found {
+		r.err = errors.New("wsl: the Linux PID was not reported")
+		close(r.done)
+
+		if _, err := r.w.Write(r.line); err != nil {
+			return err
+		}
+	}
+
+	if f, ok := r.w.(flusher); ok {
+		return f.flush()
+	}
+	return nil
+}
+
+// lockedWriter serializes writes to a writer shared by stdout and stderr.
+type lockedWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
 // prefixSuffixSaver is an io.Writer which retains the first N bytes
 // and the last N bytes written to it. The Bytes() methods reconstructs
 // it with a pretty error message.
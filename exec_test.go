@@ -107,6 +107,12 @@ func TestCommandRun(t *testing.T) {
 			if tc.wantExitCode != 0 {
 				require.ErrorAsf(t, err, &target, "Run() should have returned an ExitError")
 				require.Equal(t, target.ExitCode(), tc.wantExitCode, "returned error ExitError has unexpected Code status")
+
+				wslTarget := &wsl.ExitError{}
+				require.ErrorAsf(t, err, &wslTarget, "Run() should have returned a wsl.ExitError")
+				require.Equal(t, tc.wantExitCode, wslTarget.ExitCode(), "returned error wsl.ExitError has unexpected Code status")
+				require.Equal(t, tc.cmd, wslTarget.Command(), "returned error wsl.ExitError has unexpected command")
+				require.False(t, wslTarget.IsWindowsSide(), "returned error wsl.ExitError should come from Linux")
 				return
 			}
 
@@ -453,6 +459,11 @@ func TestCommandOutput(t *testing.T) {
 			require.ErrorAsf(t, err, &target, "Unexpected error type. Expected an ExitError.")
 			require.Equal(t, target.ExitCode(), tc.wantExitCode, "Unexpected value for ExitError.Code.")
 			require.Equal(t, tc.wantStderr, string(target.Stderr), "Unexpected contents in stderr")
+
+			wslTarget := &wsl.ExitError{}
+			require.ErrorAsf(t, err, &wslTarget, "Unexpected error type. Expected a wsl.ExitError.")
+			require.Equal(t, tc.wantExitCode, wslTarget.ExitCode(), "Unexpected value for wsl.ExitError.Code.")
+			require.Equal(t, tc.wantStderr, string(wslTarget.Stderr), "Unexpected contents in wsl.ExitError stderr")
 		})
 	}
 }
@@ -640,6 +651,103 @@ print("Your text was", v)
 	}
 }
 
+func TestCommandLinuxPID(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	testCases := map[string]struct {
+		reportPID bool
+		stderr    bool
+		combined  bool // Whether stdout and stderr share the same writer
+		signal    wsl.Signal
+
+		wantErr bool
+	}{
+		"success":                        {reportPID: true},
+		"success with stderr":            {reportPID: true, stderr: true},
+		"success with combined output":   {reportPID: true, stderr: true, combined: true},
+		"success sending a signal":       {reportPID: true, signal: wsl.SIGTERM},
+		"success sending a user signal":  {reportPID: true, signal: wsl.SIGUSR1},
+		"error when PID is not reported": {wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			cmd := d.Command(ctx, "echo 'Hello stderr!' >&2 && sleep 10")
+			cmd.ReportLinuxPID = tc.reportPID
+
+			_, err := cmd.LinuxPID()
+			require.Error(t, err, "Unexpected success calling (*Cmd).LinuxPID before (*Cmd).Start")
+
+			stderr := &bytes.Buffer{}
+			if tc.stderr {
+				cmd.Stderr = stderr
+			}
+			if tc.combined {
+				cmd.Stdout = stderr
+			}
+
+			err = cmd.Start()
+			require.NoError(t, err, "Unexpected error calling (*Cmd).Start")
+			defer cmd.Wait() //nolint: errcheck // The command may be interrupted, this is only for cleanup
+
+			if tc.combined {
+				require.Same(t, stderr, cmd.Stdout, "Start should not have replaced Stdout")
+				require.Same(t, stderr, cmd.Stderr, "Start should not have replaced Stderr")
+			}
+
+			pid, err := cmd.LinuxPID()
+			if tc.wantErr {
+				require.Error(t, err, "Unexpected success calling (*Cmd).LinuxPID")
+				require.Error(t, cmd.Signal(wsl.SIGTERM), "Unexpected success calling (*Cmd).Signal")
+				return
+			}
+			require.NoError(t, err, "Unexpected error calling (*Cmd).LinuxPID")
+			require.Positive(t, pid, "Linux PID should be a positive number")
+
+			pgid, err := cmd.LinuxProcessGroup()
+			require.NoError(t, err, "Unexpected error calling (*Cmd).LinuxProcessGroup")
+			require.Positive(t, pgid, "Linux process group should be a positive number")
+
+			// The reported process must be visible from inside the distro
+			out, err := d.Command(ctx, fmt.Sprintf("cat /proc/%d/cmdline", pid)).Output()
+			require.NoErrorf(t, err, "Reported PID %d does not exist inside the distro", pid)
+			require.Contains(t, string(out), "sleep 10", "Reported PID %d is not the one running the command", pid)
+
+			if tc.signal == 0 {
+				// Signaling while another goroutine waits is the main use case.
+				waitErr := make(chan error)
+				go func() { waitErr <- cmd.Wait() }()
+
+				err = cmd.Signal(wsl.SIGKILL)
+				require.NoError(t, err, "Unexpected error calling (*Cmd).Signal")
+				require.Error(t, <-waitErr, "Unexpected success waiting for a killed command")
+				require.Error(t, cmd.Signal(wsl.SIGKILL), "Unexpected success calling (*Cmd).Signal after the process finished")
+				if tc.stderr {
+					require.Equal(t, "Hello stderr!\n", stderr.String(), "The PID report should not be visible in stderr")
+				}
+				return
+			}
+
+			err = cmd.Signal(tc.signal)
+			require.NoError(t, err, "Unexpected error calling (*Cmd).Signal")
+
+			err = cmd.Wait()
+			require.Error(t, err, "Unexpected success waiting for a signaled command")
+
+			target := &exec.ExitError{}
+			require.ErrorAs(t, err, &target, "Unexpected error type. Expected an ExitError.")
+			require.Equal(t, 128+int(tc.signal), target.ExitCode(), "Unexpected exit code for a signaled command")
+		})
+	}
+}
+
 // ErrorAsf implements the non-existent require.NotErrorAsf
 //
 // Based on github.com\stretchr\testify@v1.8.1\require\require.go:@ErrorAsf.
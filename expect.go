@@ -0,0 +1,31 @@
+package gowsl
+
+// This file contains utilities to interact with programs that prompt for input.
+
+import (
+	"github.com/ubuntu/gowsl/expect"
+)
+
+// Expect connects an expect.Session to the standard input and output of the
+// command, so that it can answer its prompts. Unless Stderr is set, the standard
+// error output is read by the session as well, as prompts are often written there.
+//
+// It must be called before Start. Closing the session closes the standard input
+// of the command.
+func (c *Cmd) Expect() (*expect.Session, error) {
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Stderr == nil {
+		c.Stderr = c.Stdout
+	}
+
+	return expect.New(stdin, stdout), nil
+}
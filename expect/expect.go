@@ -0,0 +1,385 @@
+// Package expect drives programs that prompt interactively, by waiting for
+// patterns in their output and answering them, in the style of expect(1).
+//
+// It works over any pair of streams, such as the pipes of a command in a
+// distro (see (*gowsl.Cmd).Expect) or of a local process.
+package expect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is the error of a NoMatchError when the patterns did not appear in time.
+var ErrTimeout = errors.New("timed out")
+
+// NoMatchError is returned when none of the expected patterns appeared in the output.
+type NoMatchError struct {
+	// Patterns that were expected.
+	Patterns []string
+
+	// Output holds the output that was read since the last match, to tell what
+	// the program said instead.
+	Output string
+
+	// err is ErrTimeout, io.EOF, the error of the context, or a read error.
+	err error
+}
+
+// Error makes it so NoMatchError implements the error interface.
+func (err *NoMatchError) Error() string {
+	return fmt.Sprintf("expected %s: %v. Output: %q", strings.Join(err.Patterns, " or "), err.err, err.Output)
+}
+
+// Unwrap returns the reason why the patterns were not found: ErrTimeout, io.EOF,
+// the error of the context, or an error reading the output.
+func (err *NoMatchError) Unwrap() error {
+	return err.err
+}
+
+// StepError is returned by (*Session).Run when a step of the script fails.
+type StepError struct {
+	// Step is the index of the failed step, counting from 0.
+	Step int
+
+	err error
+}
+
+// Error makes it so StepError implements the error interface.
+func (err *StepError) Error() string {
+	return fmt.Sprintf("step %d: %v", err.Step, err.err)
+}
+
+// Unwrap returns the error of the step, usually a *NoMatchError.
+func (err *StepError) Unwrap() error {
+	return err.err
+}
+
+// Pattern is something to look for in the output.
+type Pattern interface {
+	// find returns the location of the pattern and its submatches in b, or nil.
+	find(b []byte) []int
+	fmt.Stringer
+}
+
+type exact string
+
+func (p exact) find(b []byte) []int {
+	i := bytes.Index(b, []byte(p))
+	if i < 0 {
+		return nil
+	}
+	return []int{i, i + len(p)}
+}
+
+func (p exact) String() string {
+	return fmt.Sprintf("%q", string(p))
+}
+
+// Exact is a pattern that matches the text as-is.
+func Exact(text string) Pattern {
+	return exact(text)
+}
+
+type regex struct {
+	*regexp.Regexp
+}
+
+func (p regex) find(b []byte) []int {
+	return p.FindSubmatchIndex(b)
+}
+
+func (p regex) String() string {
+	return fmt.Sprintf("/%s/", p.Regexp.String())
+}
+
+// Regexp is a pattern that matches the regular expression. Its submatches
+// are returned in Match.Groups.
+func Regexp(re *regexp.Regexp) Pattern {
+	return regex{re}
+}
+
+// Match is the output that matched one of the expected patterns.
+type Match struct {
+	// Index is the position of the matching pattern among the expected ones.
+	Index int
+
+	// Text is the text that matched the pattern.
+	Text string
+
+	// Groups holds the submatches of a Regexp pattern, the whole match first.
+	Groups []string
+
+	// Before is the output between the previous match and this one.
+	Before string
+}
+
+// Step is a step of a script: it waits for a pattern, and answers it.
+type Step struct {
+	Expect Pattern
+	Send   string
+}
+
+// MaxBuffer is the default size after which the output that is not matched yet is
+// dropped from the front, so that a chatty program whose output never matches does
+// not grow the memory without bound. See SetMaxBuffer.
+const MaxBuffer = 64 * 1024
+
+// Session interacts with a program over its standard input and output.
+type Session struct {
+	// Timeout bounds every call to Expect, on top of its context. There is no
+	// timeout if it is zero.
+	Timeout time.Duration
+
+	w io.Writer
+
+	mu         sync.Mutex
+	buf        []byte        // Output read but not matched yet
+	maxBuffer  int           // Size after which the front of buf is dropped
+	readErr    error         // Error that stopped reading the output, io.EOF at the end
+	notify     chan struct{} // Signals that there is new output or readErr is set
+	transcript bytes.Buffer  // Everything that was read and sent
+	log        io.Writer     // Receives the transcript as it happens. Can be nil.
+}
+
+// New starts a session that sends into w and reads the output from r. It starts
+// reading from r right away, and keeps doing so until it fails or reaches EOF.
+func New(w io.Writer, r io.Reader) *Session {
+	s := &Session{
+		w:         w,
+		maxBuffer: MaxBuffer,
+		notify:    make(chan struct{}, 1),
+	}
+	go s.read(r)
+	return s
+}
+
+func (s *Session) read(r io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+
+		s.mu.Lock()
+		s.buf = append(s.buf, buf[:n]...)
+		if s.maxBuffer > 0 && len(s.buf) > s.maxBuffer {
+			s.buf = append(s.buf[:0], s.buf[len(s.buf)-s.maxBuffer:]...)
+		}
+		s.record(buf[:n])
+		if err != nil {
+			s.readErr = err
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// record adds data to the transcript. The mutex must be held.
+func (s *Session) record(data []byte) {
+	s.transcript.Write(data)
+	if s.log != nil {
+		//nolint: errcheck // The log is best-effort, it must not break the session
+		s.log.Write(data)
+	}
+}
+
+// SetMaxBuffer sets the size after which the output that is not matched yet is
+// dropped from the front, MaxBuffer by default. Patterns that start in the output
+// that is dropped are not found. There is no limit if n is zero or negative. The
+// transcript is kept whole regardless.
+func (s *Session) SetMaxBuffer(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxBuffer = n
+}
+
+// SetLog makes the session write its transcript into w as it happens, from now on.
+func (s *Session) SetLog(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = w
+}
+
+// Expect waits until the output contains any of the patterns, and returns the
+// earliest match. The output up to the end of the match is then consumed.
+//
+// If none of the patterns appears before the context is done, the timeout of
+// the session expires, or the output ends, the error is of type *NoMatchError.
+func (s *Session) Expect(ctx context.Context, patterns ...Pattern) (Match, error) {
+	if len(patterns) == 0 {
+		return Match{}, errors.New("no patterns to expect")
+	}
+
+	var timeout <-chan time.Time
+	if s.Timeout > 0 {
+		timer := time.NewTimer(s.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		m, ok, readErr := s.match(patterns)
+		if ok {
+			return m, nil
+		}
+		if readErr != nil {
+			return Match{}, s.expectError(patterns, readErr)
+		}
+
+		select {
+		case <-s.notify:
+		case <-timeout:
+			return Match{}, s.expectError(patterns, ErrTimeout)
+		case <-ctx.Done():
+			return Match{}, s.expectError(patterns, ctx.Err())
+		}
+	}
+}
+
+// match looks for the earliest match of any pattern in the output, and consumes
+// the output up to its end. It also returns the error that stopped reading, if any.
+func (s *Session) match(patterns []Pattern) (m Match, ok bool, readErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var loc []int
+	var groups bool
+	for i, p := range patterns {
+		l := p.find(s.buf)
+		if l == nil {
+			continue
+		}
+		// Earliest match wins, and the first pattern wins ties.
+		if loc == nil || l[0] < loc[0] {
+			loc = l
+			m.Index = i
+			_, groups = p.(regex)
+		}
+	}
+
+	if loc == nil {
+		return Match{}, false, s.readErr
+	}
+
+	m.Before = string(s.buf[:loc[0]])
+	m.Text = string(s.buf[loc[0]:loc[1]])
+	for i := 0; groups && i+1 < len(loc); i += 2 {
+		if loc[i] < 0 {
+			m.Groups = append(m.Groups, "")
+			continue
+		}
+		m.Groups = append(m.Groups, string(s.buf[loc[i]:loc[i+1]]))
+	}
+
+	s.buf = append(s.buf[:0], s.buf[loc[1]:]...)
+	return m, true, nil
+}
+
+func (s *Session) expectError(patterns []Pattern, err error) *NoMatchError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		names = append(names, p.String())
+	}
+	return &NoMatchError{Patterns: names, Output: string(s.buf), err: err}
+}
+
+// ExpectEOF waits until the output ends, and returns the output that was not
+// matched. If it does not end in time, the error is of type *NoMatchError.
+func (s *Session) ExpectEOF(ctx context.Context) (string, error) {
+	var timeout <-chan time.Time
+	if s.Timeout > 0 {
+		timer := time.NewTimer(s.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		s.mu.Lock()
+		readErr, rest := s.readErr, string(s.buf)
+		s.mu.Unlock()
+
+		if errors.Is(readErr, io.EOF) {
+			return rest, nil
+		}
+		if readErr != nil {
+			return rest, &NoMatchError{Patterns: []string{"EOF"}, Output: rest, err: readErr}
+		}
+
+		select {
+		case <-s.notify:
+		case <-timeout:
+			return rest, &NoMatchError{Patterns: []string{"EOF"}, Output: rest, err: ErrTimeout}
+		case <-ctx.Done():
+			return rest, &NoMatchError{Patterns: []string{"EOF"}, Output: rest, err: ctx.Err()}
+		}
+	}
+}
+
+// Send writes the text into the input of the program.
+func (s *Session) Send(text string) error {
+	if _, err := io.WriteString(s.w, text); err != nil {
+		return fmt.Errorf("could not send %q: %v", text, err)
+	}
+
+	s.mu.Lock()
+	s.record([]byte(text))
+	s.mu.Unlock()
+	return nil
+}
+
+// SendLine writes the text, followed by a line break, into the input of the program.
+func (s *Session) SendLine(text string) error {
+	return s.Send(text + "\n")
+}
+
+// Run plays the steps of a script in order: it waits for the pattern of each
+// step and then sends its answer. Steps without a pattern send right away, and
+// steps without an answer only wait. If a step fails, the error is of type *StepError.
+func (s *Session) Run(ctx context.Context, steps ...Step) error {
+	for i, step := range steps {
+		if step.Expect != nil {
+			if _, err := s.Expect(ctx, step.Expect); err != nil {
+				return &StepError{Step: i, err: err}
+			}
+		}
+		if step.Send != "" {
+			if err := s.Send(step.Send); err != nil {
+				return &StepError{Step: i, err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// Transcript returns everything that was read from the output and sent into
+// the input so far, in the order it happened.
+func (s *Session) Transcript() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transcript.String()
+}
+
+// Close closes the input of the program, if it can be closed, so that it sees EOF.
+func (s *Session) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
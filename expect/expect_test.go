@@ -0,0 +1,286 @@
+package expect_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/expect"
+)
+
+func TestExpect(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		output   []string // Chunks written by the fake program, with a pause in between
+		patterns []expect.Pattern
+		timeout  time.Duration
+		closeOut bool
+
+		want    expect.Match
+		wantErr error
+	}{
+		"exact":                      {output: []string{"Password: "}, patterns: pats(expect.Exact("Password:")), want: expect.Match{Text: "Password:"}},
+		"exact with output before":   {output: []string{"Welcome\nPassword: "}, patterns: pats(expect.Exact("Password:")), want: expect.Match{Text: "Password:", Before: "Welcome\n"}},
+		"exact across chunks":        {output: []string{"Pass", "word: "}, patterns: pats(expect.Exact("Password:")), want: expect.Match{Text: "Password:"}},
+		"regexp":                     {output: []string{"Accept license? [y/N] "}, patterns: pats(expect.Regexp(regexp.MustCompile(`\[(y)/(N)\]`))), want: expect.Match{Text: "[y/N]", Groups: []string{"[y/N]", "y", "N"}, Before: "Accept license? "}},
+		"regexp with optional group": {output: []string{"version 1"}, patterns: pats(expect.Regexp(regexp.MustCompile(`version (\d)(\.\d)?`))), want: expect.Match{Text: "version 1", Groups: []string{"version 1", "1", ""}, Before: ""}},
+		"second pattern":             {output: []string{"Error: no space"}, patterns: pats(expect.Exact("Done"), expect.Exact("Error")), want: expect.Match{Index: 1, Text: "Error"}},
+		"earliest match wins":        {output: []string{"Error then Done"}, patterns: pats(expect.Exact("Done"), expect.Exact("Error")), want: expect.Match{Index: 1, Text: "Error"}},
+		"first pattern wins ties":    {output: []string{"Done"}, patterns: pats(expect.Exact("Do"), expect.Exact("Done")), want: expect.Match{Index: 0, Text: "Do"}},
+		"match before EOF":           {output: []string{"bye"}, closeOut: true, patterns: pats(expect.Exact("bye")), want: expect.Match{Text: "bye"}},
+
+		"error on timeout":       {output: []string{"something else"}, patterns: pats(expect.Exact("Password:")), timeout: 200 * time.Millisecond, wantErr: expect.ErrTimeout},
+		"error on EOF":           {output: []string{"something else"}, closeOut: true, patterns: pats(expect.Exact("Password:")), wantErr: io.EOF},
+		"error on context":       {output: []string{"something else"}, patterns: pats(expect.Exact("Password:")), wantErr: context.DeadlineExceeded},
+		"error with no patterns": {output: []string{"something"}, wantErr: errAny},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			r, w := io.Pipe()
+			s := expect.New(io.Discard, r)
+			s.Timeout = tc.timeout
+
+			go func() {
+				for _, chunk := range tc.output {
+					//nolint: errcheck // The test fails if the output is not written
+					w.Write([]byte(chunk))
+					time.Sleep(10 * time.Millisecond)
+				}
+				if tc.closeOut {
+					w.Close()
+				}
+			}()
+			defer w.Close()
+
+			got, err := s.Expect(ctx, tc.patterns...)
+			if tc.wantErr == nil {
+				require.NoError(t, err, "Expect should not return an error")
+				require.Equal(t, tc.want, got, "Unexpected match")
+				return
+			}
+
+			require.Error(t, err, "Expect should have returned an error")
+			if errors.Is(tc.wantErr, errAny) {
+				return
+			}
+			require.ErrorIs(t, err, tc.wantErr, "Unexpected error")
+
+			var noMatch *expect.NoMatchError
+			require.ErrorAs(t, err, &noMatch, "Unexpected error type. Expected a NoMatchError.")
+			require.Equal(t, strings.Join(tc.output, ""), noMatch.Output, "The error should hold the unmatched output")
+			require.Len(t, noMatch.Patterns, len(tc.patterns), "The error should list the expected patterns")
+		})
+	}
+}
+
+func TestExpectConsumesOutput(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := expect.New(io.Discard, strings.NewReader("a1 a2 a3 end"))
+	re := expect.Regexp(regexp.MustCompile(`a(\d)`))
+
+	for _, want := range []string{"1", "2", "3"} {
+		m, err := s.Expect(ctx, re)
+		require.NoError(t, err, "Expect should not return an error")
+		require.Equal(t, want, m.Groups[1], "Each call should match the next occurrence")
+	}
+
+	rest, err := s.ExpectEOF(ctx)
+	require.NoError(t, err, "ExpectEOF should not return an error")
+	require.Equal(t, " end", rest, "ExpectEOF should return the unmatched output")
+
+	_, err = s.Expect(ctx, re)
+	require.ErrorIs(t, err, io.EOF, "Expect should fail after the end of the output")
+}
+
+func TestExpectMaxBuffer(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		maxBuffer int
+
+		wantRest string
+	}{
+		"drops the front of the output past the limit": {maxBuffer: 10, wantRest: "ghijklmnop"},
+		"keeps the whole output without a limit":       {maxBuffer: -1, wantRest: "0123456789abcdefghijklmnop"},
+		"keeps the output within the default limit":    {wantRest: "0123456789abcdefghijklmnop"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			r, w := io.Pipe()
+			s := expect.New(io.Discard, r)
+			if tc.maxBuffer != 0 {
+				s.SetMaxBuffer(tc.maxBuffer)
+			}
+
+			go func() {
+				_, _ = w.Write([]byte("0123456789abcdef"))
+				_, _ = w.Write([]byte("ghijklmnop"))
+				w.Close()
+			}()
+
+			rest, err := s.ExpectEOF(ctx)
+			require.NoError(t, err, "ExpectEOF should not return an error")
+			require.Equal(t, tc.wantRest, rest, "Unexpected output kept by the session")
+			require.Equal(t, "0123456789abcdefghijklmnop", s.Transcript(), "The transcript should be kept whole")
+		})
+	}
+}
+
+func TestExpectEOFTimeout(t *testing.T) {
+	t.Parallel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	s := expect.New(io.Discard, r)
+	s.Timeout = 100 * time.Millisecond
+
+	_, err := s.ExpectEOF(context.Background())
+	require.ErrorIs(t, err, expect.ErrTimeout, "ExpectEOF should time out if the output does not end")
+}
+
+func TestSendErrors(t *testing.T) {
+	t.Parallel()
+
+	r, w := io.Pipe()
+	r.Close()
+
+	s := expect.New(w, strings.NewReader(""))
+	require.Error(t, s.SendLine("hello"), "Send should fail if the input is closed")
+	require.NoError(t, s.Close(), "Close should not fail")
+}
+
+func TestRunScriptWithProcess(t *testing.T) {
+	t.Parallel()
+
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("Skipping test because /bin/sh is not available")
+	}
+
+	// A program with prompts on stdout and stderr.
+	const program = `
+printf 'Username: '
+read user
+printf 'Password: ' >&2
+read password
+printf 'Accept the license? [y/N] '
+read accept
+[ "$accept" = y ] || { echo 'License declined'; exit 1; }
+echo "Welcome, $user ($password)"
+`
+
+	testCases := map[string]struct {
+		steps []expect.Step
+
+		wantErr    bool
+		wantStep   int
+		wantOutput string
+	}{
+		"success": {steps: []expect.Step{
+			{Expect: expect.Exact("Username:"), Send: "alice\n"},
+			{Expect: expect.Exact("Password:"), Send: "secret\n"},
+			{Expect: expect.Regexp(regexp.MustCompile(`\[y/N\]`)), Send: "y\n"},
+			{Expect: expect.Regexp(regexp.MustCompile(`Welcome, alice \(secret\)`))},
+		}},
+		"success sending first": {steps: []expect.Step{
+			{Send: "bob\nhunter2\ny\n"},
+			{Expect: expect.Exact("Welcome, bob (hunter2)")},
+		}},
+
+		"error when the program says something else": {steps: []expect.Step{
+			{Expect: expect.Exact("Username:"), Send: "alice\n"},
+			{Expect: expect.Exact("Password:"), Send: "secret\n"},
+			{Expect: expect.Exact("[y/N]"), Send: "n\n"},
+			{Expect: expect.Exact("Welcome")},
+		}, wantErr: true, wantStep: 3, wantOutput: " License declined\n"},
+		"error when the program is stuck": {steps: []expect.Step{
+			{Expect: expect.Exact("Email:")},
+		}, wantErr: true, wantStep: 0, wantOutput: "Username: "},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cmd := exec.Command("/bin/sh", "-c", program)
+			stdin, err := cmd.StdinPipe()
+			require.NoError(t, err, "Setup: could not get stdin pipe")
+			stdout, err := cmd.StdoutPipe()
+			require.NoError(t, err, "Setup: could not get stdout pipe")
+			cmd.Stderr = cmd.Stdout
+
+			require.NoError(t, cmd.Start(), "Setup: could not start the program")
+			defer cmd.Wait() //nolint: errcheck // The program may fail, this is only for cleanup
+			defer cmd.Process.Kill()
+
+			s := expect.New(stdin, stdout)
+			s.Timeout = time.Second
+
+			var log bytes.Buffer
+			s.SetLog(&log)
+
+			err = s.Run(ctx, tc.steps...)
+			if !tc.wantErr {
+				require.NoError(t, err, "Run should not return an error")
+				require.NoError(t, s.Close(), "Close should not return an error")
+
+				rest, err := s.ExpectEOF(ctx)
+				require.NoError(t, err, "The program should finish")
+				require.Empty(t, strings.TrimSpace(rest), "All output should have been matched")
+
+				transcript := s.Transcript()
+				require.Contains(t, transcript, "Username: ", "The transcript should hold the output")
+				require.Contains(t, transcript, "y\n", "The transcript should hold the input")
+				require.Equal(t, transcript, log.String(), "The log should receive the whole transcript")
+				return
+			}
+
+			require.Error(t, err, "Run should have returned an error")
+
+			var stepErr *expect.StepError
+			require.ErrorAs(t, err, &stepErr, "Unexpected error type. Expected a StepError.")
+			require.Equal(t, tc.wantStep, stepErr.Step, "Unexpected failed step")
+
+			var noMatch *expect.NoMatchError
+			require.ErrorAs(t, err, &noMatch, "Unexpected error type. Expected a NoMatchError.")
+			require.Equal(t, tc.wantOutput, noMatch.Output, "Unexpected unmatched output")
+		})
+	}
+}
+
+func pats(patterns ...expect.Pattern) []expect.Pattern {
+	return patterns
+}
+
+var errAny = errors.New("any error")
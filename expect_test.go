@@ -0,0 +1,72 @@
+package gowsl_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/expect"
+)
+
+func TestCommandExpect(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	testCases := map[string]struct {
+		reportPID bool
+		onLines   bool
+	}{
+		"success":                            {},
+		"success reporting the Linux PID":    {reportPID: true},
+		"success following the output lines": {onLines: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			cmd := d.Command(ctx, `printf 'Name: ' >&2 && read name && printf 'Accept? [y/N] ' && read yes && echo "Hello, $name ($yes)"`)
+
+			s, err := cmd.Expect()
+			require.NoError(t, err, "Unexpected error calling (*Cmd).Expect")
+			s.Timeout = 10 * time.Second
+
+			_, err = cmd.Expect()
+			require.Error(t, err, "Unexpected success calling (*Cmd).Expect twice")
+
+			// These read stderr apart from stdout, so the session must still get both.
+			cmd.ReportLinuxPID = tc.reportPID
+			var lines []string
+			if tc.onLines {
+				cmd.OnStdoutLine(func(line string) { lines = append(lines, line) })
+			}
+
+			err = cmd.Start()
+			require.NoError(t, err, "Unexpected error starting the command")
+
+			err = s.Run(ctx,
+				expect.Step{Expect: expect.Exact("Name:"), Send: "WSL\n"},
+				expect.Step{Expect: expect.Regexp(regexp.MustCompile(`\[y/N\]`)), Send: "y\n"},
+			)
+			require.NoError(t, err, "Unexpected error answering the prompts")
+
+			m, err := s.Expect(ctx, expect.Regexp(regexp.MustCompile(`Hello, (\w+) \((\w)\)`)))
+			require.NoError(t, err, "Unexpected error expecting the greeting")
+			require.Equal(t, []string{"Hello, WSL (y)", "WSL", "y"}, m.Groups, "Unexpected greeting")
+
+			require.NoError(t, s.Close(), "Unexpected error closing the session")
+			require.NoError(t, cmd.Wait(), "Unexpected error waiting for the command")
+
+			require.Contains(t, s.Transcript(), "Name: WSL\n", "The transcript should hold the prompts and answers")
+			if tc.onLines {
+				require.Contains(t, lines, "Accept? [y/N] Hello, WSL (y)", "The output lines should have been followed")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package gowsl
+
+// This file contains utilities to read the filesystem of a distro.
+
+import (
+	"context"
+	"io/fs"
+	"os"
+
+	"github.com/ubuntu/gowsl/internal/cmdfs"
+)
+
+// FS returns a read-only view of the filesystem of the distro, rooted at "/".
+// It also implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+//
+// Files are read via the \\wsl.localhost\<distro> network share when it is
+// reachable (or its older form \\wsl$\<distro>). Otherwise, they are read by
+// running commands in the distro, which requires GNU find. In that case, the
+// context bounds the commands.
+func (d *Distro) FS(ctx context.Context) fs.FS {
+	for _, share := range []string{`\\wsl.localhost\`, `\\wsl$\`} {
+		root := share + d.Name()
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			return shareFS{FS: os.DirFS(root)}
+		}
+	}
+
+	return cmdfs.New(func(command string) ([]byte, error) {
+		return d.Command(ctx, command).Output()
+	}, "/")
+}
+
+// shareFS adds the ReadDirFS, StatFS and ReadFileFS interfaces to the filesystem
+// of a network share.
+type shareFS struct {
+	fs.FS
+}
+
+func (s shareFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.FS, name)
+}
+
+func (s shareFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.FS, name)
+}
+
+func (s shareFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.FS, name)
+}
@@ -0,0 +1,56 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	out, err := d.Command(ctx, `mkdir -p /tmp/fstest/dir/sub && printf 'Hello!' > /tmp/fstest/file.txt \
+		&& printf 'Nested' > /tmp/fstest/dir/nested.txt && touch /tmp/fstest/dir/sub/empty.txt`).CombinedOutput()
+	require.NoError(t, err, "Setup: could not create files in the distro: %s", out)
+
+	fsys := d.FS(ctx)
+
+	_, ok := fsys.(fs.ReadDirFS)
+	require.True(t, ok, "FS should implement fs.ReadDirFS")
+	_, ok = fsys.(fs.StatFS)
+	require.True(t, ok, "FS should implement fs.StatFS")
+	_, ok = fsys.(fs.ReadFileFS)
+	require.True(t, ok, "FS should implement fs.ReadFileFS")
+
+	sub, err := fs.Sub(fsys, "tmp/fstest")
+	require.NoError(t, err, "Setup: could not create sub-filesystem")
+
+	err = fstest.TestFS(sub, "file.txt", "dir/nested.txt", "dir/sub/empty.txt")
+	require.NoError(t, err, "FS does not behave as expected")
+
+	contents, err := fs.ReadFile(fsys, "tmp/fstest/file.txt")
+	require.NoError(t, err, "Unexpected error reading file")
+	require.Equal(t, "Hello!", string(contents), "Unexpected contents")
+
+	_, err = fs.Stat(fsys, "tmp/fstest/missing")
+	require.ErrorIs(t, err, fs.ErrNotExist, "Unexpected error for a missing file")
+}
+
+func TestFSNotRegistered(t *testing.T) {
+	d := wsl.NewDistro(uniqueDistroName(t))
+
+	_, err := fs.Stat(d.FS(context.Background()), "etc")
+	require.Error(t, err, "Unexpected success reading a distro that is not registered")
+}
@@ -1,8 +1,12 @@
 module github.com/ubuntu/gowsl
 
-go 1.18
+go 1.21
 
-require golang.org/x/sys v0.1.0
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/sys v0.1.0
+)
 
 require (
 	github.com/0xrawsec/golang-utils v1.3.2
@@ -0,0 +1,188 @@
+package gowsl
+
+// This file contains utilities to intercept the launch of commands.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Interceptor is called around the Start and Wait methods of every Cmd, so that
+// launching commands can be logged, timed, denied, or rewritten in one place.
+//
+// It is called twice for every command: around Start, with PhaseStart, and
+// around Wait, with PhaseWait. Calling next proceeds with the next interceptor
+// in the chain, or with the call itself after the last one. An interceptor that
+// does not call next prevents the call, and the error it returns is returned by
+// Start or Wait instead. The context is the one the command was created with.
+//
+// Only starting a command can be prevented: once it started, it is waited for
+// even if an interceptor does not call next, so that its process is released.
+//
+// Interceptors are called concurrently for commands that run concurrently.
+type Interceptor func(ctx context.Context, phase CmdPhase, cmd *Cmd, next func() error) error
+
+// CmdPhase is the method of Cmd that an Interceptor is called around.
+type CmdPhase int
+
+const (
+	// PhaseStart is the phase of Start, before the command is launched.
+	PhaseStart CmdPhase = iota
+	// PhaseWait is the phase of Wait, once the command was launched.
+	PhaseWait
+)
+
+// String returns the name of the phase, such as "Start".
+func (p CmdPhase) String() string {
+	switch p {
+	case PhaseStart:
+		return "Start"
+	case PhaseWait:
+		return "Wait"
+	default:
+		return fmt.Sprintf("CmdPhase(%d)", int(p))
+	}
+}
+
+// registeredInterceptor is an interceptor, along with an ID to remove it, as
+// functions cannot be compared.
+type registeredInterceptor struct {
+	id        uint64
+	intercept Interceptor
+}
+
+var interceptors = struct {
+	mu        sync.RWMutex
+	lastID    uint64
+	global    []registeredInterceptor
+	perDistro map[string][]registeredInterceptor
+}{
+	perDistro: make(map[string][]registeredInterceptor),
+}
+
+// AddInterceptor registers an interceptor for the commands launched into any
+// distro. Interceptors are called in the order they were added, and those
+// added this way are called before those added to a particular distro.
+//
+// The returned function removes the interceptor.
+func AddInterceptor(i Interceptor) (remove func()) {
+	return addInterceptor("", true, i)
+}
+
+// AddInterceptor registers an interceptor for the commands launched into this
+// distro. Interceptors are called in the order they were added, after those
+// added for all distros. They apply to any Distro with the same name.
+//
+// The returned function removes the interceptor.
+func (d Distro) AddInterceptor(i Interceptor) (remove func()) {
+	return addInterceptor(d.Name(), false, i)
+}
+
+func addInterceptor(distroName string, global bool, i Interceptor) (remove func()) {
+	if i == nil {
+		panic("nil Interceptor")
+	}
+
+	interceptors.mu.Lock()
+	defer interceptors.mu.Unlock()
+
+	interceptors.lastID++
+	id := interceptors.lastID
+
+	r := registeredInterceptor{id: id, intercept: i}
+	if global {
+		interceptors.global = append(interceptors.global, r)
+	} else {
+		interceptors.perDistro[distroName] = append(interceptors.perDistro[distroName], r)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			interceptors.mu.Lock()
+			defer interceptors.mu.Unlock()
+
+			if global {
+				interceptors.global = withoutInterceptor(interceptors.global, id)
+				return
+			}
+
+			remaining := withoutInterceptor(interceptors.perDistro[distroName], id)
+			if len(remaining) == 0 {
+				delete(interceptors.perDistro, distroName)
+				return
+			}
+			interceptors.perDistro[distroName] = remaining
+		})
+	}
+}
+
+// withoutInterceptor returns a copy of the list without the interceptor with
+// the given ID. The list is not modified in place, as it may be in use.
+func withoutInterceptor(list []registeredInterceptor, id uint64) []registeredInterceptor {
+	out := make([]registeredInterceptor, 0, len(list))
+	for _, r := range list {
+		if r.id != id {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// interceptorChain returns the interceptors for the distro, in the order they
+// must be called.
+func interceptorChain(distroName string) []Interceptor {
+	interceptors.mu.RLock()
+	defer interceptors.mu.RUnlock()
+
+	global := interceptors.global
+	local := interceptors.perDistro[distroName]
+
+	chain := make([]Interceptor, 0, len(global)+len(local))
+	for _, r := range global {
+		chain = append(chain, r.intercept)
+	}
+	for _, r := range local {
+		chain = append(chain, r.intercept)
+	}
+	return chain
+}
+
+// intercept makes the call through the chain of interceptors of the command.
+func (c *Cmd) intercept(phase CmdPhase, call func() error) error {
+	chain := interceptorChain(c.distro.Name())
+
+	ctx := c.contextOrBackground()
+
+	next := call
+	for i := len(chain) - 1; i >= 0; i-- {
+		intercept, inner := chain[i], next
+		next = func() error {
+			return intercept(ctx, phase, c, inner)
+		}
+	}
+
+	return next()
+}
+
+// Command returns the command that is launched into the distro.
+func (c *Cmd) Command() string {
+	return c.command
+}
+
+// SetCommand replaces the command that is launched into the distro. It is meant
+// for interceptors, to rewrite commands before they start.
+func (c *Cmd) SetCommand(cmd string) error {
+	if c.Process != nil {
+		return errors.New("wsl: already started")
+	}
+	c.command = cmd
+	return nil
+}
+
+// Distro returns the distro that the command is launched into.
+func (c *Cmd) Distro() Distro {
+	return *c.distro
+}
@@ -0,0 +1,120 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptor(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+	defer keepAwake(t, context.Background(), &d)()
+
+	errDenied := errors.New("denied by policy")
+
+	testCases := map[string]struct {
+		command string
+		denyAt  wsl.CmdPhase
+		deny    bool
+
+		wantPhases []wsl.CmdPhase
+		wantOutput string
+		wantErr    error
+	}{
+		"success":                        {command: "echo hello", wantPhases: []wsl.CmdPhase{wsl.PhaseStart, wsl.PhaseWait}, wantOutput: "hello\n"},
+		"success rewriting commands":     {command: "echo REWRITE", wantPhases: []wsl.CmdPhase{wsl.PhaseStart, wsl.PhaseWait}, wantOutput: "rewritten\n"},
+		"error when denied at start":     {command: "echo hello", deny: true, denyAt: wsl.PhaseStart, wantPhases: []wsl.CmdPhase{wsl.PhaseStart}, wantErr: errDenied},
+		"error when denied at wait":      {command: "echo hello", deny: true, denyAt: wsl.PhaseWait, wantPhases: []wsl.CmdPhase{wsl.PhaseStart, wsl.PhaseWait}, wantErr: errDenied},
+		"error from the command is seen": {command: "exit 3", wantPhases: []wsl.CmdPhase{wsl.PhaseStart, wsl.PhaseWait}, wantErr: &wsl.ExitError{}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var phases []wsl.CmdPhase
+			var gotErr error
+
+			remove := d.AddInterceptor(func(ctx context.Context, phase wsl.CmdPhase, cmd *wsl.Cmd, next func() error) error {
+				require.Equal(t, d.Name(), cmd.Distro().Name(), "Interceptor received a command from the wrong distro")
+
+				phases = append(phases, phase)
+
+				if tc.deny && phase == tc.denyAt {
+					return errDenied
+				}
+
+				if phase == wsl.PhaseStart && strings.Contains(cmd.Command(), "REWRITE") {
+					require.NoError(t, cmd.SetCommand("echo rewritten"), "SetCommand should not fail before the command starts")
+				}
+				if phase == wsl.PhaseWait {
+					require.Error(t, cmd.SetCommand("echo too late"), "SetCommand should fail once the command started")
+				}
+
+				err := next()
+				if phase == wsl.PhaseWait {
+					gotErr = err
+				}
+				return err
+			})
+			defer remove()
+
+			cmd := d.Command(context.Background(), tc.command)
+			out, err := cmd.Output()
+
+			require.Equal(t, tc.wantPhases, phases, "Unexpected calls to the interceptor")
+
+			if tc.wantErr == nil {
+				require.NoError(t, err, "Output should not have failed")
+				require.Equal(t, tc.wantOutput, string(out), "Unexpected output")
+				return
+			}
+
+			require.Error(t, err, "Output should have failed")
+			if errors.Is(tc.wantErr, errDenied) {
+				require.ErrorIs(t, err, errDenied, "Output should return the error of the interceptor")
+				if tc.denyAt == wsl.PhaseWait {
+					require.NotNil(t, cmd.ProcessState, "The command should have been waited for even if denied")
+				}
+				return
+			}
+
+			var target *wsl.ExitError
+			require.ErrorAs(t, err, &target, "Output should return an ExitError")
+			require.ErrorAs(t, gotErr, &target, "The interceptor should see the ExitError")
+		})
+	}
+}
+
+func TestInterceptorIsPerDistro(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+	other := wsl.NewDistro(uniqueDistroName(t))
+
+	defer keepAwake(t, context.Background(), &d)()
+
+	remove := other.AddInterceptor(func(ctx context.Context, phase wsl.CmdPhase, cmd *wsl.Cmd, next func() error) error {
+		return errors.New("this interceptor belongs to another distro")
+	})
+	defer remove()
+
+	out, err := d.Command(context.Background(), "echo hello").Output()
+	require.NoError(t, err, "Command should not be intercepted by the interceptors of other distros")
+	require.Equal(t, "hello\n", string(out), "Unexpected output")
+
+	// Other instances of the same distro share its interceptors
+	same := wsl.NewDistro(d.Name())
+	removeDeny := same.AddInterceptor(func(ctx context.Context, phase wsl.CmdPhase, cmd *wsl.Cmd, next func() error) error {
+		return errors.New("denied")
+	})
+
+	err = d.Command(context.Background(), "echo hello").Run()
+	require.Error(t, err, "Command should be intercepted by the interceptors of the distro with the same name")
+
+	removeDeny()
+	err = d.Command(context.Background(), "echo hello").Run()
+	require.NoError(t, err, "Command should not be intercepted once the interceptor is removed")
+}
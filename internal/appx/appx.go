@@ -0,0 +1,296 @@
+// Package appx reads the packages of distros from the Microsoft Store, which are
+// zip archives in the .appx format, or bundles of them in the .appxbundle format.
+package appx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Names of the manifests in packages and bundles.
+const (
+	packageManifest = "AppxManifest.xml"
+	bundleManifest  = "AppxMetadata/AppxBundleManifest.xml"
+)
+
+// Metadata describes a distro package.
+type Metadata struct {
+	// Name is the identity of the package, such as CanonicalGroupLimited.Ubuntu22.04LTS.
+	Name string
+	// DisplayName is the name of the package shown to users, such as Ubuntu 22.04 LTS.
+	DisplayName string
+	// Version is the version of the package, such as 2204.1.7.0.
+	Version string
+	// Publisher is the subject of the certificate of the publisher, such as CN=Canonical.
+	Publisher string
+	// PublisherDisplayName is the name of the publisher shown to users.
+	PublisherDisplayName string
+	// Architecture is the architecture of the package, in the terms of GOARCH, or
+	// "neutral".
+	Architecture string
+	// Launcher is the name of the executable that launches the distro, such as
+	// ubuntu2204.exe.
+	Launcher string
+}
+
+// Options tweak how packages are opened.
+type Options struct {
+	// Architecture selects the package among those of a bundle, in the terms of
+	// GOARCH. It defaults to runtime.GOARCH.
+	Architecture string
+}
+
+// Package is an open distro package.
+type Package struct {
+	Metadata
+
+	rootfs  *zip.File
+	f       *os.File
+	cleanup func()
+}
+
+// Open opens the distro package at p, be it a package or a bundle of packages, in
+// which case the package for the architecture is picked.
+func Open(p string, opts Options) (_ *Package, err error) {
+	if opts.Architecture == "" {
+		opts.Architecture = runtime.GOARCH
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &Package{f: f, cleanup: func() {}}
+	defer func() {
+		if err != nil {
+			pkg.Close()
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("not a distro package: %v", err)
+	}
+
+	if zf := find(zr, bundleManifest); zf != nil {
+		if zr, err = pkg.openInner(zr, zf, opts.Architecture); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pkg.read(zr); err != nil {
+		return nil, err
+	}
+	if pkg.Architecture != opts.Architecture && pkg.Architecture != "neutral" {
+		return nil, fmt.Errorf("the package is for %s, not for %s", pkg.Architecture, opts.Architecture)
+	}
+	return pkg, nil
+}
+
+// Rootfs returns the tarball with the root filesystem of the distro.
+func (p *Package) Rootfs() (io.ReadCloser, error) {
+	return p.rootfs.Open()
+}
+
+// Close closes the package.
+func (p *Package) Close() error {
+	err := p.f.Close()
+	p.cleanup()
+	return err
+}
+
+// bundle is the manifest of a bundle.
+// See https://learn.microsoft.com/uwp/schemas/bundlemanifestschema/bundle-manifest.
+type bundle struct {
+	Packages []struct {
+		Type         string `xml:"Type,attr"`
+		Architecture string `xml:"Architecture,attr"`
+		FileName     string `xml:"FileName,attr"`
+	} `xml:"Packages>Package"`
+}
+
+// openInner opens the package of the bundle for the architecture.
+func (p *Package) openInner(zr *zip.Reader, manifest *zip.File, arch string) (*zip.Reader, error) {
+	var b bundle
+	if err := readXML(manifest, &b); err != nil {
+		return nil, err
+	}
+
+	var name string
+	var found []string
+	for _, pkg := range b.Packages {
+		if pkg.Type != "application" {
+			// Resource packages only contain translations and images.
+			continue
+		}
+		a := goArch(pkg.Architecture)
+		found = append(found, a)
+		if a == arch || (a == "neutral" && name == "") {
+			name = pkg.FileName
+		}
+	}
+	if name == "" {
+		sort.Strings(found)
+		return nil, fmt.Errorf("the bundle has no package for %s, only for: %s", arch, strings.Join(found, ", "))
+	}
+
+	zf := find(zr, name)
+	if zf == nil {
+		return nil, fmt.Errorf("the bundle has no %s, despite its manifest", name)
+	}
+
+	// Packages are usually stored as is in bundles, and can be read in place.
+	if zf.Method == zip.Store {
+		offset, err := zf.DataOffset()
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", name, err)
+		}
+		size := int64(zf.UncompressedSize64)
+		inner, err := zip.NewReader(io.NewSectionReader(p.f, offset, size), size)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", name, err)
+		}
+		return inner, nil
+	}
+
+	return p.spool(zf)
+}
+
+// spool decompresses the package of a bundle into a temporary file, which is
+// removed once the package is closed.
+func (p *Package) spool(zf *zip.File) (*zip.Reader, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", zf.Name, err)
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp("", "gowsl-package-*.appx")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary file: %v", err)
+	}
+	bundle := p.f
+	p.f = tmp
+	p.cleanup = func() { os.Remove(tmp.Name()) }
+	defer bundle.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, fmt.Errorf("could not extract %s: %v", zf.Name, err)
+	}
+	inner, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", zf.Name, err)
+	}
+	return inner, nil
+}
+
+// manifest is the manifest of a package.
+// See https://learn.microsoft.com/uwp/schemas/appxpackage/appx-package-manifest.
+type manifest struct {
+	Identity struct {
+		Name                  string `xml:"Name,attr"`
+		Publisher             string `xml:"Publisher,attr"`
+		Version               string `xml:"Version,attr"`
+		ProcessorArchitecture string `xml:"ProcessorArchitecture,attr"`
+	} `xml:"Identity"`
+	Properties struct {
+		DisplayName          string `xml:"DisplayName"`
+		PublisherDisplayName string `xml:"PublisherDisplayName"`
+	} `xml:"Properties"`
+	Applications []struct {
+		Executable string `xml:"Executable,attr"`
+	} `xml:"Applications>Application"`
+}
+
+// read reads the metadata of the package, and finds its rootfs.
+func (p *Package) read(zr *zip.Reader) error {
+	zf := find(zr, packageManifest)
+	if zf == nil {
+		return fmt.Errorf("not a distro package: there is neither %s nor %s", packageManifest, bundleManifest)
+	}
+
+	var m manifest
+	if err := readXML(zf, &m); err != nil {
+		return err
+	}
+
+	p.Metadata = Metadata{
+		Name:                 m.Identity.Name,
+		DisplayName:          m.Properties.DisplayName,
+		Version:              m.Identity.Version,
+		Publisher:            m.Identity.Publisher,
+		PublisherDisplayName: m.Properties.PublisherDisplayName,
+		Architecture:         goArch(m.Identity.ProcessorArchitecture),
+	}
+	if len(m.Applications) > 0 {
+		p.Launcher = path.Base(strings.ReplaceAll(m.Applications[0].Executable, `\`, "/"))
+	}
+
+	// The rootfs is usually install.tar.gz, but some packages compress it otherwise.
+	for _, zf := range zr.File {
+		if zf.Name == "install.tar.gz" {
+			p.rootfs = zf
+			return nil
+		}
+		if p.rootfs == nil && strings.HasPrefix(zf.Name, "install.tar") {
+			p.rootfs = zf
+		}
+	}
+	if p.rootfs == nil {
+		return errors.New("not a distro package: there is no install.tar.gz")
+	}
+	return nil
+}
+
+// readXML parses the XML document in zf into v.
+func readXML(zf *zip.File, v any) error {
+	r, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", zf.Name, err)
+	}
+	defer r.Close()
+
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("could not parse %s: %v", zf.Name, err)
+	}
+	return nil
+}
+
+// find returns the file of the archive with the given name, or nil. Names are case
+// insensitive, as on Windows.
+func find(zr *zip.Reader, name string) *zip.File {
+	for _, zf := range zr.File {
+		if strings.EqualFold(zf.Name, name) {
+			return zf
+		}
+	}
+	return nil
+}
+
+// goArch returns the architecture of a manifest in the terms of GOARCH.
+func goArch(arch string) string {
+	switch a := strings.ToLower(arch); a {
+	case "x86":
+		return "386"
+	case "x64":
+		return "amd64"
+	case "":
+		return "neutral"
+	default:
+		// arm, arm64 and neutral are the same.
+		return a
+	}
+}
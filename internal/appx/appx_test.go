@@ -0,0 +1,211 @@
+package appx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/appx"
+)
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	ubuntu := appx.Metadata{
+		Name:                 "CanonicalGroupLimited.Ubuntu22.04LTS",
+		DisplayName:          "Ubuntu 22.04 LTS",
+		Version:              "2204.1.7.0",
+		Publisher:            "CN=23596F84-C3EA-4CD8-A7DF-550DCE37BCD0",
+		PublisherDisplayName: "Canonical Group Limited",
+		Architecture:         "amd64",
+		Launcher:             "ubuntu2204.exe",
+	}
+	arm64 := ubuntu
+	arm64.Architecture = "arm64"
+	neutral := ubuntu
+	neutral.Architecture = "neutral"
+
+	testCases := map[string]struct {
+		kind string // Kind of package, see writePackage
+		arch string
+
+		want       appx.Metadata
+		wantRootfs string
+		wantErr    bool
+	}{
+		"from a package":                          {kind: "appx", want: ubuntu, wantRootfs: "rootfs x64"},
+		"from a package for any architecture":     {kind: "appx-neutral", want: neutral, wantRootfs: "rootfs neutral"},
+		"from a package with an xz rootfs":        {kind: "appx-xz", want: ubuntu, wantRootfs: "xz rootfs x64"},
+		"from a bundle":                           {kind: "bundle", want: ubuntu, wantRootfs: "rootfs x64"},
+		"from a bundle for another architecture":  {kind: "bundle", arch: "arm64", want: arm64, wantRootfs: "rootfs arm64"},
+		"from a bundle with compressed packages":  {kind: "bundle-deflated", arch: "arm64", want: arm64, wantRootfs: "rootfs arm64"},
+		"from a bundle with a neutral package":    {kind: "bundle-neutral", arch: "arm64", want: neutral, wantRootfs: "rootfs neutral"},
+		"from a bundle with a lowercase manifest": {kind: "bundle-lowercase", want: ubuntu, wantRootfs: "rootfs x64"},
+
+		"error when the package is for another architecture":        {kind: "appx", arch: "arm64", wantErr: true},
+		"error when the bundle has no package for the architecture": {kind: "bundle", arch: "386", wantErr: true},
+		"error when the bundle lacks a package of its manifest":     {kind: "bundle-missing", wantErr: true},
+		"error when the package has no rootfs":                      {kind: "appx-no-rootfs", wantErr: true},
+		"error when the manifest is broken":                         {kind: "appx-broken-manifest", wantErr: true},
+		"error when it is a zip archive without manifest":           {kind: "zip", wantErr: true},
+		"error when it is not a zip archive":                        {kind: "not-zip", wantErr: true},
+		"error when it does not exist":                              {kind: "inexistent", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.arch == "" {
+				tc.arch = "amd64"
+			}
+
+			p := writePackage(t, tc.kind)
+
+			pkg, err := appx.Open(p, appx.Options{Architecture: tc.arch})
+			if tc.wantErr {
+				require.Error(t, err, "Open should have failed")
+				return
+			}
+			require.NoError(t, err, "Open should not have failed")
+			defer pkg.Close()
+
+			require.Equal(t, tc.want, pkg.Metadata, "Unexpected metadata")
+
+			r, err := pkg.Rootfs()
+			require.NoError(t, err, "Rootfs should not have failed")
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err, "The rootfs should be readable")
+			require.Equal(t, tc.wantRootfs, string(got), "Unexpected rootfs")
+		})
+	}
+}
+
+// writePackage writes a distro package of the given kind, and returns its path.
+func writePackage(t *testing.T, kind string) string {
+	t.Helper()
+
+	var data []byte
+	switch kind {
+	case "appx":
+		data = makePackage(t, "x64", "install.tar.gz")
+	case "appx-neutral":
+		data = makePackage(t, "neutral", "install.tar.gz")
+	case "appx-xz":
+		data = makePackage(t, "x64", "install.tar.xz")
+	case "appx-no-rootfs":
+		data = makePackage(t, "x64", "")
+	case "appx-broken-manifest":
+		data = makeZip(t, zip.Deflate, map[string][]byte{"AppxManifest.xml": []byte("<Package><Identity"), "install.tar.gz": nil})
+	case "bundle", "bundle-deflated", "bundle-missing", "bundle-lowercase":
+		method := zip.Store
+		if kind == "bundle-deflated" {
+			method = zip.Deflate
+		}
+		manifestName := "AppxMetadata/AppxBundleManifest.xml"
+		if kind == "bundle-lowercase" {
+			manifestName = "appxmetadata/appxbundlemanifest.xml"
+		}
+		files := map[string][]byte{
+			manifestName:                         bundleManifest("x64", "ARM64"),
+			"Ubuntu_2204.1.7.0_x64.appx":         makePackage(t, "x64", "install.tar.gz"),
+			"Ubuntu_2204.1.7.0_ARM64.appx":       makePackage(t, "arm64", "install.tar.gz"),
+			"Ubuntu_2204.1.7.0_language-fr.appx": []byte("resources"),
+		}
+		if kind == "bundle-missing" {
+			delete(files, "Ubuntu_2204.1.7.0_x64.appx")
+		}
+		data = makeZip(t, method, files)
+	case "bundle-neutral":
+		data = makeZip(t, zip.Store, map[string][]byte{
+			"AppxMetadata/AppxBundleManifest.xml": bundleManifest("x64", "neutral"),
+			"Ubuntu_2204.1.7.0_x64.appx":          makePackage(t, "x64", "install.tar.gz"),
+			"Ubuntu_2204.1.7.0_neutral.appx":      makePackage(t, "neutral", "install.tar.gz"),
+		})
+	case "zip":
+		data = makeZip(t, zip.Deflate, map[string][]byte{"install.tar.gz": []byte("rootfs")})
+	case "not-zip":
+		data = []byte("I am not a zip archive")
+	case "inexistent":
+		return filepath.Join(t.TempDir(), "inexistent.appx")
+	default:
+		require.Failf(t, "Setup: unknown kind of package", "%q", kind)
+	}
+
+	p := filepath.Join(t.TempDir(), "Ubuntu.appxbundle")
+	require.NoError(t, os.WriteFile(p, data, 0600), "Setup: could not write package")
+	return p
+}
+
+// makePackage returns a package for the architecture, with a fake rootfs named
+// after it, or without rootfs if its name is empty.
+func makePackage(t *testing.T, arch, rootfs string) []byte {
+	t.Helper()
+
+	manifest := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10" xmlns:uap="http://schemas.microsoft.com/appx/manifest/uap/windows10">
+  <Identity Name="CanonicalGroupLimited.Ubuntu22.04LTS" Publisher="CN=23596F84-C3EA-4CD8-A7DF-550DCE37BCD0" Version="2204.1.7.0" ProcessorArchitecture="%s"/>
+  <Properties>
+    <DisplayName>Ubuntu 22.04 LTS</DisplayName>
+    <PublisherDisplayName>Canonical Group Limited</PublisherDisplayName>
+  </Properties>
+  <Applications>
+    <Application Id="ubuntu2204" Executable="ubuntu2204.exe" EntryPoint="Windows.FullTrustApplication">
+      <uap:VisualElements DisplayName="Ubuntu 22.04 LTS"/>
+    </Application>
+  </Applications>
+</Package>`, arch)
+
+	files := map[string][]byte{
+		"AppxManifest.xml": []byte(manifest),
+		"ubuntu2204.exe":   []byte("launcher"),
+	}
+	if rootfs != "" {
+		contents := "rootfs " + arch
+		if rootfs != "install.tar.gz" {
+			contents = "xz " + contents
+		}
+		files[rootfs] = []byte(contents)
+	}
+	return makeZip(t, zip.Deflate, files)
+}
+
+// bundleManifest returns the manifest of a bundle with packages for the architectures.
+func bundleManifest(archs ...string) []byte {
+	var packages string
+	for _, a := range archs {
+		packages += fmt.Sprintf(`    <Package Type="application" Version="2204.1.7.0" Architecture="%s" FileName="Ubuntu_2204.1.7.0_%s.appx"/>
+`, a, a)
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<Bundle xmlns="http://schemas.microsoft.com/appx/2013/bundle" SchemaVersion="4.0">
+  <Identity Name="CanonicalGroupLimited.Ubuntu22.04LTS" Publisher="CN=23596F84-C3EA-4CD8-A7DF-550DCE37BCD0" Version="2204.1.7.0"/>
+  <Packages>
+%s    <Package Type="resource" Version="2204.1.7.0" FileName="Ubuntu_2204.1.7.0_language-fr.appx"/>
+  </Packages>
+</Bundle>`, packages))
+}
+
+// makeZip returns a zip archive with the given files, compressed with method.
+func makeZip(t *testing.T, method uint16, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		require.NoError(t, err, "Setup: could not write zip archive")
+		_, err = w.Write(data)
+		require.NoError(t, err, "Setup: could not write zip archive")
+	}
+	require.NoError(t, zw.Close(), "Setup: could not write zip archive")
+	return buf.Bytes()
+}
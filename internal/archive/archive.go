@@ -0,0 +1,317 @@
+// Package archive streams files and directories to and from tar archives,
+// preserving their metadata.
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileError is the error of a single file that could not be archived or extracted.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Options tweak how archives are written and extracted.
+type Options struct {
+	// Owner overrides the owner of every file written to the archive. When nil,
+	// the owner of the local file is used, if the platform has one.
+	Owner *Owner
+
+	// Progress is called after every file has been archived or extracted.
+	Progress func(path string, size int64)
+}
+
+// Owner is the user and group owning a file.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// Pack writes a tar archive with every source to w. Directories are archived
+// recursively. Each source is stored under its base name.
+//
+// Files that cannot be read are skipped and returned as FileErrors. The error
+// is only set when the archive itself cannot be written.
+func Pack(w io.Writer, sources []string, opts Options) ([]FileError, error) {
+	tw := tar.NewWriter(w)
+	var fileErrs []FileError
+
+	for _, src := range sources {
+		src = filepath.Clean(src)
+		parent := filepath.Dir(src)
+
+		err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				fileErrs = append(fileErrs, FileError{Path: p, Err: err})
+				return nil
+			}
+
+			rel, err := filepath.Rel(parent, p)
+			if err != nil {
+				fileErrs = append(fileErrs, FileError{Path: p, Err: err})
+				return nil
+			}
+
+			if err := packEntry(tw, p, filepath.ToSlash(rel), info, opts); err != nil {
+				var fileErr FileError
+				if errors.As(err, &fileErr) {
+					fileErrs = append(fileErrs, fileErr)
+					return nil
+				}
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return fileErrs, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fileErrs, fmt.Errorf("could not finish archive: %v", err)
+	}
+	return fileErrs, nil
+}
+
+// packEntry writes a single file into the archive. Errors reading the local
+// file are returned as FileError, and errors writing to the archive are not.
+func packEntry(tw *tar.Writer, p, name string, info os.FileInfo, opts Options) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		l, err := os.Readlink(p)
+		if err != nil {
+			return FileError{Path: p, Err: err}
+		}
+		link = filepath.ToSlash(l)
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return FileError{Path: p, Err: err}
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if opts.Owner != nil {
+		hdr.Uid = opts.Owner.UID
+		hdr.Gid = opts.Owner.GID
+		hdr.Uname = ""
+		hdr.Gname = ""
+	}
+
+	// Only regular files have contents
+	var f *os.File
+	if hdr.Typeflag == tar.TypeReg {
+		f, err = os.Open(p)
+		if err != nil {
+			return FileError{Path: p, Err: err}
+		}
+		defer f.Close()
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("could not write header for %q: %v", name, err)
+	}
+
+	if f != nil {
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("could not write contents of %q: %v", name, err)
+		}
+	}
+
+	if opts.Progress != nil {
+		opts.Progress(name, hdr.Size)
+	}
+	return nil
+}
+
+// Unpack extracts the tar archive read from r into the directory dest, which
+// is created if needed. Permissions, modification times and symbolic links are
+// preserved. Owners are preserved as well when running as root.
+//
+// Entries that cannot be extracted are skipped and returned as FileErrors.
+// The error is only set when the archive itself cannot be read.
+func Unpack(r io.Reader, dest string, opts Options) ([]FileError, error) {
+	if err := os.MkdirAll(dest, 0750); err != nil {
+		return nil, fmt.Errorf("could not create destination: %v", err)
+	}
+
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+	var fileErrs []FileError
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fileErrs, fmt.Errorf("could not read archive: %v", err)
+		}
+
+		target, err := localPath(dest, hdr.Name)
+		if err != nil {
+			fileErrs = append(fileErrs, FileError{Path: hdr.Name, Err: err})
+			continue
+		}
+
+		if err := unpackEntry(tr, hdr, dest, target); err != nil {
+			fileErrs = append(fileErrs, FileError{Path: hdr.Name, Err: err})
+			continue
+		}
+
+		// Directory times are set at the end, as extracting their contents changes them.
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTime{path: target, mtime: hdr.ModTime})
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(hdr.Name, hdr.Size)
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime); err != nil {
+			fileErrs = append(fileErrs, FileError{Path: dirs[i].path, Err: err})
+		}
+	}
+
+	return fileErrs, nil
+}
+
+// localPath finds where an entry must be extracted, refusing to go outside dest,
+// be it with a path that is not local or through a symbolic link extracted before.
+func localPath(dest, name string) (string, error) {
+	// Backslashes are not separators in Linux names, but they are on Windows once
+	// joined, so the name is checked after conversion.
+	p := filepath.FromSlash(path.Clean(name))
+	if !filepath.IsLocal(p) {
+		return "", errors.New("refusing to extract an entry outside of the destination")
+	}
+
+	dir := dest
+	for _, part := range strings.Split(filepath.Dir(p), string(filepath.Separator)) {
+		if part == "." {
+			break
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", errors.New("refusing to extract an entry through a symbolic link")
+		}
+	}
+
+	return filepath.Join(dest, p), nil
+}
+
+// unpackEntry extracts a single entry of the archive.
+func unpackEntry(tr *tar.Reader, hdr *tar.Header, dest, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+		return err
+	}
+
+	// Writing to a symbolic link extracted before would write where it points to.
+	if hdr.Typeflag != tar.TypeSymlink {
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	mode := os.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA: //nolint: staticcheck // TypeRegA is deprecated but still found in old archives
+		if err := writeFile(tr, target, mode); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		os.Remove(target)
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+		return chown(target, hdr)
+	case tar.TypeLink:
+		source, err := localPath(dest, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Link(source, target); err != nil {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported file type %q", hdr.Typeflag)
+	}
+
+	if err := chown(target, hdr); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
+
+// writeFile writes the contents of the entry into a file with the given mode.
+func writeFile(r io.Reader, target string, mode os.FileMode) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The mode passed to OpenFile is affected by the umask and ignored for existing files.
+	return os.Chmod(target, mode)
+}
+
+// chown sets the owner of the file. Only root can give files away, so it does
+// nothing otherwise (which is always the case on Windows).
+func chown(target string, hdr *tar.Header) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(target, hdr.Uid, hdr.Gid)
+}
@@ -0,0 +1,273 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/archive"
+)
+
+func TestPackUnpack(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		sources []string // Relative to the source tree
+
+		wantFiles   []string // Relative to the destination
+		wantMissing []string // Relative to the destination
+	}{
+		"single file":           {sources: []string{"tree/file.txt"}, wantFiles: []string{"file.txt"}},
+		"executable file":       {sources: []string{"tree/script.sh"}, wantFiles: []string{"script.sh"}},
+		"directory":             {sources: []string{"tree"}, wantFiles: []string{"tree", "tree/file.txt", "tree/script.sh", "tree/sub", "tree/sub/nested.txt", "tree/link"}},
+		"symlink":               {sources: []string{"tree/link"}, wantFiles: []string{"link"}},
+		"multiple sources":      {sources: []string{"tree/file.txt", "tree/sub"}, wantFiles: []string{"file.txt", "sub", "sub/nested.txt"}, wantMissing: []string{"script.sh"}},
+		"nested directory only": {sources: []string{"tree/sub"}, wantFiles: []string{"sub", "sub/nested.txt"}, wantMissing: []string{"file.txt"}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			src := t.TempDir()
+			dst := filepath.Join(t.TempDir(), "destination")
+
+			writeTree(t, src, mtime)
+
+			var sources []string
+			for _, s := range tc.sources {
+				sources = append(sources, filepath.Join(src, filepath.FromSlash(s)))
+			}
+
+			var packed []string
+			var buf bytes.Buffer
+			fileErrs, err := archive.Pack(&buf, sources, archive.Options{
+				Progress: func(p string, _ int64) { packed = append(packed, p) },
+			})
+			require.NoError(t, err, "Pack should not return an error")
+			require.Empty(t, fileErrs, "Pack should not return file errors")
+
+			var unpacked []string
+			fileErrs, err = archive.Unpack(&buf, dst, archive.Options{
+				Progress: func(p string, _ int64) { unpacked = append(unpacked, p) },
+			})
+			require.NoError(t, err, "Unpack should not return an error")
+			require.Empty(t, fileErrs, "Unpack should not return file errors")
+
+			require.Len(t, packed, len(tc.wantFiles), "Progress should be reported for every packed file")
+			require.Len(t, unpacked, len(tc.wantFiles), "Progress should be reported for every unpacked file")
+
+			srcRoot := filepath.Join(src, filepath.Dir(filepath.FromSlash(tc.sources[0])))
+			for _, f := range tc.wantFiles {
+				requireSameFile(t, filepath.Join(srcRoot, filepath.FromSlash(f)), filepath.Join(dst, filepath.FromSlash(f)))
+			}
+			for _, f := range tc.wantMissing {
+				require.NoFileExists(t, filepath.Join(dst, filepath.FromSlash(f)), "Unexpected file in destination")
+			}
+		})
+	}
+}
+
+func TestPackOwner(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	writeTree(t, src, time.Now())
+
+	var buf bytes.Buffer
+	_, err := archive.Pack(&buf, []string{filepath.Join(src, "tree")}, archive.Options{
+		Owner: &archive.Owner{UID: 1234, GID: 5678},
+	})
+	require.NoError(t, err, "Pack should not return an error")
+
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		require.Equal(t, 1234, hdr.Uid, "Unexpected owner for %q", hdr.Name)
+		require.Equal(t, 5678, hdr.Gid, "Unexpected group for %q", hdr.Name)
+	}
+}
+
+func TestPackMissingSource(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	writeTree(t, src, time.Now())
+
+	var buf bytes.Buffer
+	fileErrs, err := archive.Pack(&buf, []string{filepath.Join(src, "tree", "file.txt"), filepath.Join(src, "missing")}, archive.Options{})
+	require.NoError(t, err, "Pack should not fail because of a single file")
+	require.Len(t, fileErrs, 1, "Pack should return one file error")
+	require.Equal(t, filepath.Join(src, "missing"), fileErrs[0].Path, "Unexpected path in file error")
+	require.ErrorIs(t, fileErrs[0], os.ErrNotExist, "Unexpected error in file error")
+
+	// The rest of the archive is still usable
+	dst := t.TempDir()
+	fileErrs, err = archive.Unpack(&buf, dst, archive.Options{})
+	require.NoError(t, err, "Unpack should not return an error")
+	require.Empty(t, fileErrs, "Unpack should not return file errors")
+	require.FileExists(t, filepath.Join(dst, "file.txt"), "Valid file should have been copied")
+}
+
+func TestUnpackUnsafe(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		name     string
+		linkname string
+		typeflag byte
+	}{
+		"parent directory":    {name: "../escaped.txt", typeflag: tar.TypeReg},
+		"nested parent":       {name: "a/../../escaped.txt", typeflag: tar.TypeReg},
+		"absolute path":       {name: "/escaped.txt", typeflag: tar.TypeReg},
+		"hard link outside":   {name: "link", linkname: "../escaped.txt", typeflag: tar.TypeLink},
+		"unsupported devices": {name: "device", typeflag: tar.TypeChar},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: tc.name, Linkname: tc.linkname, Typeflag: tc.typeflag, Mode: 0600}), "Setup: could not write header")
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: "good.txt", Typeflag: tar.TypeReg, Mode: 0600}), "Setup: could not write header")
+			require.NoError(t, tw.Close(), "Setup: could not close archive")
+
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			fileErrs, err := archive.Unpack(&buf, dst, archive.Options{})
+			require.NoError(t, err, "Unpack should not fail because of a single entry")
+			require.Len(t, fileErrs, 1, "Unpack should return one file error")
+			require.Equal(t, tc.name, fileErrs[0].Path, "Unexpected path in file error")
+
+			require.NoFileExists(t, filepath.Join(parent, "escaped.txt"), "Entry escaped the destination")
+			require.FileExists(t, filepath.Join(dst, "good.txt"), "Valid entry should have been extracted")
+		})
+	}
+}
+
+func TestUnpackThroughSymlinks(t *testing.T) {
+	t.Parallel()
+
+	// Backslashes are only separators on Windows.
+	backslashErrs := 0
+	if runtime.GOOS == "windows" {
+		backslashErrs = 1
+	}
+
+	testCases := map[string]struct {
+		entries []tar.Header // Entries after link, a symbolic link to the parent of the destination
+
+		wantErrs int
+	}{
+		"file through a symbolic link":           {entries: []tar.Header{{Name: "link/escaped.txt", Typeflag: tar.TypeReg}}, wantErrs: 1},
+		"directory through a symbolic link":      {entries: []tar.Header{{Name: "link/escaped.txt/", Typeflag: tar.TypeDir}}, wantErrs: 1},
+		"hard link through a symbolic link":      {entries: []tar.Header{{Name: "hardlink", Linkname: "link/secret.txt", Typeflag: tar.TypeLink}}, wantErrs: 1},
+		"file replacing a symbolic link":         {entries: []tar.Header{{Name: "link", Typeflag: tar.TypeReg}}},
+		"file through a replaced symbolic link":  {entries: []tar.Header{{Name: "link/", Typeflag: tar.TypeDir}, {Name: "link/escaped.txt", Typeflag: tar.TypeReg}}},
+		"name with backslashes and parent paths": {entries: []tar.Header{{Name: `..\escaped.txt`, Typeflag: tar.TypeReg}}, wantErrs: backslashErrs},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			require.NoError(t, os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0600), "Setup: could not write file")
+
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Linkname: parent, Typeflag: tar.TypeSymlink, Mode: 0777}), "Setup: could not write header")
+			for _, hdr := range tc.entries {
+				hdr := hdr
+				hdr.Mode = 0600
+				require.NoError(t, tw.WriteHeader(&hdr), "Setup: could not write header")
+			}
+			require.NoError(t, tw.Close(), "Setup: could not close archive")
+
+			fileErrs, err := archive.Unpack(&buf, dst, archive.Options{})
+			require.NoError(t, err, "Unpack should not fail because of a single entry")
+			require.Len(t, fileErrs, tc.wantErrs, "Unexpected number of file errors: %v", fileErrs)
+
+			require.NoFileExists(t, filepath.Join(parent, "escaped.txt"), "Entry escaped the destination")
+			require.NoDirExists(t, filepath.Join(parent, "escaped.txt"), "Entry escaped the destination")
+			require.NoFileExists(t, filepath.Join(dst, "hardlink"), "Hard link to a file outside the destination should not have been extracted")
+		})
+	}
+}
+
+func TestUnpackCorrupted(t *testing.T) {
+	t.Parallel()
+
+	_, err := archive.Unpack(bytes.NewBufferString("This is not a tar archive, but it is long enough to look like a header maybe"), t.TempDir(), archive.Options{})
+	require.Error(t, err, "Unpack should fail on a corrupted archive")
+}
+
+// writeTree creates a tree with files, directories and links under dir/tree.
+func writeTree(t *testing.T, dir string, mtime time.Time) {
+	t.Helper()
+
+	root := filepath.Join(dir, "tree")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0750), "Setup: could not create directories")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("Hello, world!\n"), 0640), "Setup: could not write file")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "script.sh"), []byte("#!/bin/sh\necho hi\n"), 0755), "Setup: could not write file") //nolint: gosec // Executable on purpose
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "nested.txt"), []byte("Nested\n"), 0600), "Setup: could not write file")
+	require.NoError(t, os.Chmod(filepath.Join(root, "script.sh"), 0755), "Setup: could not set mode despite umask") //nolint: gosec // Executable on purpose
+	require.NoError(t, os.Symlink("file.txt", filepath.Join(root, "link")), "Setup: could not create symlink")
+
+	for _, p := range []string{"file.txt", "script.sh", "sub/nested.txt", "sub", ""} {
+		require.NoError(t, os.Chtimes(filepath.Join(root, filepath.FromSlash(p)), mtime, mtime), "Setup: could not set times")
+	}
+}
+
+// requireSameFile checks that two files have the same type, mode, contents and modification time.
+func requireSameFile(t *testing.T, want, got string) {
+	t.Helper()
+
+	wantInfo, err := os.Lstat(want)
+	require.NoError(t, err, "Setup: could not stat source")
+	gotInfo, err := os.Lstat(got)
+	require.NoError(t, err, "Could not stat copied file %q", got)
+
+	require.Equal(t, wantInfo.Mode(), gotInfo.Mode(), "Mode of %q was not preserved", got)
+
+	if wantInfo.Mode()&os.ModeSymlink != 0 {
+		wantLink, err := os.Readlink(want)
+		require.NoError(t, err, "Setup: could not read link")
+		gotLink, err := os.Readlink(got)
+		require.NoError(t, err, "Could not read copied link %q", got)
+		require.Equal(t, wantLink, gotLink, "Target of %q was not preserved", got)
+		return
+	}
+
+	require.True(t, wantInfo.ModTime().Equal(gotInfo.ModTime()), "Modification time of %q was not preserved: want %v, got %v", got, wantInfo.ModTime(), gotInfo.ModTime())
+
+	if wantInfo.IsDir() {
+		return
+	}
+
+	wantContents, err := os.ReadFile(want)
+	require.NoError(t, err, "Setup: could not read source")
+	gotContents, err := os.ReadFile(got)
+	require.NoError(t, err, "Could not read copied file %q", got)
+	require.Equal(t, wantContents, gotContents, "Contents of %q were not preserved", got)
+
+	if runtime.GOOS != "windows" && os.Geteuid() == 0 {
+		requireSameOwner(t, wantInfo, gotInfo)
+	}
+}
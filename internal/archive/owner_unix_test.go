@@ -0,0 +1,21 @@
+//go:build !windows
+
+package archive_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireSameOwner checks that two files belong to the same user and group.
+func requireSameOwner(t *testing.T, want, got os.FileInfo) {
+	t.Helper()
+
+	//nolint: forcetypeassert // Always true on Unix
+	wantSys, gotSys := want.Sys().(*syscall.Stat_t), got.Sys().(*syscall.Stat_t)
+	require.Equal(t, wantSys.Uid, gotSys.Uid, "Owner of %q was not preserved", got.Name())
+	require.Equal(t, wantSys.Gid, gotSys.Gid, "Group of %q was not preserved", got.Name())
+}
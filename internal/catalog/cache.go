@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/download"
+	"github.com/ubuntu/gowsl/internal/lockfile"
+)
+
+const (
+	// cacheExt is the extension of the images in the cache, which are named after
+	// their checksum.
+	cacheExt = ".rootfs"
+
+	// lockExt is the extension of the lock files of the images in the cache.
+	lockExt = ".lock"
+
+	// cacheLockName is the name of the lock file of the whole cache.
+	cacheLockName = "cache" + lockExt
+)
+
+// Cache is a directory where the images that are downloaded are kept, to be reused.
+type Cache struct {
+	// Dir is the directory of the cache. It is created when needed.
+	Dir string
+
+	// MaxSize is the size in bytes that the images of the cache are trimmed to
+	// after every download, by removing the least recently used ones. There is no
+	// limit when it is zero or negative.
+	MaxSize int64
+
+	// Download tweaks how images are downloaded.
+	Download download.Options
+}
+
+// Get returns the path of the image, after verifying its checksum. Images with a
+// URL are downloaded into the cache first, unless they are in it already. Cached
+// images that do not match their checksum anymore are downloaded again.
+//
+// The cache can be shared by several processes: it is locked while it is updated,
+// and images are downloaded under another name that is renamed once they are
+// complete. Cached images are not evicted until release is called, which must be
+// done once the image is not used anymore.
+func (c Cache) Get(ctx context.Context, img Image) (path string, release func(), err error) {
+	sum := strings.ToLower(img.SHA256)
+
+	if img.Path != "" {
+		got, err := download.Checksum(img.Path)
+		if err != nil {
+			return "", nil, err
+		}
+		if got != sum {
+			return "", nil, fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", img.Path, sum, got)
+		}
+		return img.Path, func() {}, nil
+	}
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return "", nil, fmt.Errorf("could not create cache directory: %v", err)
+	}
+
+	cacheLock, err := lockfile.Acquire(ctx, filepath.Join(c.Dir, cacheLockName))
+	if err != nil {
+		return "", nil, err
+	}
+	defer cacheLock.Release()
+
+	dst := filepath.Join(c.Dir, sum+cacheExt)
+
+	// Images are locked by those using them, so that trim leaves them alone. They
+	// are only locked under the lock of the cache, which allows trim to remove the
+	// lock files along with the images.
+	imageLock, err := lockfile.AcquireShared(ctx, dst+lockExt)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		if err != nil {
+			imageLock.Release()
+		}
+	}()
+
+	cached := false
+	if _, err := os.Stat(dst); err == nil {
+		got, err := download.Checksum(dst)
+		if err != nil {
+			return "", nil, err
+		}
+		cached = got == sum
+	}
+	if !cached {
+		// The cached image, if any, was corrupted since it was downloaded.
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("could not remove corrupted image from cache: %v", err)
+		}
+		if err := download.Fetch(ctx, img.URL, dst, sum, c.Download); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// The modification time tells which images were used last.
+	now := time.Now()
+	if err := os.Chtimes(dst, now, now); err != nil {
+		return "", nil, fmt.Errorf("could not update cache: %v", err)
+	}
+	if err := c.trim(dst); err != nil {
+		return "", nil, err
+	}
+	return dst, func() { imageLock.Release() }, nil
+}
+
+// trim removes the least recently used images until the cache fits in MaxSize,
+// except for keep, which is about to be used, and for the images that are in use.
+// It must be called with the lock of the cache held.
+func (c Cache) trim(keep string) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return fmt.Errorf("could not read cache: %v", err)
+	}
+
+	var images []os.FileInfo
+	var size int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() || filepath.Ext(e.Name()) != cacheExt {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// The image was removed in the meantime.
+			continue
+		}
+		images = append(images, info)
+		size += info.Size()
+	}
+
+	sort.Slice(images, func(i, j int) bool { return images[i].ModTime().Before(images[j].ModTime()) })
+
+	for _, info := range images {
+		if size <= c.MaxSize {
+			break
+		}
+		p := filepath.Join(c.Dir, info.Name())
+		if p == keep {
+			continue
+		}
+		evicted, err := evict(p)
+		if err != nil {
+			return err
+		}
+		if evicted {
+			size -= info.Size()
+		}
+	}
+	return nil
+}
+
+// evict removes the image at p from the cache, along with its lock file, unless it
+// is in use. It must be called with the lock of the cache held.
+func evict(p string) (bool, error) {
+	l, ok, err := lockfile.TryAcquire(p + lockExt)
+	if err != nil {
+		return false, fmt.Errorf("could not evict image from cache: %v", err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	removeErr := os.Remove(p)
+	// The lock file must be closed before it can be removed on Windows. Nobody can
+	// lock it again in the meantime, as images are locked under the lock of the cache.
+	if err := l.Release(); err != nil {
+		return false, fmt.Errorf("could not evict image from cache: %v", err)
+	}
+	if removeErr != nil && !os.IsNotExist(removeErr) {
+		return false, fmt.Errorf("could not evict image from cache: %v", removeErr)
+	}
+	if err := os.Remove(p + lockExt); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("could not evict image from cache: %v", err)
+	}
+	return true, nil
+}
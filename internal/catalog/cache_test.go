@@ -0,0 +1,204 @@
+package catalog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/catalog"
+	"github.com/ubuntu/gowsl/internal/download"
+)
+
+func TestCacheGet(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("I am a rootfs")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	testCases := map[string]struct {
+		cached    string // Contents of the image in the cache before Get
+		localFile string // Contents of the image on the machine, for images with a path
+		checksum  string
+		cancelled bool
+
+		wantDownloads int
+		wantErr       bool
+	}{
+		"download an image":                    {wantDownloads: 1},
+		"reuse a cached image":                 {cached: string(content)},
+		"download again a corrupted image":     {cached: "corrupted", wantDownloads: 1},
+		"use an image on the machine":          {localFile: string(content)},
+		"error with a corrupted image":         {checksum: hex.EncodeToString(make([]byte, 32)), wantDownloads: 1, wantErr: true},
+		"error with a corrupted image on disk": {localFile: "corrupted", wantErr: true},
+		"error with a cancelled context":       {cancelled: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.checksum == "" {
+				tc.checksum = checksum
+			}
+
+			var downloads atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloads.Add(1)
+				_, _ = w.Write(content)
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+			cache := catalog.Cache{Dir: filepath.Join(dir, "cache"), Download: download.Options{Attempts: 1}}
+			img := catalog.Image{Name: "base", Version: "1", URL: srv.URL, SHA256: tc.checksum}
+
+			if tc.cached != "" {
+				require.NoError(t, os.MkdirAll(cache.Dir, 0700), "Setup: could not create cache")
+				err := os.WriteFile(filepath.Join(cache.Dir, tc.checksum+".rootfs"), []byte(tc.cached), 0600)
+				require.NoError(t, err, "Setup: could not write cached image")
+			}
+			if tc.localFile != "" {
+				img.URL = ""
+				img.Path = filepath.Join(dir, "base.tar.gz")
+				require.NoError(t, os.WriteFile(img.Path, []byte(tc.localFile), 0600), "Setup: could not write image")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			p, release, err := cache.Get(ctx, img)
+			require.Equal(t, tc.wantDownloads, int(downloads.Load()), "Unexpected number of downloads")
+			if tc.wantErr {
+				require.Error(t, err, "Get should have failed")
+				return
+			}
+			require.NoError(t, err, "Get should not have failed")
+			defer release()
+
+			got, err := os.ReadFile(p)
+			require.NoError(t, err, "The image should be readable")
+			require.Equal(t, content, got, "Unexpected contents of the image")
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	images := map[string][]byte{
+		"old":    []byte("0123456789"),
+		"recent": []byte("abcdefghij"),
+		"new":    []byte("ABCDEFGHIJ"),
+	}
+	sums := make(map[string]string)
+	for name, data := range images {
+		sum := sha256.Sum256(data)
+		sums[name] = hex.EncodeToString(sum[:])
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(images[r.URL.Path[1:]])
+	}))
+	defer srv.Close()
+
+	cache := catalog.Cache{Dir: t.TempDir(), MaxSize: 25}
+	get := func(name string) {
+		t.Helper()
+		_, release, err := cache.Get(context.Background(), catalog.Image{Name: name, Version: "1", URL: srv.URL + "/" + name, SHA256: sums[name]})
+		require.NoError(t, err, "Get should not have failed")
+		release()
+	}
+	cached := func(name string) bool {
+		_, err := os.Stat(filepath.Join(cache.Dir, sums[name]+".rootfs"))
+		return err == nil
+	}
+
+	get("old")
+	get("recent")
+	// Using an image again makes it recent.
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(cache.Dir, sums["recent"]+".rootfs"), past, past), "Setup: could not age image")
+	require.NoError(t, os.Chtimes(filepath.Join(cache.Dir, sums["old"]+".rootfs"), past.Add(-time.Minute), past.Add(-time.Minute)), "Setup: could not age image")
+	get("old")
+
+	get("new")
+	require.True(t, cached("new"), "The image that was just downloaded should be cached")
+	require.True(t, cached("old"), "The image that was used recently should be cached")
+	require.False(t, cached("recent"), "The least recently used image should have been evicted")
+
+	// Images bigger than the cache are kept all the same, until the next download.
+	cache.MaxSize = 1
+	get("recent")
+	require.True(t, cached("recent"), "The image that was just downloaded should be cached")
+	require.False(t, cached("old"), "The other images should have been evicted")
+	require.False(t, cached("new"), "The other images should have been evicted")
+
+	// Images that are in use are not evicted until they are released.
+	_, release, err := cache.Get(context.Background(), catalog.Image{Name: "new", Version: "1", URL: srv.URL + "/new", SHA256: sums["new"]})
+	require.NoError(t, err, "Get should not have failed")
+	get("old")
+	require.True(t, cached("new"), "The image that is in use should not have been evicted")
+
+	release()
+	get("recent")
+	require.False(t, cached("new"), "The image that was released should have been evicted")
+	require.False(t, cached("old"), "The other images should have been evicted")
+}
+
+func TestCacheGetConcurrently(t *testing.T) {
+	t.Parallel()
+
+	images := map[string][]byte{
+		"a": bytes.Repeat([]byte("a"), 1<<16),
+		"b": bytes.Repeat([]byte("b"), 1<<16),
+	}
+	sums := make(map[string]string)
+	for name, data := range images {
+		sum := sha256.Sum256(data)
+		sums[name] = hex.EncodeToString(sum[:])
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(images[r.URL.Path[1:]])
+	}))
+	defer srv.Close()
+
+	// The cache only fits one image, so that every Get evicts the other one if it can.
+	cache := catalog.Cache{Dir: t.TempDir(), MaxSize: 1}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		name := "a"
+		if i%2 == 1 {
+			name = "b"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			p, release, err := cache.Get(context.Background(), catalog.Image{Name: name, Version: "1", URL: srv.URL + "/" + name, SHA256: sums[name]})
+			require.NoError(t, err, "Get should not have failed")
+			defer release()
+
+			got, err := os.ReadFile(p)
+			require.NoError(t, err, "The image should be readable until it is released")
+			require.Equal(t, images[name], got, "Unexpected contents of the image")
+		}()
+	}
+	wg.Wait()
+}
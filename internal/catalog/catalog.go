@@ -0,0 +1,188 @@
+// Package catalog reads catalogs of versioned distro images, and caches the images
+// that are downloaded.
+package catalog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Image is an image of a catalog.
+type Image struct {
+	// Name is the name of the image, shared by all of its versions.
+	Name string `json:"name"`
+	// Version is the version of the image. Versions are compared component by
+	// component, numerically when they are numbers, so that 1.10 is after 1.9.
+	Version string `json:"version"`
+
+	// URL is where the image is downloaded from. Exactly one of URL and Path is set.
+	URL string `json:"url,omitempty"`
+	// Path is the path of the image on the machine. Relative paths are relative to
+	// the directory of the catalog.
+	Path string `json:"path,omitempty"`
+	// SHA256 is the checksum of the image, in hexadecimal.
+	SHA256 string `json:"sha256"`
+
+	// DefaultUser is the user that distros run commands as once installed, if set.
+	// The user must exist once the post-install steps are done.
+	DefaultUser string `json:"defaultUser,omitempty"`
+	// PostInstall are commands run in order once the distro is registered, as its
+	// default user: root, unless /etc/wsl.conf sets another one.
+	PostInstall []string `json:"postInstall,omitempty"`
+}
+
+// Catalog is a set of images. Its format is a JSON document such as:
+//
+//	{
+//	  "images": [
+//	    {
+//	      "name": "base",
+//	      "version": "1.2.0",
+//	      "url": "https://example.com/base-1.2.0.tar.gz",
+//	      "sha256": "…",
+//	      "defaultUser": "dev",
+//	      "postInstall": ["useradd -m -s /bin/bash dev"]
+//	    }
+//	  ]
+//	}
+type Catalog struct {
+	Images []Image `json:"images"`
+}
+
+var (
+	nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	userRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+)
+
+// Load reads the catalog in the file at p, and resolves the relative paths of its
+// images against its directory.
+func Load(p string) (Catalog, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return Catalog{}, err
+	}
+	defer f.Close()
+
+	c, err := Parse(f)
+	if err != nil {
+		return Catalog{}, err
+	}
+
+	for i, img := range c.Images {
+		if img.Path != "" && !filepath.IsAbs(img.Path) {
+			c.Images[i].Path = filepath.Join(filepath.Dir(p), img.Path)
+		}
+	}
+	return c, nil
+}
+
+// Parse reads a catalog from r, and validates it.
+func Parse(r io.Reader) (Catalog, error) {
+	var c Catalog
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Catalog{}, fmt.Errorf("could not parse catalog: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, img := range c.Images {
+		if err := img.validate(); err != nil {
+			return Catalog{}, fmt.Errorf("invalid image #%d of the catalog: %v", i+1, err)
+		}
+		ref := img.Name + "@" + img.Version
+		if seen[ref] {
+			return Catalog{}, fmt.Errorf("invalid catalog: image %s is listed more than once", ref)
+		}
+		seen[ref] = true
+	}
+	return c, nil
+}
+
+func (img Image) validate() error {
+	if !nameRegexp.MatchString(img.Name) {
+		return fmt.Errorf("invalid name %q", img.Name)
+	}
+	if img.Version == "" {
+		return fmt.Errorf("image %s has no version", img.Name)
+	}
+	if (img.URL == "") == (img.Path == "") {
+		return fmt.Errorf("image %s must have either a URL or a path", img.Name)
+	}
+	if b, err := hex.DecodeString(img.SHA256); err != nil || len(b) != 32 {
+		return fmt.Errorf("image %s has an invalid sha256 checksum %q", img.Name, img.SHA256)
+	}
+	if img.DefaultUser != "" && !userRegexp.MatchString(img.DefaultUser) {
+		return fmt.Errorf("image %s has an invalid default user %q", img.Name, img.DefaultUser)
+	}
+	return nil
+}
+
+// Lookup returns the image with the reference ref, which is either a name, for the
+// latest version of the image, or a name and a version separated by @.
+func (c Catalog) Lookup(ref string) (Image, error) {
+	name, version, pinned := strings.Cut(ref, "@")
+
+	var found *Image
+	for i, img := range c.Images {
+		if img.Name != name {
+			continue
+		}
+		if pinned && img.Version == version {
+			return img, nil
+		}
+		if !pinned && (found == nil || CompareVersions(img.Version, found.Version) > 0) {
+			found = &c.Images[i]
+		}
+	}
+	if found == nil {
+		return Image{}, fmt.Errorf("there is no image %s in the catalog", ref)
+	}
+	return *found, nil
+}
+
+// CompareVersions returns -1 if version a is before b, 1 if it is after, and 0 if
+// they are the same. Versions are split into components on dots, dashes, pluses and
+// tildes, which are compared numerically if both are numbers, and as strings
+// otherwise.
+func CompareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return strings.ContainsRune(".-+~", r) })
+	}
+	as, bs := split(a), split(b)
+
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareComponents(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+func compareComponents(a, b string) int {
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+package catalog_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/catalog"
+)
+
+const testSum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	entry := `{"name": "base", "version": "1.0", "url": "https://example.com/base.tar.gz", "sha256": "` + testSum + `"`
+	image := func(fields string) string {
+		return `{"images": [` + entry + fields + `}]}`
+	}
+
+	testCases := map[string]struct {
+		catalog string
+
+		wantErr bool
+	}{
+		"with an image to download":    {catalog: image("")},
+		"with an image on the machine": {catalog: `{"images": [{"name": "base", "version": "1.0", "path": "base.tar.gz", "sha256": "` + testSum + `"}]}`},
+		"with setup steps":             {catalog: image(`, "defaultUser": "dev", "postInstall": ["useradd -m dev"]`)},
+		"with no images":               {catalog: `{"images": []}`},
+
+		"error with an invalid name":         {catalog: strings.Replace(image(""), `"base"`, `"base@1"`, 1), wantErr: true},
+		"error with no version":              {catalog: strings.Replace(image(""), `"1.0"`, `""`, 1), wantErr: true},
+		"error with both a URL and a path":   {catalog: image(`, "path": "base.tar.gz"`), wantErr: true},
+		"error with neither URL nor path":    {catalog: strings.Replace(image(""), `"url"`, `"comment"`, 1), wantErr: true},
+		"error with an invalid checksum":     {catalog: strings.Replace(image(""), testSum, "abcd", 1), wantErr: true},
+		"error with an invalid default user": {catalog: image(`, "defaultUser": "dev; rm -rf /"`), wantErr: true},
+		"error with an unknown field":        {catalog: image(`, "defaultUsr": "dev"`), wantErr: true},
+		"error with a duplicated image":      {catalog: `{"images": [` + entry + `}, ` + entry + `}]}`, wantErr: true},
+		"error with invalid JSON":            {catalog: `{"images": [`, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := catalog.Parse(strings.NewReader(tc.catalog))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed")
+				return
+			}
+			require.NoError(t, err, "Parse should not have failed")
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "catalog.json")
+	err := os.WriteFile(p, []byte(`{"images": [
+		{"name": "relative", "version": "1", "path": "images/base.tar.gz", "sha256": "`+testSum+`"},
+		{"name": "absolute", "version": "1", "path": "`+filepath.ToSlash(filepath.Join(dir, "abs.tar.gz"))+`", "sha256": "`+testSum+`"}
+	]}`), 0600)
+	require.NoError(t, err, "Setup: could not write catalog")
+
+	c, err := catalog.Load(p)
+	require.NoError(t, err, "Load should not have failed")
+	require.Equal(t, filepath.Join(dir, "images", "base.tar.gz"), c.Images[0].Path, "Relative paths should be relative to the catalog")
+	require.Equal(t, filepath.Join(dir, "abs.tar.gz"), filepath.Clean(c.Images[1].Path), "Absolute paths should be kept")
+
+	_, err = catalog.Load(filepath.Join(dir, "inexistent.json"))
+	require.Error(t, err, "Load should have failed with an inexistent catalog")
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	c := catalog.Catalog{Images: []catalog.Image{
+		{Name: "base", Version: "1.9"},
+		{Name: "base", Version: "1.10"},
+		{Name: "base", Version: "1.2"},
+		{Name: "other", Version: "2.0"},
+	}}
+
+	testCases := map[string]struct {
+		ref string
+
+		wantVersion string
+		wantErr     bool
+	}{
+		"latest version":    {ref: "base", wantVersion: "1.10"},
+		"pinned version":    {ref: "base@1.9", wantVersion: "1.9"},
+		"only version":      {ref: "other", wantVersion: "2.0"},
+		"error with a name": {ref: "inexistent", wantErr: true},
+		"error with a version that does not exist": {ref: "base@3.0", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := c.Lookup(tc.ref)
+			if tc.wantErr {
+				require.Error(t, err, "Lookup should have failed")
+				return
+			}
+			require.NoError(t, err, "Lookup should not have failed")
+			require.Equal(t, tc.wantVersion, img.Version, "Lookup returned the wrong version")
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		a, b string
+		want int
+	}{
+		"equal":                                     {a: "1.2.3", b: "1.2.3", want: 0},
+		"numbers are compared numerically":          {a: "1.10", b: "1.9", want: 1},
+		"shorter versions are before":               {a: "1.2", b: "1.2.1", want: -1},
+		"words are compared as strings":             {a: "22.04-beta", b: "22.04-rc", want: -1},
+		"separators are all the same":               {a: "2024.01+build2", b: "2024.01.build1", want: 1},
+		"numbers and words are compared as strings": {a: "1.a", b: "1.1", want: 1},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tc.want, catalog.CompareVersions(tc.a, tc.b), "Unexpected comparison of %s and %s", tc.a, tc.b)
+			require.Equal(t, -tc.want, catalog.CompareVersions(tc.b, tc.a), "Unexpected comparison of %s and %s", tc.b, tc.a)
+		})
+	}
+}
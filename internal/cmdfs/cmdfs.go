@@ -0,0 +1,399 @@
+// Package cmdfs implements a read-only fs.FS over a Linux filesystem that is
+// only reachable by running shell commands. It requires GNU find.
+package cmdfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/shell"
+)
+
+// Runner runs a shell command and returns its standard output. If the command
+// fails, the error must implement ExitCode() int.
+type Runner func(command string) ([]byte, error)
+
+// FS is a read-only filesystem served by running commands.
+type FS struct {
+	run  Runner
+	root string
+}
+
+var (
+	_ fs.ReadDirFS  = &FS{}
+	_ fs.StatFS     = &FS{}
+	_ fs.ReadFileFS = &FS{}
+)
+
+// New creates a filesystem rooted at the absolute Linux path root.
+func New(run Runner, root string) *FS {
+	return &FS{run: run, root: root}
+}
+
+// Exit codes of the scripts, so that the cause of the failure can be known.
+const (
+	exitNotExist   = 90
+	exitNotDir     = 91
+	exitIsDir      = 92
+	exitPermission = 93
+)
+
+// entryFormat is the -printf format for find to print a file.
+// Records are NUL-terminated, and the name is last, as it may contain spaces.
+const entryFormat = `%y %m %s %T@ %f\0`
+
+// Open opens the named file.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &dir{fsys: fsys, name: name, info: info}, nil
+	}
+	return &file{fsys: fsys, name: name, info: info}, nil
+}
+
+// Stat returns a FileInfo describing the named file, following symbolic links.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+func (fsys *FS) stat(op, name string) (*fileInfo, error) {
+	p, err := fsys.path(op, name)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := fsys.script(op, name, fmt.Sprintf(`p=%s
+[ -e "$p" ] || exit %d
+find -L "$p" -maxdepth 0 -printf '%s'`, shell.Quote(p), exitNotExist, entryFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseEntries(out)
+	if err != nil || len(entries) != 1 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("unexpected output %q: %v", out, err)}
+	}
+
+	// The name must be the one asked for, even for the root or symbolic links.
+	entries[0].name = path.Base(name)
+	return entries[0], nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := fsys.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := fsys.script("readdir", name, fmt.Sprintf(`p=%s
+[ -e "$p" ] || exit %d
+[ -d "$p" ] || exit %d
+[ -r "$p" ] && [ -x "$p" ] || exit %d
+find -H "$p" -mindepth 1 -maxdepth 1 -printf '%s'`, shell.Quote(p), exitNotExist, exitNotDir, exitPermission, entryFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := parseEntries(out)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	p, err := fsys.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsys.script("open", name, fmt.Sprintf(`p=%s
+[ -e "$p" ] || exit %d
+[ -d "$p" ] && exit %d
+[ -r "$p" ] || exit %d
+cat -- "$p"`, shell.Quote(p), exitNotExist, exitIsDir, exitPermission))
+}
+
+// path validates the name and converts it to a Linux path.
+func (fsys *FS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(fsys.root, name), nil
+}
+
+// script runs a script and translates its exit codes into errors.
+func (fsys *FS) script(op, name, script string) ([]byte, error) {
+	out, err := fsys.run(script)
+	if err == nil {
+		return out, nil
+	}
+
+	var target interface{ ExitCode() int }
+	if !errors.As(err, &target) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	switch target.ExitCode() {
+	case exitNotExist:
+		err = fs.ErrNotExist
+	case exitPermission:
+		err = fs.ErrPermission
+	case exitNotDir:
+		err = errors.New("not a directory")
+	case exitIsDir:
+		err = errors.New("is a directory")
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// parseEntries parses the output of find with entryFormat.
+func parseEntries(out []byte) ([]*fileInfo, error) {
+	var infos []*fileInfo
+	for _, record := range bytes.Split(out, []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+
+		fields := strings.SplitN(string(record), " ", 5)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("malformed record %q", record)
+		}
+
+		mode, err := parseMode(fields[0], fields[1])
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse size %q: %v", fields[2], err)
+		}
+		modTime, err := parseTime(fields[3])
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, &fileInfo{
+			name:    fields[4],
+			size:    size,
+			mode:    mode,
+			modTime: modTime,
+		})
+	}
+	return infos, nil
+}
+
+// parseMode converts the type letter and octal permissions printed by find into a FileMode.
+func parseMode(typ, perm string) (fs.FileMode, error) {
+	bits, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse permissions %q: %v", perm, err)
+	}
+
+	mode := fs.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+
+	switch typ {
+	case "f":
+	case "d":
+		mode |= fs.ModeDir
+	case "l":
+		mode |= fs.ModeSymlink
+	case "p":
+		mode |= fs.ModeNamedPipe
+	case "s":
+		mode |= fs.ModeSocket
+	case "c":
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case "b":
+		mode |= fs.ModeDevice
+	default:
+		mode |= fs.ModeIrregular
+	}
+	return mode, nil
+}
+
+// parseTime parses a timestamp in seconds with an optional fractional part.
+func parseTime(s string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(s, ".")
+
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse time %q: %v", s, err)
+	}
+
+	var nsec int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		nsec, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not parse time %q: %v", s, err)
+		}
+	}
+
+	return time.Unix(sec, nsec), nil
+}
+
+// fileInfo implements fs.FileInfo.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() any           { return nil }
+
+// file is a regular file. Its contents are read on first use.
+type file struct {
+	fsys *FS
+	name string
+	info *fileInfo
+
+	r      *bytes.Reader
+	closed bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+	return f.r.Read(b)
+}
+
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+	return f.r.ReadAt(b, off)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load("seek"); err != nil {
+		return 0, err
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// load reads the contents of the file, if it has not been done already.
+func (f *file) load(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.r != nil {
+		return nil
+	}
+
+	data, err := f.fsys.ReadFile(f.name)
+	if err != nil {
+		return err
+	}
+	f.r = bytes.NewReader(data)
+	return nil
+}
+
+// dir is a directory. Its entries are read on first use.
+type dir struct {
+	fsys *FS
+	name string
+	info *fileInfo
+
+	entries []fs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	if !d.loaded {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,185 @@
+package cmdfs_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/cmdfs"
+)
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	root := newTree(t)
+	fsys := cmdfs.New(localRunner(t), root)
+
+	err := fstest.TestFS(fsys, "file.txt", "empty.txt", "with space.txt", "dir/nested.txt", "dir/sub/deep.txt", "executable.sh")
+	require.NoError(t, err, "FS does not behave as expected")
+}
+
+func TestFSMatchesOS(t *testing.T) {
+	t.Parallel()
+
+	root := newTree(t)
+	fsys := cmdfs.New(localRunner(t), root)
+	want := os.DirFS(root)
+
+	for _, name := range []string{".", "file.txt", "empty.txt", "dir", "dir/sub/deep.txt", "executable.sh", "link", "dirlink", "sticky"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			wantInfo, err := fs.Stat(want, name)
+			require.NoError(t, err, "Setup: could not stat file")
+
+			got, err := fsys.Stat(name)
+			require.NoError(t, err, "Stat should not return an error")
+
+			require.Equal(t, wantInfo.Name(), got.Name(), "Unexpected name")
+			require.Equal(t, wantInfo.Mode(), got.Mode(), "Unexpected mode")
+			require.Equal(t, wantInfo.IsDir(), got.IsDir(), "Unexpected IsDir")
+			require.True(t, wantInfo.ModTime().Equal(got.ModTime()), "Unexpected modification time: want %v, got %v", wantInfo.ModTime(), got.ModTime())
+			if !wantInfo.IsDir() {
+				require.Equal(t, wantInfo.Size(), got.Size(), "Unexpected size")
+			}
+		})
+	}
+
+	// Directory entries describe links themselves, rather than their targets
+	entries, err := fsys.ReadDir(".")
+	require.NoError(t, err, "ReadDir should not return an error")
+
+	wantEntries, err := fs.ReadDir(want, ".")
+	require.NoError(t, err, "Setup: could not read directory")
+
+	require.Len(t, entries, len(wantEntries), "Unexpected number of entries")
+	for i := range entries {
+		require.Equal(t, wantEntries[i].Name(), entries[i].Name(), "Unexpected entry name")
+		require.Equal(t, wantEntries[i].Type(), entries[i].Type(), "Unexpected type for entry %q", entries[i].Name())
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	t.Parallel()
+
+	root := newTree(t)
+	require.NoError(t, os.Symlink("missing", filepath.Join(root, "broken")), "Setup: could not create link")
+	fsys := cmdfs.New(localRunner(t), root)
+
+	testCases := map[string]struct {
+		op   func(string) error
+		name string
+
+		wantErr error
+	}{
+		"stat missing file":      {op: stat(fsys), name: "missing", wantErr: fs.ErrNotExist},
+		"stat broken link":       {op: stat(fsys), name: "broken", wantErr: fs.ErrNotExist},
+		"stat invalid path":      {op: stat(fsys), name: "../file.txt", wantErr: fs.ErrInvalid},
+		"open missing file":      {op: open(fsys), name: "dir/missing", wantErr: fs.ErrNotExist},
+		"open invalid path":      {op: open(fsys), name: "/file.txt", wantErr: fs.ErrInvalid},
+		"read missing file":      {op: readFile(fsys), name: "missing", wantErr: fs.ErrNotExist},
+		"read directory":         {op: readFile(fsys), name: "dir"},
+		"read missing directory": {op: readDir(fsys), name: "missing", wantErr: fs.ErrNotExist},
+		"read file as directory": {op: readDir(fsys), name: "file.txt"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.op(tc.name)
+			require.Error(t, err, "Operation should have failed")
+
+			var target *fs.PathError
+			require.ErrorAs(t, err, &target, "Error should be a PathError")
+			require.Equal(t, tc.name, target.Path, "Unexpected path in PathError")
+
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr, "Unexpected error")
+			}
+		})
+	}
+}
+
+func TestFSRunnerError(t *testing.T) {
+	t.Parallel()
+
+	fsys := cmdfs.New(func(string) ([]byte, error) { return nil, errors.New("mock error") }, "/")
+
+	_, err := fsys.Stat("file.txt")
+	require.Error(t, err, "Stat should fail when commands cannot run")
+
+	_, err = fsys.ReadFile("file.txt")
+	require.Error(t, err, "ReadFile should fail when commands cannot run")
+}
+
+func stat(fsys *cmdfs.FS) func(string) error {
+	return func(name string) error { _, err := fsys.Stat(name); return err }
+}
+
+func open(fsys *cmdfs.FS) func(string) error {
+	return func(name string) error { _, err := fsys.Open(name); return err }
+}
+
+func readFile(fsys *cmdfs.FS) func(string) error {
+	return func(name string) error { _, err := fsys.ReadFile(name); return err }
+}
+
+func readDir(fsys *cmdfs.FS) func(string) error {
+	return func(name string) error { _, err := fsys.ReadDir(name); return err }
+}
+
+// localRunner runs commands in a local shell, as a stand-in for a distro.
+func localRunner(t *testing.T) cmdfs.Runner {
+	t.Helper()
+
+	if _, err := exec.LookPath("find"); err != nil {
+		t.Skip("Setup: these tests need GNU find")
+	}
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("Setup: these tests need a local /bin/sh")
+	}
+
+	return func(command string) ([]byte, error) {
+		return exec.Command("/bin/sh", "-c", command).Output()
+	}
+}
+
+// newTree creates a directory tree to serve as the filesystem.
+func newTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	mtime := time.Date(2020, 5, 17, 12, 30, 0, 123456789, time.UTC)
+
+	files := map[string]string{
+		"file.txt":         "Hello, world!\n",
+		"empty.txt":        "",
+		"with space.txt":   "Spaces\n",
+		"dir/nested.txt":   "Nested\n",
+		"dir/sub/deep.txt": "Deep\n",
+		"executable.sh":    "#!/bin/sh\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750), "Setup: could not create directory")
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0600), "Setup: could not write file")
+		require.NoError(t, os.Chtimes(p, mtime, mtime), "Setup: could not set times")
+	}
+
+	require.NoError(t, os.Chmod(filepath.Join(root, "executable.sh"), 0755), "Setup: could not set mode") //nolint: gosec // Executable on purpose
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sticky"), 0750), "Setup: could not create directory")
+	require.NoError(t, os.Chmod(filepath.Join(root, "sticky"), 0750|os.ModeSticky), "Setup: could not set mode")
+	require.NoError(t, os.Symlink("file.txt", filepath.Join(root, "link")), "Setup: could not create link")
+	require.NoError(t, os.Symlink("dir", filepath.Join(root, "dirlink")), "Setup: could not create link")
+
+	return root
+}
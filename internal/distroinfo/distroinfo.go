@@ -0,0 +1,350 @@
+// Package distroinfo reads the list of distros that can be installed with
+// wsl --install, in the format of DistributionInfo.json.
+package distroinfo
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultURL is where wsl.exe gets the list of distros from, unless it is
+// overridden by the DistributionListUrl value of its registry key.
+const DefaultURL = "https://raw.githubusercontent.com/microsoft/WSL/master/distributions/DistributionInfo.json"
+
+// maxSize is the maximum size of a list, so that a broken mirror cannot exhaust the memory.
+const maxSize = 16 << 20
+
+// List is a list of distros that can be installed.
+type List struct {
+	// Distributions are the distros of the list, sorted by name.
+	Distributions []Distribution
+	// Default is the name of the distro installed by wsl --install without a name.
+	Default string
+}
+
+// Distribution is a distro that can be installed.
+type Distribution struct {
+	// Name is the name of the distro, as given to wsl --install.
+	Name string
+	// FriendlyName is the name of the distro shown to users.
+	FriendlyName string
+	// Family is the family of the distro, such as Ubuntu, for modern distros.
+	Family string
+	// Default is true for the default version of the family of modern distros.
+	Default bool
+
+	// Legacy is true for distros packaged for the Microsoft Store, as .appx or
+	// .appxbundle packages, and false for modern distros, packaged as tarballs.
+	Legacy bool
+	// StoreAppID is the ID of the package of legacy distros in the Microsoft Store.
+	StoreAppID string
+	// PackageFamilyName is the family name of the package of legacy distros.
+	PackageFamilyName string
+
+	// Packages are the packages of the distro, by architecture in the terms of GOARCH.
+	Packages map[string]Package
+}
+
+// Package is a package of a distro for an architecture.
+type Package struct {
+	// URL is where the package is downloaded from.
+	URL string
+	// SHA256 is the checksum of the package, in lowercase hexadecimal, or empty for
+	// legacy distros.
+	SHA256 string
+}
+
+// document is the format of DistributionInfo.json.
+type document struct {
+	Default             string                     `json:"Default"`
+	Distributions       []legacyDistribution       `json:"Distributions"`
+	ModernDistributions map[string][]modernVersion `json:"ModernDistributions"`
+}
+
+type legacyDistribution struct {
+	Name              string `json:"Name"`
+	FriendlyName      string `json:"FriendlyName"`
+	StoreAppID        string `json:"StoreAppId"`
+	Amd64             bool   `json:"Amd64"`
+	Arm64             bool   `json:"Arm64"`
+	Amd64PackageURL   string `json:"Amd64PackageUrl"`
+	Arm64PackageURL   string `json:"Arm64PackageUrl"`
+	PackageFamilyName string `json:"PackageFamilyName"`
+}
+
+type modernVersion struct {
+	Name         string         `json:"Name"`
+	FriendlyName string         `json:"FriendlyName"`
+	Default      bool           `json:"Default"`
+	Amd64URL     *modernPackage `json:"Amd64Url"`
+	Arm64URL     *modernPackage `json:"Arm64Url"`
+}
+
+type modernPackage struct {
+	URL    string `json:"Url"`
+	SHA256 string `json:"Sha256"`
+}
+
+// Parse reads a list in the format of DistributionInfo.json from r.
+func Parse(r io.Reader) (List, error) {
+	var doc document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return List{}, fmt.Errorf("could not parse distribution list: %v", err)
+	}
+
+	list := List{Default: doc.Default}
+	seen := make(map[string]bool)
+
+	// Modern distros take precedence, as with wsl --install.
+	for family, versions := range doc.ModernDistributions {
+		for _, v := range versions {
+			d := Distribution{Name: v.Name, FriendlyName: v.FriendlyName, Family: family, Default: v.Default, Packages: make(map[string]Package)}
+			for arch, p := range map[string]*modernPackage{"amd64": v.Amd64URL, "arm64": v.Arm64URL} {
+				if p == nil || p.URL == "" {
+					continue
+				}
+				sum, err := parseSHA256(p.SHA256)
+				if err != nil {
+					return List{}, fmt.Errorf("invalid distribution %s: %v", v.Name, err)
+				}
+				d.Packages[arch] = Package{URL: p.URL, SHA256: sum}
+			}
+			if err := list.add(d, seen); err != nil {
+				return List{}, err
+			}
+		}
+	}
+
+	for _, l := range doc.Distributions {
+		if seen[strings.ToLower(l.Name)] {
+			continue
+		}
+		d := Distribution{
+			Name:              l.Name,
+			FriendlyName:      l.FriendlyName,
+			Legacy:            true,
+			StoreAppID:        l.StoreAppID,
+			PackageFamilyName: l.PackageFamilyName,
+			Packages:          make(map[string]Package),
+		}
+		if l.Amd64 && l.Amd64PackageURL != "" {
+			d.Packages["amd64"] = Package{URL: l.Amd64PackageURL}
+		}
+		if l.Arm64 && l.Arm64PackageURL != "" {
+			d.Packages["arm64"] = Package{URL: l.Arm64PackageURL}
+		}
+		if err := list.add(d, seen); err != nil {
+			return List{}, err
+		}
+	}
+
+	sort.Slice(list.Distributions, func(i, j int) bool { return list.Distributions[i].Name < list.Distributions[j].Name })
+	return list, nil
+}
+
+func (l *List) add(d Distribution, seen map[string]bool) error {
+	if d.Name == "" {
+		return errors.New("invalid distribution list: a distribution has no name")
+	}
+	key := strings.ToLower(d.Name)
+	if seen[key] {
+		return fmt.Errorf("invalid distribution list: distribution %s is listed more than once", d.Name)
+	}
+	seen[key] = true
+	l.Distributions = append(l.Distributions, d)
+	return nil
+}
+
+// parseSHA256 returns the checksum in lowercase hexadecimal, without the 0x prefix
+// that DistributionInfo.json uses.
+func parseSHA256(s string) (string, error) {
+	sum := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("invalid sha256 checksum %q", s)
+	}
+	return sum, nil
+}
+
+// Lookup returns the distro with the given name, which is case insensitive as with
+// wsl --install. An empty name stands for the default distro of the list.
+func (l List) Lookup(name string) (Distribution, error) {
+	if name == "" {
+		if l.Default == "" {
+			return Distribution{}, errors.New("the distribution list has no default distribution")
+		}
+		name = l.Default
+	}
+
+	for _, d := range l.Distributions {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+	}
+	return Distribution{}, fmt.Errorf("there is no distribution %s in the list", name)
+}
+
+// Package returns the package of the distro for the architecture, in the terms of GOARCH.
+func (d Distribution) Package(arch string) (Package, error) {
+	p, ok := d.Packages[arch]
+	if !ok {
+		return Package{}, fmt.Errorf("distribution %s has no package for %s", d.Name, arch)
+	}
+	return p, nil
+}
+
+// Open reads the list at source, which is either the URL of a mirror over HTTP, the
+// path of a local file, or a file:// URL. The list of Microsoft at DefaultURL is
+// read when source is empty. client makes the requests, or http.DefaultClient if nil.
+//
+// The URLs of the packages that are relative are resolved against source: relative
+// paths in a local list are relative to its directory.
+func Open(ctx context.Context, source string, client *http.Client) (List, error) {
+	if source == "" {
+		source = DefaultURL
+	}
+
+	r, err := Get(ctx, source, client)
+	if err != nil {
+		return List{}, err
+	}
+	defer r.Close()
+
+	list, err := Parse(io.LimitReader(r, maxSize))
+	if err != nil {
+		return List{}, err
+	}
+
+	for _, d := range list.Distributions {
+		for arch, pkg := range d.Packages {
+			pkg.URL = resolve(source, pkg.URL)
+			d.Packages[arch] = pkg
+		}
+	}
+	return list, nil
+}
+
+// resolve returns location relative to the list at source when it is relative.
+func resolve(source, location string) string {
+	if isAbs(location) {
+		return location
+	}
+
+	p, ok, err := LocalPath(source)
+	if err != nil {
+		// The list was read from source, so this does not happen.
+		return location
+	}
+	if ok {
+		return filepath.Join(filepath.Dir(p), location)
+	}
+
+	base, err := url.Parse(source)
+	if err != nil {
+		return location
+	}
+	ref, err := url.Parse(filepath.ToSlash(location))
+	if err != nil {
+		return location
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// isAbs returns whether location is a URL with a scheme or an absolute path, of
+// Windows or not.
+func isAbs(location string) bool {
+	if len(scheme(location)) > 1 {
+		return true
+	}
+	if len(location) >= 2 && location[1] == ':' {
+		// Drive letter, such as C:\distros\ubuntu.tar.gz.
+		return true
+	}
+	return strings.HasPrefix(location, "/") || strings.HasPrefix(location, `\`) || filepath.IsAbs(location)
+}
+
+// Get opens the file at location, which is either a URL over HTTP, the path of a
+// local file, or a file:// URL, such as the URL of a package. client makes the
+// requests, or http.DefaultClient if nil.
+func Get(ctx context.Context, location string, client *http.Client) (io.ReadCloser, error) {
+	p, ok, err := LocalPath(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid location %s: %v", location, err)
+	}
+	if ok {
+		return os.Open(p)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %v", location, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not download %s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// LocalPath returns the path of the file at location, which is a local path or a
+// file:// URL, or false if it is a URL of any other scheme. Locations without a
+// scheme, or with a one-letter one such as Windows drive letters, are paths. An
+// error is returned for URLs that cannot be parsed.
+func LocalPath(location string) (string, bool, error) {
+	if len(scheme(location)) <= 1 {
+		return location, true, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", false, err
+	}
+	if u.Scheme != "file" {
+		return "", false, nil
+	}
+
+	p := u.Path
+	if u.Host != "" {
+		// UNC path, such as file://server/share/distros.json.
+		p = "//" + u.Host + p
+	} else if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		// Drive letter, such as file:///C:/distros.json.
+		p = p[1:]
+	}
+	return p, true, nil
+}
+
+// scheme returns the scheme of the URL at location, or an empty string if it has
+// none, without parsing the rest of it.
+func scheme(location string) string {
+	for i, c := range location {
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return ""
+			}
+		case c == ':':
+			return location[:i]
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,337 @@
+package distroinfo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/distroinfo"
+)
+
+const (
+	sumAmd64 = "1111111111111111111111111111111111111111111111111111111111111111"
+	sumArm64 = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+)
+
+// testList is a list in the format of DistributionInfo.json, with both legacy and
+// modern distros.
+const testList = `{
+  "Default": "Ubuntu",
+  "ModernDistributions": {
+    "Ubuntu": [
+      {
+        "Name": "Ubuntu",
+        "Default": true,
+        "FriendlyName": "Ubuntu",
+        "Amd64Url": {"Url": "https://example.com/ubuntu-amd64.wsl", "Sha256": "0x` + sumAmd64 + `"},
+        "Arm64Url": {"Url": "https://example.com/ubuntu-arm64.wsl", "Sha256": "0x` + sumArm64 + `"}
+      },
+      {
+        "Name": "Ubuntu-24.04",
+        "Default": false,
+        "FriendlyName": "Ubuntu 24.04 LTS",
+        "Amd64Url": {"Url": "https://example.com/ubuntu-24.04-amd64.wsl", "Sha256": "` + sumAmd64 + `"}
+      }
+    ]
+  },
+  "Distributions": [
+    {
+      "Name": "Ubuntu",
+      "FriendlyName": "Ubuntu (Store)",
+      "StoreAppId": "9PDXGNCFSCZV",
+      "Amd64": true,
+      "Arm64": true,
+      "Amd64PackageUrl": "https://example.com/Ubuntu.appxbundle",
+      "Arm64PackageUrl": "https://example.com/Ubuntu.appxbundle",
+      "PackageFamilyName": "CanonicalGroupLimited.UbuntuonWindows_79rhkp1fndgsc"
+    },
+    {
+      "Name": "Debian",
+      "FriendlyName": "Debian GNU/Linux",
+      "StoreAppId": "9MSVKQC78PK6",
+      "Amd64": true,
+      "Arm64": false,
+      "Amd64PackageUrl": "https://example.com/Debian.appxbundle",
+      "Arm64PackageUrl": "",
+      "PackageFamilyName": "TheDebianProject.DebianGNULinux_76v4gfsz19hv4"
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	list, err := distroinfo.Parse(strings.NewReader(testList))
+	require.NoError(t, err, "Parse should not have failed")
+
+	want := distroinfo.List{
+		Default: "Ubuntu",
+		Distributions: []distroinfo.Distribution{
+			{
+				Name:              "Debian",
+				FriendlyName:      "Debian GNU/Linux",
+				Legacy:            true,
+				StoreAppID:        "9MSVKQC78PK6",
+				PackageFamilyName: "TheDebianProject.DebianGNULinux_76v4gfsz19hv4",
+				Packages:          map[string]distroinfo.Package{"amd64": {URL: "https://example.com/Debian.appxbundle"}},
+			},
+			{
+				Name:         "Ubuntu",
+				FriendlyName: "Ubuntu",
+				Family:       "Ubuntu",
+				Default:      true,
+				Packages: map[string]distroinfo.Package{
+					"amd64": {URL: "https://example.com/ubuntu-amd64.wsl", SHA256: sumAmd64},
+					"arm64": {URL: "https://example.com/ubuntu-arm64.wsl", SHA256: sumArm64},
+				},
+			},
+			{
+				Name:         "Ubuntu-24.04",
+				FriendlyName: "Ubuntu 24.04 LTS",
+				Family:       "Ubuntu",
+				Packages:     map[string]distroinfo.Package{"amd64": {URL: "https://example.com/ubuntu-24.04-amd64.wsl", SHA256: sumAmd64}},
+			},
+		},
+	}
+	require.Equal(t, want, list, "Unexpected list")
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"error with invalid JSON":          `{"Distributions": [`,
+		"error with an invalid checksum":   `{"ModernDistributions": {"Ubuntu": [{"Name": "Ubuntu", "Amd64Url": {"Url": "https://example.com", "Sha256": "0x1234"}}]}}`,
+		"error with a distro without name": `{"Distributions": [{"FriendlyName": "Nameless"}]}`,
+		"error with a duplicated distro":   `{"ModernDistributions": {"Ubuntu": [{"Name": "Ubuntu"}], "Other": [{"Name": "ubuntu"}]}}`,
+	}
+
+	for name, list := range testCases {
+		list := list
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := distroinfo.Parse(strings.NewReader(list))
+			require.Error(t, err, "Parse should have failed")
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	list, err := distroinfo.Parse(strings.NewReader(testList))
+	require.NoError(t, err, "Setup: Parse should not have failed")
+
+	testCases := map[string]struct {
+		name string
+		arch string
+
+		wantURL string
+		wantErr bool
+	}{
+		"modern distro":                   {name: "Ubuntu-24.04", arch: "amd64", wantURL: "https://example.com/ubuntu-24.04-amd64.wsl"},
+		"modern distro for another arch":  {name: "Ubuntu", arch: "arm64", wantURL: "https://example.com/ubuntu-arm64.wsl"},
+		"legacy distro":                   {name: "Debian", arch: "amd64", wantURL: "https://example.com/Debian.appxbundle"},
+		"names are case insensitive":      {name: "debian", arch: "amd64", wantURL: "https://example.com/Debian.appxbundle"},
+		"default distro":                  {name: "", arch: "amd64", wantURL: "https://example.com/ubuntu-amd64.wsl"},
+		"error with an unknown distro":    {name: "Fedora", arch: "amd64", wantErr: true},
+		"error with an unsupported arch":  {name: "Debian", arch: "arm64", wantErr: true},
+		"error with a modern distro arch": {name: "Ubuntu-24.04", arch: "arm64", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := list.Lookup(tc.name)
+			if err == nil {
+				var p distroinfo.Package
+				p, err = d.Package(tc.arch)
+				if err == nil {
+					require.Equal(t, tc.wantURL, p.URL, "Unexpected package")
+				}
+			}
+			if tc.wantErr {
+				require.Error(t, err, "Lookup or Package should have failed")
+				return
+			}
+			require.NoError(t, err, "Lookup and Package should not have failed")
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "DistributionInfo.json")
+	require.NoError(t, os.WriteFile(local, []byte(testList), 0600), "Setup: could not write list")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/DistributionInfo.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testList))
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := map[string]struct {
+		source    string
+		cancelled bool
+
+		wantErr bool
+	}{
+		"from a mirror":     {source: srv.URL + "/DistributionInfo.json"},
+		"from a local file": {source: local},
+		"from a file URL":   {source: "file://" + filepath.ToSlash(local)},
+
+		"error when the mirror does not have it": {source: srv.URL + "/missing.json", wantErr: true},
+		"error when the file does not exist":     {source: filepath.Join(dir, "missing.json"), wantErr: true},
+		"error with a cancelled context":         {source: srv.URL + "/DistributionInfo.json", cancelled: true, wantErr: true},
+		"error with an invalid URL":              {source: srv.URL + "/%zz.json", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			list, err := distroinfo.Open(ctx, tc.source, nil)
+			if tc.wantErr {
+				require.Error(t, err, "Open should have failed")
+				return
+			}
+			require.NoError(t, err, "Open should not have failed")
+			require.Len(t, list.Distributions, 3, "Unexpected number of distributions")
+		})
+	}
+}
+
+func TestOpenResolvesPackages(t *testing.T) {
+	t.Parallel()
+
+	packages := map[string]string{
+		"relative":  "distros/ubuntu.wsl",
+		"dot":       "./ubuntu.wsl",
+		"parent":    "../ubuntu.wsl",
+		"absolute":  "/srv/ubuntu.wsl",
+		"windows":   `C:\distros\ubuntu.wsl`,
+		"file-url":  "file:///srv/ubuntu.wsl",
+		"https-url": "https://example.com/ubuntu.wsl",
+	}
+	var versions []string
+	for name, url := range packages {
+		versions = append(versions, fmt.Sprintf(`{"Name": %q, "Amd64Url": {"Url": %q, "Sha256": "%s"}}`, name, url, sumAmd64))
+	}
+	list := `{"ModernDistributions": {"Test": [` + strings.Join(versions, ",") + `]}}`
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "lists", "DistributionInfo.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(local), 0700), "Setup: could not create list directory")
+	require.NoError(t, os.WriteFile(local, []byte(list), 0600), "Setup: could not write list")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(list))
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := map[string]struct {
+		source string
+
+		want map[string]string // URLs of the packages that are resolved, the others are left as is
+	}{
+		"from a local file": {source: local, want: map[string]string{
+			"relative": filepath.Join(dir, "lists", "distros", "ubuntu.wsl"),
+			"dot":      filepath.Join(dir, "lists", "ubuntu.wsl"),
+			"parent":   filepath.Join(dir, "ubuntu.wsl"),
+		}},
+		"from a file URL": {source: "file://" + filepath.ToSlash(local), want: map[string]string{
+			"relative": filepath.Join(dir, "lists", "distros", "ubuntu.wsl"),
+			"dot":      filepath.Join(dir, "lists", "ubuntu.wsl"),
+			"parent":   filepath.Join(dir, "ubuntu.wsl"),
+		}},
+		"from a mirror": {source: srv.URL + "/lists/DistributionInfo.json", want: map[string]string{
+			"relative": srv.URL + "/lists/distros/ubuntu.wsl",
+			"dot":      srv.URL + "/lists/ubuntu.wsl",
+			"parent":   srv.URL + "/ubuntu.wsl",
+		}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := distroinfo.Open(context.Background(), tc.source, nil)
+			require.NoError(t, err, "Open should not have failed")
+
+			for name, url := range packages {
+				want, ok := tc.want[name]
+				if !ok {
+					want = url
+				}
+
+				d, err := list.Lookup(name)
+				require.NoError(t, err, "Lookup should not have failed")
+				pkg, err := d.Package("amd64")
+				require.NoError(t, err, "Package should not have failed")
+				require.Equal(t, want, pkg.URL, "Unexpected URL for package %q", name)
+			}
+		})
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		location string
+
+		want      string
+		wantLocal bool
+		wantErr   bool
+	}{
+		"relative path":          {location: "distros/list.json", want: "distros/list.json", wantLocal: true},
+		"absolute path":          {location: "/srv/list.json", want: "/srv/list.json", wantLocal: true},
+		"windows path":           {location: `C:\distros\list.json`, want: `C:\distros\list.json`, wantLocal: true},
+		"file URL":               {location: "file:///srv/list.json", want: "/srv/list.json", wantLocal: true},
+		"file URL with a drive":  {location: "file:///C:/distros/list.json", want: "C:/distros/list.json", wantLocal: true},
+		"file URL with a server": {location: "file://server/share/list.json", want: "//server/share/list.json", wantLocal: true},
+		"HTTPS URL":              {location: "https://example.com/list.json"},
+		"path with a percent":    {location: `C:\100%zz\list.json`, want: `C:\100%zz\list.json`, wantLocal: true},
+
+		"error with an invalid HTTPS URL": {location: "https://example.com/%zz", wantErr: true},
+		"error with an invalid file URL":  {location: "file:///srv/%zz", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, local, err := distroinfo.LocalPath(tc.location)
+			if tc.wantErr {
+				require.Error(t, err, "LocalPath should have failed")
+				return
+			}
+			require.NoError(t, err, "LocalPath should not have failed")
+			require.Equal(t, tc.wantLocal, local, "Unexpected locality of %q", tc.location)
+			require.Equal(t, tc.want, got, "Unexpected path of %q", tc.location)
+		})
+	}
+}
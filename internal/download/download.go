@@ -0,0 +1,228 @@
+// Package download fetches files over HTTP, resuming interrupted downloads and
+// verifying their checksum.
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/lockfile"
+)
+
+// ChecksumError is returned when a downloaded file does not have the expected checksum.
+type ChecksumError struct {
+	URL  string
+	Want string
+	Got  string
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: expected sha256 %s, got %s", e.URL, e.Want, e.Got)
+}
+
+// Options tweak how files are downloaded.
+type Options struct {
+	// Client makes the requests. http.DefaultClient is used when nil.
+	Client *http.Client
+
+	// Attempts is the number of times the download is attempted, resuming where the
+	// previous attempt stopped. It defaults to 3.
+	Attempts int
+
+	// Backoff is the time to wait before the second attempt, which doubles with
+	// every further attempt. It defaults to one second.
+	Backoff time.Duration
+
+	// Part is the file where the data is written until it is complete. It defaults
+	// to dst.part, and can be shared by downloads to different destinations so that
+	// they resume each other.
+	Part string
+}
+
+// Fetch downloads url into dst, and verifies that its SHA-256 checksum is sha256Hex.
+//
+// The data is written into dst.part first, or opts.Part, which is renamed once it is
+// complete and verified. If it exists already, from a download that was interrupted,
+// it is resumed with a range request, if the server supports it. The partial file is
+// locked during the download, so that downloads sharing it, in this process or in
+// others, take turns.
+func Fetch(ctx context.Context, url, dst, sha256Hex string, opts Options) error {
+	want := strings.ToLower(sha256Hex)
+	if b, err := hex.DecodeString(want); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid sha256 checksum %q", sha256Hex)
+	}
+
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+
+	part := opts.Part
+	if part == "" {
+		part = dst + ".part"
+	}
+
+	lock, err := lockfile.Acquire(ctx, part+".lock")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The lock file is only needed as long as the partial download is there.
+		if _, err := os.Stat(part); os.IsNotExist(err) {
+			lock.Remove()
+			return
+		}
+		lock.Release()
+	}()
+
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fetchOnce(ctx, opts.Client, url, part)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var statusErr statusError
+		if errors.As(err, &statusErr) && !statusErr.temporary() {
+			return err
+		}
+		if attempt >= opts.Attempts {
+			return fmt.Errorf("could not download %s after %d attempts: %v", url, attempt, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+
+	got, err := Checksum(part)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		// The data is corrupted: it must not be resumed.
+		os.Remove(part)
+		return ChecksumError{URL: url, Want: want, Got: got}
+	}
+
+	if err := os.Rename(part, dst); err != nil {
+		return fmt.Errorf("could not move download into place: %v", err)
+	}
+	return nil
+}
+
+// fetchOnce downloads url into part, resuming from its current size.
+func fetchOnce(ctx context.Context, client *http.Client, url, part string) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open download file: %v", err)
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("could not open download file: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("could not create request: %v", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		if !resumesAt(resp, offset) {
+			// The next attempt starts over rather than stitch mismatched pieces together.
+			if err := f.Truncate(0); err != nil {
+				return fmt.Errorf("could not restart download: %v", err)
+			}
+			return fmt.Errorf("could not resume download of %s: unexpected range %q", url, resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The previous attempt got everything: the checksum tells whether it is right.
+		return nil
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range, so the download starts over.
+		if err := f.Truncate(0); err != nil {
+			return fmt.Errorf("could not restart download: %v", err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("could not restart download: %v", err)
+		}
+	default:
+		return statusError{url: url, code: resp.StatusCode}
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("could not download %s: %v", url, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write download file: %v", err)
+	}
+	return nil
+}
+
+// resumesAt returns true if the partial response starts at the offset.
+func resumesAt(resp *http.Response, offset int64) bool {
+	var start int64
+	_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start)
+	return err == nil && start == offset
+}
+
+// Checksum returns the SHA-256 checksum of the file, in hexadecimal.
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not compute checksum: %v", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("could not compute checksum: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// statusError is returned when the server answers with an unexpected status.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("could not download %s: %d %s", e.url, e.code, http.StatusText(e.code))
+}
+
+// temporary returns true if the request may succeed if it is attempted again.
+func (e statusError) temporary() bool {
+	return e.code >= 500 || e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests
+}
@@ -0,0 +1,215 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/download"
+)
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	testCases := map[string]struct {
+		server      string // Behaviour of the server, see newServer
+		partial     []byte // Contents of the .part file left by a previous download
+		checksum    string
+		cancelled   bool
+		wantRanges  []string // Range header of every request
+		wantErr     bool
+		wantSumErr  bool
+		wantPartial bool // Whether the .part file must be left behind on error
+	}{
+		"success":                                     {server: "ok", wantRanges: []string{""}},
+		"success with an uppercase checksum":          {server: "ok", checksum: strings.ToUpper(checksum), wantRanges: []string{""}},
+		"success resuming a previous download":        {server: "ok", partial: content[:1000], wantRanges: []string{"bytes=1000-"}},
+		"success with a complete previous download":   {server: "ok", partial: content, wantRanges: []string{fmt.Sprintf("bytes=%d-", len(content))}},
+		"success retrying after a dropped connection": {server: "drop-first", wantRanges: []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}},
+		"success retrying after a server error":       {server: "fail-first", wantRanges: []string{"", ""}},
+		"success when the server ignores ranges":      {server: "no-ranges", partial: []byte("garbage"), wantRanges: []string{"bytes=7-"}},
+		"success when the server sends another range": {server: "wrong-range", partial: content[:1000], wantRanges: []string{"bytes=1000-", ""}},
+
+		"error with a checksum mismatch":         {server: "ok", checksum: checksumOf("something else"), wantRanges: []string{""}, wantErr: true, wantSumErr: true},
+		"error with a corrupted previous part":   {server: "ok", partial: []byte("garbage"), wantRanges: []string{"bytes=7-"}, wantErr: true, wantSumErr: true},
+		"error with an invalid checksum":         {server: "ok", checksum: "not hex", wantErr: true},
+		"error with a short checksum":            {server: "ok", checksum: "abcd", wantErr: true},
+		"error when not found, without retrying": {server: "not-found", wantRanges: []string{""}, wantErr: true},
+		"error when the server keeps failing":    {server: "fail-always", wantRanges: []string{"", "", ""}, wantErr: true},
+		"error when the context is cancelled":    {server: "ok", partial: content[:1000], cancelled: true, wantErr: true, wantPartial: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, ranges := newServer(t, tc.server, content)
+
+			dst := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+			if tc.partial != nil {
+				require.NoError(t, os.WriteFile(dst+".part", tc.partial, 0600), "Setup: could not write partial download")
+			}
+
+			if tc.checksum == "" {
+				tc.checksum = checksum
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			err := download.Fetch(ctx, srv.URL+"/rootfs.tar.gz", dst, tc.checksum, download.Options{Backoff: time.Millisecond})
+			if tc.wantRanges != nil {
+				require.Equal(t, tc.wantRanges, ranges(), "Unexpected requests to the server")
+			}
+
+			if tc.wantErr {
+				require.Error(t, err, "Fetch should have failed")
+				require.NoFileExists(t, dst, "Fetch should not leave a file behind on error")
+
+				var sumErr download.ChecksumError
+				if tc.wantSumErr {
+					require.ErrorAs(t, err, &sumErr, "Fetch should have returned a ChecksumError")
+					require.NoFileExists(t, dst+".part", "A corrupted download should not be resumed")
+					require.NoFileExists(t, dst+".part.lock", "The lock file should be gone along with the partial download")
+				} else {
+					require.False(t, errors.As(err, &sumErr), "Fetch should not have returned a ChecksumError")
+				}
+
+				if tc.wantPartial {
+					require.FileExists(t, dst+".part", "An interrupted download should be left for resuming")
+				}
+				return
+			}
+			require.NoError(t, err, "Fetch should not have failed")
+
+			got, err := os.ReadFile(dst)
+			require.NoError(t, err, "Downloaded file should be readable")
+			require.Equal(t, content, got, "Unexpected contents of the downloaded file")
+			require.NoFileExists(t, dst+".part", "The partial download should be gone")
+			require.NoFileExists(t, dst+".part.lock", "The lock file should be gone along with the partial download")
+		})
+	}
+}
+
+func TestFetchConcurrently(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	srv, _ := newServer(t, "ok", content)
+
+	dir := t.TempDir()
+	part := filepath.Join(dir, "rootfs.tar.gz.part")
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dst := filepath.Join(dir, fmt.Sprintf("rootfs-%d.tar.gz", i))
+			errs[i] = download.Fetch(context.Background(), srv.URL+"/rootfs.tar.gz", dst, checksum, download.Options{Part: part})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		require.NoError(t, err, "Fetch #%d should not have failed", i)
+
+		got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("rootfs-%d.tar.gz", i)))
+		require.NoError(t, err, "Downloaded file #%d should be readable", i)
+		require.Equal(t, content, got, "Unexpected contents of downloaded file #%d", i)
+	}
+	require.NoFileExists(t, part, "The partial download should be gone")
+	require.NoFileExists(t, part+".lock", "The lock file should be gone along with the partial download")
+}
+
+// newServer serves the content with the given behaviour, and returns a function
+// that returns the Range header of every request it received.
+func newServer(t *testing.T, behaviour string, content []byte) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var ranges []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		n := len(ranges)
+		mu.Unlock()
+
+		switch behaviour {
+		case "ok":
+		case "not-found":
+			http.NotFound(w, r)
+			return
+		case "fail-always":
+			http.Error(w, "oops", http.StatusServiceUnavailable)
+			return
+		case "fail-first":
+			if n == 1 {
+				http.Error(w, "oops", http.StatusServiceUnavailable)
+				return
+			}
+		case "drop-first":
+			if n == 1 {
+				// Announcing all of it but sending only half makes the client fail mid-stream.
+				w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				w.WriteHeader(http.StatusOK)
+				//nolint: errcheck // The connection is dropped on purpose
+				w.Write(content[:len(content)/2])
+				return
+			}
+		case "no-ranges":
+			r.Header.Del("Range")
+		case "wrong-range":
+			if n == 1 {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-9/%d", len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				//nolint: errcheck // The client is expected to give up on this response
+				w.Write(content[:10])
+				return
+			}
+		default:
+			panic("unknown behaviour " + behaviour)
+		}
+
+		http.ServeContent(w, r, "rootfs.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, ranges...)
+	}
+}
+
+func checksumOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+// Package fanout runs a task for many items concurrently, with bounded
+// concurrency, a timeout per item, and optionally stopping at the first failure.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSkipped is the error of the items that were not started because another
+// item failed in fail-fast mode.
+var ErrSkipped = errors.New("skipped because another task failed")
+
+// Options configures Run.
+type Options struct {
+	// Concurrency is the maximum number of tasks running at the same time.
+	// There is no limit if it is zero or negative.
+	Concurrency int
+
+	// Timeout bounds each task, if positive.
+	Timeout time.Duration
+
+	// FailFast cancels the running tasks and skips the rest as soon as one fails.
+	FailFast bool
+}
+
+// Run calls task for the items 0 to n-1, and returns their errors at their index.
+// Items are started in order. Run returns once all started tasks have returned.
+func Run(parent context.Context, n int, opts Options, task func(ctx context.Context, i int) error) []error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 || concurrency > n {
+		concurrency = n
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		// Nothing else is started once the parent context is done or a task failed fast.
+		if ctx.Err() != nil {
+			for j := i; j < n; j++ {
+				errs[j] = skipReason(parent)
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			taskCtx := ctx
+			if opts.Timeout > 0 {
+				var cancelTask context.CancelFunc
+				taskCtx, cancelTask = context.WithTimeout(ctx, opts.Timeout)
+				defer cancelTask()
+			}
+
+			errs[i] = task(taskCtx, i)
+			if errs[i] != nil && opts.FailFast {
+				cancel()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// skipReason explains why an item was not started: either the parent context
+// is done, or fail-fast mode canceled the rest.
+func skipReason(parent context.Context) error {
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	return ErrSkipped
+}
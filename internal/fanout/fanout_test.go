@@ -0,0 +1,105 @@
+package fanout_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/fanout"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		n           int
+		concurrency int
+		timeout     time.Duration
+		failFast    bool
+		failing     map[int]bool // Items whose task fails right away
+		slow        map[int]bool // Items whose task lasts until their context is done
+		cancelAfter int          // Cancel the parent context after this many tasks started, if positive
+
+		wantErrs        []error
+		wantMaxParallel int
+	}{
+		"success":                       {n: 5, wantErrs: make([]error, 5), wantMaxParallel: 5},
+		"success with no items":         {n: 0, wantErrs: []error{}},
+		"success with bound":            {n: 6, concurrency: 2, wantErrs: make([]error, 6), wantMaxParallel: 2},
+		"success with bound of one":     {n: 3, concurrency: 1, wantErrs: make([]error, 3), wantMaxParallel: 1},
+		"success with bound over items": {n: 2, concurrency: 10, wantErrs: make([]error, 2), wantMaxParallel: 2},
+
+		"errors are collected":            {n: 4, failing: map[int]bool{1: true, 3: true}, wantErrs: []error{nil, errMock, nil, errMock}},
+		"errors with bound are collected": {n: 4, concurrency: 1, failing: map[int]bool{0: true}, wantErrs: []error{errMock, nil, nil, nil}, wantMaxParallel: 1},
+		"timeout stops slow tasks":        {n: 3, timeout: 100 * time.Millisecond, slow: map[int]bool{1: true}, wantErrs: []error{nil, context.DeadlineExceeded, nil}},
+		"fail-fast skips the rest":        {n: 4, concurrency: 1, failFast: true, failing: map[int]bool{1: true}, wantErrs: []error{nil, errMock, fanout.ErrSkipped, fanout.ErrSkipped}},
+		"fail-fast cancels running tasks": {n: 3, failFast: true, failing: map[int]bool{2: true}, slow: map[int]bool{0: true, 1: true}, wantErrs: []error{context.Canceled, context.Canceled, errMock}},
+		"fail-fast without failures":      {n: 3, failFast: true, wantErrs: make([]error, 3)},
+		"canceled parent skips the rest":  {n: 4, concurrency: 1, cancelAfter: 2, wantErrs: []error{nil, nil, context.Canceled, context.Canceled}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var running, maxRunning, started int32
+			var mu sync.Mutex
+
+			errs := fanout.Run(ctx, tc.n, fanout.Options{Concurrency: tc.concurrency, Timeout: tc.timeout, FailFast: tc.failFast},
+				func(ctx context.Context, i int) error {
+					n := atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+
+					mu.Lock()
+					if n > maxRunning {
+						maxRunning = n
+					}
+					started++
+					if tc.cancelAfter > 0 && int(started) == tc.cancelAfter {
+						cancel()
+					}
+					mu.Unlock()
+
+					if tc.slow[i] {
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-time.After(30 * time.Second):
+							return errors.New("task was not stopped")
+						}
+					}
+
+					// Give other tasks the chance to overlap
+					time.Sleep(50 * time.Millisecond)
+
+					if tc.failing[i] {
+						return errMock
+					}
+					return nil
+				})
+
+			require.Len(t, errs, len(tc.wantErrs), "Run should return one error per item")
+			for i := range tc.wantErrs {
+				if tc.wantErrs[i] == nil {
+					require.NoError(t, errs[i], "Item %d should not have failed", i)
+					continue
+				}
+				require.ErrorIs(t, errs[i], tc.wantErrs[i], "Unexpected error for item %d", i)
+			}
+
+			if tc.wantMaxParallel > 0 {
+				require.Equal(t, int32(tc.wantMaxParallel), maxRunning, "Unexpected maximum number of tasks running at once")
+			}
+		})
+	}
+}
+
+var errMock = errors.New("mock error")
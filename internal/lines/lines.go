@@ -0,0 +1,176 @@
+// Package lines splits streams of command output into lines.
+package lines
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// MaxLength is the default length after which a line is cut and handed over
+// in pieces, so that output without line endings does not grow without bound.
+const MaxLength = 64 * 1024
+
+// Splitter is an io.Writer that calls a function for every line written to it.
+//
+// Lines end with "\n", "\r\n" or a lone "\r". The latter is what progress bars
+// use to redraw themselves, so every redraw is reported as a line of its own.
+// Line endings are not passed to the callback.
+//
+// Lines longer than MaxLength are handed over in pieces of MaxLength bytes.
+// Whatever is left without a line ending is handed over by Flush.
+type Splitter struct {
+	// MaxLength is the length after which lines are cut.
+	MaxLength int
+
+	w      io.Writer         // Writer to forward the raw output to. Can be nil.
+	onLine func(line string) // Callback for every line
+	line   []byte            // Incomplete line
+
+	// skipLF is set after a "\r" ended a line, so that the "\n" of a
+	// "\r\n" does not end another one.
+	skipLF bool
+}
+
+// NewSplitter returns a Splitter that calls onLine for every line written to it,
+// and forwards the output unchanged to w if it is not nil.
+func NewSplitter(w io.Writer, onLine func(line string)) *Splitter {
+	return &Splitter{
+		MaxLength: MaxLength,
+		w:         w,
+		onLine:    onLine,
+	}
+}
+
+// Write splits p into lines. Incomplete lines are kept until they are completed.
+func (s *Splitter) Write(p []byte) (n int, err error) {
+	if s.w != nil {
+		if n, err := s.w.Write(p); err != nil {
+			return n, err
+		}
+	}
+
+	n = len(p)
+	for len(p) > 0 {
+		if s.skipLF {
+			s.skipLF = false
+			if p[0] == '\n' {
+				p = p[1:]
+				continue
+			}
+		}
+
+		i := bytes.IndexAny(p, "\r\n")
+		if i < 0 {
+			s.line = append(s.line, p...)
+			s.cut()
+			break
+		}
+
+		s.line = append(s.line, p[:i]...)
+		s.cut()
+		end := p[i]
+		p = p[i+1:]
+
+		// Progress bars often start with a "\r": it does not end an empty line.
+		// An empty line ended by "\r\n" is still reported once its "\n" arrives.
+		if end == '\r' && len(s.line) == 0 {
+			continue
+		}
+		s.skipLF = end == '\r'
+		s.emit()
+	}
+
+	return n, nil
+}
+
+// cut hands over the pieces of the incomplete line that exceed the maximum length.
+func (s *Splitter) cut() {
+	if s.MaxLength <= 0 {
+		return
+	}
+	for len(s.line) > s.MaxLength {
+		s.onLine(string(s.line[:s.MaxLength]))
+		s.line = append(s.line[:0], s.line[s.MaxLength:]...)
+	}
+}
+
+func (s *Splitter) emit() {
+	s.onLine(string(s.line))
+	s.line = s.line[:0]
+}
+
+// Flush hands over the last line if the output did not end with a line ending.
+func (s *Splitter) Flush() error {
+	if len(s.line) > 0 {
+		s.emit()
+	}
+	return nil
+}
+
+// Prefixer is an io.Writer that inserts a prefix at the start of every line.
+//
+// Lines are not buffered: the prefix is written as soon as the first byte of
+// a line is, which keeps partial lines and very long lines flowing. A lone
+// "\r" starts a new line, so that progress bars keep their prefix as they redraw.
+type Prefixer struct {
+	w          io.Writer
+	prefix     string
+	timeLayout string           // Layout of the timestamp. No timestamp if empty.
+	now        func() time.Time // Source of the timestamps
+
+	started bool // Whether the current line has been prefixed already
+	afterCR bool // Whether the last byte was a carriage return
+}
+
+// NewPrefixer returns a Prefixer that writes into w, prefixing every line with
+// prefix. If timeLayout is not empty, the prefix is followed by the time at
+// which the line started, formatted with it, and a space.
+func NewPrefixer(w io.Writer, prefix, timeLayout string, now func() time.Time) *Prefixer {
+	if now == nil {
+		now = time.Now
+	}
+	return &Prefixer{
+		w:          w,
+		prefix:     prefix,
+		timeLayout: timeLayout,
+		now:        now,
+	}
+}
+
+// Write writes p into the underlying writer, with the prefix before each line.
+func (p *Prefixer) Write(b []byte) (n int, err error) {
+	buf := make([]byte, 0, len(b))
+	for _, c := range b {
+		// The "\n" of a "\r\n" ends the line that the "\r" ended already.
+		if p.afterCR && c == '\n' {
+			p.afterCR = false
+			buf = append(buf, c)
+			continue
+		}
+		p.afterCR = false
+
+		if !p.started && c != '\r' {
+			buf = append(buf, p.header()...)
+			p.started = true
+		}
+		buf = append(buf, c)
+
+		if c == '\n' || c == '\r' {
+			p.started = false
+			p.afterCR = c == '\r'
+		}
+	}
+
+	if _, err := p.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *Prefixer) header() string {
+	if p.timeLayout == "" {
+		return p.prefix
+	}
+	return p.prefix + p.now().Format(p.timeLayout) + " "
+}
@@ -0,0 +1,161 @@
+package lines_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/lines"
+)
+
+func TestSplitter(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		writes    []string
+		maxLength int
+
+		want           []string
+		wantAfterFlush []string
+	}{
+		"single line":                   {writes: []string{"hello\n"}, want: []string{"hello"}},
+		"several lines":                 {writes: []string{"a\nb\nc\n"}, want: []string{"a", "b", "c"}},
+		"empty lines":                   {writes: []string{"\n\na\n\n"}, want: []string{"", "", "a", ""}},
+		"line split across writes":      {writes: []string{"hel", "lo", "\nwor", "ld\n"}, want: []string{"hello", "world"}},
+		"one byte at a time":            {writes: strings.Split("ab\ncd\n", ""), want: []string{"ab", "cd"}},
+		"windows line endings":          {writes: []string{"a\r\nb\r\n"}, want: []string{"a", "b"}},
+		"windows line ending split":     {writes: []string{"a\r", "\nb\r", "\n"}, want: []string{"a", "b"}},
+		"empty lines with windows ends": {writes: []string{"a\r\n\r\n\r\nb\r\n"}, want: []string{"a", "", "", "b"}},
+		"progress bar":                  {writes: []string{"10%\r", "50%\r", "100%\r\n", "done\n"}, want: []string{"10%", "50%", "100%", "done"}},
+		"progress bar leading CR":       {writes: []string{"\r10%", "\r50%", "\r100%\n"}, want: []string{"10%", "50%", "100%"}},
+		"CR followed by text":           {writes: []string{"a\rb\n"}, want: []string{"a", "b"}},
+
+		"partial line is kept":           {writes: []string{"a\nincomplete"}, want: []string{"a"}, wantAfterFlush: []string{"incomplete"}},
+		"partial line after CR":          {writes: []string{"50%\r100%"}, want: []string{"50%"}, wantAfterFlush: []string{"100%"}},
+		"nothing to flush after CR":      {writes: []string{"50%\r"}, want: []string{"50%"}},
+		"long line is cut":               {writes: []string{"abcdefgh\n"}, maxLength: 3, want: []string{"abc", "def", "gh"}},
+		"long line is cut across writes": {writes: []string{"ab", "cdefg", "h", "\n"}, maxLength: 3, want: []string{"abc", "def", "gh"}},
+		"long line without end is cut":   {writes: []string{"abcdefgh"}, maxLength: 3, want: []string{"abc", "def"}, wantAfterFlush: []string{"gh"}},
+		"line of exactly the maximum":    {writes: []string{"abc\n"}, maxLength: 3, want: []string{"abc"}},
+		"no maximum length":              {writes: []string{"abcdefgh\n"}, maxLength: -1, want: []string{"abcdefgh"}},
+		"nothing written":                {writes: nil},
+		"empty write":                    {writes: []string{""}},
+		"unicode is not altered":         {writes: []string{"ドキュ", "メント\n"}, want: []string{"ドキュメント"}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			var raw bytes.Buffer
+			s := lines.NewSplitter(&raw, func(line string) { got = append(got, line) })
+			if tc.maxLength != 0 {
+				s.MaxLength = tc.maxLength
+			}
+
+			for _, w := range tc.writes {
+				n, err := s.Write([]byte(w))
+				require.NoError(t, err, "Write should not return an error")
+				require.Equal(t, len(w), n, "Write should report all bytes as written")
+			}
+			require.Equal(t, tc.want, got, "Unexpected lines before flushing")
+
+			require.NoError(t, s.Flush(), "Flush should not return an error")
+			require.Equal(t, append(tc.want, tc.wantAfterFlush...), got, "Unexpected lines after flushing")
+
+			require.Equal(t, strings.Join(tc.writes, ""), raw.String(), "Output should be forwarded unchanged")
+		})
+	}
+}
+
+func TestSplitterDefaultMaxLength(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+	s := lines.NewSplitter(nil, func(line string) { got = append(got, line) })
+
+	_, err := s.Write(bytes.Repeat([]byte("x"), 2*lines.MaxLength+1))
+	require.NoError(t, err, "Write should not return an error")
+	require.Len(t, got, 2, "Lines over the maximum length should be handed over in pieces")
+	require.Len(t, got[0], lines.MaxLength, "Pieces should be of the maximum length")
+
+	require.NoError(t, s.Flush(), "Flush should not return an error")
+	require.Equal(t, []string{"x"}, got[2:], "The rest of the line should be handed over on flush")
+}
+
+func TestSplitterWriteError(t *testing.T) {
+	t.Parallel()
+
+	var called bool
+	s := lines.NewSplitter(failingWriter{}, func(string) { called = true })
+
+	_, err := s.Write([]byte("hello\n"))
+	require.Error(t, err, "Write should return the error of the underlying writer")
+	require.False(t, called, "No line should be handed over if the underlying writer failed")
+}
+
+func TestPrefixer(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		writes     []string
+		timeLayout string
+
+		want string
+	}{
+		"single line":               {writes: []string{"hello\n"}, want: "[p] hello\n"},
+		"several lines":             {writes: []string{"a\nb\n"}, want: "[p] a\n[p] b\n"},
+		"empty lines":               {writes: []string{"\n\n"}, want: "[p] \n[p] \n"},
+		"partial line":              {writes: []string{"a\nincomplete"}, want: "[p] a\n[p] incomplete"},
+		"line split across writes":  {writes: []string{"hel", "lo\n", "world"}, want: "[p] hello\n[p] world"},
+		"windows line endings":      {writes: []string{"a\r\nb\r\n"}, want: "[p] a\r\n[p] b\r\n"},
+		"windows line ending split": {writes: []string{"a\r", "\nb"}, want: "[p] a\r\n[p] b"},
+		"progress bar":              {writes: []string{"10%\r", "50%\r", "100%\n"}, want: "[p] 10%\r[p] 50%\r[p] 100%\n"},
+		"progress bar leading CR":   {writes: []string{"\r10%", "\r50%\n"}, want: "\r[p] 10%\r[p] 50%\n"},
+		"very long line":            {writes: []string{strings.Repeat("x", 100000), "\n"}, want: "[p] " + strings.Repeat("x", 100000) + "\n"},
+		"nothing written":           {},
+
+		"timestamp":                   {writes: []string{"a\nb\n"}, timeLayout: "15:04:05", want: "[p] 12:34:56 a\n[p] 12:34:56 b\n"},
+		"timestamp on partial line":   {writes: []string{"a"}, timeLayout: "15:04:05", want: "[p] 12:34:56 a"},
+		"timestamp with progress bar": {writes: []string{"1\r2\n"}, timeLayout: "15:04:05", want: "[p] 12:34:56 1\r[p] 12:34:56 2\n"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			now := func() time.Time { return time.Date(2022, 1, 2, 12, 34, 56, 0, time.UTC) }
+
+			var out bytes.Buffer
+			p := lines.NewPrefixer(&out, "[p] ", tc.timeLayout, now)
+			for _, w := range tc.writes {
+				n, err := p.Write([]byte(w))
+				require.NoError(t, err, "Write should not return an error")
+				require.Equal(t, len(w), n, "Write should report all bytes as written")
+			}
+
+			require.Equal(t, tc.want, out.String(), "Unexpected prefixed output")
+		})
+	}
+}
+
+func TestPrefixerWriteError(t *testing.T) {
+	t.Parallel()
+
+	p := lines.NewPrefixer(failingWriter{}, "[p] ", "", nil)
+	n, err := p.Write([]byte("hello\n"))
+	require.Error(t, err, "Write should return the error of the underlying writer")
+	require.Zero(t, n, "Write should not report bytes as written if the underlying writer failed")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("mock error")
+}
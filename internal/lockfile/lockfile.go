@@ -0,0 +1,118 @@
+// Package lockfile locks files, so that processes can take turns using what they
+// share, such as a directory of downloads.
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pollInterval is how often a lock held by someone else is attempted again.
+const pollInterval = 100 * time.Millisecond
+
+// errLocked is returned by tryLock when someone else holds the lock.
+var errLocked = errors.New("the file is locked")
+
+// Lock is a lock on a file. It is held by an open file, so that it is released if
+// the process dies. Locks exclude each other within a process as well.
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Acquire locks the file at path exclusively, creating it if needed. It waits until
+// whoever holds the lock releases it, or until the context is done.
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	return acquire(ctx, path, false)
+}
+
+// AcquireShared is like Acquire, but the lock can be held by several at once, as
+// long as nobody holds it exclusively.
+func AcquireShared(ctx context.Context, path string) (*Lock, error) {
+	return acquire(ctx, path, true)
+}
+
+// TryAcquire locks the file at path exclusively, creating it if needed. It does not
+// wait: ok is false if someone else holds the lock.
+func TryAcquire(path string) (l *Lock, ok bool, err error) {
+	l, err = lock(path, false)
+	if errors.Is(err, errLocked) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return l, true, nil
+}
+
+func acquire(ctx context.Context, path string, shared bool) (*Lock, error) {
+	for {
+		l, err := lock(path, shared)
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, errLocked) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// lock locks the file at path, or returns errLocked if someone else holds the lock.
+func lock(path string, shared bool) (*Lock, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open lock file: %v", err)
+		}
+
+		err = tryLock(f, shared)
+		if errors.Is(err, errLocked) {
+			f.Close()
+			return nil, err
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %v", path, err)
+		}
+
+		// The file may have been removed by whoever held the lock before, in which
+		// case others lock a new file at path: the lock on this one is worthless.
+		if current, err := os.Stat(path); err == nil {
+			if info, err := f.Stat(); err == nil && os.SameFile(info, current) {
+				return &Lock{f: f, path: path}, nil
+			}
+		}
+		//nolint: errcheck // The file is not ours anymore, the lock is given up on
+		unlock(f)
+		f.Close()
+	}
+}
+
+// Release releases the lock. The lock file is left in place: see Remove.
+func (l *Lock) Release() error {
+	err := unlock(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not release lock: %v", err)
+	}
+	return nil
+}
+
+// Remove removes the lock file and releases the lock, for when what it protects
+// is gone. Those waiting for the lock lock a new file instead. On Windows, where
+// files cannot be removed while they are open, the lock is released first, and
+// the lock file is left in place if others have it open.
+func (l *Lock) Remove() error {
+	return remove(l)
+}
@@ -0,0 +1,135 @@
+package lockfile_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/lockfile"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.lock")
+
+	l, err := lockfile.Acquire(context.Background(), p)
+	require.NoError(t, err, "Acquire should not have failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = lockfile.Acquire(ctx, p)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "Acquire should have waited for the lock until the context was done")
+
+	require.NoError(t, l.Release(), "Release should not have failed")
+
+	l, err = lockfile.Acquire(context.Background(), p)
+	require.NoError(t, err, "Acquire should not have failed once the lock was released")
+	require.NoError(t, l.Release(), "Release should not have failed")
+
+	_, err = lockfile.Acquire(context.Background(), filepath.Join(t.TempDir(), "missing", "test.lock"))
+	require.Error(t, err, "Acquire should have failed in a directory that does not exist")
+}
+
+func TestAcquireExcludes(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.lock")
+
+	var mu sync.Mutex
+	holders, maxHolders := 0, 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			l, err := lockfile.Acquire(context.Background(), p)
+			require.NoError(t, err, "Acquire should not have failed")
+
+			mu.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+
+			require.NoError(t, l.Release(), "Release should not have failed")
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, maxHolders, "The lock should have been held by one goroutine at a time")
+}
+
+func TestAcquireShared(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.lock")
+
+	first, err := lockfile.AcquireShared(context.Background(), p)
+	require.NoError(t, err, "AcquireShared should not have failed")
+	second, err := lockfile.AcquireShared(context.Background(), p)
+	require.NoError(t, err, "AcquireShared should not have waited for another shared lock")
+
+	_, ok, err := lockfile.TryAcquire(p)
+	require.NoError(t, err, "TryAcquire should not have failed")
+	require.False(t, ok, "TryAcquire should not have locked a file with shared locks")
+
+	require.NoError(t, first.Release(), "Release should not have failed")
+	_, ok, err = lockfile.TryAcquire(p)
+	require.NoError(t, err, "TryAcquire should not have failed")
+	require.False(t, ok, "TryAcquire should not have locked a file with a shared lock left")
+
+	require.NoError(t, second.Release(), "Release should not have failed")
+	l, ok, err := lockfile.TryAcquire(p)
+	require.NoError(t, err, "TryAcquire should not have failed")
+	require.True(t, ok, "TryAcquire should have locked a file without locks")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = lockfile.AcquireShared(ctx, p)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "AcquireShared should have waited for the exclusive lock until the context was done")
+
+	require.NoError(t, l.Release(), "Release should not have failed")
+}
+
+func TestRemove(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "test.lock")
+
+	l, err := lockfile.Acquire(context.Background(), p)
+	require.NoError(t, err, "Acquire should not have failed")
+
+	acquired := make(chan *lockfile.Lock)
+	go func() {
+		l, err := lockfile.Acquire(context.Background(), p)
+		require.NoError(t, err, "Acquire should not have failed once the lock file was removed")
+		acquired <- l
+	}()
+
+	// Leaving time for the other goroutine to wait for the lock.
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, l.Remove(), "Remove should not have failed")
+	require.NoFileExists(t, p, "The lock file should have been removed")
+
+	l = <-acquired
+	require.FileExists(t, p, "Waiting for the lock should have created a new lock file")
+	_, ok, err := lockfile.TryAcquire(p)
+	require.NoError(t, err, "TryAcquire should not have failed")
+	require.False(t, ok, "The new lock file should be locked by whoever waited for it")
+
+	require.NoError(t, l.Remove(), "Remove should not have failed")
+	require.NoFileExists(t, p, "The lock file should have been removed")
+}
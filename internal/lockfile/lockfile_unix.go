@@ -0,0 +1,41 @@
+//go:build !windows
+
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func tryLock(f *os.File, shared bool) error {
+	how := unix.LOCK_EX
+	if shared {
+		how = unix.LOCK_SH
+	}
+
+	err := unix.Flock(int(f.Fd()), how|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return errLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
+
+func remove(l *Lock) error {
+	// The file is removed before the lock is released, so that nobody locks it in
+	// between and keeps the lock on a file that is gone.
+	removeErr := os.Remove(l.path)
+	if err := l.Release(); err != nil {
+		return err
+	}
+	if removeErr != nil && !os.IsNotExist(removeErr) {
+		return fmt.Errorf("could not remove lock file: %v", removeErr)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func tryLock(f *os.File, shared bool) error {
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if !shared {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	// Only the first byte is locked: that is enough for locks to exclude each other.
+	var ol windows.Overlapped
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	var ol windows.Overlapped
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
+
+func remove(l *Lock) error {
+	if err := l.Release(); err != nil {
+		return err
+	}
+	// This fails if others have the file open, waiting for the lock: they lock it
+	// in turn, and remove it if they are done with it as well.
+	//nolint: errcheck // The lock file is removed on a best-effort basis
+	os.Remove(l.path)
+	return nil
+}
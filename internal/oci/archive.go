@@ -0,0 +1,172 @@
+package oci
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+// archiveFS is a read-only filesystem with the regular files of a tar archive,
+// such as one made by docker save. The files are read in place, so the archive
+// is not compressed: compressed archives are decompressed into a temporary file.
+type archiveFS struct {
+	f       *os.File
+	files   map[string]archiveEntry
+	cleanup func()
+}
+
+type archiveEntry struct {
+	offset int64
+	size   int64
+	mode   fs.FileMode
+	mtime  time.Time
+}
+
+// openArchive indexes the tar archive at p, possibly compressed.
+func openArchive(p string) (_ *archiveFS, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	afs := &archiveFS{f: f, files: make(map[string]archiveEntry), cleanup: func() {}}
+	defer func() {
+		if err != nil {
+			afs.Close()
+		}
+	}()
+
+	// Files inside compressed archives cannot be read in place.
+	tr, format, err := rootfs.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr.Close()
+
+	if format != rootfs.FormatTar {
+		if err := afs.decompress(format); err != nil {
+			return nil, err
+		}
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	cr := &countingReader{r: afs.f}
+	t := tar.NewReader(cr)
+	for {
+		hdr, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if !fs.ValidPath(name) {
+			continue
+		}
+		// The data of the entry starts right after its header.
+		afs.files[name] = archiveEntry{offset: cr.n, size: hdr.Size, mode: hdr.FileInfo().Mode(), mtime: hdr.ModTime}
+	}
+
+	return afs, nil
+}
+
+// decompress replaces the archive with a decompressed copy in a temporary file.
+func (afs *archiveFS) decompress(format rootfs.Format) error {
+	if _, err := afs.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	zr, _, err := rootfs.NewReader(afs.f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tmp, err := os.CreateTemp("", "gowsl-image-*.tar")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %v", err)
+	}
+	src := afs.f
+	afs.f = tmp
+	afs.cleanup = func() { os.Remove(tmp.Name()) }
+	defer src.Close()
+
+	if _, err := io.Copy(tmp, zr); err != nil {
+		return fmt.Errorf("could not decompress %s archive: %v", format, err)
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close closes the archive, and removes its decompressed copy, if any.
+func (afs *archiveFS) Close() error {
+	err := afs.f.Close()
+	afs.cleanup()
+	return err
+}
+
+// Open implements fs.FS.
+func (afs *archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := afs.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &archiveFile{SectionReader: io.NewSectionReader(afs.f, e.offset, e.size), name: name, entry: e}, nil
+}
+
+type archiveFile struct {
+	*io.SectionReader
+	name  string
+	entry archiveEntry
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return archiveFileInfo{f}, nil }
+func (f *archiveFile) Close() error               { return nil }
+
+type archiveFileInfo struct {
+	f *archiveFile
+}
+
+func (fi archiveFileInfo) Name() string       { return path.Base(fi.f.name) }
+func (fi archiveFileInfo) Size() int64        { return fi.f.entry.size }
+func (fi archiveFileInfo) Mode() fs.FileMode  { return fi.f.entry.mode }
+func (fi archiveFileInfo) ModTime() time.Time { return fi.f.entry.mtime }
+func (fi archiveFileInfo) IsDir() bool        { return false }
+func (fi archiveFileInfo) Sys() any           { return nil }
+
+// countingReader counts the bytes read and skipped, to know the offset of the
+// entries of a tar archive.
+type countingReader struct {
+	r io.ReadSeeker
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Seek lets the tar reader skip the data of entries without reading it.
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	n, err := r.r.Seek(offset, whence)
+	if err == nil {
+		r.n = n
+	}
+	return n, err
+}
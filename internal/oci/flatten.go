@@ -0,0 +1,238 @@
+package oci
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+// Options tweak how images are flattened.
+type Options struct {
+	// Architecture selects the image among those of a multi-platform image, in the
+	// terms of GOARCH. It defaults to runtime.GOARCH.
+	Architecture string
+}
+
+// Prefixes of the names of whiteout files, which delete files of the layers below.
+// See https://github.com/opencontainers/image-spec/blob/main/layer.md#whiteouts.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutMeta   = ".wh..wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Flatten writes the root filesystem of the container image at src into w, as a
+// tarball compressed with gzip. src is either a directory with an OCI image layout,
+// or a tar archive, possibly compressed, of one or made by docker save.
+//
+// The layers of the image are applied in order, with their whiteouts, and the
+// digests of the layers are verified when they are known.
+func Flatten(ctx context.Context, w io.Writer, src string, opts Options) error {
+	if opts.Architecture == "" {
+		opts.Architecture = runtime.GOARCH
+	}
+
+	fsys, closeImage, err := openImage(src)
+	if err != nil {
+		return fmt.Errorf("could not open image: %v", err)
+	}
+	defer closeImage()
+
+	ls, err := layers(fsys, opts.Architecture)
+	if err != nil {
+		return err
+	}
+	if len(ls) == 0 {
+		return errors.New("the image has no layers")
+	}
+
+	// Every layer hides parts of the layers below it, and they can only be read
+	// in order: the layers are read a first time to know what is hidden.
+	s := newShadows()
+	for i, l := range ls {
+		if err := s.scan(ctx, i, l); err != nil {
+			return fmt.Errorf("could not read layer %s: %v", l.name, err)
+		}
+	}
+
+	zw := rootfs.NewGzipWriter(w)
+	tw := tar.NewWriter(zw)
+
+	for i, l := range ls {
+		if err := s.copy(ctx, tw, i, l); err != nil {
+			return fmt.Errorf("could not flatten layer %s: %v", l.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("could not write rootfs: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("could not write rootfs: %v", err)
+	}
+	return nil
+}
+
+// openImage returns the filesystem of the image at src, be it a directory or an archive.
+func openImage(src string) (fsys fs.FS, closeImage func(), err error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(src), func() {}, nil
+	}
+
+	afs, err := openArchive(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return afs, func() { afs.Close() }, nil
+}
+
+// shadows records, for every path, the highest layer that hides it from the layers
+// below it.
+type shadows struct {
+	last      map[string]int // Layer with the last entry at the path
+	whiteouts map[string]int // Layer that deletes the path
+	opaque    map[string]int // Layer that deletes the contents of the directory at the path
+	nonDirs   map[string]int // Layer with a file that is not a directory at the path, which deletes its contents
+}
+
+func newShadows() *shadows {
+	return &shadows{
+		last:      make(map[string]int),
+		whiteouts: make(map[string]int),
+		opaque:    make(map[string]int),
+		nonDirs:   make(map[string]int),
+	}
+}
+
+// scan records what the layer hides, and verifies its digest.
+func (s *shadows) scan(ctx context.Context, i int, l layer) error {
+	return readLayer(ctx, l, func(name string, hdr *tar.Header, _ io.Reader) error {
+		dir, base := path.Split(name)
+		dir = path.Clean(dir)
+
+		switch {
+		case base == whiteoutOpaque:
+			s.opaque[dir] = i
+		case strings.HasPrefix(base, whiteoutMeta):
+			// Other metadata of aufs, which is meaningless here.
+		case strings.HasPrefix(base, whiteoutPrefix):
+			s.whiteouts[path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))] = i
+		default:
+			s.last[name] = i
+			if hdr.Typeflag != tar.TypeDir {
+				s.nonDirs[name] = i
+			}
+		}
+		return nil
+	})
+}
+
+// copy writes the entries of the layer that are not hidden by the layers above it.
+func (s *shadows) copy(ctx context.Context, tw *tar.Writer, i int, l layer) error {
+	return readLayer(ctx, l, func(name string, hdr *tar.Header, r io.Reader) error {
+		if strings.HasPrefix(path.Base(name), whiteoutPrefix) || !s.visible(i, name) {
+			return nil
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+}
+
+// visible returns true if the entry at name in layer i is not hidden by the layers above.
+func (s *shadows) visible(i int, name string) bool {
+	if s.last[name] > i {
+		return false
+	}
+
+	for p := name; p != "/"; p = path.Dir(p) {
+		if j, ok := s.whiteouts[p]; ok && j > i {
+			return false
+		}
+		if p == name {
+			continue
+		}
+		if j, ok := s.opaque[p]; ok && j > i {
+			return false
+		}
+		if j, ok := s.nonDirs[p]; ok && j > i {
+			return false
+		}
+	}
+	return true
+}
+
+// readLayer calls f on every entry of the layer, with its absolute path, and
+// verifies its digest if it is known.
+func readLayer(ctx context.Context, l layer, f func(name string, hdr *tar.Header, r io.Reader) error) error {
+	blob, err := l.open()
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	var raw io.Reader = blob
+	var v *verifier
+	if l.digest != "" {
+		v = newVerifier(l.digest)
+		raw = io.TeeReader(blob, v)
+	}
+
+	zr, _, err := rootfs.NewReader(raw)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name, ok := rootfs.CleanName(hdr.Name)
+		if !ok {
+			return fmt.Errorf("invalid entry name %q: it climbs above the root", hdr.Name)
+		}
+		if name == "/" {
+			continue
+		}
+
+		if err := f(name, hdr, tr); err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+	// The digest covers what is after the end of the archive as well.
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return err
+	}
+	return v.verify()
+}
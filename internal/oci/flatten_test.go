@@ -0,0 +1,327 @@
+package oci_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/oci"
+)
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+
+	layers := [][]entry{
+		{
+			dir("etc"), file("etc/a", "a0"), file("etc/b", "b0"),
+			dir("opt"), dir("opt/x"), file("opt/x/1", "1"),
+			dir("var"), file("var/keep", "k"),
+			dir("srv"), file("srv/old", "o"),
+			symlink("usr/lib64", "lib"),
+		},
+		{
+			file("etc/a", "a1"),
+			file("etc/.wh.b", ""),
+			file(".wh.opt", ""),
+			dir("var"), file("var/.wh..wh..opq", ""), file("var/new", "n"),
+			file("srv", "s"),
+		},
+		{
+			dir("opt"), file("opt/y", "y"),
+		},
+	}
+	want := map[string]string{
+		"etc/":      "dir",
+		"etc/a":     "a1",
+		"var/":      "dir",
+		"var/new":   "n",
+		"srv":       "s",
+		"opt/":      "dir",
+		"opt/y":     "y",
+		"usr/lib64": "-> lib",
+	}
+
+	testCases := map[string]struct {
+		image    string // Kind of image, see writeImage
+		arch     string
+		layers   [][]entry
+		cancel   bool
+		breakDig bool // Corrupts the first layer
+
+		want    map[string]string
+		wantErr bool
+	}{
+		"from an OCI layout":                          {image: "oci"},
+		"from an OCI layout with uncompressed layers": {image: "oci-uncompressed"},
+		"from an OCI archive":                         {image: "oci-archive"},
+		"from a docker save archive":                  {image: "docker"},
+		"from a compressed docker save archive":       {image: "docker-gzip"},
+		"from a multi-platform image":                 {image: "multi-platform", arch: "arm64"},
+		"from a nested multi-platform image":          {image: "nested", arch: "arm64"},
+
+		"error when there is no image for the architecture":            {image: "multi-platform", arch: "riscv64", wantErr: true},
+		"error when there are several images":                          {image: "several", wantErr: true},
+		"error when there are several images in a docker save archive": {image: "docker-several", wantErr: true},
+		"error when the digest of a layer does not match":              {image: "oci", breakDig: true, wantErr: true},
+		"error when a layer is missing":                                {image: "oci-missing-layer", wantErr: true},
+		"error when an entry climbs above the root":                    {image: "oci", layers: [][]entry{{file("../evil", "evil")}}, wantErr: true},
+		"error when the image has no layers":                           {image: "oci", layers: [][]entry{}, wantErr: true},
+		"error when it is not an image":                                {image: "not-an-image", wantErr: true},
+		"error when the image does not exist":                          {image: "inexistent", wantErr: true},
+		"error when the context is cancelled":                          {image: "oci", cancel: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.layers == nil {
+				tc.layers = layers
+				tc.want = want
+			}
+			if tc.arch == "" {
+				tc.arch = "amd64"
+			}
+
+			src := writeImage(t, tc.image, tc.layers, tc.breakDig)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				cancel()
+			}
+
+			var out bytes.Buffer
+			err := oci.Flatten(ctx, &out, src, oci.Options{Architecture: tc.arch})
+			if tc.wantErr {
+				require.Error(t, err, "Flatten should have failed")
+				return
+			}
+			require.NoError(t, err, "Flatten should not have failed")
+
+			require.Equal(t, tc.want, readRootfs(t, out.Bytes()), "Unexpected contents of the flattened rootfs")
+		})
+	}
+}
+
+// entry is an entry of a generated layer.
+type entry struct {
+	hdr  tar.Header
+	data string
+}
+
+func dir(name string) entry {
+	return entry{hdr: tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755}}
+}
+
+func file(name, data string) entry {
+	return entry{hdr: tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data))}, data: data}
+}
+
+func symlink(name, target string) entry {
+	return entry{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target, Mode: 0777}}
+}
+
+// makeTar generates a tar archive with the given entries, compressed with gzip if asked.
+func makeTar(t *testing.T, entries []entry, compress bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := e.hdr
+		require.NoError(t, tw.WriteHeader(&hdr), "Setup: could not write tar header")
+		_, err := tw.Write([]byte(e.data))
+		require.NoError(t, err, "Setup: could not write tar entry")
+	}
+	require.NoError(t, tw.Close(), "Setup: could not close tar writer")
+	if zw != nil {
+		require.NoError(t, zw.Close(), "Setup: could not close gzip writer")
+	}
+	return buf.Bytes()
+}
+
+// imageWriter writes the files of an image, into a directory or a tar archive.
+type imageWriter struct {
+	t     *testing.T
+	files []entry
+}
+
+func (w *imageWriter) add(name string, data []byte) {
+	w.files = append(w.files, file(name, string(data)))
+}
+
+// blob adds a content-addressed blob, and returns its descriptor.
+func (w *imageWriter) blob(mediaType string, data []byte) map[string]any {
+	sum := sha256.Sum256(data)
+	w.add("blobs/sha256/"+hex.EncodeToString(sum[:]), data)
+	return map[string]any{"mediaType": mediaType, "digest": "sha256:" + hex.EncodeToString(sum[:]), "size": len(data)}
+}
+
+func (w *imageWriter) json(v any) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(w.t, err, "Setup: could not marshal JSON")
+	return data
+}
+
+// manifest adds the layers and the image manifest, and returns its descriptor.
+func (w *imageWriter) manifest(layers [][]entry, compress bool) map[string]any {
+	mediaType := "application/vnd.oci.image.layer.v1.tar"
+	if compress {
+		mediaType += "+gzip"
+	}
+
+	descs := []map[string]any{}
+	for _, l := range layers {
+		descs = append(descs, w.blob(mediaType, makeTar(w.t, l, compress)))
+	}
+	config := w.blob("application/vnd.oci.image.config.v1+json", []byte(`{"architecture":"amd64","os":"linux"}`))
+
+	m := map[string]any{"schemaVersion": 2, "config": config, "layers": descs}
+	return w.blob("application/vnd.oci.image.manifest.v1+json", w.json(m))
+}
+
+func (w *imageWriter) index(manifests ...map[string]any) []byte {
+	return w.json(map[string]any{"schemaVersion": 2, "manifests": manifests})
+}
+
+// writeImage writes an image of the given kind with the given layers, and returns its path.
+func writeImage(t *testing.T, kind string, layers [][]entry, breakDigest bool) string {
+	t.Helper()
+
+	dst := filepath.Join(t.TempDir(), "image")
+	w := &imageWriter{t: t}
+	platform := func(m map[string]any, arch string) map[string]any {
+		m["platform"] = map[string]any{"os": "linux", "architecture": arch}
+		return m
+	}
+
+	switch kind {
+	case "oci", "oci-archive", "oci-missing-layer":
+		w.add("index.json", w.index(w.manifest(layers, true)))
+	case "oci-uncompressed":
+		w.add("index.json", w.index(w.manifest(layers, false)))
+	case "multi-platform":
+		w.add("index.json", w.index(
+			platform(w.manifest([][]entry{{file("wrong", "amd64")}}, true), "amd64"),
+			platform(w.manifest(layers, true), "arm64"),
+			map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:" + fmt.Sprintf("%064d", 0),
+				"annotations": map[string]string{"vnd.docker.reference.type": "attestation-manifest"}},
+		))
+	case "nested":
+		nested := w.index(
+			platform(w.manifest([][]entry{{file("wrong", "amd64")}}, true), "amd64"),
+			platform(w.manifest(layers, true), "arm64"),
+		)
+		w.add("index.json", w.index(w.blob("application/vnd.oci.image.index.v1+json", nested)))
+	case "several":
+		w.add("index.json", w.index(w.manifest(layers, true), w.manifest([][]entry{{file("other", "")}}, true)))
+	case "docker", "docker-gzip", "docker-several":
+		var paths []string
+		for i, l := range layers {
+			p := fmt.Sprintf("%d/layer.tar", i)
+			w.add(p, makeTar(t, l, false))
+			paths = append(paths, p)
+		}
+		manifests := []map[string]any{{"Config": "config.json", "RepoTags": []string{"ubuntu:latest"}, "Layers": paths}}
+		if kind == "docker-several" {
+			manifests = append(manifests, map[string]any{"Config": "config.json", "RepoTags": []string{"alpine:latest"}, "Layers": paths})
+		}
+		w.add("manifest.json", w.json(manifests))
+	case "not-an-image":
+		w.add("hello", []byte("world"))
+	case "inexistent":
+		return dst
+	default:
+		require.Failf(t, "Setup: unknown kind of image", "%q", kind)
+	}
+	w.add("oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`))
+
+	if breakDigest || kind == "oci-missing-layer" {
+		for i, f := range w.files {
+			if f.hdr.Name != "blobs/sha256/"+layerDigest(t, layers[0]) {
+				continue
+			}
+			if kind == "oci-missing-layer" {
+				w.files = append(w.files[:i], w.files[i+1:]...)
+				break
+			}
+			w.files[i] = file(f.hdr.Name, string(makeTar(t, append(layers[0], file("extra", "")), true)))
+			break
+		}
+	}
+
+	switch kind {
+	case "oci-archive":
+		require.NoError(t, os.WriteFile(dst, makeTar(t, w.files, false), 0600), "Setup: could not write image")
+	case "docker", "docker-several":
+		require.NoError(t, os.WriteFile(dst, makeTar(t, w.files, false), 0600), "Setup: could not write image")
+	case "docker-gzip":
+		require.NoError(t, os.WriteFile(dst, makeTar(t, w.files, true), 0600), "Setup: could not write image")
+	default:
+		for _, f := range w.files {
+			p := filepath.Join(dst, filepath.FromSlash(f.hdr.Name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700), "Setup: could not create image directory")
+			require.NoError(t, os.WriteFile(p, []byte(f.data), 0600), "Setup: could not write image file")
+		}
+	}
+	return dst
+}
+
+// layerDigest returns the hex digest of the compressed layer.
+func layerDigest(t *testing.T, l []entry) string {
+	t.Helper()
+
+	sum := sha256.Sum256(makeTar(t, l, true))
+	return hex.EncodeToString(sum[:])
+}
+
+// readRootfs describes the entries of a gzip-compressed rootfs: directories,
+// file contents, or link targets.
+func readRootfs(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err, "The rootfs should be compressed with gzip")
+
+	got := make(map[string]string)
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err, "The rootfs should be readable")
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			got[hdr.Name] = "dir"
+		case tar.TypeSymlink:
+			got[hdr.Name] = "-> " + hdr.Linkname
+		default:
+			contents, err := io.ReadAll(tr)
+			require.NoError(t, err, "The rootfs should be readable")
+			got[hdr.Name] = string(contents)
+		}
+	}
+	return got
+}
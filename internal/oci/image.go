@@ -0,0 +1,308 @@
+// Package oci flattens container images, in the OCI image layout or as saved by
+// docker, into the root filesystem of a distro.
+package oci
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Media types of the documents that point to image manifests.
+const (
+	mediaTypeOCIIndex   = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// descriptor points to a blob of an OCI image layout.
+// See https://github.com/opencontainers/image-spec/blob/main/descriptor.md.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p *platform) String() string {
+	if p == nil {
+		return "unknown platform"
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// index is an OCI image index, or a docker manifest list.
+type index struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// manifest is an OCI image manifest, or a docker one.
+type manifest struct {
+	Layers []descriptor `json:"layers"`
+}
+
+// dockerManifest is an entry of the manifest.json of docker save archives.
+type dockerManifest struct {
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// layer is a layer of an image, to be opened as many times as needed.
+type layer struct {
+	name   string // Path of the layer in the image
+	digest string // Digest of the layer, or empty if unknown
+	fsys   fs.FS
+}
+
+func (l layer) open() (io.ReadCloser, error) {
+	return l.fsys.Open(l.name)
+}
+
+// layers returns the layers of the image in fsys, from the bottom one to the top
+// one, for the given architecture.
+func layers(fsys fs.FS, arch string) ([]layer, error) {
+	if _, err := fs.Stat(fsys, "index.json"); err == nil {
+		return ociLayers(fsys, arch)
+	}
+	if _, err := fs.Stat(fsys, "manifest.json"); err == nil {
+		return dockerLayers(fsys)
+	}
+	return nil, errors.New("not an OCI image layout nor a docker save archive: there is neither index.json nor manifest.json")
+}
+
+// ociLayers returns the layers of the image of an OCI image layout.
+// See https://github.com/opencontainers/image-spec/blob/main/image-layout.md.
+func ociLayers(fsys fs.FS, arch string) ([]layer, error) {
+	data, err := fs.ReadFile(fsys, "index.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("could not parse index.json: %v", err)
+	}
+
+	manifests, err := imageManifests(fsys, idx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := selectManifest(manifests, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = readBlob(fsys, desc)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image manifest: %v", err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("could not parse image manifest %s: %v", desc.Digest, err)
+	}
+
+	out := make([]layer, 0, len(m.Layers))
+	for _, l := range m.Layers {
+		p, err := blobPath(l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, layer{name: p, digest: l.Digest, fsys: fsys})
+	}
+	return out, nil
+}
+
+// maxIndexDepth is the maximum nesting of image indexes, to avoid loops.
+const maxIndexDepth = 8
+
+// imageManifests returns the descriptors of the image manifests of an index,
+// looking into nested indexes.
+func imageManifests(fsys fs.FS, idx index, depth int) ([]descriptor, error) {
+	if depth > maxIndexDepth {
+		return nil, errors.New("image indexes are nested too deeply")
+	}
+
+	var out []descriptor
+	for _, desc := range idx.Manifests {
+		if desc.MediaType != mediaTypeOCIIndex && desc.MediaType != mediaTypeDockerList {
+			out = append(out, desc)
+			continue
+		}
+
+		data, err := readBlob(fsys, desc)
+		if err != nil {
+			return nil, fmt.Errorf("could not read image index: %v", err)
+		}
+		var nested index
+		if err := json.Unmarshal(data, &nested); err != nil {
+			return nil, fmt.Errorf("could not parse image index %s: %v", desc.Digest, err)
+		}
+		manifests, err := imageManifests(fsys, nested, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, manifests...)
+	}
+	return out, nil
+}
+
+// selectManifest returns the only image manifest for Linux on the architecture.
+// Manifests without a platform are candidates as well, unless they are
+// attestations, as added by docker buildx.
+func selectManifest(manifests []descriptor, arch string) (descriptor, error) {
+	var candidates []descriptor
+	for _, desc := range manifests {
+		if desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+			continue
+		}
+		if p := desc.Platform; p != nil && (p.OS != "linux" || p.Architecture != arch) {
+			continue
+		}
+		candidates = append(candidates, desc)
+	}
+
+	switch len(candidates) {
+	case 0:
+		found := make([]string, 0, len(manifests))
+		for _, desc := range manifests {
+			found = append(found, desc.Platform.String())
+		}
+		return descriptor{}, fmt.Errorf("there is no image for linux/%s, only for: %s", arch, strings.Join(found, ", "))
+	case 1:
+		return candidates[0], nil
+	}
+
+	names := make([]string, 0, len(candidates))
+	for _, desc := range candidates {
+		name := desc.Annotations["org.opencontainers.image.ref.name"]
+		if name == "" {
+			name = desc.Digest
+		}
+		names = append(names, name)
+	}
+	return descriptor{}, fmt.Errorf("there are several images for linux/%s: %s", arch, strings.Join(names, ", "))
+}
+
+// dockerLayers returns the layers of the image of a docker save archive.
+func dockerLayers(fsys fs.FS) ([]layer, error) {
+	data, err := fs.ReadFile(fsys, "manifest.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []dockerManifest
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("could not parse manifest.json: %v", err)
+	}
+
+	switch len(manifests) {
+	case 0:
+		return nil, errors.New("there is no image in manifest.json")
+	case 1:
+	default:
+		var tags []string
+		for _, m := range manifests {
+			tags = append(tags, m.RepoTags...)
+		}
+		return nil, fmt.Errorf("there are several images in the archive: %s", strings.Join(tags, ", "))
+	}
+
+	out := make([]layer, 0, len(manifests[0].Layers))
+	for _, p := range manifests[0].Layers {
+		name := path.Clean(p)
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid layer path %q", p)
+		}
+
+		// Layers of recent versions of docker are content-addressed blobs.
+		l := layer{name: name, fsys: fsys}
+		if rest, ok := strings.CutPrefix(name, "blobs/"); ok {
+			if digest := strings.Replace(rest, "/", ":", 1); digestRegexp.MatchString(digest) {
+				l.digest = digest
+			}
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+var digestRegexp = regexp.MustCompile(`^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$`)
+
+// blobPath returns the path of the blob with the given digest.
+func blobPath(digest string) (string, error) {
+	if !digestRegexp.MatchString(digest) {
+		return "", fmt.Errorf("invalid or unsupported digest %q", digest)
+	}
+	alg, encoded, _ := strings.Cut(digest, ":")
+	return path.Join("blobs", alg, encoded), nil
+}
+
+// readBlob reads the blob of a descriptor, and verifies its digest.
+func readBlob(fsys fs.FS, desc descriptor) ([]byte, error) {
+	p, err := blobPath(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newVerifier(desc.Digest)
+	v.Write(data)
+	if err := v.verify(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// verifier computes the digest of a blob as it is read.
+type verifier struct {
+	want string
+	hash hash.Hash
+}
+
+// newVerifier returns a verifier for the digest, which must be valid.
+func newVerifier(digest string) *verifier {
+	alg, _, _ := strings.Cut(digest, ":")
+	h := sha256.New()
+	if alg == "sha512" {
+		h = sha512.New()
+	}
+	return &verifier{want: digest, hash: h}
+}
+
+func (v *verifier) Write(p []byte) (int, error) {
+	return v.hash.Write(p)
+}
+
+func (v *verifier) verify() error {
+	alg, _, _ := strings.Cut(v.want, ":")
+	got := alg + ":" + hex.EncodeToString(v.hash.Sum(nil))
+	if got != v.want {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", v.want, got)
+	}
+	return nil
+}
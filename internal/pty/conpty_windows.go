@@ -0,0 +1,174 @@
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreatePseudoConsole = kernel32.NewProc("CreatePseudoConsole")
+	procResizePseudoConsole = kernel32.NewProc("ResizePseudoConsole")
+	procClosePseudoConsole  = kernel32.NewProc("ClosePseudoConsole")
+)
+
+// procThreadAttributePseudoConsole attaches a process to a pseudo-console.
+// https://learn.microsoft.com/en-us/windows/win32/api/processthreadsapi/nf-processthreadsapi-updateprocthreadattribute
+const procThreadAttributePseudoConsole = 0x00020016
+
+// conPTY is a Windows pseudo-console.
+type conPTY struct {
+	handle windows.Handle
+	input  *os.File // Our end of the input pipe
+	output *os.File // Our end of the output pipe
+
+	closeOnce       sync.Once
+	closeOutputOnce sync.Once
+}
+
+// Start launches the command line attached to a new pseudo-console of the given size,
+// in the directory dir (or the current one if empty).
+func Start(commandLine, dir string, size Size) (Console, *os.Process, error) {
+	if err := size.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := procCreatePseudoConsole.Find(); err != nil {
+		return nil, nil, errors.New("pseudo-consoles are not supported by this version of Windows")
+	}
+
+	c, err := newConPTY(size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := c.spawn(commandLine, dir)
+	if err != nil {
+		c.Close()
+		c.closeOutputOnce.Do(func() { c.output.Close() })
+		return nil, nil, err
+	}
+
+	return c, p, nil
+}
+
+func newConPTY(size Size) (c *conPTY, err error) {
+	// The pseudo-console reads its input from inR and writes its output into outW.
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not create input pipe: %v", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, fmt.Errorf("could not create output pipe: %v", err)
+	}
+
+	// The pseudo-console keeps its own copies of its ends of the pipes.
+	defer inR.Close()
+	defer outW.Close()
+
+	var handle windows.Handle
+	r1, _, _ := procCreatePseudoConsole.Call(
+		uintptr(coord(size)),
+		inR.Fd(),
+		outW.Fd(),
+		0,
+		uintptr(unsafe.Pointer(&handle)))
+	if r1 != uintptr(windows.S_OK) {
+		inW.Close()
+		outR.Close()
+		return nil, fmt.Errorf("could not create pseudo-console: HRESULT 0x%x", r1)
+	}
+
+	return &conPTY{handle: handle, input: inW, output: outR}, nil
+}
+
+// spawn starts the command line attached to the pseudo-console.
+func (c *conPTY) spawn(commandLine, dir string) (*os.Process, error) {
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		return nil, fmt.Errorf("could not create process attributes: %v", err)
+	}
+	defer attrs.Delete()
+
+	// This attribute takes the handle itself as its value, not a pointer to it.
+	value := *(*unsafe.Pointer)(unsafe.Pointer(&c.handle))
+	if err := attrs.Update(procThreadAttributePseudoConsole, value, unsafe.Sizeof(c.handle)); err != nil {
+		return nil, fmt.Errorf("could not attach process to pseudo-console: %v", err)
+	}
+
+	si := &windows.StartupInfoEx{ProcThreadAttributeList: attrs.List()}
+	si.Cb = uint32(unsafe.Sizeof(*si))
+	// Otherwise the process would inherit our standard handles rather than use the pseudo-console.
+	si.Flags = windows.STARTF_USESTDHANDLES
+
+	cmdLine, err := windows.UTF16PtrFromString(commandLine)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert command line %q to UTF16: %v", commandLine, err)
+	}
+
+	var cwd *uint16
+	if dir != "" {
+		cwd, err = windows.UTF16PtrFromString(dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert directory %q to UTF16: %v", dir, err)
+		}
+	}
+
+	var pi windows.ProcessInformation
+	err = windows.CreateProcess(nil, cmdLine, nil, nil, false,
+		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
+		nil, cwd, &si.StartupInfo, &pi)
+	if err != nil {
+		return nil, fmt.Errorf("could not start %q: %v", commandLine, err)
+	}
+	defer windows.CloseHandle(pi.Thread)
+	defer windows.CloseHandle(pi.Process)
+
+	return os.FindProcess(int(pi.ProcessId))
+}
+
+func (c *conPTY) Read(p []byte) (int, error) {
+	n, err := c.output.Read(p)
+	if err != nil {
+		// The output is over once the pseudo-console is closed and drained.
+		c.closeOutputOnce.Do(func() { c.output.Close() })
+	}
+	return n, err
+}
+
+func (c *conPTY) Write(p []byte) (int, error) {
+	return c.input.Write(p)
+}
+
+func (c *conPTY) Resize(size Size) error {
+	r1, _, _ := procResizePseudoConsole.Call(uintptr(c.handle), uintptr(coord(size)))
+	if r1 != uintptr(windows.S_OK) {
+		return fmt.Errorf("could not resize pseudo-console: HRESULT 0x%x", r1)
+	}
+	return nil
+}
+
+// Close closes the pseudo-console and its input. Its output is closed once it is
+// drained, as ClosePseudoConsole waits for it.
+func (c *conPTY) Close() error {
+	c.closeOnce.Do(func() {
+		//nolint: errcheck // ClosePseudoConsole has no return value
+		procClosePseudoConsole.Call(uintptr(c.handle))
+		c.input.Close()
+	})
+	return nil
+}
+
+// coord packs a size into a Windows COORD, which is passed by value.
+func coord(size Size) uint32 {
+	return uint32(size.Cols) | uint32(size.Rows)<<16
+}
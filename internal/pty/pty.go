@@ -0,0 +1,124 @@
+// Package pty connects processes attached to a pseudo-console with arbitrary
+// readers and writers, so that they can be embedded as terminals.
+//
+// The data path is independent from the console implementation, which is a
+// ConPTY on Windows. This allows testing it with a fake console anywhere.
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Size is the size of a console, in characters.
+type Size struct {
+	Cols uint16
+	Rows uint16
+}
+
+// Validate returns an error if the size cannot be used for a console.
+func (s Size) Validate() error {
+	if s.Cols == 0 || s.Rows == 0 {
+		return fmt.Errorf("invalid console size %dx%d", s.Cols, s.Rows)
+	}
+	return nil
+}
+
+// Console is our end of a pseudo-console. Writing into it types into the terminal,
+// and reading from it returns what the terminal displays, including escape sequences.
+type Console interface {
+	io.ReadWriter
+
+	// Resize changes the size of the terminal.
+	Resize(Size) error
+
+	// Close closes the terminal. The output that is pending can still be read,
+	// until Read returns io.EOF.
+	Close() error
+}
+
+// Session copies the input of a console from a reader, and its output into a writer.
+type Session struct {
+	console Console
+
+	mu     sync.Mutex
+	closed bool
+
+	outputDone chan struct{} // Closed when all the output was copied
+	outputErr  error         // Error copying the output, if any
+}
+
+// Attach starts copying stdin into the console, and the output of the console
+// into stdout. Copying stdin stops when it reaches EOF, fails, or the console
+// is closed. Copying the output stops when the console is closed and drained.
+func Attach(console Console, stdin io.Reader, stdout io.Writer) *Session {
+	s := &Session{
+		console:    console,
+		outputDone: make(chan struct{}),
+	}
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	go func() {
+		defer close(s.outputDone)
+		_, err := io.Copy(stdout, console)
+		if err != nil {
+			s.outputErr = err
+			// The console must still be drained, otherwise closing it could hang.
+			//nolint: errcheck // The error that matters was recorded already
+			io.Copy(io.Discard, console)
+		}
+	}()
+
+	if stdin != nil {
+		// This goroutine is not waited for: it may be blocked reading from stdin
+		// long after the process is gone, like with an interactive user.
+		go func() {
+			//nolint: errcheck // The input stops being copied once the console is closed
+			io.Copy(console, stdin)
+		}()
+	}
+
+	return s
+}
+
+// Resize changes the size of the console.
+func (s *Session) Resize(size Size) error {
+	if err := size.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("console is closed")
+	}
+	return s.console.Resize(size)
+}
+
+// Close closes the console, and waits until all its output is copied. It must
+// be called once the process attached to the console exits.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("console is already closed")
+	}
+	s.closed = true
+	err := s.console.Close()
+	s.mu.Unlock()
+
+	<-s.outputDone
+
+	if err != nil {
+		return fmt.Errorf("could not close console: %v", err)
+	}
+	if s.outputErr != nil {
+		return fmt.Errorf("could not copy console output: %v", s.outputErr)
+	}
+	return nil
+}
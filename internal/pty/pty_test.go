@@ -0,0 +1,225 @@
+package pty_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/pty"
+)
+
+func TestAttach(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		stdin       io.Reader
+		nilStdout   bool
+		failStdout  bool
+		exitOnInput bool // The fake process exits when it reads "exit"
+
+		wantOutput string
+		wantErr    bool
+	}{
+		"success":                         {stdin: strings.NewReader("hello\nworld\nexit\n"), exitOnInput: true, wantOutput: "> HELLO\n> WORLD\n"},
+		"success with no stdin":           {wantOutput: ""},
+		"success with no stdout":          {stdin: strings.NewReader("hello\nexit\n"), exitOnInput: true, nilStdout: true},
+		"success with stdin that blocks":  {stdin: blockingReader{}},
+		"success with stdin ending early": {stdin: strings.NewReader("hello\n"), wantOutput: "> HELLO\n"},
+		"error when stdout fails":         {stdin: strings.NewReader("hello\nworld\nexit\n"), exitOnInput: true, failStdout: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			console := newFakeConsole()
+			exited := console.run(tc.exitOnInput)
+
+			var stdout io.Writer
+			out := &syncBuffer{}
+			if !tc.nilStdout {
+				stdout = out
+			}
+			if tc.failStdout {
+				stdout = failingWriter{}
+			}
+
+			s := pty.Attach(console, tc.stdin, stdout)
+
+			if tc.exitOnInput {
+				select {
+				case <-exited:
+				case <-time.After(5 * time.Second):
+					require.Fail(t, "The fake process did not exit")
+				}
+			} else {
+				// Give the input time to be processed before the process "exits".
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			done := make(chan error)
+			go func() { done <- s.Close() }()
+
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "Close did not return")
+			}
+
+			if tc.wantErr {
+				require.Error(t, err, "Close should return an error")
+			} else {
+				require.NoError(t, err, "Close should not return an error")
+			}
+			require.True(t, console.drained(), "The output of the console should be drained")
+
+			if !tc.nilStdout && !tc.failStdout {
+				require.Equal(t, tc.wantOutput, out.String(), "Unexpected output")
+			}
+
+			require.Error(t, s.Close(), "Closing twice should fail")
+		})
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+
+	console := newFakeConsole()
+	console.run(false)
+	s := pty.Attach(console, nil, nil)
+
+	require.NoError(t, s.Resize(pty.Size{Cols: 80, Rows: 24}), "Resize should not fail")
+	require.NoError(t, s.Resize(pty.Size{Cols: 120, Rows: 40}), "Resize should not fail")
+	require.Error(t, s.Resize(pty.Size{Cols: 0, Rows: 40}), "Resize should fail with no columns")
+	require.Error(t, s.Resize(pty.Size{Cols: 80, Rows: 0}), "Resize should fail with no rows")
+
+	console.resizeErr = errors.New("mock error")
+	require.Error(t, s.Resize(pty.Size{Cols: 10, Rows: 10}), "Resize should return the error of the console")
+
+	require.NoError(t, s.Close(), "Close should not fail")
+	require.Error(t, s.Resize(pty.Size{Cols: 10, Rows: 10}), "Resize should fail after Close")
+
+	require.Equal(t, []pty.Size{{Cols: 80, Rows: 24}, {Cols: 120, Rows: 40}}, console.sizes, "Unexpected sizes set on the console")
+}
+
+func TestSizeValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, pty.Size{Cols: 1, Rows: 1}.Validate(), "Smallest size should be valid")
+	require.NoError(t, pty.Size{Cols: 65535, Rows: 65535}.Validate(), "Largest size should be valid")
+	require.Error(t, pty.Size{}.Validate(), "Empty size should be invalid")
+}
+
+// fakeConsole is a console attached to a fake process, which echoes its input in
+// uppercase. Like a ConPTY, closing it closes the input, and its output ends once
+// everything the process wrote was read.
+type fakeConsole struct {
+	inR, outR *io.PipeReader
+	inW, outW *io.PipeWriter
+
+	sizes     []pty.Size
+	resizeErr error
+
+	mu       sync.Mutex
+	finished chan struct{} // Closed when the fake process ended
+	readEOF  bool
+}
+
+func newFakeConsole() *fakeConsole {
+	c := &fakeConsole{finished: make(chan struct{})}
+	c.inR, c.inW = io.Pipe()
+	c.outR, c.outW = io.Pipe()
+	return c
+}
+
+// run starts the fake process. The returned channel is closed when it reads "exit".
+func (c *fakeConsole) run(exitOnInput bool) <-chan struct{} {
+	exited := make(chan struct{})
+	go func() {
+		defer close(c.finished)
+		defer c.outW.Close()
+
+		sc := bufio.NewScanner(c.inR)
+		for sc.Scan() {
+			if exitOnInput && sc.Text() == "exit" {
+				close(exited)
+				return
+			}
+			fmt.Fprintf(c.outW, "> %s\n", strings.ToUpper(sc.Text()))
+		}
+	}()
+	return exited
+}
+
+func (c *fakeConsole) Read(p []byte) (int, error) {
+	n, err := c.outR.Read(p)
+	if errors.Is(err, io.EOF) {
+		c.mu.Lock()
+		c.readEOF = true
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *fakeConsole) Write(p []byte) (int, error) {
+	return c.inW.Write(p)
+}
+
+func (c *fakeConsole) Resize(size pty.Size) error {
+	if c.resizeErr != nil {
+		return c.resizeErr
+	}
+	c.sizes = append(c.sizes, size)
+	return nil
+}
+
+func (c *fakeConsole) Close() error {
+	c.inW.Close()
+	<-c.finished
+	return nil
+}
+
+func (c *fakeConsole) drained() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readEOF
+}
+
+type blockingReader struct{}
+
+func (blockingReader) Read(p []byte) (int, error) {
+	select {}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("mock error")
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,142 @@
+// Package rootfs reads, inspects and rewrites the tarballs that distros are
+// registered from.
+package rootfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format is the compression format of a tarball.
+type Format string
+
+// Formats that are told apart by their magic bytes.
+const (
+	FormatUnknown Format = ""
+	FormatTar     Format = "tar"
+	FormatGzip    Format = "gzip"
+	FormatXz      Format = "xz"
+	FormatZstd    Format = "zstd"
+	FormatBzip2   Format = "bzip2"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicBzip2 = []byte("BZh")   // Followed by the block size, from '1' to '9'
+	magicTar   = []byte("ustar") // At offset 257
+)
+
+// tarMagicOffset is the offset of the magic bytes in the header of a tar archive.
+const tarMagicOffset = 257
+
+// Detect tells the format of the data in r by its first bytes, without consuming them.
+func Detect(r *bufio.Reader) (Format, error) {
+	head, err := r.Peek(tarMagicOffset + len(magicTar))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return FormatUnknown, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return FormatGzip, nil
+	case bytes.HasPrefix(head, magicXz):
+		return FormatXz, nil
+	case bytes.HasPrefix(head, magicZstd):
+		return FormatZstd, nil
+	case hasBzip2Magic(head):
+		return FormatBzip2, nil
+	case len(head) >= tarMagicOffset+len(magicTar) && bytes.Equal(head[tarMagicOffset:], magicTar):
+		return FormatTar, nil
+	}
+	return FormatUnknown, nil
+}
+
+// hasBzip2Magic returns true if head starts with the magic bytes of bzip2, followed
+// by a valid block size.
+func hasBzip2Magic(head []byte) bool {
+	if len(head) <= len(magicBzip2) || !bytes.HasPrefix(head, magicBzip2) {
+		return false
+	}
+	blockSize := head[len(magicBzip2)]
+	return '1' <= blockSize && blockSize <= '9'
+}
+
+// NewReader returns a reader of the tar archive in r, decompressing it if needed.
+// The format is detected by its magic bytes, regardless of the name of the file.
+func NewReader(r io.Reader) (io.ReadCloser, Format, error) {
+	br := bufio.NewReader(r)
+	format, err := Detect(br)
+	if err != nil {
+		return nil, FormatUnknown, fmt.Errorf("could not read tarball: %v", err)
+	}
+
+	switch format {
+	case FormatTar:
+		return io.NopCloser(br), format, nil
+	case FormatGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, format, fmt.Errorf("could not read gzip stream: %v", err)
+		}
+		return zr, format, nil
+	case FormatXz:
+		zr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, format, fmt.Errorf("could not read xz stream: %v", err)
+		}
+		return io.NopCloser(zr), format, nil
+	case FormatZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, format, fmt.Errorf("could not read zstd stream: %v", err)
+		}
+		return zr.IOReadCloser(), format, nil
+	case FormatBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), format, nil
+	}
+
+	return nil, FormatUnknown, errors.New("unknown tarball format: expected a tar archive, possibly compressed with gzip, xz, zstd or bzip2")
+}
+
+// NewGzipWriter returns a writer that compresses what is written to it into w,
+// with gzip, for the tarballs written by this package and the ones alike. They are
+// usually temporary files, which are removed once registered, so speed matters
+// more than their size.
+func NewGzipWriter(w io.Writer) *gzip.Writer {
+	zw, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		// The level is valid, so this cannot happen.
+		panic(err)
+	}
+	return zw
+}
+
+// Transcode writes the tarball in r into w, compressed with gzip, and returns the
+// format it was in. The tarball is streamed, so that it is never held in memory.
+func Transcode(w io.Writer, r io.Reader) (Format, error) {
+	tr, format, err := NewReader(r)
+	if err != nil {
+		return format, err
+	}
+	defer tr.Close()
+
+	zw := NewGzipWriter(w)
+	if _, err := io.Copy(zw, tr); err != nil {
+		return format, fmt.Errorf("could not transcode %s tarball: %v", format, err)
+	}
+	if err := zw.Close(); err != nil {
+		return format, fmt.Errorf("could not transcode %s tarball: %v", format, err)
+	}
+
+	return format, nil
+}
@@ -0,0 +1,137 @@
+package rootfs_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+func TestNewReader(t *testing.T) {
+	t.Parallel()
+
+	tarball := makeTarball(t, []fakeEntry{file("bin/sh", "ELF")}, rootfs.FormatTar)
+
+	testCases := map[string]struct {
+		format rootfs.Format // Format to compress the tarball with
+		data   []byte        // Data to read instead of the tarball
+
+		wantErr bool
+	}{
+		"plain tar": {format: rootfs.FormatTar},
+		"gzip":      {format: rootfs.FormatGzip},
+		"xz":        {format: rootfs.FormatXz},
+		"zstd":      {format: rootfs.FormatZstd},
+		"bzip2":     {format: rootfs.FormatBzip2},
+
+		"error with an empty stream":        {data: []byte{}, wantErr: true},
+		"error with a short stream":         {data: []byte("hi"), wantErr: true},
+		"error with an unknown format":      {data: bytes.Repeat([]byte("not a tarball"), 100), wantErr: true},
+		"error with a bad bzip2 block size": {data: []byte("BZh0 and then some"), wantErr: true},
+		"error with a corrupted gzip head":  {data: []byte{0x1f, 0x8b, 0xff, 0xff}, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := tc.data
+			if data == nil {
+				data = compress(t, tarball, tc.format)
+			}
+
+			format, err := rootfs.Detect(bufio.NewReader(bytes.NewReader(data)))
+			require.NoError(t, err, "Detect should not fail on readable data")
+			if !tc.wantErr {
+				require.Equal(t, tc.format, format, "Detect returned an unexpected format")
+			}
+
+			r, format, err := rootfs.NewReader(bytes.NewReader(data))
+			if tc.wantErr {
+				require.Error(t, err, "NewReader should have failed")
+				return
+			}
+			require.NoError(t, err, "NewReader should not have failed")
+			defer r.Close()
+
+			require.Equal(t, tc.format, format, "NewReader returned an unexpected format")
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err, "Reading the decompressed stream should not have failed")
+			require.Equal(t, tarball, got, "The decompressed stream should be the original tarball")
+		})
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	t.Parallel()
+
+	tarball := makeTarball(t, []fakeEntry{file("bin/sh", "ELF"), file("etc/hostname", "ubuntu")}, rootfs.FormatTar)
+
+	testCases := map[string]struct {
+		format    rootfs.Format // Format to compress the tarball with
+		truncate  bool
+		failWrite bool
+
+		wantErr bool
+	}{
+		"from plain tar": {format: rootfs.FormatTar},
+		"from gzip":      {format: rootfs.FormatGzip},
+		"from xz":        {format: rootfs.FormatXz},
+		"from zstd":      {format: rootfs.FormatZstd},
+		"from bzip2":     {format: rootfs.FormatBzip2},
+
+		"error with a truncated xz stream":    {format: rootfs.FormatXz, truncate: true, wantErr: true},
+		"error when the output fails":         {format: rootfs.FormatZstd, failWrite: true, wantErr: true},
+		"error with an unknown format":        {format: "unknown", wantErr: true},
+		"error with a truncated bzip2 stream": {format: rootfs.FormatBzip2, truncate: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data := []byte("This is not a tarball")
+			if tc.format != "unknown" {
+				data = compress(t, tarball, tc.format)
+			}
+			if tc.truncate {
+				data = data[:len(data)/2]
+			}
+
+			var out bytes.Buffer
+			var w io.Writer = &out
+			if tc.failWrite {
+				w = failingWriter{}
+			}
+
+			format, err := rootfs.Transcode(w, bytes.NewReader(data))
+			if tc.wantErr {
+				require.Error(t, err, "Transcode should have failed")
+				return
+			}
+			require.NoError(t, err, "Transcode should not have failed")
+			require.Equal(t, tc.format, format, "Transcode returned an unexpected format")
+
+			zr, err := gzip.NewReader(&out)
+			require.NoError(t, err, "The output of Transcode should be compressed with gzip")
+			got, err := io.ReadAll(zr)
+			require.NoError(t, err, "The output of Transcode should be a valid gzip stream")
+			require.Equal(t, tarball, got, "The output of Transcode should be the original tarball")
+		})
+	}
+}
+
+// failingWriter is a writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("writing failed on purpose")
+}
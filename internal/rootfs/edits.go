@@ -0,0 +1,113 @@
+package rootfs
+
+import (
+	"bytes"
+	"strings"
+)
+
+// WriteFile returns a patch that creates the file at p with the given contents,
+// or replaces the contents of the existing one.
+func WriteFile(p string, contents []byte, mode int64) Patch {
+	return Patch{
+		Path: p,
+		Mode: mode,
+		Edit: func([]byte, bool) ([]byte, bool, error) {
+			return contents, true, nil
+		},
+	}
+}
+
+// Delete returns a patch that removes the file or directory at p, if it exists.
+func Delete(p string) Patch {
+	return Patch{
+		Path: p,
+		Edit: func([]byte, bool) ([]byte, bool, error) {
+			return nil, false, nil
+		},
+	}
+}
+
+// AppendLines returns a patch that adds lines at the end of the file at p. If the
+// file does not exist, or is a symbolic link, it is created only if create is true.
+func AppendLines(p string, create bool, lines ...string) Patch {
+	return Patch{
+		Path:      p,
+		SkipLinks: !create,
+		Edit: func(contents []byte, exists bool) ([]byte, bool, error) {
+			if !exists && !create {
+				return nil, false, nil
+			}
+
+			out := bytes.Clone(contents)
+			if len(out) > 0 && out[len(out)-1] != '\n' {
+				out = append(out, '\n')
+			}
+			for _, l := range lines {
+				out = append(out, l...)
+				out = append(out, '\n')
+			}
+			return out, true, nil
+		},
+	}
+}
+
+// SetINI returns a patch that sets a key in a section of the INI file at p, such
+// as /etc/wsl.conf, creating the file, the section or the key as needed. The rest
+// of the file, including its comments, is left untouched.
+func SetINI(p, section, key, value string) Patch {
+	return Patch{
+		Path: p,
+		Edit: func(contents []byte, _ bool) ([]byte, bool, error) {
+			return setINI(contents, section, key, value), true, nil
+		},
+	}
+}
+
+func setINI(contents []byte, section, key, value string) []byte {
+	setting := key + " = " + value
+
+	var lines []string
+	if len(contents) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	}
+
+	inSection := false
+	lastInSection := -1 // Last line of the section that is not blank
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inSection = strings.EqualFold(strings.TrimSpace(trimmed[1:len(trimmed)-1]), section)
+			if inSection {
+				lastInSection = i
+			}
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if trimmed != "" {
+			lastInSection = i
+		}
+
+		k, _, ok := strings.Cut(trimmed, "=")
+		if !ok || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(k), key) {
+			lines[i] = setting
+			return []byte(strings.Join(lines, "\n") + "\n")
+		}
+	}
+
+	if lastInSection >= 0 {
+		lines = append(lines[:lastInSection+1], append([]string{setting}, lines[lastInSection+1:]...)...)
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "["+section+"]", setting)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
@@ -0,0 +1,38 @@
+package rootfs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+func TestSetINI(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		contents string
+
+		want string
+	}{
+		"create the file":                 {contents: "", want: "[user]\ndefault = u\n"},
+		"add the section":                 {contents: "[boot]\nsystemd=true", want: "[boot]\nsystemd=true\n\n[user]\ndefault = u\n"},
+		"add the key to the section":      {contents: "[user]\n# A comment\nfoo=bar\n\n[boot]\nsystemd=true\n", want: "[user]\n# A comment\nfoo=bar\ndefault = u\n\n[boot]\nsystemd=true\n"},
+		"add the key to an empty section": {contents: "[user]\n[boot]\n", want: "[user]\ndefault = u\n[boot]\n"},
+		"replace the key":                 {contents: "[boot]\ndefault=x\n[user]\n  Default = root # old\n", want: "[boot]\ndefault=x\n[user]\ndefault = u\n"},
+		"ignore commented keys":           {contents: "[user]\n# default = root\n", want: "[user]\n# default = root\ndefault = u\n"},
+		"match the section loosely":       {contents: "[ User ]\n", want: "[ User ]\ndefault = u\n"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, keep, err := rootfs.SetINI("/etc/wsl.conf", "user", "default", "u").Edit([]byte(tc.contents), tc.contents != "")
+			require.NoError(t, err, "SetINI should not fail")
+			require.True(t, keep, "SetINI should keep the file")
+			require.Equal(t, tc.want, string(got), "Unexpected contents after SetINI")
+		})
+	}
+}
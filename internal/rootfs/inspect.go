@@ -0,0 +1,391 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ProblemKind is the kind of a problem found in a rootfs.
+type ProblemKind string
+
+// Problems that Inspect looks for.
+const (
+	// ProblemOwnership is a system file that is not owned by root, which usually means
+	// the tarball was created without preserving ownership.
+	ProblemOwnership ProblemKind = "ownership"
+
+	// ProblemSymlinkEscape is a symbolic link whose target climbs above the root of
+	// the filesystem.
+	ProblemSymlinkEscape ProblemKind = "symlink-escape"
+
+	// ProblemHardlink is a hard link whose target is not in the tarball before it.
+	ProblemHardlink ProblemKind = "hardlink"
+
+	// ProblemUnsafePath is an entry whose name climbs above the root of the filesystem.
+	ProblemUnsafePath ProblemKind = "unsafe-path"
+
+	// ProblemNoShell is the lack of /bin/sh, which WSL needs to run commands.
+	ProblemNoShell ProblemKind = "no-shell"
+)
+
+// Problem is an issue found in a rootfs.
+type Problem struct {
+	Kind   ProblemKind
+	Path   string // Path of the offending entry, from the root of the filesystem
+	Detail string
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", p.Kind, p.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Kind, p.Path, p.Detail)
+}
+
+// Report is what Inspect finds in a rootfs.
+type Report struct {
+	// Format is the compression format of the tarball.
+	Format Format
+
+	// OSRelease holds the variables of /etc/os-release, or /usr/lib/os-release.
+	// It is nil if there is none.
+	OSRelease map[string]string
+
+	// HasShell is true if /bin/sh exists.
+	HasShell bool
+
+	// DefaultShell is the login shell of root, according to /etc/passwd.
+	DefaultShell string
+
+	// HasWSLConf is true if /etc/wsl.conf exists.
+	HasWSLConf bool
+
+	// Entries is the number of entries in the tarball.
+	Entries int
+
+	// TotalSize is the total size of the regular files, in bytes.
+	TotalSize int64
+
+	// Problems are the issues found in the rootfs, which may prevent it from working.
+	Problems []Problem
+}
+
+// systemDirs are the directories whose contents must belong to root.
+var systemDirs = []string{"/bin", "/etc", "/lib", "/lib32", "/lib64", "/root", "/sbin", "/usr"}
+
+// maxCapturedFile is the size above which the contents of files of interest are
+// not captured, as they cannot be what we expect.
+const maxCapturedFile = 1 << 20
+
+// entry is what is remembered of every entry in the tarball, to resolve links
+// once it is read entirely.
+type entry struct {
+	typeflag byte
+	linkname string
+}
+
+// Inspect streams the tarball in r, possibly compressed, and reports what it finds.
+// It returns an error if the tarball cannot be read.
+func Inspect(r io.Reader) (*Report, error) {
+	tr, format, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Close()
+
+	i := inspector{
+		report:   &Report{Format: format},
+		entries:  make(map[string]entry),
+		captured: make(map[string][]byte),
+		owners:   make(map[string]int),
+
+		firstBadOwner: make(map[string]Problem),
+	}
+
+	t := tar.NewReader(tr)
+	for {
+		hdr, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read tarball after %d entries: %v", i.report.Entries, err)
+		}
+		if err := i.add(hdr, t); err != nil {
+			return nil, fmt.Errorf("could not read %s in tarball: %v", hdr.Name, err)
+		}
+	}
+
+	if i.report.Entries == 0 {
+		return nil, errors.New("tarball is empty")
+	}
+
+	i.finish()
+	return i.report, nil
+}
+
+type inspector struct {
+	report *Report
+
+	entries  map[string]entry
+	captured map[string][]byte // Contents of the files of interest, by path
+
+	owners          map[string]int     // Number of entries not owned by root, by system directory
+	firstBadOwner   map[string]Problem // First entry not owned by root, by system directory
+	badOwnersInDirs []string           // System directories with entries not owned by root, in order
+}
+
+// filesOfInterest are the files whose contents are needed by the report. Links to
+// them are resolved once the whole tarball is read.
+var filesOfInterest = map[string]bool{
+	"/etc/os-release":     true,
+	"/usr/lib/os-release": true,
+	"/etc/passwd":         true,
+}
+
+func (i *inspector) add(hdr *tar.Header, r io.Reader) error {
+	i.report.Entries++
+
+	name, ok := CleanName(hdr.Name)
+	if !ok {
+		i.problem(ProblemUnsafePath, hdr.Name, "the name climbs above the root of the filesystem")
+		return nil
+	}
+
+	i.entries[name] = entry{typeflag: hdr.Typeflag, linkname: hdr.Linkname}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA: //nolint: staticcheck // TypeRegA is deprecated, but old tarballs still use it
+		i.report.TotalSize += hdr.Size
+		if filesOfInterest[name] && hdr.Size <= maxCapturedFile {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			i.captured[name] = data
+		}
+	case tar.TypeSymlink:
+		if escapes(path.Dir(name), hdr.Linkname) {
+			i.problem(ProblemSymlinkEscape, name, fmt.Sprintf("the target %q is outside of the filesystem", hdr.Linkname))
+		}
+	case tar.TypeLink:
+		target, ok := CleanName(hdr.Linkname)
+		if _, found := i.entries[target]; !ok || !found {
+			i.problem(ProblemHardlink, name, fmt.Sprintf("the target %q is not in the tarball before the link", hdr.Linkname))
+		}
+	}
+
+	i.checkOwner(name, hdr)
+	return nil
+}
+
+// checkOwner records system files not owned by root. Only the first one of every
+// system directory is reported, as there are usually many of them.
+func (i *inspector) checkOwner(name string, hdr *tar.Header) {
+	if hdr.Uid == 0 {
+		return
+	}
+
+	for _, dir := range systemDirs {
+		if name != dir && !strings.HasPrefix(name, dir+"/") {
+			continue
+		}
+
+		if _, ok := i.firstBadOwner[dir]; !ok {
+			i.firstBadOwner[dir] = Problem{Kind: ProblemOwnership, Path: name}
+			i.badOwnersInDirs = append(i.badOwnersInDirs, dir)
+		}
+		i.owners[dir]++
+		return
+	}
+}
+
+func (i *inspector) problem(kind ProblemKind, name, detail string) {
+	i.report.Problems = append(i.report.Problems, Problem{Kind: kind, Path: name, Detail: detail})
+}
+
+// finish fills in the parts of the report that need the whole tarball.
+func (i *inspector) finish() {
+	for _, dir := range i.badOwnersInDirs {
+		p := i.firstBadOwner[dir]
+		p.Detail = fmt.Sprintf("not owned by root, like %d entries in %s", i.owners[dir], dir)
+		i.report.Problems = append(i.report.Problems, p)
+	}
+
+	_, i.report.HasShell = i.resolve("/bin/sh")
+	if !i.report.HasShell {
+		i.problem(ProblemNoShell, "/bin/sh", "it is missing, so WSL cannot run commands")
+	}
+
+	_, i.report.HasWSLConf = i.resolve("/etc/wsl.conf")
+
+	for _, p := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		if data, ok := i.file(p); ok {
+			i.report.OSRelease = parseOSRelease(data)
+			break
+		}
+	}
+
+	if data, ok := i.file("/etc/passwd"); ok {
+		i.report.DefaultShell = rootShell(data)
+	}
+}
+
+// file returns the captured contents of the file at p, following links.
+func (i *inspector) file(p string) ([]byte, bool) {
+	resolved, ok := i.resolve(p)
+	if !ok {
+		return nil, false
+	}
+	data, ok := i.captured[resolved]
+	return data, ok
+}
+
+// maxLinks is the maximum number of links followed to resolve a path, like Linux's.
+const maxLinks = 40
+
+// resolve follows the symbolic links in p, including those of its parent
+// directories, and returns the path of the entry it designates, or false if
+// there is none.
+func (i *inspector) resolve(p string) (string, bool) {
+	links := 0
+	resolved := "/"
+	rest := strings.Split(strings.TrimPrefix(p, "/"), "/")
+
+	for len(rest) > 0 {
+		component := rest[0]
+		rest = rest[1:]
+
+		next := path.Join(resolved, component)
+		// Tarballs need not have entries for the directories they contain.
+		e, ok := i.entries[next]
+		if !ok && len(rest) == 0 {
+			return "", false
+		}
+
+		switch e.typeflag {
+		case tar.TypeSymlink:
+			links++
+			if links > maxLinks {
+				return "", false
+			}
+			target := e.linkname
+			if !path.IsAbs(target) {
+				target = path.Join(resolved, target)
+			}
+			// The target is resolved from the root again, along with what is left.
+			rest = append(strings.Split(strings.TrimPrefix(path.Clean(target), "/"), "/"), rest...)
+			resolved = "/"
+		case tar.TypeLink:
+			target, ok := CleanName(e.linkname)
+			if !ok {
+				return "", false
+			}
+			resolved = target
+		default:
+			resolved = next
+		}
+	}
+
+	return resolved, true
+}
+
+// CleanName returns the absolute path of the name of an entry of a tarball, or
+// false if it climbs above the root.
+func CleanName(name string) (string, bool) {
+	if escapes("/", strings.TrimPrefix(name, "/")) {
+		return "", false
+	}
+	return path.Clean("/" + name), true
+}
+
+// escapes returns true if target, relative to dir or absolute, climbs above the root.
+func escapes(dir, target string) bool {
+	depth := 0
+	if !path.IsAbs(target) {
+		for _, c := range strings.Split(strings.TrimPrefix(path.Clean(dir), "/"), "/") {
+			if c != "" {
+				depth++
+			}
+		}
+	}
+
+	for _, c := range strings.Split(target, "/") {
+		switch c {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		default:
+			depth++
+		}
+	}
+	return false
+}
+
+// parseOSRelease parses the variables of an os-release file.
+// See https://www.freedesktop.org/software/systemd/man/os-release.html.
+func parseOSRelease(data []byte) map[string]string {
+	vars := make(map[string]string)
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		vars[key] = unquote(value)
+	}
+
+	return vars
+}
+
+// unquote removes the shell quotes around an os-release value, and its escapes.
+func unquote(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+
+	q := value[0]
+	if (q != '"' && q != '\'') || value[len(value)-1] != q {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	if q == '\'' {
+		return value
+	}
+
+	var b strings.Builder
+	for j := 0; j < len(value); j++ {
+		if value[j] == '\\' && j+1 < len(value) && strings.ContainsRune("\"\\$`", rune(value[j+1])) {
+			j++
+		}
+		b.WriteByte(value[j])
+	}
+	return b.String()
+}
+
+// rootShell returns the login shell of root in a passwd file.
+func rootShell(passwd []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(passwd))
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), ":")
+		if len(fields) == 7 && fields[0] == "root" {
+			return fields[6]
+		}
+	}
+	return ""
+}
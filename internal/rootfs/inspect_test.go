@@ -0,0 +1,287 @@
+package rootfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os/exec"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/rootfs"
+	"github.com/ulikunitz/xz"
+)
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	const osRelease = `# A comment
+NAME="Ubuntu"
+VERSION_ID="22.04"
+PRETTY_NAME="Ubuntu \"Jammy\" 22.04"
+ID=ubuntu
+ID_LIKE='debian'
+`
+	const passwd = "daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\nroot:x:0:0:root:/root:/bin/bash\n"
+	const wslConf = "[boot]\nsystemd=true\n"
+
+	ubuntu := []fakeEntry{
+		dir("etc"),
+		dir("usr"),
+		dir("usr/bin"),
+		dir("usr/lib"),
+		symlink("bin", "usr/bin"),
+		file("usr/bin/dash", "ELF"),
+		symlink("usr/bin/sh", "dash"),
+		file("usr/bin/bash", "ELF!"),
+		file("usr/lib/os-release", osRelease),
+		symlink("etc/os-release", "../usr/lib/os-release"),
+		file("etc/passwd", passwd),
+		file("etc/wsl.conf", wslConf),
+	}
+	ubuntuSize := int64(len("ELF") + len("ELF!") + len(osRelease) + len(passwd) + len(wslConf))
+	ubuntuRelease := map[string]string{
+		"NAME":        "Ubuntu",
+		"VERSION_ID":  "22.04",
+		"PRETTY_NAME": `Ubuntu "Jammy" 22.04`,
+		"ID":          "ubuntu",
+		"ID_LIKE":     "debian",
+	}
+
+	testCases := map[string]struct {
+		entries []fakeEntry
+		format  rootfs.Format
+
+		wantOSRelease    map[string]string
+		wantShell        bool
+		wantDefaultShell string
+		wantWSLConf      bool
+		wantEntries      int
+		wantSize         int64
+		wantProblems     []rootfs.Problem
+		wantErr          bool
+	}{
+		"success with a plain tarball": {entries: ubuntu, format: rootfs.FormatTar, wantOSRelease: ubuntuRelease, wantShell: true, wantDefaultShell: "/bin/bash", wantWSLConf: true, wantEntries: 12, wantSize: ubuntuSize},
+		"success with gzip":            {entries: ubuntu, format: rootfs.FormatGzip, wantOSRelease: ubuntuRelease, wantShell: true, wantDefaultShell: "/bin/bash", wantWSLConf: true, wantEntries: 12, wantSize: ubuntuSize},
+		"success with xz":              {entries: ubuntu, format: rootfs.FormatXz, wantOSRelease: ubuntuRelease, wantShell: true, wantDefaultShell: "/bin/bash", wantWSLConf: true, wantEntries: 12, wantSize: ubuntuSize},
+		"success with bzip2":           {entries: ubuntu, format: rootfs.FormatBzip2, wantOSRelease: ubuntuRelease, wantShell: true, wantDefaultShell: "/bin/bash", wantWSLConf: true, wantEntries: 12, wantSize: ubuntuSize},
+		"success with zstd":            {entries: ubuntu, format: rootfs.FormatZstd, wantOSRelease: ubuntuRelease, wantShell: true, wantDefaultShell: "/bin/bash", wantWSLConf: true, wantEntries: 12, wantSize: ubuntuSize},
+
+		"success with names starting with ./": {
+			entries:   []fakeEntry{dir("./bin"), file("./bin/sh", "ELF"), file("./etc/os-release", "ID=alpine\n")},
+			wantShell: true, wantEntries: 3, wantSize: 13,
+			wantOSRelease: map[string]string{"ID": "alpine"},
+		},
+		"success with os-release only in /usr/lib": {
+			entries:   []fakeEntry{file("bin/sh", "ELF"), file("usr/lib/os-release", "ID=arch\n")},
+			wantShell: true, wantEntries: 2, wantSize: 11,
+			wantOSRelease: map[string]string{"ID": "arch"},
+		},
+		"success with an absolute symlink to the shell": {
+			entries:   []fakeEntry{file("bin/busybox", "ELF"), symlink("bin/sh", "/bin/busybox")},
+			wantShell: true, wantEntries: 2, wantSize: 3,
+		},
+		"success with a hardlink to the shell": {
+			entries:   []fakeEntry{file("bin/busybox", "ELF"), hardlink("bin/sh", "bin/busybox")},
+			wantShell: true, wantEntries: 2, wantSize: 3,
+		},
+		"success with a relative symlink within the filesystem": {
+			entries:   []fakeEntry{file("bin/sh", "ELF"), symlink("usr/lib/lib.so", "../../lib/lib.so")},
+			wantShell: true, wantEntries: 2, wantSize: 3,
+		},
+
+		"problem without a shell": {
+			entries:      []fakeEntry{file("etc/hostname", "ubuntu")},
+			wantEntries:  1,
+			wantSize:     6,
+			wantProblems: []rootfs.Problem{{Kind: rootfs.ProblemNoShell, Path: "/bin/sh"}},
+		},
+		"problem with a dangling symlink to the shell": {
+			entries:      []fakeEntry{symlink("bin/sh", "dash")},
+			wantEntries:  1,
+			wantProblems: []rootfs.Problem{{Kind: rootfs.ProblemNoShell, Path: "/bin/sh"}},
+		},
+		"problem with a symlink loop": {
+			entries:      []fakeEntry{symlink("bin/sh", "ash"), symlink("bin/ash", "sh")},
+			wantEntries:  2,
+			wantProblems: []rootfs.Problem{{Kind: rootfs.ProblemNoShell, Path: "/bin/sh"}},
+		},
+		"problem with files not owned by root": {
+			entries: []fakeEntry{
+				file("bin/sh", "ELF"),
+				owned(file("usr/bin/a", "a"), 1000),
+				owned(file("usr/bin/b", "b"), 1000),
+				owned(file("etc/c", "c"), 1000),
+				owned(file("home/user/d", "d"), 1000),
+			},
+			wantShell: true, wantEntries: 5, wantSize: 7,
+			wantProblems: []rootfs.Problem{
+				{Kind: rootfs.ProblemOwnership, Path: "/usr/bin/a"},
+				{Kind: rootfs.ProblemOwnership, Path: "/etc/c"},
+			},
+		},
+		"problem with symlinks escaping the root": {
+			entries: []fakeEntry{
+				file("bin/sh", "ELF"),
+				symlink("usr/lib/relative", "../../../etc/shadow"),
+				symlink("usr/lib/absolute", "/../../etc/shadow"),
+			},
+			wantShell: true, wantEntries: 3, wantSize: 3,
+			wantProblems: []rootfs.Problem{
+				{Kind: rootfs.ProblemSymlinkEscape, Path: "/usr/lib/relative"},
+				{Kind: rootfs.ProblemSymlinkEscape, Path: "/usr/lib/absolute"},
+			},
+		},
+		"problem with a hardlink to a missing file": {
+			entries:   []fakeEntry{file("bin/sh", "ELF"), hardlink("bin/ash", "bin/busybox")},
+			wantShell: true, wantEntries: 2, wantSize: 3,
+			wantProblems: []rootfs.Problem{{Kind: rootfs.ProblemHardlink, Path: "/bin/ash"}},
+		},
+		"problem with a name escaping the root": {
+			entries:   []fakeEntry{file("bin/sh", "ELF"), file("../evil", "evil")},
+			wantShell: true, wantEntries: 2, wantSize: 3,
+			wantProblems: []rootfs.Problem{{Kind: rootfs.ProblemUnsafePath, Path: "../evil"}},
+		},
+
+		"error with an empty tarball":    {entries: []fakeEntry{}, wantErr: true},
+		"error with an unknown format":   {format: "not a tarball", wantErr: true},
+		"error with a truncated tarball": {format: "truncated", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.format == "" {
+				tc.format = rootfs.FormatGzip
+			}
+			if tc.entries == nil {
+				tc.entries = ubuntu
+			}
+
+			var data []byte
+			switch tc.format {
+			case "not a tarball":
+				data = []byte("This is not a tarball")
+			case "truncated":
+				data = makeTarball(t, tc.entries, rootfs.FormatGzip)
+				data = data[:len(data)/2]
+			default:
+				data = makeTarball(t, tc.entries, tc.format)
+			}
+
+			report, err := rootfs.Inspect(bytes.NewReader(data))
+			if tc.wantErr {
+				require.Error(t, err, "Inspect should have failed")
+				return
+			}
+			require.NoError(t, err, "Inspect should not have failed")
+
+			require.Equal(t, tc.format, report.Format, "Unexpected format")
+			require.Equal(t, tc.wantOSRelease, report.OSRelease, "Unexpected os-release")
+			require.Equal(t, tc.wantShell, report.HasShell, "Unexpected presence of /bin/sh")
+			require.Equal(t, tc.wantDefaultShell, report.DefaultShell, "Unexpected default shell")
+			require.Equal(t, tc.wantWSLConf, report.HasWSLConf, "Unexpected presence of /etc/wsl.conf")
+			require.Equal(t, tc.wantEntries, report.Entries, "Unexpected number of entries")
+			require.Equal(t, tc.wantSize, report.TotalSize, "Unexpected total size")
+
+			require.Len(t, report.Problems, len(tc.wantProblems), "Unexpected problems: %v", report.Problems)
+			for i, want := range tc.wantProblems {
+				got := report.Problems[i]
+				require.Equal(t, want.Kind, got.Kind, "Unexpected kind of problem %d", i)
+				require.Equal(t, want.Path, got.Path, "Unexpected path of problem %d", i)
+				require.NotEmpty(t, got.Detail, "Problem %d should have details", i)
+			}
+		})
+	}
+}
+
+// fakeEntry is an entry of a generated tarball.
+type fakeEntry struct {
+	hdr  tar.Header
+	data string
+}
+
+func dir(name string) fakeEntry {
+	return fakeEntry{hdr: tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755}}
+}
+
+func file(name, data string) fakeEntry {
+	return fakeEntry{hdr: tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data))}, data: data}
+}
+
+func symlink(name, target string) fakeEntry {
+	return fakeEntry{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target, Mode: 0777}}
+}
+
+func hardlink(name, target string) fakeEntry {
+	return fakeEntry{hdr: tar.Header{Typeflag: tar.TypeLink, Name: name, Linkname: target, Mode: 0644}}
+}
+
+func owned(e fakeEntry, uid int) fakeEntry {
+	e.hdr.Uid = uid
+	e.hdr.Gid = uid
+	return e
+}
+
+// makeTarball generates a tarball with the given entries, compressed with the given format.
+func makeTarball(t *testing.T, entries []fakeEntry, format rootfs.Format) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		require.NoError(t, tw.WriteHeader(&hdr), "Setup: could not write tar header")
+		_, err := tw.Write([]byte(e.data))
+		require.NoError(t, err, "Setup: could not write tar entry")
+	}
+	require.NoError(t, tw.Close(), "Setup: could not close tar writer")
+
+	return compress(t, buf.Bytes(), format)
+}
+
+// compress compresses data with the given format.
+func compress(t *testing.T, data []byte, format rootfs.Format) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case rootfs.FormatTar:
+		return data
+	case rootfs.FormatGzip:
+		w := gzip.NewWriter(&buf)
+		_, err = w.Write(data)
+		require.NoError(t, err, "Setup: could not compress with gzip")
+		err = w.Close()
+	case rootfs.FormatXz:
+		w, e := xz.NewWriter(&buf)
+		require.NoError(t, e, "Setup: could not create xz writer")
+		_, err = w.Write(data)
+		require.NoError(t, err, "Setup: could not compress with xz")
+		err = w.Close()
+	case rootfs.FormatZstd:
+		w, e := zstd.NewWriter(&buf)
+		require.NoError(t, e, "Setup: could not create zstd writer")
+		_, err = w.Write(data)
+		require.NoError(t, err, "Setup: could not compress with zstd")
+		err = w.Close()
+	case rootfs.FormatBzip2:
+		// There is no bzip2 writer in the standard library.
+		if _, err := exec.LookPath("bzip2"); err != nil {
+			t.Skip("Skipping: bzip2 is not installed")
+		}
+		cmd := exec.Command("bzip2", "-c")
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = &buf
+		err = cmd.Run()
+	default:
+		require.Failf(t, "Setup: unknown format", "%q", format)
+	}
+	require.NoError(t, err, "Setup: could not close compressor")
+
+	return buf.Bytes()
+}
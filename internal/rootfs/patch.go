@@ -0,0 +1,414 @@
+package rootfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Patch is a change to a file of a tarball, applied by Rewrite.
+type Patch struct {
+	// Path is the path of the file, from the root of the filesystem.
+	Path string
+
+	// Edit returns the new contents of the file, given its current ones. exists is
+	// false if the file is not in the tarball, and returning false removes it.
+	Edit func(contents []byte, exists bool) (newContents []byte, keep bool, err error)
+
+	// Mode is the permissions of the file if it is created. It defaults to 0644.
+	Mode int64
+
+	// SkipLinks makes the patch leave symbolic links and special files untouched,
+	// instead of replacing them. Hard links are patched all the same, as their
+	// contents are kept.
+	SkipLinks bool
+}
+
+// Rewrite writes the tarball in r into w, compressed with gzip, with the patches
+// applied. Patches to the same file are applied in order. Entries that are not
+// patched are copied along with all of their metadata, and patched files keep
+// theirs. Files that are created are added at the end, along with their missing
+// parent directories.
+//
+// Symbolic links and other special files that are patched are replaced by regular
+// files, as if they were empty. Hard links that are patched are replaced by regular
+// files as well, with the contents of the file they link to. Directories can only
+// be deleted, along with their contents. Patched files no longer share their
+// contents with their hard links: the first of them becomes a regular file with
+// the contents from before the patches, and the others link to it instead.
+//
+// Hard links are found by reading the tarball a first time, until every file to
+// patch is found, so that the contents of the files they link to can be kept.
+func Rewrite(w io.Writer, r io.ReadSeeker, patches []Patch) error {
+	rw := rewriter{
+		patches:  make(map[string][]Patch),
+		seen:     map[string]bool{"/": true},
+		patched:  make(map[string]bool),
+		detached: make(map[string][]byte),
+		relinked: make(map[string]string),
+		linked:   make(map[string][]byte),
+	}
+	for _, p := range patches {
+		name, ok := CleanName(p.Path)
+		if !ok || name == "/" {
+			return fmt.Errorf("invalid path to patch %q", p.Path)
+		}
+		if _, ok := rw.patches[name]; !ok {
+			rw.order = append(rw.order, name)
+		}
+		rw.patches[name] = append(rw.patches[name], p)
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("could not read tarball: %v", err)
+	}
+	if err := rw.findLinks(r); err != nil {
+		return err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("could not read tarball: %v", err)
+	}
+
+	tr, _, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+
+	zw := NewGzipWriter(w)
+	rw.tw = tar.NewWriter(zw)
+
+	t := tar.NewReader(tr)
+	for {
+		hdr, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read tarball: %v", err)
+		}
+		if err := rw.copy(hdr, t); err != nil {
+			return fmt.Errorf("could not rewrite %s: %v", hdr.Name, err)
+		}
+	}
+
+	if err := rw.create(); err != nil {
+		return err
+	}
+
+	if err := rw.tw.Close(); err != nil {
+		return fmt.Errorf("could not write tarball: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("could not write tarball: %v", err)
+	}
+	return nil
+}
+
+type rewriter struct {
+	tw *tar.Writer
+
+	patches map[string][]Patch // Patches by path
+	order   []string           // Paths to patch, in the order they were first given
+
+	seen        map[string]bool   // Paths of the entries written so far
+	patched     map[string]bool   // Paths that were patched in place
+	deletedDirs []string          // Directories that were deleted, along with their contents
+	detached    map[string][]byte // Contents of the regular files before they were patched, for their hard links
+	relinked    map[string]string // Names of the entries that hard links to patched files point to instead
+	linked      map[string][]byte // Contents of the files that patched hard links point to, nil until they are read
+	started     bool              // Whether an entry was copied already
+	dotSlash    bool              // Whether names start with "./", to create entries in the same style
+}
+
+// findLinks reads the tarball in r until every file to patch is found, to know the
+// files that the patched hard links point to.
+func (rw *rewriter) findLinks(r io.Reader) error {
+	tr, _, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+
+	remaining := len(rw.patches)
+	t := tar.NewReader(tr)
+	for remaining > 0 {
+		hdr, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read tarball: %v", err)
+		}
+
+		name, ok := CleanName(hdr.Name)
+		if !ok {
+			continue
+		}
+		if _, ok := rw.patches[name]; !ok {
+			continue
+		}
+		remaining--
+
+		if hdr.Typeflag != tar.TypeLink {
+			continue
+		}
+		if target, ok := CleanName(hdr.Linkname); ok {
+			rw.linked[target] = nil
+		}
+	}
+	return nil
+}
+
+// copy writes the entry in the new tarball, patched if needed.
+func (rw *rewriter) copy(hdr *tar.Header, r io.Reader) error {
+	if !rw.started {
+		rw.started = true
+		rw.dotSlash = strings.HasPrefix(hdr.Name, "./")
+	}
+
+	if hdr.Typeflag == tar.TypeRegA { //nolint: staticcheck // TypeRegA is deprecated but still found in old archives
+		// Legacy archives use a trailing slash for directories.
+		normalized := *hdr
+		normalized.Typeflag = tar.TypeReg
+		if strings.HasSuffix(hdr.Name, "/") {
+			normalized.Typeflag = tar.TypeDir
+		}
+		hdr = &normalized
+	}
+
+	name, ok := CleanName(hdr.Name)
+	if !ok {
+		// Not ours to fix: it is copied as is.
+		return rw.write(hdr, r)
+	}
+
+	for _, dir := range rw.deletedDirs {
+		if strings.HasPrefix(name, dir+"/") {
+			return nil
+		}
+	}
+
+	patches, ok := rw.patches[name]
+	if ok && hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeLink && hdr.Typeflag != tar.TypeDir {
+		patches = withoutSkipLinks(patches)
+		ok = len(patches) > 0
+	}
+	if !ok {
+		rw.seen[name] = true
+		if _, ok := rw.linked[name]; ok && hdr.Typeflag == tar.TypeReg {
+			// Patched hard links point to this file: its contents are kept for them.
+			contents, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			rw.linked[name] = contents
+			r = bytes.NewReader(contents)
+		}
+		return rw.relink(hdr, r)
+	}
+	rw.patched[name] = true
+
+	var contents []byte
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		contents = data
+		rw.detached[name] = bytes.Clone(data)
+	case tar.TypeLink:
+		contents = rw.linkedContents(hdr.Linkname)
+	}
+
+	contents, keep, err := apply(patches, contents, true)
+	if err != nil {
+		return err
+	}
+
+	if !keep {
+		if hdr.Typeflag == tar.TypeDir {
+			rw.deletedDirs = append(rw.deletedDirs, name)
+		}
+		return nil
+	}
+
+	if hdr.Typeflag == tar.TypeDir {
+		return errors.New("it is a directory, which can only be deleted")
+	}
+
+	patched := *hdr
+	if hdr.Typeflag != tar.TypeReg {
+		patched.Typeflag = tar.TypeReg
+		patched.Linkname = ""
+		if hdr.Typeflag != tar.TypeLink {
+			// Hard links have the metadata of the file they point to.
+			patched.Mode = mode(patches)
+		}
+	}
+	patched.Size = int64(len(contents))
+	rw.seen[name] = true
+	return rw.write(&patched, bytes.NewReader(contents))
+}
+
+// linkedContents returns a copy of the contents of the file that a patched hard
+// link points to, from before it was patched.
+func (rw *rewriter) linkedContents(linkname string) []byte {
+	target, ok := CleanName(linkname)
+	if !ok {
+		return nil
+	}
+	if contents, ok := rw.detached[target]; ok {
+		return bytes.Clone(contents)
+	}
+	return bytes.Clone(rw.linked[target])
+}
+
+// relink writes an entry that is not patched. Hard links to patched files are
+// detached from them: the first one becomes a regular file with the contents of
+// the file before it was patched, and the others link to it instead.
+func (rw *rewriter) relink(hdr *tar.Header, r io.Reader) error {
+	if hdr.Typeflag != tar.TypeLink {
+		return rw.write(hdr, r)
+	}
+	target, ok := CleanName(hdr.Linkname)
+	if !ok {
+		return rw.write(hdr, r)
+	}
+	contents, ok := rw.detached[target]
+	if !ok {
+		return rw.write(hdr, r)
+	}
+
+	if first, ok := rw.relinked[target]; ok {
+		link := *hdr
+		link.Linkname = first
+		return rw.write(&link, nil)
+	}
+
+	regular := *hdr
+	regular.Typeflag = tar.TypeReg
+	regular.Linkname = ""
+	regular.Size = int64(len(contents))
+	rw.relinked[target] = hdr.Name
+	return rw.write(&regular, bytes.NewReader(contents))
+}
+
+// create adds the files that were patched without being in the tarball.
+func (rw *rewriter) create() error {
+	for _, name := range rw.order {
+		if rw.patched[name] {
+			continue
+		}
+
+		patches := rw.patches[name]
+		contents, keep, err := apply(patches, nil, false)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %v", name, err)
+		}
+		if !keep {
+			continue
+		}
+
+		if err := rw.createParents(path.Dir(name)); err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     rw.entryName(name),
+			Mode:     mode(patches),
+			Size:     int64(len(contents)),
+			ModTime:  time.Now(),
+		}
+		if err := rw.write(hdr, bytes.NewReader(contents)); err != nil {
+			return fmt.Errorf("could not create %s: %v", name, err)
+		}
+		rw.seen[name] = true
+	}
+	return nil
+}
+
+// createParents adds the directories leading to dir that are not in the tarball.
+func (rw *rewriter) createParents(dir string) error {
+	if rw.seen[dir] {
+		return nil
+	}
+	if err := rw.createParents(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     rw.entryName(dir) + "/",
+		Mode:     0755,
+		ModTime:  time.Now(),
+	}
+	if err := rw.write(hdr, nil); err != nil {
+		return fmt.Errorf("could not create %s: %v", dir, err)
+	}
+	rw.seen[dir] = true
+	return nil
+}
+
+// entryName returns the name of a new entry, in the style of the tarball.
+func (rw *rewriter) entryName(name string) string {
+	if rw.dotSlash {
+		return "." + name
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+func (rw *rewriter) write(hdr *tar.Header, r io.Reader) error {
+	if err := rw.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+	_, err := io.Copy(rw.tw, r)
+	return err
+}
+
+// apply applies the patches in order to the contents of a file.
+func apply(patches []Patch, contents []byte, exists bool) ([]byte, bool, error) {
+	for _, p := range patches {
+		var err error
+		contents, exists, err = p.Edit(contents, exists)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			contents = nil
+		}
+	}
+	return contents, exists, nil
+}
+
+// withoutSkipLinks returns the patches that apply to links.
+func withoutSkipLinks(patches []Patch) []Patch {
+	var out []Patch
+	for _, p := range patches {
+		if !p.SkipLinks {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// mode returns the permissions of a file created by the patches.
+func mode(patches []Patch) int64 {
+	for i := len(patches) - 1; i >= 0; i-- {
+		if patches[i].Mode != 0 {
+			return patches[i].Mode
+		}
+	}
+	return 0644
+}
@@ -0,0 +1,287 @@
+package rootfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+func TestRewrite(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []fakeEntry{
+		dir("etc"),
+		withTime(owned(file("etc/hosts", "127.0.0.1 localhost"), 42), mtime),
+		file("etc/wsl.conf", "[boot]\nsystemd = true\n"),
+		symlink("etc/resolv.conf", "../run/resolvconf/resolv.conf"),
+		dir("opt"),
+		dir("opt/app"),
+		file("opt/app/bin", "ELF"),
+		withXattr(file("usr/bin/ping", "ELF"), "security.capability", "cap_net_raw"),
+	}
+	linked := []fakeEntry{
+		dir("bin"),
+		file("bin/gzip", "GZIP"),
+		hardlink("bin/gunzip", "bin/gzip"),
+		hardlink("bin/zcat", "bin/gzip"),
+		file("bin/ls", "LS"),
+		hardlink("bin/dir", "bin/ls"),
+	}
+	original := []string{
+		`etc/ 5 755 0:0 ""`,
+		`etc/hosts 0 644 42:42 "127.0.0.1 localhost"`,
+		`etc/wsl.conf 0 644 0:0 "[boot]\nsystemd = true\n"`,
+		`etc/resolv.conf 2 777 0:0 "-> ../run/resolvconf/resolv.conf"`,
+		`opt/ 5 755 0:0 ""`,
+		`opt/app/ 5 755 0:0 ""`,
+		`opt/app/bin 0 644 0:0 "ELF"`,
+		`usr/bin/ping 0 644 0:0 "ELF"`,
+	}
+
+	testCases := map[string]struct {
+		entries []fakeEntry
+		format  rootfs.Format
+		patches []rootfs.Patch
+
+		want    []string // Entries of the rewritten tarball, in order, or the original ones if nil
+		wantErr bool
+	}{
+		"copy without patches":          {},
+		"copy from another compression": {format: rootfs.FormatZstd},
+
+		"replace a file, keeping its metadata": {
+			patches: []rootfs.Patch{rootfs.WriteFile("/etc/hosts", []byte("10.0.0.1 db\n"), 0600)},
+			want:    replace(original, 1, `etc/hosts 0 644 42:42 "10.0.0.1 db\n"`),
+		},
+		"replace a symlink with a file": {
+			patches: []rootfs.Patch{rootfs.WriteFile("/etc/resolv.conf", []byte("nameserver 1.1.1.1\n"), 0)},
+			want:    replace(original, 3, `etc/resolv.conf 0 644 0:0 "nameserver 1.1.1.1\n"`),
+		},
+		"add a file at the end": {
+			patches: []rootfs.Patch{rootfs.WriteFile("/etc/hostname", []byte("ubuntu\n"), 0)},
+			want:    append(clone(original), `etc/hostname 0 644 0:0 "ubuntu\n"`),
+		},
+		"add a file along with its parent directories": {
+			patches: []rootfs.Patch{rootfs.WriteFile("usr/local/share/ca-certificates/corp.crt", []byte("PEM"), 0444)},
+			want: append(clone(original),
+				`usr/ 5 755 0:0 ""`,
+				`usr/local/ 5 755 0:0 ""`,
+				`usr/local/share/ 5 755 0:0 ""`,
+				`usr/local/share/ca-certificates/ 5 755 0:0 ""`,
+				`usr/local/share/ca-certificates/corp.crt 0 444 0:0 "PEM"`),
+		},
+		"add a file in the style of names starting with ./": {
+			entries: []fakeEntry{dir("./etc"), file("./etc/hosts", "")},
+			patches: []rootfs.Patch{rootfs.WriteFile("/etc/hostname", []byte("ubuntu"), 0), rootfs.WriteFile("/root/.bashrc", nil, 0)},
+			want: []string{
+				`./etc/ 5 755 0:0 ""`,
+				`./etc/hosts 0 644 0:0 ""`,
+				`./etc/hostname 0 644 0:0 "ubuntu"`,
+				`./root/ 5 755 0:0 ""`,
+				`./root/.bashrc 0 644 0:0 ""`,
+			},
+		},
+		"delete a file": {
+			patches: []rootfs.Patch{rootfs.Delete("/etc/wsl.conf")},
+			want:    remove(original, 2),
+		},
+		"delete a directory with its contents": {
+			patches: []rootfs.Patch{rootfs.Delete("/opt")},
+			want:    remove(remove(remove(original, 6), 5), 4),
+		},
+		"delete a file that does not exist": {
+			patches: []rootfs.Patch{rootfs.Delete("/etc/shadow")},
+		},
+		"apply patches to the same file in order": {
+			patches: []rootfs.Patch{
+				rootfs.Delete("/etc/wsl.conf"),
+				rootfs.SetINI("/etc/wsl.conf", "user", "default", "u"),
+				rootfs.SetINI("/etc/wsl.conf", "network", "generateHosts", "false"),
+				rootfs.AppendLines("/etc/hosts", false, "10.0.0.1 db"),
+			},
+			want: replace(replace(original,
+				1, `etc/hosts 0 644 42:42 "127.0.0.1 localhost\n10.0.0.1 db\n"`),
+				2, `etc/wsl.conf 0 644 0:0 "[user]\ndefault = u\n\n[network]\ngenerateHosts = false\n"`),
+		},
+		"append to a file that does not exist without creating it": {
+			patches: []rootfs.Patch{rootfs.AppendLines("/etc/ssl/certs/ca-certificates.crt", false, "PEM")},
+		},
+		"append to a link without replacing it": {
+			patches: []rootfs.Patch{rootfs.AppendLines("/etc/resolv.conf", false, "nameserver 1.1.1.1")},
+		},
+		"append to a file that does not exist, creating it": {
+			patches: []rootfs.Patch{rootfs.AppendLines("/etc/motd", true, "Hello", "World")},
+			want:    append(clone(original), `etc/motd 0 644 0:0 "Hello\nWorld\n"`),
+		},
+
+		"delete a file with hard links": {
+			entries: linked,
+			patches: []rootfs.Patch{rootfs.Delete("/bin/gzip")},
+			want: []string{
+				`bin/ 5 755 0:0 ""`,
+				`bin/gunzip 0 644 0:0 "GZIP"`,
+				`bin/zcat 1 644 0:0 "-> bin/gunzip"`,
+				`bin/ls 0 644 0:0 "LS"`,
+				`bin/dir 1 644 0:0 "-> bin/ls"`,
+			},
+		},
+		"edit a hard link, keeping the contents of its file": {
+			entries: linked,
+			patches: []rootfs.Patch{rootfs.AppendLines("/bin/zcat", false, "MORE")},
+			want: []string{
+				`bin/ 5 755 0:0 ""`,
+				`bin/gzip 0 644 0:0 "GZIP"`,
+				`bin/gunzip 1 644 0:0 "-> bin/gzip"`,
+				`bin/zcat 0 644 0:0 "GZIP\nMORE\n"`,
+				`bin/ls 0 644 0:0 "LS"`,
+				`bin/dir 1 644 0:0 "-> bin/ls"`,
+			},
+		},
+		"edit a hard link to a file that is patched as well": {
+			entries: linked,
+			patches: []rootfs.Patch{rootfs.WriteFile("/bin/gzip", []byte("NEW"), 0), rootfs.AppendLines("/bin/zcat", false, "MORE")},
+			want: []string{
+				`bin/ 5 755 0:0 ""`,
+				`bin/gzip 0 644 0:0 "NEW"`,
+				`bin/gunzip 0 644 0:0 "GZIP"`,
+				`bin/zcat 0 644 0:0 "GZIP\nMORE\n"`,
+				`bin/ls 0 644 0:0 "LS"`,
+				`bin/dir 1 644 0:0 "-> bin/ls"`,
+			},
+		},
+		"replace a file with hard links": {
+			entries: linked,
+			patches: []rootfs.Patch{rootfs.WriteFile("/bin/gzip", []byte("NEW"), 0)},
+			want: []string{
+				`bin/ 5 755 0:0 ""`,
+				`bin/gzip 0 644 0:0 "NEW"`,
+				`bin/gunzip 0 644 0:0 "GZIP"`,
+				`bin/zcat 1 644 0:0 "-> bin/gunzip"`,
+				`bin/ls 0 644 0:0 "LS"`,
+				`bin/dir 1 644 0:0 "-> bin/ls"`,
+			},
+		},
+
+		"error patching a directory":             {patches: []rootfs.Patch{rootfs.WriteFile("/opt/app", []byte("oops"), 0)}, wantErr: true},
+		"error patching the root":                {patches: []rootfs.Patch{rootfs.Delete("/")}, wantErr: true},
+		"error patching outside the root":        {patches: []rootfs.Patch{rootfs.Delete("/../etc/hosts")}, wantErr: true},
+		"error when a patch fails":               {patches: []rootfs.Patch{failingPatch("/etc/hosts")}, wantErr: true},
+		"error when a patch to a new file fails": {patches: []rootfs.Patch{failingPatch("/etc/new")}, wantErr: true},
+		"error with an unknown format":           {format: "not a tarball", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.entries == nil {
+				tc.entries = entries
+			}
+			if tc.format == "" {
+				tc.format = rootfs.FormatGzip
+			}
+			if tc.want == nil {
+				tc.want = original
+			}
+
+			data := []byte("This is not a tarball")
+			if tc.format != "not a tarball" {
+				data = makeTarball(t, tc.entries, tc.format)
+			}
+
+			var out bytes.Buffer
+			err := rootfs.Rewrite(&out, bytes.NewReader(data), tc.patches)
+			if tc.wantErr {
+				require.Error(t, err, "Rewrite should have failed")
+				return
+			}
+			require.NoError(t, err, "Rewrite should not have failed")
+
+			hdrs, got := readTarball(t, out.Bytes())
+			require.Equal(t, tc.want, got, "Unexpected entries in the rewritten tarball")
+
+			// Metadata that is not part of the description is preserved as well.
+			for _, hdr := range hdrs {
+				switch hdr.Name {
+				case "etc/hosts":
+					require.True(t, mtime.Equal(hdr.ModTime), "The modification time of a patched file should be preserved")
+				case "usr/bin/ping":
+					require.Equal(t, "cap_net_raw", hdr.PAXRecords["SCHILY.xattr.security.capability"], "Extended attributes should be preserved")
+				}
+			}
+		})
+	}
+}
+
+// readTarball describes the entries of a gzip-compressed tarball, in order.
+func readTarball(t *testing.T, data []byte) ([]*tar.Header, []string) {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err, "The tarball should be compressed with gzip")
+
+	var hdrs []*tar.Header
+	var entries []string
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err, "The tarball should be readable")
+
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err, "The tarball should be readable")
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			contents = []byte("-> " + hdr.Linkname)
+		}
+
+		hdrs = append(hdrs, hdr)
+		entries = append(entries, fmt.Sprintf("%s %c %o %d:%d %q", hdr.Name, hdr.Typeflag, hdr.Mode, hdr.Uid, hdr.Gid, contents))
+	}
+	return hdrs, entries
+}
+
+func withTime(e fakeEntry, mtime time.Time) fakeEntry {
+	e.hdr.ModTime = mtime
+	return e
+}
+
+func withXattr(e fakeEntry, key, value string) fakeEntry {
+	e.hdr.PAXRecords = map[string]string{"SCHILY.xattr." + key: value}
+	return e
+}
+
+func failingPatch(p string) rootfs.Patch {
+	return rootfs.Patch{
+		Path: p,
+		Edit: func([]byte, bool) ([]byte, bool, error) {
+			return nil, false, errors.New("patch failed on purpose")
+		},
+	}
+}
+
+func clone(s []string) []string {
+	return append([]string(nil), s...)
+}
+
+func replace(s []string, i int, v string) []string {
+	s = clone(s)
+	s[i] = v
+	return s
+}
+
+func remove(s []string, i int) []string {
+	s = clone(s)
+	return append(s[:i], s[i+1:]...)
+}
@@ -0,0 +1,187 @@
+// Package script prepares scripts to be run by an interpreter that reads them
+// from its standard input, and finds where they failed.
+//
+// Scripts are read via /dev/stdin rather than passed on the command line, so
+// that they need no escaping and their size is not limited. Shell scripts are
+// made strict (set -euo pipefail) without shifting their line numbers.
+package script
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/shell"
+)
+
+// DefaultInterpreter runs scripts that specify no interpreter, either as a
+// parameter or with a shebang.
+const DefaultInterpreter = "/bin/sh"
+
+// Path is the path the interpreter reads the script from. It is how the script
+// is named in error messages.
+const Path = "/dev/stdin"
+
+// Preambles that make shell scripts strict. They are written on the first line
+// of the script, so that line numbers are unaffected.
+const (
+	// bashPreamble reports the line of the command that failed, in the same
+	// format as the errors of bash.
+	bashPreamble = `set -euo pipefail; trap 'echo "` + Path + `: line $LINENO: exit status $?" >&2' ERR; `
+
+	// posixPreamble enables pipefail only where it is supported, as it is not POSIX.
+	posixPreamble = `set -eu; (set -o pipefail) 2>/dev/null && set -o pipefail; `
+)
+
+// Prepare returns the command that runs the script with the interpreter, passing
+// it args, and the contents to write into its standard input.
+//
+// The interpreter is a command line such as "python3 -u", which is not escaped.
+// If it is empty, the interpreter in the shebang of the script is used, with the
+// same semantics as the kernel. If there is none, DefaultInterpreter is used.
+func Prepare(r io.Reader, interpreter string, args []string) (command string, stdin io.Reader, err error) {
+	br := bufio.NewReader(r)
+
+	firstLine, err := br.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, fmt.Errorf("could not read script: %v", err)
+	}
+
+	shebang, hasShebang := cutShebang(firstLine)
+
+	var program string
+	switch {
+	case strings.TrimSpace(interpreter) != "":
+		command = interpreter
+		program = nthField(interpreter, 0)
+		if path.Base(program) == "env" {
+			program = nthField(interpreter, 1)
+		}
+	case hasShebang:
+		command, program, err = shebangCommand(shebang)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		command = DefaultInterpreter
+		program = DefaultInterpreter
+	}
+
+	if preamble, ok := preambles[path.Base(program)]; ok {
+		// The shebang is a comment to shells, so it can be replaced. Otherwise the
+		// preamble is prepended to the first line.
+		if hasShebang {
+			firstLine = preamble + lineEnding(firstLine)
+		} else {
+			firstLine = preamble + firstLine
+		}
+	}
+
+	command = fmt.Sprintf("%s %s", command, Path)
+	for _, arg := range args {
+		command = fmt.Sprintf("%s %s", command, shell.Quote(arg))
+	}
+
+	return command, io.MultiReader(strings.NewReader(firstLine), br), nil
+}
+
+// preambles maps the names of the shells to the preamble that makes them strict.
+var preambles = map[string]string{
+	"bash": bashPreamble,
+	"zsh":  bashPreamble,
+	"ksh":  bashPreamble,
+	"sh":   posixPreamble,
+	"dash": posixPreamble,
+	"ash":  posixPreamble,
+	"mksh": posixPreamble,
+}
+
+// cutShebang returns the interpreter line of the shebang, without "#!".
+func cutShebang(line string) (string, bool) {
+	if !strings.HasPrefix(line, "#!") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "#!")), true
+}
+
+// shebangCommand returns the command that runs the interpreter of a shebang,
+// and the name of the program that interprets the script. Like the kernel,
+// everything after the interpreter is passed as a single argument.
+func shebangCommand(shebang string) (command, program string, err error) {
+	interpreter, arg := shebang, ""
+	if i := strings.IndexAny(shebang, " \t"); i >= 0 {
+		interpreter, arg = shebang[:i], strings.TrimSpace(shebang[i:])
+	}
+	if interpreter == "" {
+		return "", "", errors.New("could not read script: empty shebang")
+	}
+
+	command = shell.Quote(interpreter)
+	program = interpreter
+	if arg != "" {
+		command = fmt.Sprintf("%s %s", command, shell.Quote(arg))
+		if path.Base(interpreter) == "env" {
+			program = nthField(arg, 0)
+			if program == "-S" {
+				program = nthField(arg, 1)
+			}
+		}
+	}
+
+	return command, program, nil
+}
+
+// nthField returns the n-th whitespace-separated field of s, or an empty string.
+func nthField(s string, n int) string {
+	fields := strings.Fields(s)
+	if n >= len(fields) {
+		return ""
+	}
+	return fields[n]
+}
+
+// lineEnding returns the line ending of the line, if any.
+func lineEnding(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return "\r\n"
+	}
+	if strings.HasSuffix(line, "\n") {
+		return "\n"
+	}
+	return ""
+}
+
+// linePatterns match the line numbers in the error messages of common interpreters.
+var linePatterns = []*regexp.Regexp{
+	regexp.MustCompile(regexp.QuoteMeta(Path) + `: line (\d+):`),            // bash, and the bash preamble
+	regexp.MustCompile(regexp.QuoteMeta(Path) + `: (\d+):`),                 // dash
+	regexp.MustCompile(regexp.QuoteMeta(Path) + `:(\d+):`),                  // zsh, ruby
+	regexp.MustCompile(`File "` + regexp.QuoteMeta(Path) + `", line (\d+)`), // python
+	regexp.MustCompile(`at ` + regexp.QuoteMeta(Path) + ` line (\d+)`),      // perl
+}
+
+// FailedLine finds the line where the script failed in the standard error
+// output of its interpreter. The last error message wins, as tracebacks
+// end with the innermost frame.
+func FailedLine(stderr []byte) (line int, ok bool) {
+	last := -1
+	for _, pattern := range linePatterns {
+		for _, m := range pattern.FindAllSubmatchIndex(stderr, -1) {
+			if m[0] < last {
+				continue
+			}
+			n, err := strconv.Atoi(string(stderr[m[2]:m[3]]))
+			if err != nil {
+				continue
+			}
+			last = m[0]
+			line = n
+		}
+	}
+	return line, last >= 0
+}
@@ -0,0 +1,202 @@
+package script_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/script"
+)
+
+func TestPrepare(t *testing.T) {
+	t.Parallel()
+
+	const posix = `set -eu; (set -o pipefail) 2>/dev/null && set -o pipefail; `
+	const bash = `set -euo pipefail; trap 'echo "/dev/stdin: line $LINENO: exit status $?" >&2' ERR; `
+
+	testCases := map[string]struct {
+		script      string
+		interpreter string
+		args        []string
+
+		wantCommand string
+		wantStdin   string
+	}{
+		"default interpreter":            {script: "echo hello\n", wantCommand: "/bin/sh /dev/stdin", wantStdin: posix + "echo hello\n"},
+		"explicit interpreter":           {script: "echo hello\n", interpreter: "bash", wantCommand: "bash /dev/stdin", wantStdin: bash + "echo hello\n"},
+		"interpreter with arguments":     {script: "print(1)\n", interpreter: "python3 -u", wantCommand: "python3 -u /dev/stdin", wantStdin: "print(1)\n"},
+		"interpreter through env":        {script: "echo hello\n", interpreter: "/usr/bin/env bash", wantCommand: "/usr/bin/env bash /dev/stdin", wantStdin: bash + "echo hello\n"},
+		"interpreter with path":          {script: "echo hello\n", interpreter: "/usr/bin/dash", wantCommand: "/usr/bin/dash /dev/stdin", wantStdin: posix + "echo hello\n"},
+		"arguments are quoted":           {script: "echo hello\n", args: []string{"a b", "it's", "$HOME"}, wantCommand: `/bin/sh /dev/stdin 'a b' 'it'\''s' '$HOME'`, wantStdin: posix + "echo hello\n"},
+		"explicit interpreter wins":      {script: "#!/usr/bin/python3\nprint(1)\n", interpreter: "bash", wantCommand: "bash /dev/stdin", wantStdin: bash + "\nprint(1)\n"},
+		"empty script":                   {script: "", wantCommand: "/bin/sh /dev/stdin", wantStdin: posix},
+		"no trailing line ending":        {script: "echo hello", wantCommand: "/bin/sh /dev/stdin", wantStdin: posix + "echo hello"},
+		"first line is a comment":        {script: "# comment\necho hello\n", wantCommand: "/bin/sh /dev/stdin", wantStdin: posix + "# comment\necho hello\n"},
+		"unknown interpreter is as-is":   {script: "puts 1\n", interpreter: "ruby", wantCommand: "ruby /dev/stdin", wantStdin: "puts 1\n"},
+		"shebang":                        {script: "#!/bin/bash\necho hello\n", wantCommand: "'/bin/bash' /dev/stdin", wantStdin: bash + "\necho hello\n"},
+		"shebang with spaces":            {script: "#! /bin/bash \necho hello\n", wantCommand: "'/bin/bash' /dev/stdin", wantStdin: bash + "\necho hello\n"},
+		"shebang with windows endings":   {script: "#!/bin/sh\r\necho hello\r\n", wantCommand: "'/bin/sh' /dev/stdin", wantStdin: posix + "\r\necho hello\r\n"},
+		"shebang with one argument":      {script: "#!/bin/bash -x\necho hello\n", wantCommand: "'/bin/bash' '-x' /dev/stdin", wantStdin: bash + "\necho hello\n"},
+		"shebang argument is one word":   {script: "#!/usr/bin/awk -f -v\n", wantCommand: "'/usr/bin/awk' '-f -v' /dev/stdin", wantStdin: "#!/usr/bin/awk -f -v\n"},
+		"shebang with a tab":             {script: "#!/bin/bash\t-x\n", wantCommand: "'/bin/bash' '-x' /dev/stdin", wantStdin: bash + "\n"},
+		"shebang through env":            {script: "#!/usr/bin/env python3\nprint(1)\n", wantCommand: "'/usr/bin/env' 'python3' /dev/stdin", wantStdin: "#!/usr/bin/env python3\nprint(1)\n"},
+		"shebang through env to a shell": {script: "#!/usr/bin/env bash\necho hello\n", wantCommand: "'/usr/bin/env' 'bash' /dev/stdin", wantStdin: bash + "\necho hello\n"},
+		"shebang through env -S":         {script: "#!/usr/bin/env -S bash -x\necho hello\n", wantCommand: "'/usr/bin/env' '-S bash -x' /dev/stdin", wantStdin: bash + "\necho hello\n"},
+		"shebang and arguments":          {script: "#!/bin/sh\n", args: []string{"x"}, wantCommand: "'/bin/sh' /dev/stdin 'x'", wantStdin: posix + "\n"},
+		"shebang only on the first line": {script: "echo hello\n#!/bin/bash\n", wantCommand: "/bin/sh /dev/stdin", wantStdin: posix + "echo hello\n#!/bin/bash\n"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			command, stdin, err := script.Prepare(strings.NewReader(tc.script), tc.interpreter, tc.args)
+			require.NoError(t, err, "Prepare should not return an error")
+			require.Equal(t, tc.wantCommand, command, "Unexpected command")
+
+			got, err := io.ReadAll(stdin)
+			require.NoError(t, err, "Reading the prepared script should not fail")
+			require.Equal(t, tc.wantStdin, string(got), "Unexpected prepared script")
+		})
+	}
+}
+
+func TestPrepareErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		script io.Reader
+	}{
+		"error on empty shebang":           {script: strings.NewReader("#!\necho hello\n")},
+		"error on shebang with only space": {script: strings.NewReader("#!   \n")},
+		"error reading the script":         {script: iotest.ErrReader(errors.New("mock error"))},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := script.Prepare(tc.script, "", nil)
+			require.Error(t, err, "Prepare should have returned an error")
+		})
+	}
+}
+
+func TestRunPrepared(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		script      string
+		interpreter string
+		args        []string
+
+		wantStdout   string
+		wantExitCode int
+		wantLine     int
+	}{
+		"success":                          {script: "echo hello\necho world\n", wantStdout: "hello\nworld\n"},
+		"success with arguments":           {script: `printf '%s|' "$@"`, args: []string{"a b", "it's", "$HOME"}, wantStdout: "a b|it's|$HOME|"},
+		"success with a shebang":           {script: "#!/bin/bash\necho ${BASH_VERSION:+bash}\n", wantStdout: "bash\n"},
+		"success with a lenient script":    {script: "set +eu\nfalse\necho $UNSET_VARIABLE done\n", wantStdout: "done\n"},
+		"success with a failing if":        {script: "#!/bin/bash\nif false; then echo no; fi\necho yes\n", wantStdout: "yes\n"},
+		"success with stdin of the script": {script: "cat\necho done\n", wantStdout: "done\n"},
+
+		"error stops the script in sh":       {script: "echo one\nfalse\necho two\n", wantStdout: "one\n", wantExitCode: 1},
+		"error stops the script in bash":     {script: "echo one\nfalse\necho two\n", interpreter: "bash", wantStdout: "one\n", wantExitCode: 1, wantLine: 2},
+		"error on first line in bash":        {script: "false\necho two\n", interpreter: "bash", wantExitCode: 1, wantLine: 1},
+		"error after a shebang in bash":      {script: "#!/bin/bash\n\n\n(exit 3)\necho two\n", wantExitCode: 3, wantLine: 4},
+		"error on unset variable in sh":      {script: "echo one\n\necho $UNSET_VARIABLE\n", wantStdout: "one\n", wantExitCode: 2, wantLine: 3},
+		"error on unset variable in bash":    {script: "echo one\n\necho $UNSET_VARIABLE\n", interpreter: "bash", wantStdout: "one\n", wantExitCode: 1, wantLine: 3},
+		"error on pipe failure in bash":      {script: "echo one\nfalse | true\necho two\n", interpreter: "bash", wantStdout: "one\n", wantExitCode: 1, wantLine: 2},
+		"error on command not found in sh":   {script: "\n\nthis-command-does-not-exist\n", wantExitCode: 127, wantLine: 3},
+		"error on command not found in bash": {script: "\n\nthis-command-does-not-exist\n", interpreter: "bash", wantExitCode: 127, wantLine: 3},
+		"error on syntax in sh":              {script: "echo one\nif then\n", wantStdout: "one\n", wantExitCode: 2, wantLine: 2},
+		"error in a python script":           {script: "#!/usr/bin/env python3\nimport sys\n\nraise Exception('oops')\n", wantExitCode: 1, wantLine: 4},
+		"error in a perl script":             {script: "print 1;\ndie 'oops';\n", interpreter: "perl", wantStdout: "1", wantExitCode: 255, wantLine: 2},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			command, stdin, err := script.Prepare(strings.NewReader(tc.script), tc.interpreter, tc.args)
+			require.NoError(t, err, "Prepare should not return an error")
+
+			program := strings.Fields(command)[0]
+			if _, err := exec.LookPath(strings.Trim(program, "'")); err != nil {
+				t.Skipf("Skipping test because %s is not available", program)
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command("/bin/sh", "-c", command)
+			cmd.Stdin = stdin
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			err = cmd.Run()
+			require.Equal(t, tc.wantStdout, stdout.String(), "Unexpected output of the script. Stderr: %s", stderr.String())
+
+			if tc.wantExitCode == 0 {
+				require.NoError(t, err, "The script should not fail. Stderr: %s", stderr.String())
+				return
+			}
+
+			var exitErr *exec.ExitError
+			require.ErrorAs(t, err, &exitErr, "The script should have failed")
+			require.Equal(t, tc.wantExitCode, exitErr.ExitCode(), "Unexpected exit code. Stderr: %s", stderr.String())
+
+			line, ok := script.FailedLine(stderr.Bytes())
+			if tc.wantLine == 0 {
+				return
+			}
+			require.True(t, ok, "The failing line should have been found in stderr: %s", stderr.String())
+			require.Equal(t, tc.wantLine, line, "Unexpected failing line. Stderr: %s", stderr.String())
+		})
+	}
+}
+
+func TestFailedLine(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		stderr string
+
+		wantLine int
+		wantOk   bool
+	}{
+		"bash":                {stderr: "/dev/stdin: line 12: foo: command not found\n", wantLine: 12, wantOk: true},
+		"dash":                {stderr: "/dev/stdin: 7: foo: not found\n", wantLine: 7, wantOk: true},
+		"zsh":                 {stderr: "/dev/stdin:5: command not found: foo\n", wantLine: 5, wantOk: true},
+		"ruby":                {stderr: "/dev/stdin:3:in `<main>': oops (RuntimeError)\n", wantLine: 3, wantOk: true},
+		"perl":                {stderr: "oops at /dev/stdin line 9.\n", wantLine: 9, wantOk: true},
+		"python":              {stderr: "Traceback (most recent call last):\n  File \"/dev/stdin\", line 4, in <module>\nException: oops\n", wantLine: 4, wantOk: true},
+		"python nested":       {stderr: "Traceback (most recent call last):\n  File \"/dev/stdin\", line 8, in <module>\n  File \"/dev/stdin\", line 2, in f\nException: oops\n", wantLine: 2, wantOk: true},
+		"last message wins":   {stderr: "/dev/stdin: line 2: warning\n/dev/stdin: line 5: exit status 1\n", wantLine: 5, wantOk: true},
+		"last across formats": {stderr: "/dev/stdin: 2: warning\n/dev/stdin: line 5: exit status 1\n", wantLine: 5, wantOk: true},
+		"with other output":   {stderr: "some output\n/dev/stdin: line 3: exit status 2\nmore output\n", wantLine: 3, wantOk: true},
+
+		"no line number":    {stderr: "something failed\n"},
+		"other file":        {stderr: "/etc/profile: line 3: foo: command not found\n"},
+		"empty":             {stderr: ""},
+		"number is too big": {stderr: "/dev/stdin: line 99999999999999999999: oops\n"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			line, ok := script.FailedLine([]byte(tc.stderr))
+			require.Equal(t, tc.wantOk, ok, "Unexpected detection of the failing line")
+			require.Equal(t, tc.wantLine, line, "Unexpected failing line")
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package session multiplexes sequential commands over the standard streams
+// of a single long-lived POSIX shell.
+//
+// Each command is run in its own subshell, so that it cannot alter or exit the
+// shell that hosts the session. Its output is framed by markers that are unique
+// to the session, which carry the exit code of the command.
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ubuntu/gowsl/internal/shell"
+)
+
+// Result is the outcome of a command run in a session.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Conn is a session over the standard streams of a POSIX shell. Commands can be
+// run concurrently, but they are executed one after the other.
+type Conn struct {
+	stdin  io.Writer
+	stdout *bufio.Reader
+	stderr *bufio.Reader
+
+	token string // Random token to make the markers of this session unique
+	count int    // Number of commands run so far
+
+	mu  sync.Mutex
+	err error // Once set, the session is broken and cannot be used anymore
+}
+
+// New creates a session over the streams of a shell that reads its script from stdin.
+func New(stdin io.Writer, stdout, stderr io.Reader) (*Conn, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("could not generate session token: %v", err)
+	}
+
+	return &Conn{
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		stderr: bufio.NewReader(stderr),
+		token:  "gowsl-session-" + hex.EncodeToString(token),
+	}, nil
+}
+
+// Err returns the error that broke the session, if any.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Run runs a command in the session and waits for it to complete. The command
+// does not have access to stdin.
+//
+// A non-zero exit code is not considered an error. Errors mean that the session
+// is broken and must be discarded. This is the case when the context is done
+// before the command completes.
+func (c *Conn) Run(ctx context.Context, command string) (Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return Result{}, c.err
+	}
+
+	c.count++
+	marker := fmt.Sprintf("%s-%d", c.token, c.count)
+
+	type outcome struct {
+		res Result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := c.exchange(command, marker)
+		done <- outcome{res: res, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		c.err = fmt.Errorf("session interrupted: %v", ctx.Err())
+		return Result{}, ctx.Err()
+	case o := <-done:
+		if o.err != nil {
+			c.err = fmt.Errorf("session broken: %v", o.err)
+		}
+		return o.res, o.err
+	}
+}
+
+// exchange sends the command to the shell and reads back its framed output.
+func (c *Conn) exchange(command, marker string) (res Result, err error) {
+	if _, err := io.WriteString(c.stdin, script(command, marker)); err != nil {
+		return res, fmt.Errorf("could not send command: %v", err)
+	}
+
+	var stderrErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		res.Stderr, _, stderrErr = readFrame(c.stderr, marker)
+	}()
+
+	var tail string
+	res.Stdout, tail, err = readFrame(c.stdout, marker)
+	wg.Wait()
+
+	if err != nil {
+		return res, fmt.Errorf("could not read stdout: %v", err)
+	}
+	if stderrErr != nil {
+		return res, fmt.Errorf("could not read stderr: %v", stderrErr)
+	}
+
+	res.ExitCode, err = strconv.Atoi(tail)
+	if err != nil {
+		return res, fmt.Errorf("could not parse exit code %q: %v", tail, err)
+	}
+
+	return res, nil
+}
+
+// script generates the shell code that runs the command and frames its output.
+// The command is evaluated in a subshell so that neither exit, nor syntax errors,
+// nor changes to the environment affect the session.
+func script(command, marker string) string {
+	return fmt.Sprintf(`gowsl_cmd=%s
+( eval "$gowsl_cmd" ) </dev/null
+printf '\n%s %%d\n' "$?"
+printf '\n%s\n' >&2
+`, shell.Quote(command), marker, marker)
+}
+
+// readFrame reads from r until it finds the line with the marker. It returns
+// the data before the marker, and the remainder of the marker line.
+//
+// The marker is always preceded by an extra line break, so that it starts a
+// line even if the command's output did not end with one. This line break is
+// not part of the data.
+func readFrame(r *bufio.Reader, marker string) (data []byte, tail string, err error) {
+	var buf bytes.Buffer
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil, "", errors.New("shell exited unexpectedly")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if rest, ok := cutMarker(line, marker); ok && buf.Len() > 0 {
+			data = buf.Bytes()
+			return data[:len(data)-1], rest, nil
+		}
+		buf.Write(line)
+	}
+}
+
+// cutMarker checks if the line is a marker line. If it is, it returns the rest
+// of the line.
+func cutMarker(line []byte, marker string) (string, bool) {
+	l := strings.TrimSuffix(string(line), "\n")
+	if l == marker {
+		return "", true
+	}
+	if !strings.HasPrefix(l, marker+" ") {
+		return "", false
+	}
+	return strings.TrimPrefix(l, marker+" "), true
+}
@@ -0,0 +1,179 @@
+package session_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/session"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		command string
+
+		wantStdout   string
+		wantStderr   string
+		wantExitCode int
+		wantFailure  bool // Only check that the exit code is not zero
+	}{
+		"success":                           {command: "true"},
+		"stdout":                            {command: "echo Hello", wantStdout: "Hello\n"},
+		"stderr":                            {command: "echo Error >&2", wantStderr: "Error\n"},
+		"stdout and stderr":                 {command: "echo Hello; echo Error >&2", wantStdout: "Hello\n", wantStderr: "Error\n"},
+		"no trailing line break":            {command: "printf Hello; printf Error >&2", wantStdout: "Hello", wantStderr: "Error"},
+		"empty lines":                       {command: "printf '\\n\\n'", wantStdout: "\n\n"},
+		"multiple lines":                    {command: "echo one\necho two", wantStdout: "one\ntwo\n"},
+		"single quotes":                     {command: `echo 'Hello, it'\''s me'`, wantStdout: "Hello, it's me\n"},
+		"double quotes and dollars":         {command: `echo "$((1+2))" '$HOME'`, wantStdout: "3 $HOME\n"},
+		"exit code":                         {command: "exit 42", wantExitCode: 42},
+		"exit code with output":             {command: "echo Hello; echo Error >&2; exit 3", wantStdout: "Hello\n", wantStderr: "Error\n", wantExitCode: 3},
+		"stdin is not available":            {command: "cat", wantStdout: ""},
+		"long line":                         {command: "head -c 100000 /dev/zero | tr '\\0' a", wantStdout: strings.Repeat("a", 100000)},
+		"output that looks like a marker":   {command: "echo gowsl-session-0000000000000000-1 0", wantStdout: "gowsl-session-0000000000000000-1 0\n"},
+		"syntax error does not end session": {command: "echo (", wantFailure: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := newShellSession(t)
+
+			res, err := conn.Run(context.Background(), tc.command)
+			require.NoError(t, err, "Run should not return an error")
+
+			if tc.wantFailure {
+				// Errors are reported in a shell-specific way.
+				require.NotZero(t, res.ExitCode, "Unexpected exit code")
+			} else {
+				require.Equal(t, tc.wantExitCode, res.ExitCode, "Unexpected exit code")
+				require.Equal(t, tc.wantStderr, string(res.Stderr), "Unexpected stderr")
+			}
+			require.Equal(t, tc.wantStdout, string(res.Stdout), "Unexpected stdout")
+
+			// The session must still be usable afterwards
+			res, err = conn.Run(context.Background(), "echo 'Still here'")
+			require.NoError(t, err, "Run should not fail after a previous command")
+			require.Equal(t, "Still here\n", string(res.Stdout), "Unexpected stdout after a previous command")
+			require.Zero(t, res.ExitCode, "Unexpected exit code after a previous command")
+		})
+	}
+}
+
+func TestRunIsolatesCommands(t *testing.T) {
+	t.Parallel()
+
+	conn := newShellSession(t)
+
+	wd, err := conn.Run(context.Background(), "pwd")
+	require.NoError(t, err, "Run should not return an error")
+
+	_, err = conn.Run(context.Background(), "cd /tmp; export GOWSL_TEST=1")
+	require.NoError(t, err, "Run should not return an error")
+
+	res, err := conn.Run(context.Background(), `echo "env:$GOWSL_TEST"; pwd`)
+	require.NoError(t, err, "Run should not return an error")
+	require.Equal(t, "env:\n"+string(wd.Stdout), string(res.Stdout), "Commands should not affect each other")
+}
+
+func TestRunConcurrently(t *testing.T) {
+	t.Parallel()
+
+	conn := newShellSession(t)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := conn.Run(context.Background(), fmt.Sprintf("echo %d; echo %d >&2; exit %d", i, i, i))
+			require.NoError(t, err, "Run should not return an error")
+			require.Equal(t, fmt.Sprintf("%d\n", i), string(res.Stdout), "Unexpected stdout")
+			require.Equal(t, fmt.Sprintf("%d\n", i), string(res.Stderr), "Unexpected stderr")
+			require.Equal(t, i, res.ExitCode, "Unexpected exit code")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRunBreaksSession(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cancel   bool
+		exitHost bool
+	}{
+		"when the context is cancelled": {cancel: true},
+		"when the shell exits":          {exitHost: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := newShellSession(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cmd := "sleep 30"
+			if tc.exitHost {
+				cmd = "kill -9 $$; sleep 1" // $$ is the PID of the host shell, even in a subshell
+			} else {
+				go func() {
+					time.Sleep(500 * time.Millisecond)
+					cancel()
+				}()
+			}
+
+			_, err := conn.Run(ctx, cmd)
+			require.Error(t, err, "Run should return an error")
+			require.Error(t, conn.Err(), "Session should be broken")
+
+			_, err = conn.Run(context.Background(), "true")
+			require.Error(t, err, "Run should fail on a broken session")
+		})
+	}
+}
+
+// newShellSession starts a local shell and creates a session over it.
+func newShellSession(t *testing.T) *session.Conn {
+	t.Helper()
+
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("Setup: these tests need a local /bin/sh")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "/bin/sh")
+
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err, "Setup: could not pipe stdin")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err, "Setup: could not pipe stdout")
+	stderr, err := cmd.StderrPipe()
+	require.NoError(t, err, "Setup: could not pipe stderr")
+
+	require.NoError(t, cmd.Start(), "Setup: could not start shell")
+	t.Cleanup(func() {
+		cancel()
+		_ = cmd.Wait()
+	})
+
+	conn, err := session.New(stdin, stdout, stderr)
+	require.NoError(t, err, "Setup: could not create session")
+	return conn
+}
@@ -0,0 +1,33 @@
+// Package shell contains helpers to generate POSIX shell code.
+package shell
+
+import "strings"
+
+// Quote escapes a string as a single-quoted shell word, so that the shell
+// interprets it literally.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteGlob escapes a string as a shell word, except for the pattern
+// characters *, ? and brackets, so that the shell expands it as a glob.
+func QuoteGlob(pattern string) string {
+	var b strings.Builder
+	literal := 0 // Start of the literal run being processed
+
+	for i, r := range pattern {
+		if !strings.ContainsRune("*?[]", r) {
+			continue
+		}
+		if literal < i {
+			b.WriteString(Quote(pattern[literal:i]))
+		}
+		b.WriteRune(r)
+		literal = i + 1
+	}
+
+	if literal < len(pattern) || b.Len() == 0 {
+		b.WriteString(Quote(pattern[literal:]))
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package shell_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/shell"
+)
+
+func TestQuote(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+		want  string
+	}{
+		"empty":                  {input: "", want: `''`},
+		"plain":                  {input: "hello", want: `'hello'`},
+		"spaces":                 {input: "hello world", want: `'hello world'`},
+		"single quotes":          {input: "it's", want: `'it'\''s'`},
+		"only a single quote":    {input: "'", want: `''\'''`},
+		"special characters":     {input: "$HOME `ls` \"a\" \\ ; & | *", want: "'$HOME `ls` \"a\" \\ ; & | *'"},
+		"line breaks":            {input: "a\nb", want: "'a\nb'"},
+		"leading dash is kept":   {input: "-rf", want: `'-rf'`},
+		"unicode is not escaped": {input: "héllo", want: `'héllo'`},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := shell.Quote(tc.input)
+			require.Equal(t, tc.want, got, "Unexpected quoted string")
+
+			requireShellOutput(t, "printf %s "+got, tc.input)
+		})
+	}
+}
+
+func TestQuoteGlob(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, f := range []string{"a.txt", "b.txt", "c.log", "it's.txt", "x y.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0600), "Setup: could not create file")
+	}
+
+	testCases := map[string]struct {
+		pattern string
+		want    string
+	}{
+		"no glob":                   {pattern: "a.txt", want: "a.txt"},
+		"star":                      {pattern: "*.txt", want: "a.txt b.txt it's.txt x y.txt"},
+		"question mark":             {pattern: "?.txt", want: "a.txt b.txt"},
+		"brackets":                  {pattern: "[ac].*", want: "a.txt c.log"},
+		"quote before glob":         {pattern: "it'*", want: "it's.txt"},
+		"space before glob":         {pattern: "x *", want: "x y.txt"},
+		"no match is kept":          {pattern: "*.md", want: "*.md"},
+		"special characters":        {pattern: "$(touch pwned)*", want: "$(touch pwned)*"},
+		"only glob":                 {pattern: "*", want: "a.txt b.txt c.log it's.txt x y.txt"},
+		"empty pattern stays empty": {pattern: "", want: ""},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := shell.QuoteGlob(tc.pattern)
+			requireShellOutput(t, "cd "+shell.Quote(dir)+` && for f in `+got+`; do printf '%s\n' "$f"; done | paste -sd ' ' -`, tc.want+"\n")
+
+			_, err := os.Stat(filepath.Join(dir, "pwned"))
+			require.ErrorIs(t, err, os.ErrNotExist, "Pattern must not be able to run commands")
+		})
+	}
+}
+
+// requireShellOutput runs the script in a local shell and checks its output.
+func requireShellOutput(t *testing.T, script, want string) {
+	t.Helper()
+
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("Setup: these tests need a local /bin/sh")
+	}
+
+	out, err := exec.Command("/bin/sh", "-c", script).CombinedOutput()
+	require.NoError(t, err, "Script failed: %s", out)
+	require.Equal(t, want, string(out), "Unexpected output from the shell")
+}
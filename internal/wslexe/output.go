@@ -0,0 +1,46 @@
+// Package wslexe decodes the output of wsl.exe.
+package wslexe
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf16"
+)
+
+// DecodeOutput returns the output of wsl.exe as a string. Its own messages are
+// written in UTF-16LE, unless WSL_UTF8 is set in the environment, whereas the
+// output of Linux commands that it runs is usually UTF-8. Both are handled.
+func DecodeOutput(out []byte) string {
+	if !isUTF16LE(out) {
+		return string(out)
+	}
+
+	// The byte order mark is not part of the text.
+	out = bytes.TrimPrefix(out, []byte{0xFF, 0xFE})
+
+	u := make([]uint16, 0, len(out)/2)
+	for i := 0; i+1 < len(out); i += 2 {
+		u = append(u, uint16(out[i])|uint16(out[i+1])<<8)
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
+
+// isUTF16LE guesses whether the output is encoded in UTF-16LE. Text in UTF-16LE
+// has a byte order mark, or it is mostly ASCII, so that most of its odd bytes are
+// null. Null bytes are rare in UTF-8 text.
+func isUTF16LE(out []byte) bool {
+	if len(out) < 2 || len(out)%2 != 0 {
+		return false
+	}
+	if out[0] == 0xFF && out[1] == 0xFE {
+		return true
+	}
+
+	var nulls int
+	for i := 1; i < len(out); i += 2 {
+		if out[i] == 0 {
+			nulls++
+		}
+	}
+	return nulls*2 >= len(out)/2
+}
@@ -0,0 +1,49 @@
+package wslexe_test
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/internal/wslexe"
+)
+
+func TestDecodeOutput(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		out []byte
+
+		want string
+	}{
+		"empty":                       {out: nil, want: ""},
+		"UTF-8":                       {out: []byte("The operation completed successfully.\r\n"), want: "The operation completed successfully.\r\n"},
+		"UTF-8 with odd length":       {out: []byte("odd"), want: "odd"},
+		"UTF-8 with non-ASCII":        {out: []byte("Opération réussie\n"), want: "Opération réussie\n"},
+		"UTF-16LE":                    {out: utf16le("There is no distribution with the supplied name.\r\n"), want: "There is no distribution with the supplied name.\r\n"},
+		"UTF-16LE with non-ASCII":     {out: utf16le("Opération réussie ✓\r\n"), want: "Opération réussie ✓\r\n"},
+		"UTF-16LE with BOM":           {out: append([]byte{0xFF, 0xFE}, utf16le("hello")...), want: "hello"},
+		"UTF-16LE with only a BOM":    {out: []byte{0xFF, 0xFE}, want: ""},
+		"UTF-16LE with trailing null": {out: utf16le("hello\x00"), want: "hello"},
+		"UTF-16LE with surrogates":    {out: utf16le("emoji 🐧"), want: "emoji 🐧"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := wslexe.DecodeOutput(tc.out)
+			require.Equal(t, tc.want, got, "Unexpected decoded output")
+		})
+	}
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(u))
+	for _, c := range u {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return b
+}
@@ -1,8 +1,15 @@
 package gowsl
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -72,3 +79,313 @@ func TestPackFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestExitError(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		command  string
+		exitCode uint32
+
+		wantWindowsSide bool
+		wantSignal      Signal
+		wantMessage     string
+	}{
+		"Linux exit code":          {command: "exit 42", exitCode: 42, wantMessage: `command "exit 42" returned exit code 42`},
+		"Linux exit code at limit": {command: "exit 128", exitCode: 128, wantMessage: `command "exit 128" returned exit code 128`},
+		"Linux signal":             {command: "sleep 5", exitCode: 143, wantSignal: SIGTERM, wantMessage: `command "sleep 5" returned exit code 143 (SIGTERM)`},
+		"Linux unnamed signal":     {command: "sleep 5", exitCode: 128 + 40, wantSignal: Signal(40), wantMessage: `command "sleep 5" returned exit code 168 (signal 40)`},
+		"Linux highest signal":     {command: "sleep 5", exitCode: 128 + 64, wantSignal: Signal(64), wantMessage: `command "sleep 5" returned exit code 192 (signal 64)`},
+		"Linux code above signals": {command: "exit 193", exitCode: 193, wantMessage: `command "exit 193" returned exit code 193`},
+		"Linux highest exit code":  {command: "exit 255", exitCode: 255, wantMessage: `command "exit 255" returned exit code 255`},
+		"Windows exit code":        {command: "exit 0", exitCode: 0x80070005, wantWindowsSide: true, wantMessage: `command "exit 0" failed Windows-side: exit code 0x80070005`},
+		"Windows lowest exit code": {command: "exit 0", exitCode: 0x100, wantWindowsSide: true, wantMessage: `command "exit 0" failed Windows-side: exit code 0x100`},
+		"Default shell":            {exitCode: 1, wantMessage: `shell returned exit code 1`},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := &ExitError{command: tc.command, exitCode: tc.exitCode}
+
+			require.Equal(t, int(tc.exitCode), err.ExitCode(), "Unexpected exit code")
+			require.Equal(t, tc.command, err.Command(), "Unexpected command")
+			require.Equal(t, tc.wantWindowsSide, err.IsWindowsSide(), "Unexpected side of the failure")
+			require.Equal(t, tc.wantMessage, err.Error(), "Unexpected error message")
+			require.NoError(t, err.Unwrap(), "Unexpected wrapped error for an ExitError without a Windows process")
+
+			sig, ok := err.Signal()
+			require.Equal(t, tc.wantSignal != 0, ok, "Unexpected detection of a signal")
+			require.Equal(t, tc.wantSignal, sig, "Unexpected signal")
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		line   int
+		stderr string
+
+		wantMessage string
+	}{
+		"Output":                 {wantMessage: `could not decode output of command "lsblk -J": mock error`},
+		"Output with stderr":     {stderr: "warning: something\n", wantMessage: `could not decode output of command "lsblk -J": mock error. Stderr: warning: something`},
+		"Output with blank line": {stderr: " \n", wantMessage: `could not decode output of command "lsblk -J": mock error`},
+		"Lines":                  {line: 3, wantMessage: `could not decode output of command "lsblk -J" at line 3: mock error`},
+		"Lines with stderr":      {line: 3, stderr: "oops", wantMessage: `could not decode output of command "lsblk -J" at line 3: mock error. Stderr: oops`},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			wrapped := errors.New("mock error")
+			err := &DecodeError{Stderr: []byte(tc.stderr), Line: tc.line, command: "lsblk -J", err: wrapped}
+
+			require.Equal(t, tc.wantMessage, err.Error(), "Unexpected error message")
+			require.Equal(t, "lsblk -J", err.Command(), "Unexpected command")
+			require.ErrorIs(t, err, wrapped, "DecodeError should wrap the decoding error")
+		})
+	}
+}
+
+func TestDecodeJSONLines(t *testing.T) {
+	t.Parallel()
+
+	longValue := fmt.Sprintf("%q", strings.Repeat("x", 1<<20))
+
+	tests := map[string]struct {
+		input        string
+		oneByteReads bool
+		callbackErr  bool
+
+		want     []string
+		wantLine int
+		wantErr  bool
+	}{
+		"Lines":                   {input: "{\"a\":1}\n[2]\n\"three\"\n", want: []string{`{"a":1}`, `[2]`, `"three"`}},
+		"No trailing line ending": {input: "1\n2", want: []string{"1", "2"}},
+		"Windows line endings":    {input: "1\r\n2\r\n", want: []string{"1", "2"}},
+		"Blank lines are skipped": {input: "\n1\n  \n\t\n2\n\n", want: []string{"1", "2"}},
+		"Surrounding spaces":      {input: "  {\"a\": 1}  \n", want: []string{`{"a": 1}`}},
+		"Very long line":          {input: longValue + "\n1\n", want: []string{longValue, "1"}},
+		"Byte by byte":            {input: "{\"a\":1}\n[2]\n", oneByteReads: true, want: []string{`{"a":1}`, `[2]`}},
+		"Empty input":             {input: ""},
+		"Only blank lines":        {input: "\n\n"},
+
+		"Error on invalid JSON":              {input: "1\n{oops\n3\n", want: []string{"1"}, wantLine: 2, wantErr: true},
+		"Error on two values in a line":      {input: "1 2\n", wantLine: 1, wantErr: true},
+		"Error on a value across lines":      {input: "{\n\"a\":1}\n", wantLine: 1, wantErr: true},
+		"Error on invalid line after blanks": {input: "\n\n}\n", wantLine: 3, wantErr: true},
+		"Error on invalid unterminated line": {input: "1\n{", want: []string{"1"}, wantLine: 2, wantErr: true},
+		"Error returned by the callback":     {input: "1\n2\n3\n", callbackErr: true, want: []string{"1", "2"}, wantLine: 2, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var r io.Reader = strings.NewReader(tc.input)
+			if tc.oneByteReads {
+				r = iotest.OneByteReader(r)
+			}
+
+			var got []string
+			line, err := decodeJSONLines(r, func(msg json.RawMessage) error {
+				got = append(got, string(msg))
+				if tc.callbackErr && len(got) == 2 {
+					return errors.New("mock error")
+				}
+				return nil
+			})
+
+			require.Equal(t, tc.want, got, "Unexpected decoded lines")
+			if tc.wantErr {
+				require.Error(t, err, "decodeJSONLines should have returned an error")
+				require.Equal(t, tc.wantLine, line, "Unexpected line of the error")
+				return
+			}
+			require.NoError(t, err, "decodeJSONLines should not return an error")
+		})
+	}
+}
+
+func TestShellCommandLine(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		distro  string
+		options shellOptions
+
+		want string
+	}{
+		"default shell":              {distro: "Ubuntu", want: `wsl.exe -d Ubuntu --cd ~`},
+		"default shell with CWD":     {distro: "Ubuntu", options: shellOptions{useCWD: true}, want: `wsl.exe -d Ubuntu`},
+		"command":                    {distro: "Ubuntu", options: shellOptions{command: "python3 -i"}, want: `wsl.exe -d Ubuntu --cd ~ -- python3 -i`},
+		"command with CWD":           {distro: "Ubuntu", options: shellOptions{command: "bash", useCWD: true}, want: `wsl.exe -d Ubuntu -- bash`},
+		"distro name needs escaping": {distro: "My Distro", want: `wsl.exe -d "My Distro" --cd ~`},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := shellCommandLine(tc.distro, tc.options)
+			require.Equal(t, tc.want, got, "Unexpected command line")
+		})
+	}
+}
+
+func TestInterceptorChain(t *testing.T) {
+	// Not parallel: global interceptors apply to every command.
+	distro := NewDistro("distro-with-interceptors")
+	otherDistro := NewDistro("distro-without-interceptors")
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, phase CmdPhase, cmd *Cmd, next func() error) error {
+			calls = append(calls, name+":before")
+			err := next()
+			calls = append(calls, name+":after")
+			return err
+		}
+	}
+
+	removeGlobal := AddInterceptor(record("global"))
+	defer removeGlobal()
+
+	removeLocal := distro.AddInterceptor(record("local-1"))
+	defer removeLocal()
+	removeLocal2 := distro.AddInterceptor(record("local-2"))
+	defer removeLocal2()
+
+	call := func(cmd *Cmd) error {
+		calls = append(calls, "call:"+cmd.Command())
+		return nil
+	}
+
+	cmd := &Cmd{distro: &distro, command: "true"}
+	require.NoError(t, cmd.intercept(PhaseStart, func() error { return call(cmd) }), "intercept should not fail")
+	require.Equal(t, []string{
+		"global:before", "local-1:before", "local-2:before",
+		"call:true",
+		"local-2:after", "local-1:after", "global:after",
+	}, calls, "Interceptors should be called in order")
+
+	calls = nil
+	other := &Cmd{distro: &otherDistro, command: "true"}
+	require.NoError(t, other.intercept(PhaseStart, func() error { return call(other) }), "intercept should not fail")
+	require.Equal(t, []string{"global:before", "call:true", "global:after"}, calls, "Only global interceptors should apply to other distros")
+
+	// Removing twice must be harmless
+	removeLocal()
+	removeLocal()
+
+	// Denying and rewriting commands
+	deny := distro.AddInterceptor(func(ctx context.Context, phase CmdPhase, cmd *Cmd, next func() error) error {
+		if cmd.Command() == "forbidden" {
+			return errors.New("denied")
+		}
+		if err := cmd.SetCommand("rewritten " + cmd.Command()); err != nil {
+			return err
+		}
+		return next()
+	})
+	defer deny()
+
+	calls = nil
+	cmd = &Cmd{distro: &distro, command: "allowed"}
+	require.NoError(t, cmd.intercept(PhaseStart, func() error { return call(cmd) }), "intercept should not fail")
+	require.Equal(t, []string{
+		"global:before", "local-2:before",
+		"call:rewritten allowed",
+		"local-2:after", "global:after",
+	}, calls, "The command should have been rewritten, and the removed interceptor should not be called")
+
+	calls = nil
+	cmd = &Cmd{distro: &distro, command: "forbidden"}
+	require.EqualError(t, cmd.intercept(PhaseStart, func() error { return call(cmd) }), "denied", "intercept should return the error of the interceptor")
+	require.Equal(t, []string{"global:before", "local-2:before", "local-2:after", "global:after"}, calls, "The call should have been denied")
+
+	// Cleaning up
+	removeGlobal()
+	removeLocal2()
+	deny()
+	require.Empty(t, interceptorChain(distro.Name()), "All interceptors should have been removed")
+	require.Empty(t, interceptors.perDistro, "Distros with no interceptors left should be forgotten")
+}
+
+func TestRunBlocking(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cancelBefore bool
+		cancelDuring bool
+
+		wantResult    int
+		wantErr       error
+		wantAbandoned bool
+	}{
+		"success":                                   {wantResult: 42},
+		"error with a context done beforehand":      {cancelBefore: true, wantErr: context.Canceled, wantAbandoned: true},
+		"error with a context done during the call": {cancelDuring: true, wantErr: context.Canceled, wantAbandoned: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelBefore {
+				cancel()
+			}
+
+			release := make(chan struct{})
+			called := make(chan struct{})
+			f := func() int {
+				close(called)
+				if tc.cancelDuring {
+					cancel()
+				}
+				if tc.cancelBefore || tc.cancelDuring {
+					<-release
+				}
+				return 42
+			}
+
+			abandoned := make(chan int, 1)
+			got, err := runBlocking(ctx, f, func(res int) { abandoned <- res })
+			close(release)
+
+			require.ErrorIs(t, err, tc.wantErr, "Unexpected error")
+			require.Equal(t, tc.wantResult, got, "Unexpected result")
+
+			// The function is always called, even when the context is done already.
+			select {
+			case <-called:
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "The function should have been called")
+			}
+
+			if !tc.wantAbandoned {
+				require.Empty(t, abandoned, "The result should not have been abandoned")
+				return
+			}
+			select {
+			case res := <-abandoned:
+				require.Equal(t, 42, res, "The abandoned result should be handed over")
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "The abandoned result was not handed over")
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package gowsl
+
+// This file contains utilities to decode the JSON output of commands.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeError is returned when the output of a command that exited successfully
+// could not be decoded. If the command failed, an *ExitError is returned instead.
+type DecodeError struct {
+	// Stderr holds a subset of the standard error output of the command,
+	// if it was collected by (*Cmd).OutputJSON or (*Cmd).DecodeJSONLines.
+	Stderr []byte
+
+	// Line is the line of output that could not be decoded by (*Cmd).DecodeJSONLines,
+	// counting from 1. It is 0 for (*Cmd).OutputJSON.
+	Line int
+
+	command string
+	err     error // The decoding error, or the error returned by the callback
+}
+
+// Error makes it so DecodeError implements the error interface. It displays the
+// error, followed by the standard error output of the command, if any.
+func (err *DecodeError) Error() string {
+	msg := fmt.Sprintf("could not decode output of command %q", err.command)
+	if err.Line > 0 {
+		msg = fmt.Sprintf("%s at line %d", msg, err.Line)
+	}
+	msg = fmt.Sprintf("%s: %v", msg, err.err)
+
+	if stderr := bytes.TrimSpace(err.Stderr); len(stderr) > 0 {
+		msg = fmt.Sprintf("%s. Stderr: %s", msg, stderr)
+	}
+	return msg
+}
+
+// Command returns the command whose output could not be decoded.
+func (err *DecodeError) Command() string {
+	return err.command
+}
+
+// Unwrap returns the decoding error, such as a *json.SyntaxError, or the error
+// returned by the callback of (*Cmd).DecodeJSONLines.
+func (err *DecodeError) Unwrap() error {
+	return err.err
+}
+
+// OutputJSON runs the command and decodes its standard output, a single JSON value,
+// into v (see json.Unmarshal).
+//
+// If the command fails, the error is of type *ExitError. If the output cannot be
+// decoded, it is of type *DecodeError. If c.Stderr was nil, both errors are
+// populated with a subset of the standard error output.
+func (c *Cmd) OutputJSON(v any) error {
+	if c.Stdout != nil {
+		return errors.New("wsl: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+
+	stderr := c.captureStderr()
+
+	if err := c.Run(); err != nil {
+		return withStderr(err, stderr())
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), v); err != nil {
+		return &DecodeError{Stderr: stderr(), command: c.command, err: err}
+	}
+	return nil
+}
+
+// DecodeJSONLines runs the command and calls f for every line of its standard
+// output as it is produced, such as the output of `journalctl -o json`. Each line
+// must hold a single JSON value. Blank lines are skipped.
+//
+// If the output cannot be decoded or f returns an error, the command is killed and
+// the error is of type *DecodeError, wrapping the error of f if there was one. If
+// the command fails on its own, the error is of type *ExitError. If c.Stderr was nil,
+// both errors are populated with a subset of the standard error output.
+func (c *Cmd) DecodeJSONLines(f func(json.RawMessage) error) error {
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr := c.captureStderr()
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	line, decodeErr := decodeJSONLines(stdout, f)
+	if decodeErr != nil {
+		//nolint: errcheck // The command is being stopped, so the only relevant error is the decoding one
+		c.Process.Kill()
+		//nolint: errcheck // Same as above
+		c.Wait()
+		return &DecodeError{Stderr: stderr(), Line: line, command: c.command, err: decodeErr}
+	}
+
+	if err := c.Wait(); err != nil {
+		return withStderr(err, stderr())
+	}
+	return nil
+}
+
+// decodeJSONLines calls f for every non-blank line of r, which must hold a JSON
+// value. In case of error, it returns the line number where it occurred.
+func decodeJSONLines(r io.Reader, f func(json.RawMessage) error) (line int, err error) {
+	br := bufio.NewReader(r)
+	for {
+		data, readErr := br.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return line + 1, readErr
+		}
+
+		if len(data) > 0 {
+			line++
+		}
+
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			// Unmarshalling into a RawMessage validates it, and copies it so that
+			// f can retain it.
+			var msg json.RawMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return line, err
+			}
+			if err := f(msg); err != nil {
+				return line, err
+			}
+		}
+
+		if readErr != nil {
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandOutputJSON(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	type value struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	testCases := map[string]struct {
+		cmd       string
+		setStdout bool
+		setStderr bool
+
+		want          value
+		wantErr       bool
+		wantExitError bool
+		wantDecodeErr bool
+		wantErrStderr string
+	}{
+		"success":                 {cmd: `echo '{"name":"hello","count":3}'`, want: value{Name: "hello", Count: 3}},
+		"success with stderr":     {cmd: `echo 'warning' >&2 && echo '{"name":"hello","count":3}'`, want: value{Name: "hello", Count: 3}},
+		"success with stderr set": {cmd: `echo '{"name":"hello","count":3}'`, setStderr: true, want: value{Name: "hello", Count: 3}},
+
+		"error when Stdout is set":              {cmd: `echo '{}'`, setStdout: true, wantErr: true},
+		"error when the command fails":          {cmd: `echo 'Oh no!' >&2 && exit 42`, wantErr: true, wantExitError: true, wantErrStderr: "Oh no!\n"},
+		"error when the output is not JSON":     {cmd: `echo 'broken output' >&2 && echo '{oops'`, wantErr: true, wantDecodeErr: true, wantErrStderr: "broken output\n"},
+		"error when the output has wrong types": {cmd: `echo '{"count":"three"}'`, wantErr: true, wantDecodeErr: true},
+		"error when the output is empty":        {cmd: `true`, wantErr: true, wantDecodeErr: true},
+		"error without stderr when it is set":   {cmd: `echo 'broken output' >&2 && echo '{oops'`, setStderr: true, wantErr: true, wantDecodeErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			cmd := d.Command(ctx, tc.cmd)
+			if tc.setStdout {
+				cmd.Stdout = &bytes.Buffer{}
+			}
+			if tc.setStderr {
+				cmd.Stderr = &bytes.Buffer{}
+			}
+
+			var got value
+			err := cmd.OutputJSON(&got)
+			if !tc.wantErr {
+				require.NoError(t, err, "Unexpected error calling (*Cmd).OutputJSON")
+				require.Equal(t, tc.want, got, "Unexpected decoded value")
+				return
+			}
+			require.Error(t, err, "Unexpected success calling (*Cmd).OutputJSON")
+
+			var exitErr *wsl.ExitError
+			if tc.wantExitError {
+				require.ErrorAs(t, err, &exitErr, "Unexpected error type. Expected an ExitError.")
+				require.Equal(t, tc.wantErrStderr, string(exitErr.Stderr), "Unexpected stderr in the ExitError")
+				return
+			}
+			notErrorAsf(t, err, &exitErr, "Unexpected error type. Expected anything but an ExitError.")
+
+			var decodeErr *wsl.DecodeError
+			if tc.wantDecodeErr {
+				require.ErrorAs(t, err, &decodeErr, "Unexpected error type. Expected a DecodeError.")
+				require.Equal(t, tc.wantErrStderr, string(decodeErr.Stderr), "Unexpected stderr in the DecodeError")
+				require.Zero(t, decodeErr.Line, "OutputJSON should not report a line")
+				require.Equal(t, tc.cmd, decodeErr.Command(), "Unexpected command in the DecodeError")
+			}
+		})
+	}
+}
+
+func TestCommandDecodeJSONLines(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	testCases := map[string]struct {
+		cmd         string
+		setStdout   bool
+		callbackErr error
+
+		want          []string
+		wantErr       bool
+		wantExitError bool
+		wantLine      int
+		wantErrStderr string
+	}{
+		"success":                       {cmd: `printf '{"a":1}\n\n[2]\n"three"'`, want: []string{`{"a":1}`, `[2]`, `"three"`}},
+		"success with no output":        {cmd: `true`},
+		"success with output over time": {cmd: `echo 1 && sleep 1 && echo 2`, want: []string{"1", "2"}},
+
+		"error when Stdout is set":                     {cmd: `echo 1`, setStdout: true, wantErr: true},
+		"error when the command fails":                 {cmd: `echo 1 && echo 'Oh no!' >&2 && exit 42`, want: []string{"1"}, wantErr: true, wantExitError: true, wantErrStderr: "Oh no!\n"},
+		"error when a line is not JSON":                {cmd: `echo 'broken output' >&2 && printf '1\n{oops\n3\n'`, want: []string{"1"}, wantErr: true, wantLine: 2, wantErrStderr: "broken output\n"},
+		"error when the callback fails":                {cmd: `printf '1\n2\n3\n'`, callbackErr: errors.New("mock error"), want: []string{"1"}, wantErr: true, wantLine: 1},
+		"error when the callback stops a long command": {cmd: `echo 1 && sleep 60`, callbackErr: errors.New("mock error"), want: []string{"1"}, wantErr: true, wantLine: 1},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			cmd := d.Command(ctx, tc.cmd)
+			if tc.setStdout {
+				cmd.Stdout = &bytes.Buffer{}
+			}
+
+			var got []string
+			err := cmd.DecodeJSONLines(func(msg json.RawMessage) error {
+				got = append(got, string(msg))
+				return tc.callbackErr
+			})
+			require.Equal(t, tc.want, got, "Unexpected decoded lines")
+
+			if !tc.wantErr {
+				require.NoError(t, err, "Unexpected error calling (*Cmd).DecodeJSONLines")
+				return
+			}
+			require.Error(t, err, "Unexpected success calling (*Cmd).DecodeJSONLines")
+			require.NoError(t, ctx.Err(), "(*Cmd).DecodeJSONLines should return as soon as decoding fails")
+
+			var exitErr *wsl.ExitError
+			if tc.wantExitError {
+				require.ErrorAs(t, err, &exitErr, "Unexpected error type. Expected an ExitError.")
+				require.Equal(t, tc.wantErrStderr, string(exitErr.Stderr), "Unexpected stderr in the ExitError")
+				return
+			}
+			if tc.setStdout {
+				return
+			}
+
+			var decodeErr *wsl.DecodeError
+			require.ErrorAs(t, err, &decodeErr, "Unexpected error type. Expected a DecodeError.")
+			require.Equal(t, tc.wantLine, decodeErr.Line, "Unexpected line in the DecodeError")
+			require.Equal(t, tc.wantErrStderr, string(decodeErr.Stderr), "Unexpected stderr in the DecodeError")
+			if tc.callbackErr != nil {
+				require.ErrorIs(t, err, tc.callbackErr, "The DecodeError should wrap the error of the callback")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package gowsl
+
+// This file contains utilities to follow the output of commands line by line.
+
+import (
+	"io"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/lines"
+)
+
+// OnStdoutLine makes the command call f for every line it writes to stdout, as
+// soon as the line is complete. It must be called before Start. Stdout still
+// receives the output, if it was set.
+//
+// Lines end with "\n", "\r\n" or a lone "\r", so that each redraw of a progress
+// bar is reported as it happens. Line endings are not passed to f. Lines longer
+// than 64 KiB are handed over in pieces, and a last line without a line ending
+// is handed over once the command exits.
+//
+// f is called from the goroutine that copies stdout, so it may run concurrently
+// with the function passed to OnStderrLine.
+func (c *Cmd) OnStdoutLine(f func(line string)) {
+	c.onStdoutLine = f
+}
+
+// OnStderrLine is the same as OnStdoutLine, but for stderr.
+func (c *Cmd) OnStderrLine(f func(line string)) {
+	c.onStderrLine = f
+}
+
+// lineSplitter lets the copy goroutines flush the last line once the stream is over.
+type lineSplitter struct {
+	*lines.Splitter
+}
+
+func newLineSplitter(w io.Writer, f func(line string)) lineSplitter {
+	return lineSplitter{lines.NewSplitter(w, f)}
+}
+
+func (s lineSplitter) flush() error {
+	return s.Flush()
+}
+
+type prefixOptions struct {
+	timeLayout string
+}
+
+// WithTimestamp is an optional parameter for NewPrefixWriter that adds the time at
+// which each line started after the prefix, formatted with layout (see time.Layout).
+func WithTimestamp(layout string) func(*prefixOptions) {
+	return func(o *prefixOptions) {
+		o.timeLayout = layout
+	}
+}
+
+// NewPrefixWriter returns a writer that writes into w, with prefix at the start of
+// every line. It is meant to be used as the Stdout or Stderr of a Cmd, for instance
+// to tell apart the output of commands running in several distros.
+//
+// Output is not buffered: partial lines are written out as they come. A lone "\r"
+// starts a new line, so that progress bars keep their prefix as they redraw.
+func NewPrefixWriter(w io.Writer, prefix string, opts ...func(*prefixOptions)) io.Writer {
+	options := prefixOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return lines.NewPrefixer(w, prefix, options.timeLayout, time.Now)
+}
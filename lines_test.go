@@ -0,0 +1,145 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandLines(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	const command = `printf 'a\nb\r\n10%%\r100%%\npartial' && printf 'error 1\nerror 2' >&2`
+	wantStdout := []string{"a", "b", "10%", "100%", "partial"}
+	wantStderr := []string{"error 1", "error 2"}
+
+	testCases := map[string]struct {
+		stdoutCallback bool
+		stderrCallback bool
+		sharedWriter   bool
+		reportPID      bool
+		useOutput      bool
+	}{
+		"success with stdout callback":              {stdoutCallback: true},
+		"success with stderr callback":              {stderrCallback: true},
+		"success with both callbacks":               {stdoutCallback: true, stderrCallback: true},
+		"success with a shared writer":              {stdoutCallback: true, stderrCallback: true, sharedWriter: true},
+		"success with a shared writer and one line": {stdoutCallback: true, sharedWriter: true},
+		"success reporting the Linux PID":           {stdoutCallback: true, stderrCallback: true, reportPID: true},
+		"success with Output":                       {stdoutCallback: true, stderrCallback: true, useOutput: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			cmd := d.Command(ctx, command)
+			cmd.ReportLinuxPID = tc.reportPID
+
+			// Callbacks for stdout and stderr may run concurrently
+			var mu sync.Mutex
+			var stdoutLines, stderrLines []string
+			if tc.stdoutCallback {
+				cmd.OnStdoutLine(func(line string) {
+					mu.Lock()
+					defer mu.Unlock()
+					stdoutLines = append(stdoutLines, line)
+				})
+			}
+			if tc.stderrCallback {
+				cmd.OnStderrLine(func(line string) {
+					mu.Lock()
+					defer mu.Unlock()
+					stderrLines = append(stderrLines, line)
+				})
+			}
+
+			shared := &bytes.Buffer{}
+			if tc.sharedWriter {
+				cmd.Stdout = shared
+				cmd.Stderr = shared
+			}
+
+			var err error
+			var out []byte
+			if tc.useOutput {
+				out, err = cmd.Output()
+			} else {
+				err = cmd.Run()
+			}
+			require.NoError(t, err, "Unexpected error running the command")
+
+			if tc.stdoutCallback {
+				require.Equal(t, wantStdout, stdoutLines, "Unexpected lines of stdout")
+			}
+			if tc.stderrCallback {
+				require.Equal(t, wantStderr, stderrLines, "Unexpected lines of stderr")
+			}
+
+			if tc.useOutput {
+				require.Equal(t, "a\nb\r\n10%\r100%\npartial", string(out), "Callbacks should not alter the output")
+			}
+			if tc.sharedWriter {
+				require.Contains(t, shared.String(), "a\nb\r\n10%\r100%\npartial", "Callbacks should not alter stdout")
+				require.Contains(t, shared.String(), "error 1\nerror 2", "Callbacks should not alter stderr")
+			}
+		})
+	}
+}
+
+func TestCommandPrefixWriter(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	testCases := map[string]struct {
+		timestamp bool
+
+		want string
+	}{
+		"success":                {want: "[test] a\n[test] b\n[test] partial"},
+		"success with timestamp": {timestamp: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			out := &bytes.Buffer{}
+			cmd := d.Command(ctx, `printf 'a\nb\npartial'`)
+			if tc.timestamp {
+				cmd.Stdout = wsl.NewPrefixWriter(out, "[test] ", wsl.WithTimestamp("2006"))
+			} else {
+				cmd.Stdout = wsl.NewPrefixWriter(out, "[test] ")
+			}
+
+			err := cmd.Run()
+			require.NoError(t, err, "Unexpected error running the command")
+
+			if !tc.timestamp {
+				require.Equal(t, tc.want, out.String(), "Unexpected prefixed output")
+				return
+			}
+
+			year := time.Now().Format("2006")
+			for _, line := range strings.Split(out.String(), "\n") {
+				require.True(t, strings.HasPrefix(line, "[test] "+year+" "), "Line %q should start with the prefix and timestamp", line)
+			}
+		})
+	}
+}
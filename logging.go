@@ -0,0 +1,96 @@
+package gowsl
+
+// This file contains utilities to log what gowsl does under the hood.
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger that receives structured records of everything gowsl
+// does under the hood: registry access, calls to wslapi.dll with their HRESULT,
+// invocations of wsl.exe with their output, and the start and exit of commands.
+//
+// Records are emitted at the Debug level, or at the Warn level when an operation
+// fails. Logging is disabled by default, or when the logger is nil.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// logAttrs emits a record if a logger was set.
+func logAttrs(ctx context.Context, err error, msg string, attrs ...slog.Attr) {
+	l := logger.Load()
+	if l == nil {
+		return
+	}
+
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	l.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logRegistry logs an access to the registry. The value is empty when accessing
+// the key itself.
+func logRegistry(op, key, value string, err error) {
+	attrs := []slog.Attr{slog.String("op", op), slog.String("key", key)}
+	if value != "" {
+		attrs = append(attrs, slog.String("value", value))
+	}
+	logAttrs(context.Background(), err, "registry access", attrs...)
+}
+
+// logWslAPI logs a call to a function of wslapi.dll.
+func logWslAPI(function, distroName string, hresult uintptr, duration time.Duration) {
+	var err error
+	if hresult != 0 {
+		err = fmt.Errorf("%s failed", function)
+	}
+
+	logAttrs(context.Background(), err, "wslapi call",
+		slog.String("function", function),
+		slog.String("distro", distroName),
+		slog.String("hresult", fmt.Sprintf("0x%08x", uint32(hresult))),
+		slog.Duration("duration", duration))
+}
+
+// logWslExe logs an invocation of wsl.exe, along with its decoded output.
+func logWslExe(args []string, output string, exitCode int, duration time.Duration, err error) {
+	logAttrs(context.Background(), err, "wsl.exe invocation",
+		slog.Any("args", args),
+		slog.String("output", output),
+		slog.Int("exit_code", exitCode),
+		slog.Duration("duration", duration))
+}
+
+// logCommandStart logs the start of a command in a distro, or its failure to start.
+func logCommandStart(ctx context.Context, distroName, command string, pid int, err error) {
+	msg := "command started"
+	if err != nil {
+		msg = "command failed to start"
+	}
+
+	logAttrs(ctx, err, msg,
+		slog.String("distro", distroName),
+		slog.String("command", command),
+		slog.Int("pid", pid))
+}
+
+// logCommandExit logs the exit of a command in a distro. The exit code is -1 if
+// it is not known.
+func logCommandExit(ctx context.Context, distroName, command string, pid, exitCode int, duration time.Duration, err error) {
+	logAttrs(ctx, err, "command exited",
+		slog.String("distro", distroName),
+		slog.String("command", command),
+		slog.Int("pid", pid),
+		slog.Int("exit_code", exitCode),
+		slog.Duration("duration", duration))
+}
@@ -0,0 +1,124 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLogger(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+	fakeDistro := wsl.NewDistro(uniqueDistroName(t))
+
+	testCases := map[string]struct {
+		operation func() error
+
+		wantMsg   string
+		wantAttrs map[string]any
+		wantWarn  bool
+	}{
+		"registry access": {
+			operation: func() error { _, err := d.IsRegistered(); return err },
+			wantMsg:   "registry access", wantAttrs: map[string]any{"op": "open"},
+		},
+		"wslapi call": {
+			operation: func() error { _, err := d.GetConfiguration(); return err },
+			wantMsg:   "wslapi call", wantAttrs: map[string]any{"function": "WslGetDistributionConfiguration", "distro": d.Name(), "hresult": "0x00000000"},
+		},
+		"failed wslapi call": {
+			operation: func() error { _, _ = fakeDistro.GetConfiguration(); return nil },
+			wantMsg:   "wslapi call", wantAttrs: map[string]any{"function": "WslGetDistributionConfiguration", "distro": fakeDistro.Name()}, wantWarn: true,
+		},
+		"wsl.exe invocation": {
+			operation: d.Terminate,
+			wantMsg:   "wsl.exe invocation", wantAttrs: map[string]any{"exit_code": float64(0)},
+		},
+		"failed wsl.exe invocation": {
+			operation: func() error { _ = fakeDistro.Terminate(); return nil },
+			wantMsg:   "wsl.exe invocation", wantWarn: true,
+		},
+		"command start": {
+			operation: func() error { return d.Command(context.Background(), "exit 0").Run() },
+			wantMsg:   "command started", wantAttrs: map[string]any{"distro": d.Name(), "command": "exit 0"},
+		},
+		"command exit": {
+			operation: func() error { return d.Command(context.Background(), "exit 0").Run() },
+			wantMsg:   "command exited", wantAttrs: map[string]any{"distro": d.Name(), "command": "exit 0", "exit_code": float64(0)},
+		},
+		"failed command exit": {
+			operation: func() error { _ = d.Command(context.Background(), "exit 3").Run(); return nil },
+			wantMsg:   "command exited", wantAttrs: map[string]any{"command": "exit 3", "exit_code": float64(3)}, wantWarn: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			out := &syncBuffer{}
+			wsl.SetLogger(slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+			defer wsl.SetLogger(nil)
+
+			require.NoError(t, tc.operation(), "Setup: operation should not fail")
+
+			records := findRecords(t, out.String(), tc.wantMsg)
+			require.NotEmpty(t, records, "There should be a record with message %q. Got:\n%s", tc.wantMsg, out.String())
+
+			for _, r := range records {
+				if !hasAttrs(r, tc.wantAttrs) {
+					continue
+				}
+
+				wantLevel := "DEBUG"
+				if tc.wantWarn {
+					wantLevel = "WARN"
+				}
+				require.Equal(t, wantLevel, r["level"], "Unexpected level for the record")
+				if tc.wantWarn {
+					require.Contains(t, r, "error", "Records of failures should have an error")
+				}
+				return
+			}
+			require.Failf(t, "No record with the expected attributes", "Wanted %v in a record with message %q. Got:\n%s", tc.wantAttrs, tc.wantMsg, out.String())
+		})
+	}
+}
+
+func TestSetLoggerNil(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	wsl.SetLogger(nil)
+	require.NoError(t, d.Command(context.Background(), "exit 0").Run(), "Commands should run without a logger")
+}
+
+// findRecords returns the JSON records in the output with the given message.
+func findRecords(t *testing.T, out, msg string) (records []map[string]any) {
+	t.Helper()
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &r), "Records should be valid JSON: %s", line)
+		if r["msg"] == msg {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// hasAttrs returns true if the record has all the attributes with the same values.
+func hasAttrs(record map[string]any, attrs map[string]any) bool {
+	for k, v := range attrs {
+		if record[k] != v {
+			return false
+		}
+	}
+	return true
+}
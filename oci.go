@@ -0,0 +1,69 @@
+package gowsl
+
+// This file contains utilities to make distros out of container images.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ubuntu/gowsl/internal/oci"
+)
+
+// FlattenOCI writes the root filesystem of the container image at src into dst, as
+// a tarball compressed with gzip that can be registered. src is either a directory
+// with an OCI image layout, or a tar archive of one or made by docker save, possibly
+// compressed.
+//
+// The layers of the image are applied in order, along with their whiteouts, and
+// their digests are verified when they are known. Multi-platform images must have
+// exactly one image for Linux on the architecture of the machine. dst is removed if
+// the conversion fails.
+func FlattenOCI(ctx context.Context, src, dst string) (err error) {
+	defer func() {
+		// Errors from the context are returned as is, like with Cmd.
+		if err != nil && !errors.Is(err, ctx.Err()) {
+			err = fmt.Errorf("could not flatten image %q: %v", src, err)
+		}
+	}()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = oci.Flatten(ctx, out, src, oci.Options{Architecture: nativeArch()})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// RegisterFromOCI is like RegisterContext, but it registers the root filesystem of
+// the container image at imagePath, as flattened by FlattenOCI. The rootfs is
+// written into a temporary file, which is removed once the registration is over.
+func (d *Distro) RegisterFromOCI(ctx context.Context, imagePath string, opts ...func(*registerOptions)) error {
+	f, err := os.CreateTemp("", "gowsl-rootfs-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not create temporary file: %v", d.Name(), err)
+	}
+	f.Close()
+	release := func() { os.Remove(f.Name()) }
+
+	if err := FlattenOCI(ctx, imagePath, f.Name()); err != nil {
+		release()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error registering %q: %v", d.Name(), err)
+	}
+
+	return d.register(ctx, f.Name(), release, opts)
+}
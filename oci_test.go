@@ -0,0 +1,127 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenOCI(t *testing.T) {
+	base := testTarball(t, map[string]string{"etc/motd": "Welcome", "etc/hostname": "base\n"})
+	top := testTarball(t, map[string]string{"etc/.wh.motd": "", "etc/hostname": "top\n"})
+
+	testCases := map[string]struct {
+		layers    [][]byte
+		cancelled bool
+
+		want    map[string]string
+		wantErr bool
+	}{
+		"layers are applied in order": {layers: [][]byte{base, top}, want: map[string]string{"etc/hostname": "top\n"}},
+
+		"error with a broken layer":      {layers: [][]byte{base, []byte("not a layer")}, wantErr: true},
+		"error with a cancelled context": {layers: [][]byte{base, top}, cancelled: true, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			src := writeDockerArchive(t, tc.layers...)
+			dst := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			err := wsl.FlattenOCI(ctx, src, dst)
+			if tc.cancelled {
+				require.ErrorIs(t, err, context.Canceled, "FlattenOCI should have returned the error of the context")
+			}
+			if tc.wantErr {
+				require.Error(t, err, "FlattenOCI should have failed")
+				require.NoFileExists(t, dst, "FlattenOCI should not leave a partial tarball behind")
+				return
+			}
+			require.NoError(t, err, "FlattenOCI should not have failed")
+
+			got := readTestTarball(t, dst)
+			require.Equal(t, tc.want, got, "Unexpected files in the flattened image")
+		})
+	}
+}
+
+func TestRegisterFromOCI(t *testing.T) {
+	base, err := os.ReadFile(rootFs)
+	require.NoError(t, err, "Setup: could not read rootfs")
+	top := testTarball(t, map[string]string{"etc/gowsl-test": "from an image\n"})
+
+	d := wsl.NewDistro(uniqueDistroName(t))
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err = d.RegisterFromOCI(ctx, writeDockerArchive(t, base, top))
+	require.NoError(t, err, "RegisterFromOCI should not have failed")
+
+	out, err := d.Command(ctx, "cat /etc/gowsl-test").Output()
+	require.NoError(t, err, "The file of the top layer should be readable")
+	require.Equal(t, "from an image\n", string(out), "The top layer should have been applied")
+
+	other := wsl.NewDistro(uniqueDistroName(t))
+	err = other.RegisterFromOCI(ctx, "I am not a real image.tar")
+	require.Error(t, err, "RegisterFromOCI should have failed with an inexistent image")
+}
+
+// testTarball returns a plain tarball with the given files.
+func testTarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), "layer.tar")
+	writeTestTarball(t, p, files)
+	data, err := os.ReadFile(p)
+	require.NoError(t, err, "Setup: could not read tarball")
+	return data
+}
+
+// writeDockerArchive writes an archive like the ones of docker save, with the given
+// layers, and returns its path.
+func writeDockerArchive(t *testing.T, layers ...[]byte) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(name string, data []byte) {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data))})
+		require.NoError(t, err, "Setup: could not write image")
+		_, err = tw.Write(data)
+		require.NoError(t, err, "Setup: could not write image")
+	}
+
+	var paths []string
+	for i, l := range layers {
+		p := strings.Repeat("a", i+1) + "/layer.tar"
+		write(p, l)
+		paths = append(paths, p)
+	}
+	manifest, err := json.Marshal([]map[string]any{{"RepoTags": []string{"gowsl:test"}, "Layers": paths}})
+	require.NoError(t, err, "Setup: could not write image")
+	write("manifest.json", manifest)
+	require.NoError(t, tw.Close(), "Setup: could not write image")
+
+	p := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, os.WriteFile(p, buf.Bytes(), 0600), "Setup: could not write image")
+	return p
+}
@@ -0,0 +1,164 @@
+package gowsl
+
+// This file contains utilities to change the files of a rootfs before registering it.
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+// RootfsPatch is a change to the files of a rootfs tarball, such as first-boot
+// configuration. See PatchRootfs and WithPatches.
+//
+// Patches are applied in the order they are given, so that later patches to a
+// file see the changes of the earlier ones.
+type RootfsPatch struct {
+	patches []rootfs.Patch
+	err     error // Error in the arguments of the patch, reported when it is applied
+}
+
+// PatchRootfs writes the tarball at src into dst, compressed with gzip, with the
+// patches applied. The tarball at src can be a plain tar archive, or one compressed
+// with gzip, xz, zstd or bzip2. It is streamed, so that it is never held in memory.
+//
+// Entries that are not patched are copied along with all of their metadata, and
+// the files that are replaced keep their owner, permissions and modification time.
+// Files that are created are owned by root, along with their missing parent
+// directories. dst is removed if the rewrite fails.
+func PatchRootfs(src, dst string, patches ...RootfsPatch) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("could not patch rootfs %q: %v", src, err)
+		}
+	}()
+
+	flat, err := flattenPatches(patches)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = rootfs.Rewrite(out, in, flat)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// WithPatches makes the registration apply the patches to the tarball first, as
+// with PatchRootfs. The patched tarball is written into a temporary file, which
+// is removed once the registration is over.
+func WithPatches(patches ...RootfsPatch) func(*registerOptions) {
+	return func(o *registerOptions) {
+		o.patches = append(o.patches, patches...)
+	}
+}
+
+// flattenPatches returns the changes made by the patches, in order.
+func flattenPatches(patches []RootfsPatch) ([]rootfs.Patch, error) {
+	var out []rootfs.Patch
+	for _, p := range patches {
+		if p.err != nil {
+			return nil, p.err
+		}
+		out = append(out, p.patches...)
+	}
+	return out, nil
+}
+
+// RootfsWriteFile returns a patch that creates the file at path, from the root of
+// the filesystem, with the given contents and permissions, or replaces the
+// contents of the existing one. Links are replaced by regular files.
+func RootfsWriteFile(path string, contents []byte, perm fs.FileMode) RootfsPatch {
+	return RootfsPatch{patches: []rootfs.Patch{rootfs.WriteFile(path, contents, int64(perm.Perm()))}}
+}
+
+// RootfsDeleteFile returns a patch that removes the file at path, from the root
+// of the filesystem, if it exists. Directories are removed along with their contents.
+func RootfsDeleteFile(path string) RootfsPatch {
+	return RootfsPatch{patches: []rootfs.Patch{rootfs.Delete(path)}}
+}
+
+// RootfsEditFile returns a patch that edits the file at path, from the root of
+// the filesystem. The edit function receives the current contents of the file, and
+// whether it exists, and returns its new contents, and whether to keep it. An error
+// aborts the rewrite.
+func RootfsEditFile(path string, edit func(contents []byte, exists bool) (newContents []byte, keep bool, err error)) RootfsPatch {
+	if edit == nil {
+		panic("nil edit function")
+	}
+	return RootfsPatch{patches: []rootfs.Patch{{Path: path, Edit: edit}}}
+}
+
+// wslConfPath is the path of the configuration of WSL in distros.
+const wslConfPath = "/etc/wsl.conf"
+
+// RootfsWSLConf returns a patch that replaces /etc/wsl.conf with conf.
+func RootfsWSLConf(conf []byte) RootfsPatch {
+	return RootfsWriteFile(wslConfPath, conf, 0644)
+}
+
+// RootfsWSLConfSetting returns a patch that sets a key in a section of
+// /etc/wsl.conf, creating the file, the section or the key as needed. The rest
+// of the file is left untouched.
+func RootfsWSLConfSetting(section, key, value string) RootfsPatch {
+	return RootfsPatch{patches: []rootfs.Patch{rootfs.SetINI(wslConfPath, section, key, value)}}
+}
+
+// RootfsDefaultUser returns a patch that makes name the default user of the distro,
+// via /etc/wsl.conf. The user must exist in the rootfs.
+func RootfsDefaultUser(name string) RootfsPatch {
+	return RootfsWSLConfSetting("user", "default", name)
+}
+
+// RootfsHosts returns a patch that adds entries to /etc/hosts, such as
+// "10.0.0.1 db.internal". As WSL would otherwise overwrite it at boot, it also
+// disables the generation of /etc/hosts in /etc/wsl.conf.
+func RootfsHosts(entries ...string) RootfsPatch {
+	return RootfsPatch{patches: []rootfs.Patch{
+		rootfs.AppendLines("/etc/hosts", true, entries...),
+		rootfs.SetINI(wslConfPath, "network", "generateHosts", "false"),
+	}}
+}
+
+// caBundle is the bundle of trusted certificates of Debian and its derivatives,
+// which update-ca-certificates regenerates from the individual certificates.
+const caBundle = "/etc/ssl/certs/ca-certificates.crt"
+
+// RootfsCACertificate returns a patch that makes the distro trust the certificate
+// authority in pem, in the PEM format. It is added as
+// /usr/local/share/ca-certificates/<name>.crt, for update-ca-certificates, and
+// appended to /etc/ssl/certs/ca-certificates.crt if it is a regular file, so that
+// it is trusted from the first boot.
+func RootfsCACertificate(name string, pem []byte) RootfsPatch {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return RootfsPatch{err: fmt.Errorf("invalid certificate name %q", name)}
+	}
+	if !strings.Contains(string(pem), "-----BEGIN CERTIFICATE-----") {
+		return RootfsPatch{err: fmt.Errorf("certificate %q is not in the PEM format", name)}
+	}
+
+	cert := strings.TrimRight(string(pem), "\n")
+	return RootfsPatch{patches: []rootfs.Patch{
+		rootfs.WriteFile("/usr/local/share/ca-certificates/"+name+".crt", []byte(cert+"\n"), 0644),
+		rootfs.AppendLines(caBundle, false, cert),
+	}}
+}
@@ -0,0 +1,175 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testCertificate = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+func TestPatchRootfs(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "rootfs.tar")
+	writeTestTarball(t, src, map[string]string{
+		"etc/hosts":                         "127.0.0.1 localhost\n",
+		"etc/wsl.conf":                      "[boot]\nsystemd = true\n",
+		"etc/ssl/certs/ca-certificates.crt": "",
+		"etc/motd":                          "Welcome",
+	})
+
+	testCases := map[string]struct {
+		patches []wsl.RootfsPatch
+		src     string
+
+		want    map[string]string // Contents of the files that changed, or empty if removed
+		wantErr bool
+	}{
+		"no patches": {},
+		"write, delete and edit files": {
+			patches: []wsl.RootfsPatch{
+				wsl.RootfsWriteFile("/etc/hostname", []byte("ubuntu\n"), 0644),
+				wsl.RootfsDeleteFile("/etc/motd"),
+				wsl.RootfsEditFile("/etc/hosts", func(b []byte, _ bool) ([]byte, bool, error) {
+					return bytes.ToUpper(b), true, nil
+				}),
+			},
+			want: map[string]string{"etc/hostname": "ubuntu\n", "etc/motd": "", "etc/hosts": "127.0.0.1 LOCALHOST\n"},
+		},
+		"first-boot configuration": {
+			patches: []wsl.RootfsPatch{
+				wsl.RootfsDefaultUser("u"),
+				wsl.RootfsHosts("10.0.0.1 db"),
+				wsl.RootfsCACertificate("corp", []byte(testCertificate)),
+			},
+			want: map[string]string{
+				"etc/wsl.conf":                             "[boot]\nsystemd = true\n\n[user]\ndefault = u\n\n[network]\ngenerateHosts = false\n",
+				"etc/hosts":                                "127.0.0.1 localhost\n10.0.0.1 db\n",
+				"etc/ssl/certs/ca-certificates.crt":        testCertificate,
+				"usr/local/share/ca-certificates/corp.crt": testCertificate,
+			},
+		},
+		"replace wsl.conf": {
+			patches: []wsl.RootfsPatch{wsl.RootfsWSLConf([]byte("[automount]\nenabled = false\n"))},
+			want:    map[string]string{"etc/wsl.conf": "[automount]\nenabled = false\n"},
+		},
+
+		"error with an invalid certificate name": {patches: []wsl.RootfsPatch{wsl.RootfsCACertificate("../corp", []byte(testCertificate))}, wantErr: true},
+		"error with an invalid certificate":      {patches: []wsl.RootfsPatch{wsl.RootfsCACertificate("corp", []byte("not PEM"))}, wantErr: true},
+		"error when a patch fails": {patches: []wsl.RootfsPatch{wsl.RootfsEditFile("/etc/hosts", func([]byte, bool) ([]byte, bool, error) {
+			return nil, false, errors.New("failed on purpose")
+		})}, wantErr: true},
+		"error with an inexistent rootfs": {src: "I am not a real file.tar.gz", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.src == "" {
+				tc.src = src
+			}
+			dst := filepath.Join(t.TempDir(), "patched.tar.gz")
+
+			err := wsl.PatchRootfs(tc.src, dst, tc.patches...)
+			if tc.wantErr {
+				require.Error(t, err, "PatchRootfs should have failed")
+				require.NoFileExists(t, dst, "PatchRootfs should not leave a partial tarball behind")
+				return
+			}
+			require.NoError(t, err, "PatchRootfs should not have failed")
+
+			want := readTestTarball(t, src)
+			for name, contents := range tc.want {
+				if contents == "" {
+					delete(want, name)
+					continue
+				}
+				want[name] = contents
+			}
+			got := readTestTarball(t, dst)
+			for name := range got {
+				if strings.HasSuffix(name, "/") {
+					delete(got, name)
+				}
+			}
+			require.Equal(t, want, got, "Unexpected files in the patched tarball")
+		})
+	}
+}
+
+func TestRegisterWithPatches(t *testing.T) {
+	d := wsl.NewDistro(uniqueDistroName(t))
+	defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := d.RegisterContext(ctx, rootFs, wsl.WithPatches(
+		wsl.RootfsHosts("10.0.0.1 gowsl-test-host"),
+		wsl.RootfsWriteFile("/etc/gowsl-test", []byte("patched\n"), 0644),
+	))
+	require.NoError(t, err, "Register should not have failed")
+
+	out, err := d.Command(ctx, "cat /etc/gowsl-test").Output()
+	require.NoError(t, err, "The patched file should be readable")
+	require.Equal(t, "patched\n", string(out), "The patched file should have been written")
+
+	out, err = d.Command(ctx, "getent hosts gowsl-test-host").Output()
+	require.NoError(t, err, "The patched host should be resolvable")
+	require.Contains(t, string(out), "10.0.0.1", "The patched host should be in /etc/hosts")
+}
+
+// writeTestTarball writes a plain tarball with the given files.
+func writeTestTarball(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, contents := range files {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(contents))})
+		require.NoError(t, err, "Setup: could not write tarball")
+		_, err = tw.Write([]byte(contents))
+		require.NoError(t, err, "Setup: could not write tarball")
+	}
+	require.NoError(t, tw.Close(), "Setup: could not write tarball")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600), "Setup: could not write tarball")
+}
+
+// readTestTarball returns the contents of the files in a tarball, possibly
+// compressed with gzip.
+func readTestTarball(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err, "Could not read tarball")
+
+	var r io.Reader = bytes.NewReader(data)
+	if zr, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err, "Could not read tarball")
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err, "Could not read tarball")
+		files[hdr.Name] = string(contents)
+	}
+	return files
+}
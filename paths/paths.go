@@ -0,0 +1,255 @@
+// Package paths translates paths between Windows and WSL distros, like wslpath
+// does, without the need to launch any process.
+//
+// Windows paths may be drive paths (C:\Users), WSL network shares
+// (\\wsl.localhost\Ubuntu\home or \\wsl$\Ubuntu\home), and long paths
+// (\\?\C:\Users or \\?\UNC\wsl.localhost\Ubuntu\home). Both slashes and
+// backslashes are accepted as separators.
+//
+// Windows is case-insensitive, so drive letters, share hosts and distro names
+// are matched regardless of case. Linux is case-sensitive, so only lowercase
+// mount points under the automount root are recognized as drives. Drive letters
+// are uppercase in Windows paths, and lowercase in Linux paths.
+//
+// Characters that are not allowed in Windows file names (\ : * ? " < > |) are
+// mapped to the Unicode private range (U+F000 + character), as WSL does.
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DefaultAutomountRoot is the directory where Windows drives are mounted,
+// unless configured otherwise in /etc/wsl.conf.
+const DefaultAutomountRoot = "/mnt/"
+
+// Translator converts paths between Windows and a distro.
+type Translator struct {
+	// Distro is the name of the distro. It is needed to translate Linux paths
+	// outside of the Windows drives, and to validate paths in WSL shares.
+	Distro string
+
+	// AutomountRoot is the directory where Windows drives are mounted, as in
+	// the [automount] section of /etc/wsl.conf. It defaults to /mnt/.
+	AutomountRoot string
+
+	// LegacyShare makes Windows paths use the \\wsl$ share rather than \\wsl.localhost.
+	LegacyShare bool
+
+	// LongPathPrefix makes Windows paths use the \\?\ prefix, so that they are
+	// not limited to MAX_PATH characters.
+	LongPathPrefix bool
+}
+
+// New creates a Translator for the distro with the default settings.
+func New(distro string) Translator {
+	return Translator{Distro: distro}
+}
+
+// ToLinux converts a Windows path into its Linux equivalent. Relative paths
+// remain relative.
+func (t Translator) ToLinux(winPath string) (string, error) {
+	p, err := t.toLinux(winPath)
+	if err != nil {
+		return "", fmt.Errorf("could not translate %q to a Linux path: %v", winPath, err)
+	}
+	return p, nil
+}
+
+func (t Translator) toLinux(winPath string) (string, error) {
+	if winPath == "" {
+		return "", errors.New("empty path")
+	}
+
+	p := stripLongPathPrefix(strings.ReplaceAll(winPath, "/", `\`))
+
+	// Network share
+	if strings.HasPrefix(p, `\\`) {
+		host, rest, _ := strings.Cut(p[2:], `\`)
+		if !isShareHost(host) {
+			return "", fmt.Errorf("%q is not a WSL share", host)
+		}
+
+		distro, rest, _ := strings.Cut(rest, `\`)
+		if distro == "" {
+			return "", errors.New("missing distro name")
+		}
+		if t.Distro != "" && !strings.EqualFold(distro, t.Distro) {
+			return "", fmt.Errorf("path belongs to distro %q", distro)
+		}
+
+		return path.Clean("/" + linuxComponents(rest)), nil
+	}
+
+	// Drive
+	if len(p) >= 2 && isLetter(p[0]) && p[1] == ':' {
+		rest := p[2:]
+		if rest != "" && rest[0] != '\\' {
+			return "", errors.New("paths relative to the working directory of a drive are not supported")
+		}
+
+		drive := strings.ToLower(p[:1])
+		return path.Join(t.automountRoot(), drive, path.Clean("/"+linuxComponents(rest))), nil
+	}
+
+	if strings.HasPrefix(p, `\`) {
+		return "", errors.New("paths relative to the current drive are not supported")
+	}
+
+	if strings.Contains(p, ":") {
+		return "", errors.New("unexpected colon in path")
+	}
+
+	// Relative path
+	return path.Clean(linuxComponents(p)), nil
+}
+
+// ToWindows converts a Linux path into its Windows equivalent. Paths under the
+// automount root are converted into drive paths, and the rest are converted
+// into WSL share paths. Relative paths remain relative.
+func (t Translator) ToWindows(linuxPath string) (string, error) {
+	p, err := t.toWindows(linuxPath)
+	if err != nil {
+		return "", fmt.Errorf("could not translate %q to a Windows path: %v", linuxPath, err)
+	}
+	return p, nil
+}
+
+func (t Translator) toWindows(linuxPath string) (string, error) {
+	if linuxPath == "" {
+		return "", errors.New("empty path")
+	}
+
+	p := path.Clean(linuxPath)
+
+	// Relative path
+	if !path.IsAbs(p) {
+		return windowsComponents(p), nil
+	}
+
+	// Drive
+	if drive, rest, ok := t.cutDrive(p); ok {
+		winPath := strings.ToUpper(drive) + `:\` + windowsComponents(rest)
+		if t.LongPathPrefix {
+			winPath = `\\?\` + winPath
+		}
+		return winPath, nil
+	}
+
+	// Network share
+	if t.Distro == "" {
+		return "", errors.New("the distro name is needed to translate paths outside of the Windows drives")
+	}
+
+	host := "wsl.localhost"
+	if t.LegacyShare {
+		host = "wsl$"
+	}
+
+	share := host + `\` + t.Distro + `\` + windowsComponents(strings.TrimPrefix(p, "/"))
+	if t.LongPathPrefix {
+		return `\\?\UNC\` + share, nil
+	}
+	return `\\` + share, nil
+}
+
+// cutDrive checks if the cleaned absolute path is under the mount point of a
+// drive. If so, it returns the drive letter and the path relative to the drive.
+func (t Translator) cutDrive(p string) (drive, rest string, ok bool) {
+	root := t.automountRoot()
+
+	rel := strings.TrimPrefix(p, root)
+	if root != "/" {
+		if !strings.HasPrefix(p, root+"/") {
+			return "", "", false
+		}
+		rel = strings.TrimPrefix(p, root+"/")
+	}
+
+	drive, rest, _ = strings.Cut(rel, "/")
+	if len(drive) != 1 || drive[0] < 'a' || drive[0] > 'z' {
+		return "", "", false
+	}
+	return drive, rest, true
+}
+
+// automountRoot returns the cleaned automount root.
+func (t Translator) automountRoot() string {
+	if t.AutomountRoot == "" {
+		return path.Clean(DefaultAutomountRoot)
+	}
+	return path.Clean("/" + t.AutomountRoot)
+}
+
+// stripLongPathPrefix removes the \\?\ and \\.\ prefixes, turning \\?\UNC\
+// into a regular network path.
+func stripLongPathPrefix(p string) string {
+	for _, prefix := range []string{`\\?\`, `\\.\`, `\??\`} {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		p = p[len(prefix):]
+		if len(p) >= 4 && strings.EqualFold(p[:4], `UNC\`) {
+			return `\\` + p[4:]
+		}
+		return p
+	}
+	return p
+}
+
+// isShareHost returns true if the host is one of the WSL network shares.
+func isShareHost(host string) bool {
+	return strings.EqualFold(host, "wsl.localhost") || strings.EqualFold(host, "wsl$")
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// privateRangeOffset is added to characters that are forbidden in Windows file names.
+const privateRangeOffset = 0xf000
+
+// forbiddenChars cannot be part of a Windows file name. Slash is not included,
+// as it cannot be part of Linux file names either.
+const forbiddenChars = `\:*?"<>|`
+
+// windowsComponents converts a relative Linux path into a relative Windows
+// path, escaping the characters that are forbidden on Windows.
+func windowsComponents(p string) string {
+	if p == "." || p == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range p {
+		switch {
+		case r == '/':
+			b.WriteRune('\\')
+		case strings.ContainsRune(forbiddenChars, r):
+			b.WriteRune(privateRangeOffset + r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// linuxComponents converts a relative Windows path into a relative Linux path,
+// unescaping the characters that are forbidden on Windows.
+func linuxComponents(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		switch {
+		case r == '\\':
+			b.WriteRune('/')
+		case r >= privateRangeOffset && strings.ContainsRune(forbiddenChars, r-privateRangeOffset):
+			b.WriteRune(r - privateRangeOffset)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
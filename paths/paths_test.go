@@ -0,0 +1,220 @@
+package paths_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/gowsl/paths"
+)
+
+func TestToLinux(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		path          string
+		distro        string
+		automountRoot string
+
+		want    string
+		wantErr bool
+	}{
+		// Drives
+		"drive path":                         {path: `C:\Users\me`, want: "/mnt/c/Users/me"},
+		"drive root":                         {path: `C:\`, want: "/mnt/c"},
+		"drive without separator":            {path: `C:`, want: "/mnt/c"},
+		"lowercase drive":                    {path: `d:\data`, want: "/mnt/d/data"},
+		"forward slashes":                    {path: `C:/Users/me`, want: "/mnt/c/Users/me"},
+		"mixed separators":                   {path: `C:\Users/me\Documents`, want: "/mnt/c/Users/me/Documents"},
+		"trailing separator":                 {path: `C:\Users\`, want: "/mnt/c/Users"},
+		"repeated separators":                {path: `C:\\Users\\\me`, want: "/mnt/c/Users/me"},
+		"dot components":                     {path: `C:\Users\.\me\..\you`, want: "/mnt/c/Users/you"},
+		"dot-dot cannot escape the drive":    {path: `C:\..\..\Windows`, want: "/mnt/c/Windows"},
+		"spaces":                             {path: `C:\Program Files\App`, want: "/mnt/c/Program Files/App"},
+		"unicode":                            {path: `C:\Users\Jürgen\ドキュメント`, want: "/mnt/c/Users/Jürgen/ドキュメント"},
+		"custom automount root":              {path: `C:\Users`, automountRoot: "/windir/", want: "/windir/c/Users"},
+		"custom automount root without dash": {path: `C:\Users`, automountRoot: "windir", want: "/windir/c/Users"},
+		"automount root is the root":         {path: `C:\Users`, automountRoot: "/", want: "/c/Users"},
+		"escaped forbidden characters":       {path: "C:\\a\uf03ab\uf02a\uf03f\uf022\uf03c\uf03e\uf07c\uf05c", want: `/mnt/c/a:b*?"<>|\`},
+
+		// Long paths
+		"long path":                     {path: `\\?\C:\Users\me`, want: "/mnt/c/Users/me"},
+		"long path with dot prefix":     {path: `\\.\C:\Users\me`, want: "/mnt/c/Users/me"},
+		"long path with NT prefix":      {path: `\??\C:\Users\me`, want: "/mnt/c/Users/me"},
+		"long path to share":            {path: `\\?\UNC\wsl.localhost\Ubuntu\home`, distro: "Ubuntu", want: "/home"},
+		"long path to share lowercase":  {path: `\\?\unc\wsl$\Ubuntu\home`, distro: "Ubuntu", want: "/home"},
+		"long path with forward slahes": {path: `//?/C:/Users`, want: "/mnt/c/Users"},
+
+		// Shares
+		"share":                         {path: `\\wsl.localhost\Ubuntu\home\me`, distro: "Ubuntu", want: "/home/me"},
+		"legacy share":                  {path: `\\wsl$\Ubuntu\home\me`, distro: "Ubuntu", want: "/home/me"},
+		"share root":                    {path: `\\wsl.localhost\Ubuntu`, distro: "Ubuntu", want: "/"},
+		"share root with separator":     {path: `\\wsl.localhost\Ubuntu\`, distro: "Ubuntu", want: "/"},
+		"share with forward slashes":    {path: `//wsl.localhost/Ubuntu/etc`, distro: "Ubuntu", want: "/etc"},
+		"share host is case-insensitve": {path: `\\WSL.LocalHost\Ubuntu\etc`, distro: "Ubuntu", want: "/etc"},
+		"distro is case-insensitive":    {path: `\\wsl$\UBUNTU\etc`, distro: "Ubuntu", want: "/etc"},
+		"share without distro check":    {path: `\\wsl$\Debian\etc`, want: "/etc"},
+		"share with escaped characters": {path: "\\\\wsl$\\Ubuntu\\a\uf03ab", distro: "Ubuntu", want: "/a:b"},
+		"share dot-dot cannot escape":   {path: `\\wsl$\Ubuntu\..\..\etc`, distro: "Ubuntu", want: "/etc"},
+		"share path into mount":         {path: `\\wsl$\Ubuntu\mnt\c\Users`, distro: "Ubuntu", want: "/mnt/c/Users"},
+
+		// Relative paths
+		"relative path":                  {path: `Documents\file.txt`, want: "Documents/file.txt"},
+		"relative path with dot-dot":     {path: `..\file.txt`, want: "../file.txt"},
+		"relative path with slashes":     {path: `a/b/c`, want: "a/b/c"},
+		"current directory":              {path: `.`, want: "."},
+		"relative path is cleaned":       {path: `a\.\b\..\c`, want: "a/c"},
+		"relative path with escaped one": {path: "a\uf03ab", want: "a:b"},
+
+		// Errors
+		"error on empty path":            {path: "", wantErr: true},
+		"error on other distro":          {path: `\\wsl.localhost\Debian\etc`, distro: "Ubuntu", wantErr: true},
+		"error on other share":           {path: `\\server\share\file`, wantErr: true},
+		"error on share without distro":  {path: `\\wsl.localhost\`, wantErr: true},
+		"error on share host only":       {path: `\\wsl$`, wantErr: true},
+		"error on drive-relative path":   {path: `C:Users`, wantErr: true},
+		"error on current drive path":    {path: `\Users\me`, wantErr: true},
+		"error on Linux absolute path":   {path: `/home/me`, wantErr: true},
+		"error on invalid drive":         {path: `1:\Users`, wantErr: true},
+		"error on colon in relative":     {path: `a:b`, wantErr: true},
+		"error on long path to a server": {path: `\\?\UNC\server\share`, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tr := paths.Translator{Distro: tc.distro, AutomountRoot: tc.automountRoot}
+			got, err := tr.ToLinux(tc.path)
+			if tc.wantErr {
+				require.Error(t, err, "ToLinux should have returned an error, got %q", got)
+				return
+			}
+			require.NoError(t, err, "ToLinux should not return an error")
+			require.Equal(t, tc.want, got, "Unexpected Linux path")
+		})
+	}
+}
+
+func TestToWindows(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		path           string
+		distro         string
+		automountRoot  string
+		legacyShare    bool
+		longPathPrefix bool
+
+		want    string
+		wantErr bool
+	}{
+		// Drives
+		"drive path":                    {path: "/mnt/c/Users/me", want: `C:\Users\me`},
+		"drive root":                    {path: "/mnt/c", want: `C:\`},
+		"drive root with separator":     {path: "/mnt/c/", want: `C:\`},
+		"other drive":                   {path: "/mnt/z/data", want: `Z:\data`},
+		"dot components":                {path: "/mnt/c/Users/./me/../you", want: `C:\Users\you`},
+		"repeated separators":           {path: "/mnt//c///Users", want: `C:\Users`},
+		"spaces":                        {path: "/mnt/c/Program Files/App", want: `C:\Program Files\App`},
+		"unicode":                       {path: "/mnt/c/Users/Jürgen/ドキュメント", want: `C:\Users\Jürgen\ドキュメント`},
+		"forbidden characters":          {path: `/mnt/c/a:b*?"<>|\`, want: "C:\\a\uf03ab\uf02a\uf03f\uf022\uf03c\uf03e\uf07c\uf05c"},
+		"custom automount root":         {path: "/windir/c/Users", automountRoot: "/windir/", want: `C:\Users`},
+		"custom automount root no dash": {path: "/windir/c/Users", automountRoot: "windir", want: `C:\Users`},
+		"automount root is the root":    {path: "/c/Users", automountRoot: "/", want: `C:\Users`},
+		"long path prefix":              {path: "/mnt/c/Users", longPathPrefix: true, want: `\\?\C:\Users`},
+
+		// Shares
+		"share":                             {path: "/home/me", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\home\me`},
+		"share root":                        {path: "/", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\`},
+		"legacy share":                      {path: "/home/me", distro: "Ubuntu", legacyShare: true, want: `\\wsl$\Ubuntu\home\me`},
+		"long path to share":                {path: "/home/me", distro: "Ubuntu", longPathPrefix: true, want: `\\?\UNC\wsl.localhost\Ubuntu\home\me`},
+		"long path to legacy share":         {path: "/home/me", distro: "Ubuntu", legacyShare: true, longPathPrefix: true, want: `\\?\UNC\wsl$\Ubuntu\home\me`},
+		"share with forbidden characters":   {path: "/home/a:b", distro: "Ubuntu", want: "\\\\wsl.localhost\\Ubuntu\\home\\a\uf03ab"},
+		"automount root itself":             {path: "/mnt", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\mnt`},
+		"uppercase mount is not a drive":    {path: "/mnt/C/Users", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\mnt\C\Users`},
+		"long mount name is not a drive":    {path: "/mnt/cd/Users", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\mnt\cd\Users`},
+		"digit mount is not a drive":        {path: "/mnt/1/Users", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\mnt\1\Users`},
+		"similar prefix is not a drive":     {path: "/mnt2/c/Users", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\mnt2\c\Users`},
+		"default root with custom root":     {path: "/mnt/c/Users", distro: "Ubuntu", automountRoot: "/windir", want: `\\wsl.localhost\Ubuntu\mnt\c\Users`},
+		"dot-dot out of the drive":          {path: "/mnt/c/../d", distro: "Ubuntu", want: `D:\`},
+		"dot-dot out of the automount root": {path: "/mnt/c/../../etc", distro: "Ubuntu", want: `\\wsl.localhost\Ubuntu\etc`},
+
+		// Relative paths
+		"relative path":              {path: "Documents/file.txt", want: `Documents\file.txt`},
+		"relative path with dot-dot": {path: "../file.txt", want: `..\file.txt`},
+		"current directory":          {path: ".", want: ``},
+		"relative path is cleaned":   {path: "a/./b/../c/", want: `a\c`},
+
+		// Errors
+		"error on empty path":            {path: "", wantErr: true},
+		"error on share without distro":  {path: "/home/me", wantErr: true},
+		"error on root without a distro": {path: "/", wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tr := paths.Translator{
+				Distro:         tc.distro,
+				AutomountRoot:  tc.automountRoot,
+				LegacyShare:    tc.legacyShare,
+				LongPathPrefix: tc.longPathPrefix,
+			}
+
+			got, err := tr.ToWindows(tc.path)
+			if tc.wantErr {
+				require.Error(t, err, "ToWindows should have returned an error, got %q", got)
+				return
+			}
+			require.NoError(t, err, "ToWindows should not return an error")
+			require.Equal(t, tc.want, got, "Unexpected Windows path")
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	linuxPaths := []string{
+		"/",
+		"/home/me/.bashrc",
+		"/mnt/c",
+		"/mnt/c/Users/me/Documents",
+		"/mnt/z/a:b*c",
+		"/etc/with space/ドキュメント",
+		"relative/path",
+		"../up",
+	}
+
+	for _, automountRoot := range []string{"", "/", "/windir/"} {
+		for _, legacy := range []bool{false, true} {
+			for _, long := range []bool{false, true} {
+				tr := paths.Translator{Distro: "Ubuntu", AutomountRoot: automountRoot, LegacyShare: legacy, LongPathPrefix: long}
+
+				for _, p := range linuxPaths {
+					win, err := tr.ToWindows(p)
+					require.NoError(t, err, "ToWindows should not fail for %q with %+v", p, tr)
+
+					got, err := tr.ToLinux(win)
+					require.NoError(t, err, "ToLinux should not fail for %q with %+v", win, tr)
+
+					require.Equal(t, p, got, "Path did not survive the round trip through %q with %+v", win, tr)
+				}
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tr := paths.New("Ubuntu")
+	require.Equal(t, "Ubuntu", tr.Distro, "Unexpected distro")
+
+	got, err := tr.ToLinux(`C:\Users`)
+	require.NoError(t, err, "ToLinux should not return an error")
+	require.Equal(t, paths.DefaultAutomountRoot+"c/Users", got, "New should use the default automount root")
+}
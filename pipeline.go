@@ -0,0 +1,211 @@
+package gowsl
+
+// This file contains utilities to pipe commands into one another.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// PipelineError is returned by a Pipeline when one of its stages fails.
+type PipelineError struct {
+	// Stage is the index of the failed stage, counting from 0. It is the rightmost
+	// one when several fail.
+	Stage int
+
+	err error
+}
+
+// Error makes it so PipelineError implements the error interface.
+func (err *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline stage %d: %v", err.Stage, err.err)
+}
+
+// Unwrap returns the error of the failed stage, usually an *ExitError.
+func (err *PipelineError) Unwrap() error {
+	return err.err
+}
+
+// Pipeline connects the standard output of each of its commands to the standard
+// input of the next one, like a shell pipeline. Commands can run in different
+// distros, and data flows from one to the next without going through Go memory.
+//
+// The Stdin of the first command and the Stdout of the last one can be set as usual.
+// Stderr can be set in any of them.
+//
+// A Pipeline cannot be reused after calling its Run method.
+type Pipeline struct {
+	stages []*Cmd
+
+	started  bool
+	finished bool // Flag to fail nicely when Wait is invoked twice
+
+	// Context management
+	ctx       context.Context // Context to kill all stages
+	ctxErr    error           // Error of the context, if it killed the stages
+	waitDone  chan struct{}   // Closed when all stages finished, to stop watching the context
+	watchDone chan struct{}   // Closed when the context is no longer watched, so that ctxErr can be read
+}
+
+// NewPipeline returns a Pipeline of the commands, in order.
+//
+// The provided context is used to kill all commands if it becomes done before
+// they complete on their own. Each command is also bound by its own context.
+func NewPipeline(ctx context.Context, stages ...*Cmd) *Pipeline {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	return &Pipeline{
+		ctx:    ctx,
+		stages: stages,
+	}
+}
+
+// Start connects and starts all commands, but does not wait for them to complete.
+// If any of them fails to start, the ones already started are killed.
+func (p *Pipeline) Start() error {
+	if len(p.stages) == 0 {
+		return errors.New("wsl: empty pipeline")
+	}
+	if p.started {
+		return errors.New("wsl: already started")
+	}
+	p.started = true
+
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+
+	for i, c := range p.stages[:len(p.stages)-1] {
+		next := p.stages[i+1]
+		if next.Stdin != nil {
+			p.abort(0)
+			return &PipelineError{Stage: i + 1, err: errors.New("wsl: Stdin already set")}
+		}
+
+		r, err := c.StdoutPipe()
+		if err != nil {
+			p.abort(0)
+			return &PipelineError{Stage: i, err: err}
+		}
+		next.Stdin = r
+	}
+
+	for i, c := range p.stages {
+		if err := c.Start(); err != nil {
+			p.abort(i)
+			return &PipelineError{Stage: i, err: err}
+		}
+
+		// The command was handed its own copy of the pipe from the previous stage.
+		// Ours must be closed, otherwise the previous stage would not notice if
+		// this one stopped reading.
+		if i > 0 {
+			//nolint: forcetypeassert // It was set by StdoutPipe further up
+			c.Stdin.(io.Closer).Close()
+		}
+	}
+
+	p.waitDone = make(chan struct{})
+	p.watchDone = make(chan struct{})
+	go func() {
+		defer close(p.watchDone)
+		select {
+		case <-p.ctx.Done():
+			for _, c := range p.stages {
+				//nolint: errcheck // Mimicking behaviour from (*Cmd).Start
+				c.Process.Kill()
+			}
+			p.ctxErr = p.ctx.Err()
+		case <-p.waitDone:
+		}
+	}()
+
+	return nil
+}
+
+// abort kills the stages that were started, and releases the pipes of the
+// rest, given the index of the first stage that was not started.
+func (p *Pipeline) abort(started int) {
+	for _, c := range p.stages[:started] {
+		//nolint: errcheck // The pipeline is failing already, the relevant error is that one
+		c.Process.Kill()
+		//nolint: errcheck // Same as above
+		c.Wait()
+	}
+	for _, c := range p.stages[started:] {
+		c.closeDescriptors(c.closeAfterStart)
+		c.closeDescriptors(c.closeAfterWait)
+		c.closeDescriptors(c.closeAfterCopy)
+	}
+}
+
+// Wait waits for all commands to exit.
+//
+// The returned error is nil if all commands succeed. Otherwise, like with the
+// pipefail option of bash, the pipeline fails if any of its commands fails. The
+// error is then a *PipelineError with the rightmost command to fail, regardless of
+// the order in which they exited. Unlike with pipefail, commands killed by SIGPIPE
+// are not failures unless they are the last one, as they were only writing to a
+// command that had stopped reading, as yes does in yes | head -1.
+func (p *Pipeline) Wait() error {
+	if !p.started || p.waitDone == nil {
+		return errors.New("wsl: not started")
+	}
+	if p.finished {
+		return errors.New("wsl: Wait was already called")
+	}
+	p.finished = true
+
+	errs := make([]error, len(p.stages))
+	var wg sync.WaitGroup
+	for i, c := range p.stages {
+		wg.Add(1)
+		go func(i int, c *Cmd) {
+			defer wg.Done()
+			errs[i] = c.Wait()
+		}(i, c)
+	}
+	wg.Wait()
+
+	close(p.waitDone)
+	<-p.watchDone
+
+	if p.ctxErr != nil {
+		// Same as (*Cmd).Wait: "context cancelled" is more useful than the
+		// failure of whichever stage noticed first.
+		return p.ctxErr
+	}
+
+	for i := len(errs) - 1; i >= 0; i-- {
+		if errs[i] == nil {
+			continue
+		}
+		if i < len(errs)-1 && brokenPipe(errs[i]) {
+			continue
+		}
+		return &PipelineError{Stage: i, err: errs[i]}
+	}
+	return nil
+}
+
+// brokenPipe returns whether err is the exit of a command killed by SIGPIPE.
+func brokenPipe(err error) bool {
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	sig, ok := exitErr.Signal()
+	return ok && sig == SIGPIPE
+}
+
+// Run starts all commands and waits for them to complete.
+func (p *Pipeline) Run() error {
+	if err := p.Start(); err != nil {
+		return err
+	}
+	return p.Wait()
+}
@@ -0,0 +1,151 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	d1 := newTestDistro(t, rootFs)
+	d2 := newTestDistro(t, rootFs)
+
+	// Keeping distros awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d1)()
+	defer keepAwake(t, context.Background(), &d2)()
+
+	testCases := map[string]struct {
+		stages       []string
+		otherDistros bool // Alternate distros between stages
+		stdin        string
+		setStdin     int // Index of a stage whose Stdin is set beforehand, if positive
+		cancelAfter  time.Duration
+
+		wantStdout   string
+		wantErr      bool
+		wantCtxErr   bool
+		wantStage    int
+		wantExitCode int
+	}{
+		"success with one stage":              {stages: []string{"echo Hello"}, wantStdout: "Hello\n"},
+		"success with two stages":             {stages: []string{"echo Hello", "tr a-z A-Z"}, wantStdout: "HELLO\n"},
+		"success with three stages":           {stages: []string{"printf 'c\\nb\\na\\n'", "sort", "head -n 2"}, wantStdout: "a\nb\n"},
+		"success with stdin":                  {stages: []string{"cat", "wc -l"}, stdin: "1\n2\n3\n", wantStdout: "3\n"},
+		"success across distros":              {stages: []string{"echo $WSL_DISTRO_NAME", "cat; echo $WSL_DISTRO_NAME"}, otherDistros: true},
+		"success piping a tar across distros": {stages: []string{"mkdir -p /tmp/pipeline && echo content > /tmp/pipeline/file && tar -c -C /tmp/pipeline file", "mkdir -p /tmp/received && tar -x -C /tmp/received && cat /tmp/received/file"}, otherDistros: true, wantStdout: "content\n"},
+		"success with lots of data":           {stages: []string{"head -c 50000000 /dev/zero", "wc -c"}, wantStdout: "50000000\n"},
+		"success when a writer gets SIGPIPE":  {stages: []string{"yes", "head -n 1"}, wantStdout: "y\n"},
+
+		"error when the first stage fails":        {stages: []string{"echo Hello; exit 3", "cat"}, wantErr: true, wantStage: 0, wantExitCode: 3},
+		"error when the last stage fails":         {stages: []string{"echo Hello", "cat >/dev/null; exit 4"}, wantErr: true, wantStage: 1, wantExitCode: 4},
+		"error when a middle stage fails":         {stages: []string{"echo Hello", "cat >/dev/null; exit 5", "cat"}, wantErr: true, wantStage: 1, wantExitCode: 5},
+		"error when a reader stops early":         {stages: []string{"sleep 1; exit 6", "exit 7"}, wantErr: true, wantStage: 1, wantExitCode: 7},
+		"error with the rightmost failing stage":  {stages: []string{"cat >/dev/null; exit 8", "sleep 1; exit 9", "cat"}, wantErr: true, wantStage: 1, wantExitCode: 9},
+		"error before a stage killed by SIGPIPE":  {stages: []string{"echo Hello; exit 10", "yes", "true"}, wantErr: true, wantStage: 0, wantExitCode: 10},
+		"error when a stage stdin is already set": {stages: []string{"echo Hello", "cat"}, setStdin: 1, wantErr: true, wantStage: 1},
+		"error when the context is cancelled":     {stages: []string{"sleep 30", "sleep 30"}, cancelAfter: time.Second, wantErr: true, wantCtxErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			pipelineCtx, cancelPipeline := context.WithCancel(ctx)
+			defer cancelPipeline()
+
+			var cmds []*wsl.Cmd
+			var distros []string
+			for i, s := range tc.stages {
+				d := d1
+				if tc.otherDistros && i%2 == 1 {
+					d = d2
+				}
+				distros = append(distros, d.Name())
+				cmds = append(cmds, d.Command(ctx, s))
+			}
+
+			if tc.stdin != "" {
+				cmds[0].Stdin = strings.NewReader(tc.stdin)
+			}
+			if tc.setStdin > 0 {
+				cmds[tc.setStdin].Stdin = strings.NewReader("")
+			}
+
+			stdout := &bytes.Buffer{}
+			cmds[len(cmds)-1].Stdout = stdout
+
+			if tc.cancelAfter > 0 {
+				go func() {
+					time.Sleep(tc.cancelAfter)
+					cancelPipeline()
+				}()
+			}
+
+			err := wsl.NewPipeline(pipelineCtx, cmds...).Run()
+			if tc.otherDistros && tc.wantStdout == "" {
+				// The output tells where each stage ran.
+				tc.wantStdout = strings.Join(distros, "\n") + "\n"
+			}
+
+			if !tc.wantErr {
+				require.NoError(t, err, "Unexpected error running the pipeline")
+				require.Equal(t, tc.wantStdout, stdout.String(), "Unexpected output of the pipeline")
+				return
+			}
+			require.Error(t, err, "Unexpected success running the pipeline")
+
+			if tc.wantCtxErr {
+				require.ErrorIs(t, err, context.Canceled, "Unexpected error type. Expected the pipeline to be cancelled.")
+				require.NoError(t, ctx.Err(), "The pipeline should stop as soon as its context is cancelled")
+				return
+			}
+
+			var pipelineErr *wsl.PipelineError
+			require.ErrorAs(t, err, &pipelineErr, "Unexpected error type. Expected a PipelineError.")
+			require.Equal(t, tc.wantStage, pipelineErr.Stage, "Unexpected failing stage")
+
+			if tc.wantExitCode != 0 {
+				var exitErr *wsl.ExitError
+				require.ErrorAs(t, err, &exitErr, "Unexpected error type. Expected an ExitError.")
+				require.Equal(t, tc.wantExitCode, exitErr.ExitCode(), "Unexpected exit code")
+			}
+		})
+	}
+}
+
+func TestPipelineMisuse(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := wsl.NewPipeline(ctx).Run()
+	require.Error(t, err, "Unexpected success running an empty pipeline")
+
+	p := wsl.NewPipeline(ctx, d.Command(ctx, "exit 0"))
+	require.Error(t, p.Wait(), "Unexpected success waiting for a pipeline that was not started")
+	require.NoError(t, p.Run(), "Unexpected error running the pipeline")
+	require.Error(t, p.Start(), "Unexpected success starting a pipeline twice")
+	require.Error(t, p.Wait(), "Unexpected success waiting for a pipeline twice")
+
+	fake := wsl.NewDistro(uniqueDistroName(t))
+	err = wsl.NewPipeline(ctx, d.Command(ctx, "sleep 30"), fake.Command(ctx, "cat")).Run()
+	var pipelineErr *wsl.PipelineError
+	require.ErrorAs(t, err, &pipelineErr, "Unexpected error type. Expected a PipelineError.")
+	require.Equal(t, 1, pipelineErr.Stage, "Unexpected failing stage for a distro that is not registered")
+	require.NoError(t, ctx.Err(), "Stages that were started should be killed when another fails to start")
+
+	errCtx, cancelErr := context.WithCancel(ctx)
+	cancelErr()
+	err = wsl.NewPipeline(errCtx, d.Command(ctx, "exit 0")).Run()
+	require.True(t, errors.Is(err, context.Canceled), "Unexpected error starting a pipeline with a cancelled context: %v", err)
+}
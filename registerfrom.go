@@ -0,0 +1,97 @@
+package gowsl
+
+// This file contains utilities to register distros from sources other than a file.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/download"
+)
+
+// ChecksumError is returned by RegisterFromURL when the downloaded tarball does
+// not have the expected checksum.
+type ChecksumError = download.ChecksumError
+
+// RegisterFrom is like RegisterContext, but it reads the tarball from r, such as an
+// image generated in memory. The tarball is spooled into a temporary file, which is
+// removed once the registration is over.
+func (d *Distro) RegisterFrom(ctx context.Context, r io.Reader, opts ...func(*registerOptions)) error {
+	f, err := os.CreateTemp("", "gowsl-rootfs-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not create temporary file: %v", d.Name(), err)
+	}
+	release := func() { os.Remove(f.Name()) }
+
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if ctx.Err() != nil {
+		release()
+		return ctx.Err()
+	}
+	if err != nil {
+		release()
+		return fmt.Errorf("error registering %q: could not spool rootfs: %v", d.Name(), err)
+	}
+
+	return d.register(ctx, f.Name(), release, opts)
+}
+
+// RegisterFromURL is like RegisterContext, but it downloads the tarball from url,
+// and verifies that its SHA-256 checksum is sha256 before registering it.
+//
+// If the download is interrupted, by the context or otherwise, the next call with
+// the same checksum resumes it. Concurrent calls with the same checksum, in this
+// process or in others, download one after the other. The downloaded tarball is removed once the
+// registration is over. If its checksum does not match, the error is of type
+// ChecksumError.
+func (d *Distro) RegisterFromURL(ctx context.Context, url, sha256 string, opts ...func(*registerOptions)) error {
+	dir := filepath.Join(os.TempDir(), "gowsl-downloads")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error registering %q: could not create download directory: %v", d.Name(), err)
+	}
+
+	// Every call downloads into a file of its own, so that none removes the tarball
+	// that another one is registering. They share the partial download instead,
+	// which is named after the checksum to be resumed, and which Fetch locks. The
+	// checksum is validated by Fetch before the partial download is used, and
+	// CreateTemp refuses patterns with separators, so it cannot point anywhere else.
+	sum := strings.ToLower(sha256)
+	f, err := os.CreateTemp(dir, sum+"-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("error registering %q: could not create download file: %v", d.Name(), err)
+	}
+	dst := f.Name()
+	release := func() { os.Remove(dst) }
+	if err := f.Close(); err != nil {
+		release()
+		return fmt.Errorf("error registering %q: could not create download file: %v", d.Name(), err)
+	}
+
+	opt := download.Options{Part: filepath.Join(dir, sum+".tar.gz.part")}
+	if err := download.Fetch(ctx, url, dst, sha256, opt); err != nil {
+		release()
+		return err
+	}
+
+	return d.register(ctx, dst, release, opts)
+}
+
+// contextReader is a reader that fails once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,137 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterFrom(t *testing.T) {
+	image, err := os.ReadFile(emptyRootFs)
+	require.NoError(t, err, "Setup: could not read rootfs")
+
+	testCases := map[string]struct {
+		reader    io.Reader
+		cancelled bool
+
+		wantErr error
+	}{
+		"success from memory":                 {reader: bytes.NewReader(image)},
+		"error with a cancelled context":      {reader: bytes.NewReader(image), cancelled: true, wantErr: context.Canceled},
+		"error with a reader that fails":      {reader: io.MultiReader(bytes.NewReader(image[:10]), errReader{}), wantErr: errAny},
+		"error with a tarball that is broken": {reader: strings.NewReader("not a tarball"), wantErr: errAny},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := wsl.NewDistro(uniqueDistroName(t))
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			err := d.RegisterFrom(ctx, tc.reader)
+			if tc.wantErr != nil {
+				require.Error(t, err, "RegisterFrom should have failed")
+				if !errors.Is(tc.wantErr, errAny) {
+					require.ErrorIs(t, err, tc.wantErr, "Unexpected error from RegisterFrom")
+				}
+				r, err := d.IsRegistered()
+				require.NoError(t, err, "IsRegistered should not fail")
+				require.False(t, r, "The distro should not be registered")
+				return
+			}
+
+			require.NoError(t, err, "RegisterFrom should not have failed")
+			r, err := d.IsRegistered()
+			require.NoError(t, err, "IsRegistered should not fail")
+			require.True(t, r, "The distro should be registered")
+		})
+	}
+}
+
+func TestRegisterFromURL(t *testing.T) {
+	image, err := os.ReadFile(emptyRootFs)
+	require.NoError(t, err, "Setup: could not read rootfs")
+
+	sum := sha256.Sum256(image)
+	checksum := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rootfs.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "rootfs.tar.gz", time.Time{}, bytes.NewReader(image))
+	}))
+	defer srv.Close()
+
+	testCases := map[string]struct {
+		path     string
+		checksum string
+
+		wantChecksumErr bool
+		wantErr         bool
+	}{
+		"success": {path: "/rootfs.tar.gz", checksum: checksum},
+
+		"error with a checksum mismatch": {path: "/rootfs.tar.gz", checksum: strings.Repeat("0", 64), wantErr: true, wantChecksumErr: true},
+		"error with an invalid checksum": {path: "/rootfs.tar.gz", checksum: "../../not-a-checksum", wantErr: true},
+		"error when not found":           {path: "/missing.tar.gz", checksum: checksum, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := wsl.NewDistro(uniqueDistroName(t))
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			err := d.RegisterFromURL(ctx, srv.URL+tc.path, tc.checksum)
+
+			r, regErr := d.IsRegistered()
+			require.NoError(t, regErr, "IsRegistered should not fail")
+
+			if tc.wantErr {
+				require.Error(t, err, "RegisterFromURL should have failed")
+				require.False(t, r, "The distro should not be registered")
+
+				var target wsl.ChecksumError
+				if tc.wantChecksumErr {
+					require.ErrorAs(t, err, &target, "RegisterFromURL should have returned a ChecksumError")
+				} else {
+					notErrorAsf(t, err, &target, "RegisterFromURL should not have returned a ChecksumError")
+				}
+				return
+			}
+
+			require.NoError(t, err, "RegisterFromURL should not have failed")
+			require.True(t, r, "The distro should be registered")
+		})
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
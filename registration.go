@@ -4,6 +4,7 @@ package gowsl
 // as well as utilities to query this status.
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -15,13 +16,52 @@ import (
 // Register is a wrapper around Win32's WslRegisterDistribution.
 // It creates a new distro with a copy of the given tarball as
 // its filesystem.
-func (d *Distro) Register(rootFsPath string) (e error) {
+//
+// The tarball can be a plain tar archive, or one compressed with gzip, xz, zstd
+// or bzip2, regardless of its extension. Tarballs that are not compressed with
+// gzip are converted to it first, into a temporary file.
+//
+// Can be used with optional helper parameters WithPreflightCheck and WithPatches.
+func (d *Distro) Register(rootFsPath string, opts ...func(*registerOptions)) error {
+	return d.RegisterContext(context.Background(), rootFsPath, opts...)
+}
+
+// RegisterContext is like Register, but returns ctx.Err() as soon as the context
+// is done. WslRegisterDistribution cannot be interrupted: if the context is done
+// before it completes, it carries on in the background, and the distro is
+// unregistered right after it is created.
+func (d *Distro) RegisterContext(ctx context.Context, rootFsPath string, opts ...func(*registerOptions)) error {
+	return d.register(ctx, rootFsPath, func() {}, opts)
+}
+
+// register registers the distro from the tarball at rootFsPath. release is called
+// once the tarball is no longer in use, which may be after register returns if the
+// context is done first.
+func (d *Distro) register(ctx context.Context, rootFsPath string, release func(), opts []func(*registerOptions)) (e error) {
 	defer func() {
-		if e != nil {
+		// Errors from the context are returned as is, like with Cmd.
+		if e != nil && !errors.Is(e, ctx.Err()) {
 			e = fmt.Errorf("error registering %q: %v", d.Name(), e)
 		}
 	}()
 
+	// Past this point, releasing the tarball is up to the registration itself.
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			release()
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	options := registerOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
 	rootFsPath, err := fixPath(rootFsPath)
 	if err != nil {
 		return err
@@ -35,6 +75,26 @@ func (d *Distro) Register(rootFsPath string) (e error) {
 		return errors.New("already registered")
 	}
 
+	rootFsPath, remove, err := gzipRootfs(ctx, rootFsPath, options.patches)
+	if err != nil {
+		return err
+	}
+	releaseSource := release
+	release = func() {
+		remove()
+		releaseSource()
+	}
+
+	// The check is made after patching, as patches may fix problems.
+	if options.preflight {
+		if err := preflightCheck(rootFsPath); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
 	distroUTF16, err := syscall.UTF16PtrFromString(d.Name())
 	if err != nil {
 		return errors.New("failed to convert distro name to UTF16")
@@ -45,10 +105,26 @@ func (d *Distro) Register(rootFsPath string) (e error) {
 		return fmt.Errorf("failed to convert rootfs '%q' to UTF16", rootFsPath)
 	}
 
-	r1, _, _ := wslRegisterDistribution.Call(
-		uintptr(unsafe.Pointer(distroUTF16)),
-		uintptr(unsafe.Pointer(rootFsPathUTF16)))
+	register := func() uintptr {
+		defer release()
+		return callWslAPI(wslRegisterDistribution, d.Name(),
+			uintptr(unsafe.Pointer(distroUTF16)),
+			uintptr(unsafe.Pointer(rootFsPathUTF16)))
+	}
+
+	rollback := func(r1 uintptr) {
+		if r1 != 0 {
+			return
+		}
+		// The distro was registered after the caller gave up on it.
+		callWslAPI(wslUnregisterDistribution, d.Name(), uintptr(unsafe.Pointer(distroUTF16)))
+	}
 
+	handedOff = true
+	r1, err := runBlocking(ctx, register, rollback)
+	if err != nil {
+		return err
+	}
 	if r1 != 0 {
 		return fmt.Errorf("failed syscall to wslRegisterDistribution")
 	}
@@ -85,13 +161,26 @@ func (d Distro) IsRegistered() (registered bool, e error) {
 
 // Unregister is a wrapper around Win32's WslUnregisterDistribution.
 // It irreparably destroys a distro and its filesystem.
-func (d *Distro) Unregister() (e error) {
+func (d *Distro) Unregister() error {
+	return d.UnregisterContext(context.Background())
+}
+
+// UnregisterContext is like Unregister, but returns ctx.Err() as soon as the
+// context is done. WslUnregisterDistribution cannot be interrupted: if the context
+// is done before it completes, it carries on in the background, and the distro
+// is eventually unregistered all the same.
+func (d *Distro) UnregisterContext(ctx context.Context) (e error) {
 	defer func() {
-		if e != nil {
+		// Errors from the context are returned as is, like with Cmd.
+		if e != nil && !errors.Is(e, ctx.Err()) {
 			e = fmt.Errorf("failed to unregister %q: %v", d.Name(), e)
 		}
 	}()
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r, err := d.IsRegistered()
 	if err != nil {
 		return err
@@ -105,7 +194,12 @@ func (d *Distro) Unregister() (e error) {
 		return errors.New("failed to convert distro name to UTF16")
 	}
 
-	r1, _, _ := wslUnregisterDistribution.Call(uintptr(unsafe.Pointer(distroUTF16)))
+	r1, err := runBlocking(ctx, func() uintptr {
+		return callWslAPI(wslUnregisterDistribution, d.Name(), uintptr(unsafe.Pointer(distroUTF16)))
+	}, nil)
+	if err != nil {
+		return err
+	}
 
 	if r1 != 0 {
 		return fmt.Errorf("failed syscall to WslLaunchInteractive")
@@ -14,13 +14,16 @@ func TestRegister(t *testing.T) {
 	testCases := map[string]struct {
 		distroSuffix string
 		rootfs       string
+		preflight    bool
 		wantError    bool
 	}{
-		"happy path":          {rootfs: rootFs},
-		"wrong name":          {rootfs: rootFs, distroSuffix: "--I contain whitespace", wantError: true},
-		"null char in name":   {rootfs: rootFs, distroSuffix: "--I \x00 contain a null char", wantError: true},
-		"null char in rootfs": {rootfs: "jammy\x00.tar.gz", wantError: true},
-		"inexistent rootfs":   {rootfs: "I am not a real file.tar.gz", wantError: true},
+		"happy path":                   {rootfs: rootFs},
+		"happy path with a pre-flight": {rootfs: rootFs, preflight: true},
+		"wrong name":                   {rootfs: rootFs, distroSuffix: "--I contain whitespace", wantError: true},
+		"null char in name":            {rootfs: rootFs, distroSuffix: "--I \x00 contain a null char", wantError: true},
+		"null char in rootfs":          {rootfs: "jammy\x00.tar.gz", wantError: true},
+		"inexistent rootfs":            {rootfs: "I am not a real file.tar.gz", wantError: true},
+		"failed pre-flight":            {rootfs: emptyRootFs, preflight: true, wantError: true},
 	}
 
 	for name, tc := range testCases {
@@ -36,7 +39,12 @@ func TestRegister(t *testing.T) {
 
 			cancel := wslShutdownTimeout(t, time.Minute)
 			t.Logf("Registering %q", d.Name())
-			err := d.Register(tc.rootfs)
+			var err error
+			if tc.preflight {
+				err = d.Register(tc.rootfs, wsl.WithPreflightCheck())
+			} else {
+				err = d.Register(tc.rootfs)
+			}
 			cancel()
 			t.Log("Registration completed")
 
@@ -25,6 +25,7 @@ func defaultDistro() (name string, err error) {
 	}()
 
 	lxssKey, err := registry.OpenKey(lxssRegistry, lxssPath, registry.READ)
+	logRegistry("open", lxssPath, "", err)
 	if err != nil {
 		return "", fmt.Errorf("failed to open lxss registry: %v", err)
 	}
@@ -32,6 +33,7 @@ func defaultDistro() (name string, err error) {
 
 	target := "DefaultDistribution"
 	guidVal, _, err := lxssKey.GetStringValue(target)
+	logRegistry("read", lxssPath, target, err)
 	if errors.Is(err, syscall.ERROR_FILE_NOT_FOUND) {
 		return "", errors.New("no default distro")
 	}
@@ -48,17 +50,20 @@ func defaultDistro() (name string, err error) {
 
 func distroGUIDs() (distros map[string]guid, err error) {
 	lxssKey, err := registry.OpenKey(lxssRegistry, lxssPath, registry.READ)
+	logRegistry("open", lxssPath, "", err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open lxss registry: %v", err)
 	}
 	defer lxssKey.Close()
 
 	lxssData, err := lxssKey.Stat()
+	logRegistry("stat", lxssPath, "", err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat lxss registry key: %v", err)
 	}
 
 	subkeys, err := lxssKey.ReadSubKeyNames(int(lxssData.SubKeyCount))
+	logRegistry("list subkeys", lxssPath, "", err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read lxss registry subkeys: %v", err)
 	}
@@ -108,6 +113,7 @@ func distronameFromGUID(GUID windows.GUID) (string, error) {
 	keyPath := filepath.Join(lxssPath, strings.ToLower(GUID.String()))
 
 	key, err := registry.OpenKey(lxssRegistry, keyPath, registry.QUERY_VALUE)
+	logRegistry("open", keyPath, "", err)
 	if err != nil {
 		return "", fmt.Errorf("cannot find key %s: %v", keyPath, err)
 	}
@@ -115,8 +121,56 @@ func distronameFromGUID(GUID windows.GUID) (string, error) {
 
 	target := "DistributionName"
 	name, _, err := key.GetStringValue(target)
+	logRegistry("read", keyPath, target, err)
 	if err != nil {
 		return "", fmt.Errorf("cannot find %s:%s : %v", keyPath, target, err)
 	}
 	return name, nil
 }
+
+// sourceChecksumValue is the value of the registry key of a distro where
+// EnsureRegistered records the checksum of the tarball it was registered from.
+// WSL ignores it, and removes it along with the key when the distro is unregistered.
+const sourceChecksumValue = "GowslSourceSHA256"
+
+// sourceChecksum returns the checksum of the tarball the distro was registered
+// from, or an empty string if it was not recorded.
+func sourceChecksum(GUID windows.GUID) (string, error) {
+	keyPath := filepath.Join(lxssPath, strings.ToLower(GUID.String()))
+
+	key, err := registry.OpenKey(lxssRegistry, keyPath, registry.QUERY_VALUE)
+	logRegistry("open", keyPath, "", err)
+	if err != nil {
+		return "", fmt.Errorf("cannot find key %s: %v", keyPath, err)
+	}
+	defer key.Close()
+
+	sum, _, err := key.GetStringValue(sourceChecksumValue)
+	logRegistry("read", keyPath, sourceChecksumValue, err)
+	if errors.Is(err, syscall.ERROR_FILE_NOT_FOUND) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s:%s : %v", keyPath, sourceChecksumValue, err)
+	}
+	return sum, nil
+}
+
+// setSourceChecksum records the checksum of the tarball the distro was registered from.
+func setSourceChecksum(GUID windows.GUID, sum string) error {
+	keyPath := filepath.Join(lxssPath, strings.ToLower(GUID.String()))
+
+	key, err := registry.OpenKey(lxssRegistry, keyPath, registry.SET_VALUE)
+	logRegistry("open", keyPath, "", err)
+	if err != nil {
+		return fmt.Errorf("cannot find key %s: %v", keyPath, err)
+	}
+	defer key.Close()
+
+	err = key.SetStringValue(sourceChecksumValue, sum)
+	logRegistry("write", keyPath, sourceChecksumValue, err)
+	if err != nil {
+		return fmt.Errorf("cannot write %s:%s : %v", keyPath, sourceChecksumValue, err)
+	}
+	return nil
+}
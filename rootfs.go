@@ -0,0 +1,160 @@
+package gowsl
+
+// This file contains utilities to inspect the tarballs that distros are registered from.
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ubuntu/gowsl/internal/rootfs"
+)
+
+// RootfsReport is what InspectRootfs finds in a tarball.
+type RootfsReport = rootfs.Report
+
+// RootfsProblem is an issue found in a tarball by InspectRootfs.
+type RootfsProblem = rootfs.Problem
+
+// RootfsProblemKind is the kind of a RootfsProblem.
+type RootfsProblemKind = rootfs.ProblemKind
+
+// Problems that InspectRootfs looks for.
+const (
+	// RootfsProblemOwnership is a system file that is not owned by root, which usually
+	// means the tarball was created without preserving ownership.
+	RootfsProblemOwnership = rootfs.ProblemOwnership
+
+	// RootfsProblemSymlinkEscape is a symbolic link whose target climbs above the root
+	// of the filesystem.
+	RootfsProblemSymlinkEscape = rootfs.ProblemSymlinkEscape
+
+	// RootfsProblemHardlink is a hard link whose target is not in the tarball before it.
+	RootfsProblemHardlink = rootfs.ProblemHardlink
+
+	// RootfsProblemUnsafePath is an entry whose name climbs above the root of the filesystem.
+	RootfsProblemUnsafePath = rootfs.ProblemUnsafePath
+
+	// RootfsProblemNoShell is the lack of /bin/sh, which WSL needs to run commands.
+	RootfsProblemNoShell = rootfs.ProblemNoShell
+)
+
+// InspectRootfs reads the tarball at path, which can be a plain tar archive or
+// one compressed with gzip, xz, zstd or bzip2, and reports what it contains: the
+// os-release of the distro, its shells, its WSL configuration, and the problems
+// that would prevent it from working once registered.
+//
+// It returns an error if the tarball cannot be read. Problems are not errors: they
+// are listed in the report.
+func InspectRootfs(path string) (*RootfsReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not inspect rootfs: %v", err)
+	}
+	defer f.Close()
+
+	report, err := rootfs.Inspect(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not inspect rootfs %q: %v", path, err)
+	}
+	return report, nil
+}
+
+type registerOptions struct {
+	preflight bool
+	patches   []RootfsPatch
+	recreate  bool // Only used by EnsureRegistered
+}
+
+// WithPreflightCheck makes the registration inspect the tarball first, as with
+// InspectRootfs, and fail if it cannot be read or if any problem is found in it.
+// WslRegisterDistribution fails with unhelpful errors on malformed tarballs, or
+// even succeeds and leaves a distro that cannot run commands.
+func WithPreflightCheck() func(*registerOptions) {
+	return func(o *registerOptions) {
+		o.preflight = true
+	}
+}
+
+// preflightCheck inspects the tarball at rootFsPath, and fails if it has problems.
+func preflightCheck(rootFsPath string) error {
+	report, err := InspectRootfs(rootFsPath)
+	if err != nil {
+		return err
+	}
+
+	if len(report.Problems) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(report.Problems))
+	for _, p := range report.Problems {
+		problems = append(problems, p.String())
+	}
+	return fmt.Errorf("rootfs failed the pre-flight check: %s", strings.Join(problems, "; "))
+}
+
+// contextReadSeeker is a contextReader that can seek, for tarballs that are read
+// more than once.
+type contextReadSeeker struct {
+	*contextReader
+	io.Seeker
+}
+
+// gzipRootfs returns the path of a copy of the tarball at rootFsPath compressed with
+// gzip, which is the format that WslRegisterDistribution supports, with the patches
+// applied, along with the function to remove it. The tarball is used as is if it is
+// compressed with gzip already and there are no patches, or if its format is unknown,
+// in which case remove does nothing.
+func gzipRootfs(ctx context.Context, rootFsPath string, rootfsPatches []RootfsPatch) (path string, remove func(), err error) {
+	patches, err := flattenPatches(rootfsPatches)
+	if err != nil {
+		return "", nil, err
+	}
+
+	src, err := os.Open(rootFsPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+
+	format, err := rootfs.Detect(bufio.NewReader(src))
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read rootfs: %v", err)
+	}
+	if (format == rootfs.FormatGzip && len(patches) == 0) || format == rootfs.FormatUnknown {
+		// Unknown formats are left for WslRegisterDistribution to reject.
+		return rootFsPath, func() {}, nil
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", nil, fmt.Errorf("could not read rootfs: %v", err)
+	}
+
+	dst, err := os.CreateTemp("", "gowsl-rootfs-*.tar.gz")
+	if err != nil {
+		return "", nil, fmt.Errorf("could not create temporary file: %v", err)
+	}
+	remove = func() { os.Remove(dst.Name()) }
+
+	if len(patches) == 0 {
+		_, err = rootfs.Transcode(dst, &contextReader{ctx: ctx, r: src})
+	} else {
+		err = rootfs.Rewrite(dst, contextReadSeeker{&contextReader{ctx: ctx, r: src}, src}, patches)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if ctx.Err() != nil {
+		remove()
+		return "", nil, ctx.Err()
+	}
+	if err != nil {
+		remove()
+		return "", nil, fmt.Errorf("could not rewrite rootfs: %v", err)
+	}
+
+	return dst.Name(), remove, nil
+}
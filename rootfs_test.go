@@ -0,0 +1,114 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+func TestInspectRootfs(t *testing.T) {
+	notATarball := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+	require.NoError(t, os.WriteFile(notATarball, []byte("I am not a tarball"), 0600), "Setup: could not write fake rootfs")
+
+	testCases := map[string]struct {
+		path string
+
+		wantErr bool
+	}{
+		"success": {path: rootFs},
+
+		"error with an inexistent rootfs":         {path: "I am not a real file.tar.gz", wantErr: true},
+		"error with a file that is not a tarball": {path: notATarball, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			report, err := wsl.InspectRootfs(tc.path)
+			if tc.wantErr {
+				require.Error(t, err, "InspectRootfs should have failed")
+				return
+			}
+			require.NoError(t, err, "InspectRootfs should not have failed")
+
+			require.Equal(t, "ubuntu", report.OSRelease["ID"], "The test rootfs should be Ubuntu")
+			require.True(t, report.HasShell, "The test rootfs should have /bin/sh")
+			require.NotEmpty(t, report.DefaultShell, "The test rootfs should have a default shell for root")
+			require.Positive(t, report.Entries, "The test rootfs should have entries")
+			require.Positive(t, report.TotalSize, "The test rootfs should have a size")
+			require.Empty(t, report.Problems, "The test rootfs should have no problems")
+		})
+	}
+}
+
+func TestRegisterCompressionFormats(t *testing.T) {
+	testCases := map[string]struct {
+		compress func(io.Writer) (io.WriteCloser, error)
+	}{
+		"plain tar": {compress: func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }},
+		"xz":        {compress: func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }},
+		"zstd":      {compress: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			// The extension is deliberately misleading: the format is told by its contents.
+			path := filepath.Join(t.TempDir(), "rootfs.tar.gz")
+			recompressRootfs(t, rootFs, path, tc.compress)
+
+			d := wsl.NewDistro(uniqueDistroName(t))
+			defer cleanUpWslInstance(d) //nolint: errcheck // Best effort cleanup
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			err := d.RegisterContext(ctx, path)
+			require.NoError(t, err, "Register should accept the tarball")
+
+			out, err := d.Command(ctx, "echo hello").Output()
+			require.NoError(t, err, "The registered distro should run commands")
+			require.Equal(t, "hello\n", string(out), "Unexpected output from the registered distro")
+		})
+	}
+}
+
+// recompressRootfs writes the gzip-compressed tarball at src into dst, compressed
+// with another format.
+func recompressRootfs(t *testing.T, src, dst string, compress func(io.Writer) (io.WriteCloser, error)) {
+	t.Helper()
+
+	in, err := os.Open(src)
+	require.NoError(t, err, "Setup: could not open rootfs")
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	require.NoError(t, err, "Setup: could not decompress rootfs")
+
+	out, err := os.Create(dst)
+	require.NoError(t, err, "Setup: could not create recompressed rootfs")
+	defer out.Close()
+
+	zw, err := compress(out)
+	require.NoError(t, err, "Setup: could not create compressor")
+
+	_, err = io.Copy(zw, zr)
+	require.NoError(t, err, "Setup: could not recompress rootfs")
+	require.NoError(t, zw.Close(), "Setup: could not recompress rootfs")
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
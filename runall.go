@@ -0,0 +1,130 @@
+package gowsl
+
+// This file contains utilities to run a command in many distros at once.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/fanout"
+)
+
+// ErrSkipped is the error of the distros where RunOnAll did not run the command,
+// because it failed in another distro and WithFailFast was used.
+var ErrSkipped = fanout.ErrSkipped
+
+// RunResult is the outcome of a command run by RunOnAll in one distro.
+type RunResult struct {
+	Distro   Distro
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int           // Exit code of the command, or -1 if it did not exit on its own
+	Duration time.Duration // Time it took to run the command
+	Err      error         // Error running the command, such as an *ExitError, if any
+}
+
+type runOnAllOptions struct {
+	concurrency int
+	timeout     time.Duration
+	failFast    bool
+}
+
+// WithConcurrency is an optional parameter for RunOnAll that limits the number of
+// distros where the command runs at the same time. By default, there is no limit.
+func WithConcurrency(n int) func(*runOnAllOptions) {
+	return func(o *runOnAllOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithDistroTimeout is an optional parameter for RunOnAll that bounds the time the
+// command can run in each distro.
+func WithDistroTimeout(timeout time.Duration) func(*runOnAllOptions) {
+	return func(o *runOnAllOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithFailFast is an optional parameter for RunOnAll that stops everything as soon
+// as the command fails in one of the distros. Otherwise, it runs in all of them.
+func WithFailFast() func(*runOnAllOptions) {
+	return func(o *runOnAllOptions) {
+		o.failFast = true
+	}
+}
+
+// RunOnAll runs the same command in every distro, concurrently. If distros is nil,
+// it runs in all registered distros.
+//
+// It returns one result per distro, in the same order. The error is not nil if the
+// command failed in any of the distros: see the result of each of them for details.
+func RunOnAll(ctx context.Context, distros []Distro, cmd string, opts ...func(*runOnAllOptions)) (results []RunResult, err error) {
+	options := runOnAllOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if distros == nil {
+		distros, err = RegisteredDistros()
+		if err != nil {
+			return nil, fmt.Errorf("could not run command %q on all distros: %v", cmd, err)
+		}
+	}
+
+	results = make([]RunResult, len(distros))
+	for i := range distros {
+		results[i] = RunResult{Distro: distros[i], ExitCode: -1}
+	}
+
+	errs := fanout.Run(ctx, len(distros), fanout.Options{
+		Concurrency: options.concurrency,
+		Timeout:     options.timeout,
+		FailFast:    options.failFast,
+	}, func(ctx context.Context, i int) error {
+		results[i].run(ctx, cmd)
+		return results[i].Err
+	})
+
+	var failed []string
+	for i := range results {
+		// Distros that were not started only have their error in errs.
+		results[i].Err = errs[i]
+		if errs[i] != nil {
+			failed = append(failed, distros[i].Name())
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("command %q failed in %d out of %d distros: %s", cmd, len(failed), len(distros), strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// run runs the command in the distro of the result, and fills in the rest of it.
+func (r *RunResult) run(ctx context.Context, command string) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := r.Distro.Command(ctx, command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	r.Duration = time.Since(start)
+
+	r.Stdout = stdout.Bytes()
+	r.Stderr = stderr.Bytes()
+
+	r.Err = err
+
+	var exitErr *ExitError
+	if err == nil {
+		r.ExitCode = 0
+	} else if errors.As(err, &exitErr) {
+		r.ExitCode = exitErr.ExitCode()
+	}
+}
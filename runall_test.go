@@ -0,0 +1,118 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOnAll(t *testing.T) {
+	d1 := newTestDistro(t, rootFs)
+	d2 := newTestDistro(t, rootFs)
+	fakeDistro := wsl.NewDistro(uniqueDistroName(t))
+
+	// Keeping distros awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d1)()
+	defer keepAwake(t, context.Background(), &d2)()
+
+	// The command fails in d2 only
+	failInD2 := fmt.Sprintf(`[ "$WSL_DISTRO_NAME" != %q ] || exit 42`, d2.Name())
+
+	testCases := map[string]struct {
+		distros     []wsl.Distro
+		cmd         string
+		concurrency int
+		timeout     time.Duration
+		failFast    bool
+
+		wantErr       bool
+		wantExitCodes []int
+		wantErrs      []error // Errors expected with errors.Is. Use errAny for any error.
+	}{
+		"success":                        {distros: []wsl.Distro{d1, d2}, cmd: "echo Hello", wantExitCodes: []int{0, 0}},
+		"success with concurrency limit": {distros: []wsl.Distro{d1, d2}, cmd: "echo Hello", concurrency: 1, wantExitCodes: []int{0, 0}},
+		"success with a timeout":         {distros: []wsl.Distro{d1, d2}, cmd: "echo Hello", timeout: 20 * time.Second, wantExitCodes: []int{0, 0}},
+		"success with no distros":        {distros: []wsl.Distro{}, cmd: "echo Hello", wantExitCodes: []int{}},
+
+		"error when the command fails in one distro": {distros: []wsl.Distro{d1, d2}, cmd: failInD2, wantErr: true, wantExitCodes: []int{0, 42}, wantErrs: []error{nil, errAny}},
+		"error when a distro is not registered":      {distros: []wsl.Distro{fakeDistro, d1}, cmd: "echo Hello", wantErr: true, wantExitCodes: []int{-1, 0}, wantErrs: []error{errAny, nil}},
+		"error when the command times out":           {distros: []wsl.Distro{d1, d2}, cmd: "sleep 30", timeout: time.Second, wantErr: true, wantExitCodes: []int{-1, -1}, wantErrs: []error{context.DeadlineExceeded, context.DeadlineExceeded}},
+		"error with fail-fast skips the rest":        {distros: []wsl.Distro{d2, d1}, cmd: failInD2, failFast: true, concurrency: 1, wantErr: true, wantExitCodes: []int{42, -1}, wantErrs: []error{errAny, wsl.ErrSkipped}},
+		"error with fail-fast cancels the rest":      {distros: []wsl.Distro{d1, fakeDistro}, cmd: "sleep 30", failFast: true, wantErr: true, wantExitCodes: []int{-1, -1}, wantErrs: []error{context.Canceled, errAny}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var results []wsl.RunResult
+			var err error
+			if tc.failFast {
+				results, err = wsl.RunOnAll(ctx, tc.distros, tc.cmd, wsl.WithConcurrency(tc.concurrency), wsl.WithDistroTimeout(tc.timeout), wsl.WithFailFast())
+			} else {
+				results, err = wsl.RunOnAll(ctx, tc.distros, tc.cmd, wsl.WithConcurrency(tc.concurrency), wsl.WithDistroTimeout(tc.timeout))
+			}
+			if tc.wantErr {
+				require.Error(t, err, "Unexpected success calling RunOnAll")
+			} else {
+				require.NoError(t, err, "Unexpected error calling RunOnAll")
+			}
+
+			require.Len(t, results, len(tc.distros), "RunOnAll should return one result per distro")
+			for i, r := range results {
+				require.Equal(t, tc.distros[i].Name(), r.Distro.Name(), "Results should be in the same order as the distros")
+				require.Equal(t, tc.wantExitCodes[i], r.ExitCode, "Unexpected exit code in distro %q. Error: %v", r.Distro.Name(), r.Err)
+
+				var wantErr error
+				if tc.wantErrs != nil {
+					wantErr = tc.wantErrs[i]
+				}
+				switch {
+				case wantErr == nil:
+					require.NoError(t, r.Err, "Unexpected error in distro %q", r.Distro.Name())
+					require.Positive(t, r.Duration, "The duration of the command should be measured in distro %q", r.Distro.Name())
+				case errors.Is(wantErr, errAny):
+					require.Error(t, r.Err, "Unexpected success in distro %q", r.Distro.Name())
+				default:
+					require.ErrorIs(t, r.Err, wantErr, "Unexpected error in distro %q", r.Distro.Name())
+				}
+
+				if tc.cmd == "echo Hello" && wantErr == nil {
+					require.Equal(t, "Hello\n", string(r.Stdout), "Unexpected stdout in distro %q", r.Distro.Name())
+					require.Empty(t, r.Stderr, "Unexpected stderr in distro %q", r.Distro.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestRunOnAllRegistered(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Other distros may be registered, so only the test distro is checked.
+	results, _ := wsl.RunOnAll(ctx, nil, "echo Hello", wsl.WithDistroTimeout(30*time.Second))
+
+	for _, r := range results {
+		if r.Distro.Name() != d.Name() {
+			continue
+		}
+		require.NoError(t, r.Err, "Unexpected error in the test distro")
+		require.Equal(t, "Hello\n", string(r.Stdout), "Unexpected stdout in the test distro")
+		return
+	}
+	require.Fail(t, "RunOnAll did not run in the test distro", "Results: %v", results)
+}
+
+// errAny is used in test cases to expect any error.
+var errAny = errors.New("any error")
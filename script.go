@@ -0,0 +1,76 @@
+package gowsl
+
+// This file contains utilities to run scripts in a distro.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ubuntu/gowsl/internal/script"
+)
+
+// ScriptError is returned by RunScript when the script fails and the line where
+// it failed is known. It wraps the *ExitError of the interpreter.
+type ScriptError struct {
+	// Line is the line of the script where the failure happened, counting from 1.
+	Line int
+
+	err *ExitError
+}
+
+// Error makes it so ScriptError implements the error interface.
+func (err *ScriptError) Error() string {
+	return fmt.Sprintf("script failed at line %d: %v", err.Line, err.err)
+}
+
+// Unwrap returns the *ExitError of the interpreter.
+func (err *ScriptError) Unwrap() error {
+	return err.err
+}
+
+// ScriptCommand returns a Cmd that runs the script with the interpreter, passing
+// it args. The script is delivered over stdin rather than on the command line,
+// so it needs no escaping, and its own stdin cannot be used.
+//
+// The interpreter is a command line such as "python3 -u", which is not escaped.
+// If it is empty, the interpreter in the shebang of the script is used, or
+// /bin/sh if there is none.
+//
+// Shell scripts (sh, bash, dash, zsh, ...) run with `set -euo pipefail`, where
+// the shell supports it. Scripts can opt out with `set +euo pipefail`.
+func (d *Distro) ScriptCommand(ctx context.Context, r io.Reader, interpreter string, args ...string) (*Cmd, error) {
+	command, stdin, err := script.Prepare(r, interpreter, args)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := d.Command(ctx, command)
+	cmd.Stdin = stdin
+	return cmd, nil
+}
+
+// RunScript runs the script with the interpreter, passing it args, and returns
+// its standard output. See ScriptCommand for the details on how it is run.
+//
+// If the script fails and the line where it failed can be told from the error
+// messages of the interpreter, the error is of type *ScriptError. Otherwise, it
+// is usually of type *ExitError.
+func (d *Distro) RunScript(ctx context.Context, r io.Reader, interpreter string, args ...string) (stdout []byte, err error) {
+	cmd, err := d.ScriptCommand(ctx, r, interpreter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err = cmd.Output()
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return stdout, err
+	}
+	if line, ok := script.FailedLine(exitErr.Stderr); ok {
+		return stdout, &ScriptError{Line: line, err: exitErr}
+	}
+	return stdout, err
+}
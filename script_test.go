@@ -0,0 +1,94 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunScript(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	// Keeping distro awake so there are no unexpected timeouts
+	defer keepAwake(t, context.Background(), &d)()
+
+	testCases := map[string]struct {
+		script      string
+		interpreter string
+		args        []string
+
+		wantStdout   string
+		wantErr      bool
+		wantExitCode int
+		wantLine     int
+		wantNoLine   bool
+	}{
+		"success":                       {script: "echo hello\necho world\n", wantStdout: "hello\nworld\n"},
+		"success with quotes":           {script: `echo "it's" '"quoted"' $((1+2))`, wantStdout: "it's \"quoted\" 3\n"},
+		"success with arguments":        {script: `printf '%s|' "$@"`, args: []string{"a b", "it's", "$HOME"}, wantStdout: "a b|it's|$HOME|"},
+		"success with a shebang":        {script: "#!/bin/bash\necho ${BASH_VERSION:+bash}\n", wantStdout: "bash\n"},
+		"success with an interpreter":   {script: "echo ${BASH_VERSION:+bash}\n", interpreter: "bash", wantStdout: "bash\n"},
+		"success with a lenient script": {script: "set +eu\nfalse\necho done\n", wantStdout: "done\n"},
+		"success with a long script":    {script: strings.Repeat("true\n", 10000) + "echo done\n", wantStdout: "done\n"},
+
+		"error stops the script":         {script: "echo one\nfalse\necho two\n", wantStdout: "one\n", wantErr: true, wantExitCode: 1, wantNoLine: true},
+		"error reports the line in bash": {script: "#!/bin/bash\necho one\n\nfalse\necho two\n", wantStdout: "one\n", wantErr: true, wantExitCode: 1, wantLine: 4},
+		"error reports the line in sh":   {script: "echo one\n\nthis-command-does-not-exist\n", wantStdout: "one\n", wantErr: true, wantExitCode: 127, wantLine: 3},
+		"error on an unset variable":     {script: "echo one\necho $UNSET_VARIABLE\n", interpreter: "bash", wantStdout: "one\n", wantErr: true, wantExitCode: 1, wantLine: 2},
+		"error on a missing interpreter": {script: "echo one\n", interpreter: "this-interpreter-does-not-exist", wantErr: true, wantExitCode: 127, wantNoLine: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			stdout, err := d.RunScript(ctx, strings.NewReader(tc.script), tc.interpreter, tc.args...)
+			require.Equal(t, tc.wantStdout, string(stdout), "Unexpected output of the script")
+			if !tc.wantErr {
+				require.NoError(t, err, "Unexpected error calling (*Distro).RunScript")
+				return
+			}
+			require.Error(t, err, "Unexpected success calling (*Distro).RunScript")
+
+			var exitErr *wsl.ExitError
+			require.ErrorAs(t, err, &exitErr, "Unexpected error type. Expected an ExitError.")
+			require.Equal(t, tc.wantExitCode, exitErr.ExitCode(), "Unexpected exit code")
+
+			var scriptErr *wsl.ScriptError
+			if tc.wantNoLine {
+				notErrorAsf(t, err, &scriptErr, "Unexpected error type. Expected anything but a ScriptError.")
+				return
+			}
+			require.ErrorAs(t, err, &scriptErr, "Unexpected error type. Expected a ScriptError.")
+			require.Equal(t, tc.wantLine, scriptErr.Line, "Unexpected failing line")
+		})
+	}
+}
+
+func TestScriptCommand(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := d.ScriptCommand(ctx, strings.NewReader("#!\necho hello\n"), "")
+	require.Error(t, err, "Unexpected success preparing a script with an empty shebang")
+
+	cmd, err := d.ScriptCommand(ctx, strings.NewReader("echo hello\necho world >&2\n"), "")
+	require.NoError(t, err, "Unexpected error calling (*Distro).ScriptCommand")
+
+	var lines []string
+	cmd.OnStdoutLine(func(line string) { lines = append(lines, line) })
+
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "Unexpected error running the script")
+	require.Equal(t, []string{"hello"}, lines, "Unexpected lines of stdout")
+	require.Equal(t, "hello\nworld\n", string(out), "Unexpected combined output")
+}
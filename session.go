@@ -0,0 +1,256 @@
+package gowsl
+
+// This file contains utilities to run many commands over a single long-lived shell.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ubuntu/gowsl/internal/session"
+)
+
+// Session is a long-lived shell in a distro, over which commands are run one
+// after the other. Running a command in a session avoids the cost of launching
+// a new WSL process for each command.
+//
+// Each command runs in its own subshell of /bin/sh, with no access to stdin.
+// As such, changes to the working directory or the environment do not carry
+// over to the next command.
+//
+// Commands can be run concurrently, but they are executed sequentially. Use a
+// SessionPool to execute them in parallel.
+type Session struct {
+	cmd    *Cmd
+	conn   *session.Conn
+	stdin  io.Closer
+	cancel context.CancelFunc // Kills the shell
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewSession starts a new session in the distro. The session ends when the
+// context is done or Close is called.
+func (d *Distro) NewSession(ctx context.Context) (s *Session, err error) {
+	// The session has a context of its own, so that broken sessions can be killed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		if err != nil {
+			cancel()
+			err = fmt.Errorf("could not start a session in %q: %v", d.Name(), err)
+		}
+	}()
+
+	cmd := d.Command(ctx, "exec /bin/sh")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := session.New(stdin, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		cmd:    cmd,
+		conn:   conn,
+		stdin:  stdin,
+		cancel: cancel,
+	}, nil
+}
+
+// Run runs a command in the session, and returns its standard output and error.
+//
+// If the command exits with a non-zero exit code, the error is of type *ExitError.
+// Any other error means that the session is broken and it must be closed.
+func (s *Session) Run(ctx context.Context, command string) (stdout, stderr []byte, err error) {
+	res, err := s.conn.Run(ctx, command)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not run %q in session: %v", command, err)
+	}
+
+	if res.ExitCode != 0 {
+		return res.Stdout, res.Stderr, &ExitError{
+			Stderr:   res.Stderr,
+			command:  command,
+			exitCode: uint32(res.ExitCode),
+		}
+	}
+
+	return res.Stdout, res.Stderr, nil
+}
+
+// Output runs a command in the session, and returns its standard output.
+// If the command exits with a non-zero exit code, the error is of type *ExitError,
+// and its Stderr is populated.
+func (s *Session) Output(ctx context.Context, command string) ([]byte, error) {
+	stdout, _, err := s.Run(ctx, command)
+	return stdout, err
+}
+
+// Broken returns true if the session can no longer run commands.
+func (s *Session) Broken() bool {
+	return s.conn.Err() != nil
+}
+
+// Close ends the session and waits for the shell to exit. The shell of a broken
+// session is killed, as it may still be running an interrupted command. Otherwise,
+// the shell exits once it has finished the current command. Close can be called
+// multiple times.
+func (s *Session) Close() error {
+	s.closeOnce.Do(func() {
+		defer s.cancel()
+
+		killed := s.Broken()
+		if killed {
+			s.cancel()
+		}
+		// Closing stdin makes the shell exit once it has finished the current command.
+		s.stdin.Close()
+
+		err := s.cmd.Wait()
+		if killed && errors.Is(err, s.cmd.ctx.Err()) {
+			return
+		}
+		if target := (&ExitError{}); err != nil && !errors.As(err, &target) {
+			s.closeErr = fmt.Errorf("could not close session: %v", err)
+		}
+	})
+	return s.closeErr
+}
+
+// SessionPool is a bounded set of sessions in a distro, to run commands
+// concurrently. Sessions are started on demand and reused afterwards.
+type SessionPool struct {
+	distro *Distro
+	ctx    context.Context
+
+	tokens chan struct{} // Holds one token per session that can be in use
+	idle   chan *Session // Sessions that are not in use
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewSessionPool creates a pool of up to size sessions in the distro. The
+// sessions end when the context is done or Close is called.
+func (d *Distro) NewSessionPool(ctx context.Context, size int) *SessionPool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &SessionPool{
+		distro: d,
+		ctx:    ctx,
+		tokens: make(chan struct{}, size),
+		idle:   make(chan *Session, size),
+	}
+
+	for i := 0; i < size; i++ {
+		p.tokens <- struct{}{}
+	}
+
+	return p
+}
+
+// Run runs a command in one of the sessions of the pool, waiting for one to
+// be available if necessary. See (*Session).Run.
+func (p *SessionPool) Run(ctx context.Context, command string) (stdout, stderr []byte, err error) {
+	s, err := p.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer p.release(s)
+
+	return s.Run(ctx, command)
+}
+
+// Output runs a command in one of the sessions of the pool, waiting for one to
+// be available if necessary. See (*Session).Output.
+func (p *SessionPool) Output(ctx context.Context, command string) ([]byte, error) {
+	stdout, _, err := p.Run(ctx, command)
+	return stdout, err
+}
+
+// acquire takes an idle session, or starts a new one if there are none.
+func (p *SessionPool) acquire(ctx context.Context) (*Session, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.tokens:
+	}
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		p.tokens <- struct{}{}
+		return nil, errors.New("session pool is closed")
+	}
+
+	select {
+	case s := <-p.idle:
+		return s, nil
+	default:
+	}
+
+	s, err := p.distro.NewSession(p.ctx)
+	if err != nil {
+		p.tokens <- struct{}{}
+		return nil, err
+	}
+	return s, nil
+}
+
+// release returns a session to the pool. Broken sessions are discarded.
+func (p *SessionPool) release(s *Session) {
+	defer func() { p.tokens <- struct{}{} }()
+
+	p.mu.Lock()
+	if !p.closed && !s.Broken() {
+		// There is room for every session, so this never blocks.
+		p.idle <- s
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	s.Close()
+}
+
+// Close ends all idle sessions in the pool. Sessions in use are closed as soon
+// as their command finishes. Further calls to Run fail.
+func (p *SessionPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for {
+		select {
+		case s := <-p.idle:
+			if e := s.Close(); e != nil && err == nil {
+				err = e
+			}
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	realDistro := newTestDistro(t, rootFs)
+	fakeDistro := wsl.NewDistro(uniqueDistroName(t))
+
+	testCases := map[string]struct {
+		distro *wsl.Distro
+		cmd    string
+
+		wantStdout     string
+		wantStderr     string
+		wantExitCode   int
+		wantSessionErr bool
+	}{
+		"success":                {distro: &realDistro, cmd: "exit 0"},
+		"success with stdout":    {distro: &realDistro, cmd: "echo Hello", wantStdout: "Hello\n"},
+		"success with stderr":    {distro: &realDistro, cmd: "echo Error >&2", wantStderr: "Error\n"},
+		"success with both":      {distro: &realDistro, cmd: "echo Hello && echo Error >&2", wantStdout: "Hello\n", wantStderr: "Error\n"},
+		"linux error":            {distro: &realDistro, cmd: "echo Error >&2 && exit 42", wantStderr: "Error\n", wantExitCode: 42},
+		"error with fake distro": {distro: &fakeDistro, wantSessionErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			s, err := tc.distro.NewSession(ctx)
+			if tc.wantSessionErr {
+				require.Error(t, err, "Unexpected success calling NewSession")
+				return
+			}
+			require.NoError(t, err, "Unexpected error calling NewSession")
+			defer s.Close()
+
+			// Running twice to ensure the session is reused
+			for i := 0; i < 2; i++ {
+				stdout, stderr, err := s.Run(ctx, tc.cmd)
+				require.Equal(t, tc.wantStdout, string(stdout), "Unexpected stdout")
+				require.Equal(t, tc.wantStderr, string(stderr), "Unexpected stderr")
+
+				if tc.wantExitCode == 0 {
+					require.NoError(t, err, "Unexpected error calling (*Session).Run")
+					continue
+				}
+
+				target := &wsl.ExitError{}
+				require.ErrorAs(t, err, &target, "Unexpected error type. Expected an ExitError.")
+				require.Equal(t, tc.wantExitCode, target.ExitCode(), "Unexpected exit code")
+				require.Equal(t, tc.wantStderr, string(target.Stderr), "Unexpected stderr in ExitError")
+				require.False(t, s.Broken(), "Session should not be broken by a failing command")
+			}
+
+			require.NoError(t, s.Close(), "Unexpected error calling (*Session).Close")
+			require.NoError(t, s.Close(), "Unexpected error calling (*Session).Close twice")
+
+			_, _, err = s.Run(ctx, tc.cmd)
+			require.Error(t, err, "Unexpected success calling (*Session).Run after Close")
+		})
+	}
+}
+
+func TestSessionCancel(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	s, err := d.NewSession(context.Background())
+	require.NoError(t, err, "Unexpected error calling NewSession")
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err = s.Run(ctx, "sleep 30")
+	require.Error(t, err, "Unexpected success running a command past its deadline")
+	require.True(t, s.Broken(), "Session should be broken after a command is interrupted")
+
+	require.NoError(t, s.Close(), "Unexpected error calling (*Session).Close on a broken session")
+	require.Less(t, time.Since(start), 15*time.Second, "Close should have killed the interrupted command instead of waiting for it")
+}
+
+func TestSessionPoolCancel(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	pool := d.NewSessionPool(context.Background(), 1)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := pool.Run(ctx, "sleep 30")
+	require.Error(t, err, "Unexpected success running a command past its deadline")
+	require.Less(t, time.Since(start), 15*time.Second, "Run should have returned soon after the deadline")
+
+	// The broken session is discarded, so the pool can still run commands.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	out, err := pool.Output(ctx, "echo Hello")
+	require.NoError(t, err, "Unexpected error calling (*SessionPool).Output after an interrupted command")
+	require.Equal(t, "Hello\n", string(out), "Unexpected output")
+}
+
+func TestSessionPool(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const size = 3
+	pool := d.NewSessionPool(ctx, size)
+	defer pool.Close()
+
+	// Every command sleeps so that they are forced to run in parallel
+	const n = 3 * size
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := pool.Output(ctx, fmt.Sprintf("sleep 2 && echo %d", i))
+			require.NoError(t, err, "Unexpected error calling (*SessionPool).Output")
+			require.Equal(t, fmt.Sprintf("%d\n", i), string(out), "Unexpected output")
+		}()
+	}
+	wg.Wait()
+
+	require.Less(t, time.Since(start), time.Duration(n)*2*time.Second, "Commands in the pool did not run concurrently")
+
+	require.NoError(t, pool.Close(), "Unexpected error calling (*SessionPool).Close")
+	_, err := pool.Output(ctx, "exit 0")
+	require.Error(t, err, "Unexpected success calling (*SessionPool).Output after Close")
+}
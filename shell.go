@@ -1,38 +1,36 @@
 package gowsl
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
-// ShellError returns error information when shell commands do not succeed.
-type ShellError struct {
-	exitCode uint32
-}
-
-// Error makes it so ShellError implements the error interface. In displays
-// the exit code and some auxiliary info.
+// ShellError is the error returned by Shell when the shell exits with a non-zero
+// exit code. It wraps an ExitError, so that errors.As finds either of them.
 //
-// We know that exit codes above 255 come from Windows, but error codes under
-// 256 can come from both sides.
-func (err *ShellError) Error() string {
-	if int(err.exitCode) > 0xff {
-		// Windows errors are commonly displayed in HEX, so we stick to the standard
-		return fmt.Sprintf("shell failed Windows-side: exit code 0x%x", err.exitCode)
-	}
-	// Linux exit codes are always displayed in decimal
-	return fmt.Sprintf("shell launched but returned exit code %d", err.exitCode)
+// Deprecated: use ExitError, which is returned by both Shell and Cmd.
+type ShellError struct {
+	ExitError
 }
 
-// ExitCode is a getter for the exit code of the shell when it produces.
-// Experimentally we've seen that linux produces exit codes under 255, and
-// Windows produces them above or equal to 256.
+// ExitCode returns the exit code of the shell. Unlike that of ExitError, it is
+// a uint32, as it has always been for ShellError.
 func (err *ShellError) ExitCode() uint32 {
 	return err.exitCode
 }
 
+// Unwrap returns the ExitError of the shell.
+func (err *ShellError) Unwrap() error {
+	return &err.ExitError
+}
+
 type shellOptions struct {
 	command string
 	useCWD  bool
@@ -73,6 +71,9 @@ func WithCommand(cmd string) func(*shellOptions) {
 //
 //	PS> "exit 5" | wsl.exe
 //
+// To redirect the input and output of the shell, use StartTerminal instead. To
+// bound it with a context, use ShellContext.
+//
 // Can be used with optional helper parameters UseCWD and WithCommand.
 func (d *Distro) Shell(opts ...func(*shellOptions)) error {
 	r, err := d.IsRegistered()
@@ -107,7 +108,7 @@ func (d *Distro) Shell(opts ...func(*shellOptions)) error {
 	}
 
 	var exitCode uint32
-	r1, _, _ := wslLaunchInteractive.Call(
+	r1 := callWslAPI(wslLaunchInteractive, d.Name(),
 		uintptr(unsafe.Pointer(distroUTF16)),
 		uintptr(unsafe.Pointer(commandUTF16)),
 		uintptr(useCwd),
@@ -118,8 +119,79 @@ func (d *Distro) Shell(opts ...func(*shellOptions)) error {
 	}
 
 	if exitCode != 0 {
-		return &ShellError{exitCode}
+		return &ShellError{ExitError{command: options.command, exitCode: exitCode}}
 	}
 
 	return nil
 }
+
+// ShellContext is like Shell, but it runs wsl.exe instead of WslLaunchInteractive,
+// so that it can be killed if the context is done before the shell exits. In that
+// case, the error is ctx.Err().
+//
+// The shell is attached to the console of the process, and its standard streams
+// are those of the process: os.Stdin, os.Stdout, and os.Stderr.
+//
+// Can be used with optional helper parameters UseCWD and WithCommand.
+func (d *Distro) ShellContext(ctx context.Context, opts ...func(*shellOptions)) error {
+	r, err := d.IsRegistered()
+	if err != nil {
+		return err
+	}
+	if !r {
+		return fmt.Errorf("distro %q is not registered", d.Name())
+	}
+
+	options := shellOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if strings.ContainsRune(options.command, 0) {
+		return fmt.Errorf("invalid command %q: it contains a null character", options.command)
+	}
+
+	cmd := exec.CommandContext(ctx, "wsl.exe")
+	// The command must reach wsl.exe verbatim, without the escaping of exec.Command.
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: shellCommandLine(d.Name(), options)}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		logCommandStart(ctx, d.Name(), options.command, 0, err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("could not start shell: %v", err)
+	}
+	logCommandStart(ctx, d.Name(), options.command, cmd.Process.Pid, nil)
+
+	err = cmd.Wait()
+	logCommandExit(ctx, d.Name(), options.command, cmd.Process.Pid, cmd.ProcessState.ExitCode(), time.Since(start), err)
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return newExitError(options.command, exitErr)
+	}
+	return err
+}
+
+// shellCommandLine returns the wsl.exe command line that starts the shell, with
+// the same behaviour as WslLaunchInteractive.
+func shellCommandLine(distroName string, options shellOptions) string {
+	args := []string{"wsl.exe", "-d", syscall.EscapeArg(distroName)}
+	if !options.useCWD {
+		args = append(args, "--cd", "~")
+	}
+	if options.command != "" {
+		// Everything after "--" is handed verbatim to the default shell of the distro.
+		args = append(args, "--", options.command)
+	}
+	return strings.Join(args, " ")
+}
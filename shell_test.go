@@ -28,7 +28,7 @@ func TestShell(t *testing.T) {
 		withCommand  *string
 		distro       *wsl.Distro
 		wantError    bool
-		wantExitCode uint32
+		wantExitCode int
 	}{
 		// Test with no arguments
 		"happy path":   {distro: &realDistro},
@@ -107,14 +107,19 @@ func TestShell(t *testing.T) {
 
 			require.Error(t, err, "Unexpected success after Distro.Shell")
 
-			var target *wsl.ShellError
+			var target *wsl.ExitError
 			if tc.wantExitCode == 0 {
-				notErrorAsf(t, err, &target, "unexpected ShellError, expected any other type")
+				notErrorAsf(t, err, &target, "unexpected ExitError, expected any other type")
 				return
 			}
 
-			require.ErrorAs(t, err, &target, "unexpected error type, expected a ShellError")
+			require.ErrorAs(t, err, &target, "unexpected error type, expected an ExitError")
 			require.Equal(t, tc.wantExitCode, target.ExitCode(), "Unexpected value for ExitCode returned from Distro.Shell")
+
+			// The deprecated ShellError is still returned, with its uint32 exit code.
+			var shellErr *wsl.ShellError
+			require.ErrorAs(t, err, &shellErr, "unexpected error type, expected a ShellError")
+			require.Equal(t, uint32(tc.wantExitCode), shellErr.ExitCode(), "Unexpected value for ExitCode of ShellError")
 		})
 	}
 }
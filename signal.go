@@ -0,0 +1,87 @@
+package gowsl
+
+// This file contains the Linux signals that can be sent to processes in a distro.
+
+import "fmt"
+
+// Signal is a Linux signal. Its numeric values are those of Linux, regardless
+// of the Windows host.
+type Signal int
+
+// Standard Linux signals.
+const (
+	SIGHUP    Signal = 1
+	SIGINT    Signal = 2
+	SIGQUIT   Signal = 3
+	SIGILL    Signal = 4
+	SIGTRAP   Signal = 5
+	SIGABRT   Signal = 6
+	SIGBUS    Signal = 7
+	SIGFPE    Signal = 8
+	SIGKILL   Signal = 9
+	SIGUSR1   Signal = 10
+	SIGSEGV   Signal = 11
+	SIGUSR2   Signal = 12
+	SIGPIPE   Signal = 13
+	SIGALRM   Signal = 14
+	SIGTERM   Signal = 15
+	SIGSTKFLT Signal = 16
+	SIGCHLD   Signal = 17
+	SIGCONT   Signal = 18
+	SIGSTOP   Signal = 19
+	SIGTSTP   Signal = 20
+	SIGTTIN   Signal = 21
+	SIGTTOU   Signal = 22
+	SIGURG    Signal = 23
+	SIGXCPU   Signal = 24
+	SIGXFSZ   Signal = 25
+	SIGVTALRM Signal = 26
+	SIGPROF   Signal = 27
+	SIGWINCH  Signal = 28
+	SIGIO     Signal = 29
+	SIGPWR    Signal = 30
+	SIGSYS    Signal = 31
+)
+
+var signalNames = map[Signal]string{
+	SIGHUP:    "SIGHUP",
+	SIGINT:    "SIGINT",
+	SIGQUIT:   "SIGQUIT",
+	SIGILL:    "SIGILL",
+	SIGTRAP:   "SIGTRAP",
+	SIGABRT:   "SIGABRT",
+	SIGBUS:    "SIGBUS",
+	SIGFPE:    "SIGFPE",
+	SIGKILL:   "SIGKILL",
+	SIGUSR1:   "SIGUSR1",
+	SIGSEGV:   "SIGSEGV",
+	SIGUSR2:   "SIGUSR2",
+	SIGPIPE:   "SIGPIPE",
+	SIGALRM:   "SIGALRM",
+	SIGTERM:   "SIGTERM",
+	SIGSTKFLT: "SIGSTKFLT",
+	SIGCHLD:   "SIGCHLD",
+	SIGCONT:   "SIGCONT",
+	SIGSTOP:   "SIGSTOP",
+	SIGTSTP:   "SIGTSTP",
+	SIGTTIN:   "SIGTTIN",
+	SIGTTOU:   "SIGTTOU",
+	SIGURG:    "SIGURG",
+	SIGXCPU:   "SIGXCPU",
+	SIGXFSZ:   "SIGXFSZ",
+	SIGVTALRM: "SIGVTALRM",
+	SIGPROF:   "SIGPROF",
+	SIGWINCH:  "SIGWINCH",
+	SIGIO:     "SIGIO",
+	SIGPWR:    "SIGPWR",
+	SIGSYS:    "SIGSYS",
+}
+
+// String returns the conventional name of the signal, such as "SIGTERM".
+// Signals without a name (e.g. real-time signals) are shown by number.
+func (s Signal) String() string {
+	if name, ok := signalNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(s))
+}
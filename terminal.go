@@ -0,0 +1,164 @@
+package gowsl
+
+// This file contains utilities to embed an interactive shell into a terminal.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/pty"
+)
+
+// TerminalSize is the size of a terminal, in characters.
+type TerminalSize struct {
+	Cols uint16
+	Rows uint16
+}
+
+// Terminal is an interactive shell attached to a pseudo-console, whose input and
+// output are connected to arbitrary readers and writers rather than to the
+// console of the process. See (*Distro).StartTerminal.
+type Terminal struct {
+	// Process is the wsl.exe process running the shell.
+	Process *os.Process
+
+	distroName string
+	command    string
+	session    *pty.Session
+	finished   bool      // Flag to fail nicely when Wait is invoked twice
+	startTime  time.Time // Time when the process started, to log the duration of the shell
+
+	// Context management
+	ctx       context.Context
+	ctxErr    error         // We deviate from the stdlib: "context cancelled" is more useful than "exit code 1"
+	waitDone  chan struct{} // Closed when the process exits, to stop watching the context
+	watchDone chan struct{} // Closed when the context is no longer watched, so that ctxErr can be read
+}
+
+// StartTerminal starts a shell in the distro, attached to a pseudo-console of the
+// given size, but does not wait for it to complete. It is the counterpart of Shell
+// for applications that embed a terminal, such as GUIs.
+//
+// The input of the terminal is read from stdin, and everything it displays is
+// written into stdout, including the escape sequences used to draw it. As with
+// any terminal, stderr is displayed alongside stdout. Both stdin and stdout can
+// be nil.
+//
+// The provided context is used to kill the shell if it becomes done before it
+// exits on its own.
+//
+// Can be used with optional helper parameters UseCWD and WithCommand.
+func (d *Distro) StartTerminal(ctx context.Context, stdin io.Reader, stdout io.Writer, size TerminalSize, opts ...func(*shellOptions)) (*Terminal, error) {
+	if ctx == nil {
+		panic("nil Context")
+	}
+
+	r, err := d.IsRegistered()
+	if err != nil {
+		return nil, err
+	}
+	if !r {
+		return nil, fmt.Errorf("distro %q is not registered", d.Name())
+	}
+
+	options := shellOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if strings.ContainsRune(options.command, 0) {
+		return nil, fmt.Errorf("invalid command %q: it contains a null character", options.command)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	console, process, err := pty.Start(shellCommandLine(d.Name(), options), "", pty.Size(size))
+	if err != nil {
+		logCommandStart(ctx, d.Name(), options.command, 0, err)
+		return nil, fmt.Errorf("could not start terminal: %v", err)
+	}
+	logCommandStart(ctx, d.Name(), options.command, process.Pid, nil)
+
+	t := &Terminal{
+		Process:    process,
+		distroName: d.Name(),
+		command:    options.command,
+		startTime:  startTime,
+		session:    pty.Attach(console, stdin, stdout),
+		ctx:        ctx,
+		waitDone:   make(chan struct{}),
+		watchDone:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(t.watchDone)
+		select {
+		case <-t.ctx.Done():
+			//nolint: errcheck // Mimicking behaviour from (*Cmd).Start
+			t.Process.Kill()
+			t.ctxErr = t.ctx.Err()
+		case <-t.waitDone:
+		}
+	}()
+
+	return t, nil
+}
+
+// Resize changes the size of the terminal.
+func (t *Terminal) Resize(size TerminalSize) error {
+	return t.session.Resize(pty.Size(size))
+}
+
+// Wait waits for the shell to exit, and for all of its output to be written.
+//
+// The returned error is nil if the shell exits with a zero exit code. If it exits
+// with a non-zero exit code, the error is of type *ExitError.
+func (t *Terminal) Wait() error {
+	if t.finished {
+		return errors.New("wsl: Wait was already called")
+	}
+	t.finished = true
+
+	state, err := t.Process.Wait()
+	close(t.waitDone)
+	<-t.watchDone
+
+	// The pseudo-console must be closed for its output to end.
+	sessionErr := t.session.Close()
+
+	err = t.exitError(state, err, sessionErr)
+
+	exitCode := -1
+	if state != nil {
+		exitCode = state.ExitCode()
+	}
+	logCommandExit(t.ctx, t.distroName, t.command, t.Process.Pid, exitCode, time.Since(t.startTime), err)
+
+	return err
+}
+
+// exitError returns the error of a shell that exited, given the outcome of
+// waiting for its process and of closing its pseudo-console.
+func (t *Terminal) exitError(state *os.ProcessState, waitErr, sessionErr error) error {
+	if t.ctxErr != nil {
+		// See the same deviation in (*Cmd).Wait.
+		return t.ctxErr
+	}
+
+	if waitErr != nil {
+		return waitErr
+	} else if !state.Success() {
+		return newExitError(t.command, &exec.ExitError{ProcessState: state})
+	}
+
+	return sessionErr
+}
@@ -0,0 +1,156 @@
+package gowsl_test
+
+import (
+	wsl "github.com/ubuntu/gowsl"
+
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartTerminal(t *testing.T) {
+	realDistro := newTestDistro(t, rootFs)
+	fakeDistro := wsl.NewDistro(uniqueDistroName(t))
+	wrongDistro := wsl.NewDistro("I have a \x00 null char in my name")
+
+	testCases := map[string]struct {
+		distro   *wsl.Distro
+		command  string
+		stdin    string
+		useCWD   bool
+		size     wsl.TerminalSize
+		cancelAt time.Duration
+
+		wantOutput     string
+		wantStartErr   bool
+		wantExitCode   int
+		wantContextErr bool
+	}{
+		"success with the default shell":  {distro: &realDistro, stdin: "echo hello-$((1+2))\nexit\n", wantOutput: "hello-3"},
+		"success with a command":          {distro: &realDistro, command: "echo hello-$((1+2))", wantOutput: "hello-3"},
+		"success reading the size":        {distro: &realDistro, command: "stty size", size: wsl.TerminalSize{Cols: 91, Rows: 37}, wantOutput: "37 91"},
+		"success with the HOME directory": {distro: &realDistro, command: "pwd", wantOutput: "/root"},
+		"success with the CWD":            {distro: &realDistro, command: "pwd", useCWD: true, wantOutput: "/mnt/"},
+
+		"error when the command fails":          {distro: &realDistro, command: "exit 42", wantExitCode: 42},
+		"error when the context is cancelled":   {distro: &realDistro, command: "sleep 30", cancelAt: time.Second, wantContextErr: true},
+		"error with an unregistered distro":     {distro: &fakeDistro, wantStartErr: true},
+		"error with a null char in distro name": {distro: &wrongDistro, wantStartErr: true},
+		"error with a null char in command":     {distro: &realDistro, command: "echo \x00", wantStartErr: true},
+		"error with an invalid size":            {distro: &realDistro, size: wsl.TerminalSize{Cols: 80}, wantStartErr: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			d := *tc.distro
+
+			if d == realDistro {
+				defer keepAwake(t, context.Background(), &realDistro)()
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if tc.size == (wsl.TerminalSize{}) {
+				tc.size = wsl.TerminalSize{Cols: 80, Rows: 24}
+			}
+
+			var stdin io.Reader
+			if tc.stdin != "" {
+				stdin = strings.NewReader(tc.stdin)
+			}
+			stdout := &syncBuffer{}
+
+			var term *wsl.Terminal
+			var err error
+			switch {
+			case tc.command != "" && tc.useCWD:
+				term, err = d.StartTerminal(ctx, stdin, stdout, tc.size, wsl.WithCommand(tc.command), wsl.UseCWD())
+			case tc.command != "":
+				term, err = d.StartTerminal(ctx, stdin, stdout, tc.size, wsl.WithCommand(tc.command))
+			case tc.useCWD:
+				term, err = d.StartTerminal(ctx, stdin, stdout, tc.size, wsl.UseCWD())
+			default:
+				term, err = d.StartTerminal(ctx, stdin, stdout, tc.size)
+			}
+
+			if tc.wantStartErr {
+				require.Error(t, err, "StartTerminal should have failed")
+				return
+			}
+			require.NoError(t, err, "StartTerminal should not have failed")
+
+			if tc.cancelAt != 0 {
+				time.AfterFunc(tc.cancelAt, cancel)
+			}
+
+			err = term.Wait()
+			require.Error(t, term.Wait(), "Wait should fail when called twice")
+			require.Error(t, term.Resize(tc.size), "Resize should fail after Wait")
+
+			if tc.wantContextErr {
+				require.ErrorIs(t, err, context.Canceled, "Wait should return the error of the context")
+				return
+			}
+
+			if tc.wantExitCode != 0 {
+				var target *wsl.ExitError
+				require.ErrorAs(t, err, &target, "Wait should return an ExitError")
+				require.Equal(t, tc.wantExitCode, target.ExitCode(), "Unexpected exit code")
+				return
+			}
+
+			require.NoError(t, err, "Wait should not have failed")
+			require.Contains(t, stdout.String(), tc.wantOutput, "Unexpected output of the terminal")
+		})
+	}
+}
+
+func TestTerminalResize(t *testing.T) {
+	d := newTestDistro(t, rootFs)
+	defer keepAwake(t, context.Background(), &d)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stdinR, stdinW := io.Pipe()
+	defer stdinW.Close()
+	stdout := &syncBuffer{}
+
+	term, err := d.StartTerminal(ctx, stdinR, stdout, wsl.TerminalSize{Cols: 80, Rows: 24}, wsl.WithCommand("sh"))
+	require.NoError(t, err, "StartTerminal should not have failed")
+
+	require.Error(t, term.Resize(wsl.TerminalSize{Cols: 0, Rows: 10}), "Resize should fail with an invalid size")
+	require.NoError(t, term.Resize(wsl.TerminalSize{Cols: 132, Rows: 43}), "Resize should not have failed")
+
+	_, err = io.WriteString(stdinW, "stty size; exit\n")
+	require.NoError(t, err, "Writing into the terminal should not have failed")
+
+	require.NoError(t, term.Wait(), "Wait should not have failed")
+	require.Contains(t, stdout.String(), "43 132", "The shell should see the new size of the terminal")
+}
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
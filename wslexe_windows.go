@@ -4,17 +4,48 @@ package gowsl
 // with the advantage (sometimes) of not needing to start a subprocess.
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"time"
+
+	"github.com/ubuntu/gowsl/internal/wslexe"
 )
 
+// wslExe runs wsl.exe with the arguments, and returns its decoded output. The
+// process is killed if ctx is done before it exits, and the error is then ctx.Err().
+func wslExe(ctx context.Context, args ...string) (output string, err error) {
+	start := time.Now()
+	out, err := exec.CommandContext(ctx, "wsl.exe", args...).CombinedOutput()
+	output = wslexe.DecodeOutput(out)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		exitCode = -1
+	}
+	logWslExe(args, output, exitCode, time.Since(start), err)
+
+	if err != nil && ctx.Err() != nil {
+		// "context canceled" is more useful than "exit status 1".
+		return output, ctx.Err()
+	}
+	return output, err
+}
+
 // shutdown shuts down all distros
 //
 // It is analogous to
 //
 //	`wsl.exe --shutdown
-func shutdown() error {
-	out, err := exec.Command("wsl.exe", "--shutdown").CombinedOutput()
+func shutdown(ctx context.Context) error {
+	out, err := wslExe(ctx, "--shutdown")
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error shutting WSL down: %v: %s", err, out)
 	}
@@ -26,8 +57,11 @@ func shutdown() error {
 // It is analogous to
 //
 //	`wsl.exe --terminate <distroName>`
-func terminate(distroName string) error {
-	out, err := exec.Command("wsl.exe", "--terminate", distroName).CombinedOutput()
+func terminate(ctx context.Context, distroName string) error {
+	out, err := wslExe(ctx, "--terminate", distroName)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error terminating distro %q: %v: %s", distroName, err, out)
 	}
@@ -39,8 +73,11 @@ func terminate(distroName string) error {
 // It is analogous to
 //
 //	`wsl.exe --set-default <distroName>`
-func setAsDefault(distroName string) error {
-	out, err := exec.Command("wsl.exe", "--set-default", distroName).CombinedOutput()
+func setAsDefault(ctx context.Context, distroName string) error {
+	out, err := wslExe(ctx, "--set-default", distroName)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error setting %q as default: %v, output: %s", distroName, err, out)
 	}